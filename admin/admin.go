@@ -1,37 +1,86 @@
 package admin
 
 import (
+	"fmt"
 	"strings"
 
 	"bloodtales/system"
+	"bloodtales/models"
 	"bloodtales/util"
 )
 
 var DefaultPageSize int = 20
 
+func init() {
+	util.AddTemplateFunc("hasPermission", hasPermission)
+}
+
 func HandleAdmin() {
 	system.App.Redirect("/admin", "/admin/home", 301)
-	handleAdminTemplate("/error", system.NoAuthentication, Error, "error.tmpl.html")
-	handleAdminTemplate("/admin/home", system.NoAuthentication, Home, "home.tmpl.html")
-	handleAdminTemplate("/admin/login", system.NoAuthentication, Login, "login.tmpl.html")
-	handleAdminTemplate("/admin/login/go", system.PasswordAuthentication, Login, "login.tmpl.html")
-	handleAdminTemplate("/admin/logout", system.NoAuthentication, Logout, "")
-	handleAdminTemplate("/admin/dashboard", system.TokenAuthentication, Dashboard, "dashboard.tmpl.html")
+	handleAdminTemplate("/error", system.NoAuthentication, models.PermissionNone, Error, "error.tmpl.html").Describe("Error page").Params(
+		system.Optional("message", util.StringParam, "Error occurred", "Error message"),
+	)
+	handleAdminTemplate("/admin/home", system.NoAuthentication, models.PermissionNone, Home, "home.tmpl.html").Describe("Admin home")
+	handleAdminTemplate("/admin/login", system.NoAuthentication, models.PermissionNone, Login, "login.tmpl.html").Describe("Admin login page")
+	handleAdminTemplate("/admin/login/go", system.PasswordAuthentication, models.PermissionNone, Login, "login.tmpl.html").Methods("POST").Describe("Admin login")
+	handleAdminTemplate("/admin/logout", system.NoAuthentication, models.PermissionNone, Logout, "").Describe("Admin logout")
+	handleAdminTemplate("/admin/dashboard", system.TokenAuthentication, models.PermissionViewDashboard, Dashboard, "dashboard.tmpl.html").Describe("Admin dashboard")
 
 	handleAdminUsers()
 	handleAdminCards()
 	handleAdminGuilds()
 	handleAdminMatches()
 	handleAdminLeaderboards()
+	handleAdminReplays()
+	handleAdminSeasons()
+	handleAdminWars()
 	handleAdminTracking()
 	handleAdminFaults()
+	handleAdminRoles()
+	handleAdminAudits()
+	handleAdminSanctions()
+	handleAdminDebug()
+}
+
+// admin routes
+var adminRoutes *system.RouteGroup = system.App.Group("")
+
+func handleAdminTemplate(pattern string, authType system.AuthenticationType, permission models.AdminPermission, handler func(*util.Context), template string) *system.Route {
+	return adminRoutes.HandleTemplate(pattern, authType, handler, template).Use(requirePermission(permission), adminMiddleware).Internal()
 }
 
-func handleAdminTemplate(pattern string, authType system.AuthenticationType, handler func(*util.Context), template string) {
-	system.App.HandleTemplate(pattern, authType, func(context *util.Context) {
-		initializeAdmin(context)
-		handler(context)
-	}, template)
+// permission middleware, run after authentication
+func requirePermission(permission models.AdminPermission) system.Middleware {
+	return func(context *util.Context, next func(*util.Context)) {
+		if checkPermission(context, permission) {
+			next(context)
+		}
+	}
+}
+
+func adminMiddleware(context *util.Context, next func(*util.Context)) {
+	initializeAdmin(context)
+	next(context)
+}
+
+// check current user has an admin permission, failing the request if not
+func checkPermission(context *util.Context, permission models.AdminPermission) bool {
+	if permission == models.PermissionNone {
+		return true
+	}
+
+	user := system.GetUser(context)
+	if user == nil || !user.HasPermission(permission) {
+		context.Fail(fmt.Sprintf("Permission denied: %s", permission))
+		return false
+	}
+	return true
+}
+
+// template helper to show or hide admin actions
+func hasPermission(context *util.Context, permission string) bool {
+	user := system.GetUser(context)
+	return user != nil && user.HasPermission(models.AdminPermission(permission))
 }
 
 func initializeAdmin(context *util.Context) {
@@ -40,53 +89,101 @@ func initializeAdmin(context *util.Context) {
 		Name string
 		URL string
 		Icon string
+		Permission models.AdminPermission
 		Active bool
 	} {
 		{
 			Name: "Dashboard",
 			URL: "/admin/dashboard",
 			Icon: "pe-7s-display1",
+			Permission: models.PermissionViewDashboard,
 		},
 		{
 			Name: "Players",
 			URL: "/admin/users",
 			Icon: "pe-7s-users",
+			Permission: models.PermissionViewUsers,
 		},
 		{
 			Name: "Guilds",
 			URL: "/admin/guilds",
 			Icon: "pe-7s-ribbon",
+			Permission: models.PermissionViewGuilds,
 		},
 		{
 			Name: "Leaderboard",
 			URL: "/leaderboard",
 			Icon: "pe-7s-cup",
+			Permission: models.PermissionNone,
+		},
+		{
+			Name: "Seasons",
+			URL: "/admin/seasons",
+			Icon: "pe-7s-date",
+			Permission: models.PermissionViewDashboard,
+		},
+		{
+			Name: "Wars",
+			URL: "/admin/wars",
+			Icon: "pe-7s-flag",
+			Permission: models.PermissionViewGuilds,
 		},
 		{
 			Name: "Matches",
 			URL: "/admin/matches",
 			Icon: "pe-7s-joy",
+			Permission: models.PermissionViewMatches,
 		},
 		{
 			Name: "Events",
 			URL: "/admin/events",
 			Icon: "pe-7s-timer",
+			Permission: models.PermissionViewDashboard,
 		},
 		{
 			Name: "Content",
 			URL: "/admin/content",
 			Icon: "pe-7s-gift",
+			Permission: models.PermissionViewDashboard,
 		},
 		{
 			Name: "Analytics",
 			URL: "/admin/trackings",
 			Icon: "pe-7s-graph2",
+			Permission: models.PermissionViewTrackings,
 		},
 		{
 			Name: "Faults",
 			URL: "/admin/faults",
 			Icon: "pe-7s-attention",
+			Permission: models.PermissionViewFaults,
+		},
+		{
+			Name: "Roles",
+			URL: "/admin/roles",
+			Icon: "pe-7s-key",
+			Permission: models.PermissionManageRoles,
 		},
+		{
+			Name: "Audit Log",
+			URL: "/admin/audits",
+			Icon: "pe-7s-note2",
+			Permission: models.PermissionViewAudits,
+		},
+		{
+			Name: "Debug",
+			URL: "/admin/debug",
+			Icon: "pe-7s-tools",
+			Permission: models.PermissionProfile,
+		},
+	}
+
+	// only show links the current user is permitted to view
+	user := system.GetUser(context)
+	for i := len(links) - 1; i >= 0; i-- {
+		if links[i].Permission != models.PermissionNone && (user == nil || !user.HasPermission(links[i].Permission)) {
+			links = append(links[:i], links[i + 1:]...)
+		}
 	}
 
 	for i, link := range links {
@@ -100,7 +197,7 @@ func initializeAdmin(context *util.Context) {
 
 func Error(context *util.Context) {
 	// parse parameters
-	message := context.Params.GetString("message", "Error occurred")
+	message := context.Params.GetRequiredString("message")
 
 	context.Message(message) // TODO - fix this once session flashes are working
 }
@@ -121,7 +218,7 @@ func Login(context *util.Context) {
 		if context.Success {
 			user := system.GetUser(context)
 
-			if user.Admin == true {
+			if user.IsAdmin() {
 				context.Message("User logged in successfully")
 				context.Redirect("/admin/dashboard", 302)
 			} else {
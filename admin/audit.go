@@ -0,0 +1,183 @@
+package admin
+
+import (
+	"fmt"
+	"time"
+	"encoding/csv"
+	"encoding/json"
+
+	"gopkg.in/mgo.v2"
+	"gopkg.in/mgo.v2/bson"
+
+	"bloodtales/system"
+	"bloodtales/models"
+	"bloodtales/util"
+)
+
+func init() {
+	util.AddTemplateFunc("auditValue", formatAuditValue)
+}
+
+// filters shared by audit list and export
+var auditSearchParams []system.Param = []system.Param {
+	system.Optional("search", util.StringParam, nil, "Actor or target name search"),
+	system.Optional("action", util.StringParam, nil, "Action filter"),
+	system.Optional("actorId", util.IdParam, nil, "Actor user ID"),
+	system.Optional("targetId", util.IdParam, nil, "Target ID"),
+}
+
+func handleAdminAudits() {
+	handleAdminTemplate("/admin/audits", system.TokenAuthentication, models.PermissionViewAudits, ViewAudits, "audits.tmpl.html").Describe("List audits").Params(auditSearchParams...)
+	handleAdminTemplate("/admin/audits/view", system.TokenAuthentication, models.PermissionViewAudits, ViewAudit, "audit.tmpl.html").Describe("View an audit").Params(
+		system.Required("auditId", util.IdParam, "Audit ID"),
+	)
+	handleAdminTemplate("/admin/audits/export", system.TokenAuthentication, models.PermissionExportAudits, ExportAudits, "").Methods("GET").Describe("Export audits").Params(auditSearchParams...).Params(
+		system.Optional("format", util.StringParam, "csv", "Export format").OneOf("csv", "json"),
+	)
+}
+
+// record a mutating admin action, before/after are snapshots from models.AuditSnapshot
+func recordAudit(context *util.Context, action string, targetType string, targetID bson.ObjectId, targetName string, before bson.M, after bson.M) {
+	util.Must(models.InsertAudit(context, system.GetUser(context), action, targetType, targetID, targetName, before, after))
+}
+
+func getAuditsQuery(context *util.Context) *mgo.Query {
+	// parse parameters
+	search := context.Params.GetString("search", "")
+	action := context.Params.GetString("action", "")
+	actorID := context.Params.GetId("actorId")
+	targetID := context.Params.GetId("targetId")
+
+	// process filters
+	filters := []bson.M {}
+	if action != "" {
+		filters = append(filters, bson.M { "act": action })
+	}
+	if actorID.Valid() {
+		filters = append(filters, bson.M { "ac": actorID })
+	}
+	if targetID.Valid() {
+		filters = append(filters, bson.M { "tid": targetID })
+	}
+
+	// process search terms
+	if search != "" {
+		regex := bson.M {
+			"$regex": bson.RegEx {
+				Pattern: fmt.Sprintf(".*%s.*", search),
+				Options: "i",
+			},
+		}
+		terms := []bson.M {
+			bson.M { "an": regex },
+			bson.M { "act": regex },
+			bson.M { "tt": regex },
+			bson.M { "tn": regex },
+			bson.M { "ch.f": regex },
+		}
+		if bson.IsObjectIdHex(search) {
+			terms = append(terms, bson.M { "tid": bson.ObjectIdHex(search) }, bson.M { "ac": bson.ObjectIdHex(search) })
+		}
+		filters = append(filters, bson.M { "$or": terms })
+	}
+
+	// build query
+	if len(filters) > 0 {
+		return context.DB().C(models.AuditCollectionName).Find(bson.M { "$and": filters })
+	}
+	return context.DB().C(models.AuditCollectionName).Find(nil)
+}
+
+func ViewAudits(context *util.Context) {
+	// sorting
+	query := context.Sort(getAuditsQuery(context), "t0-desc")
+
+	// paginate audits query
+	pagination, err := context.Paginate(query, DefaultPageSize)
+	util.Must(err)
+
+	// get resulting audits
+	var audits []*models.Audit
+	util.Must(pagination.All(&audits))
+
+	// set template bindings
+	context.Params.Set("audits", audits)
+}
+
+func ViewAudit(context *util.Context) {
+	// parse parameters
+	auditId := context.Params.GetRequiredId("auditId")
+
+	audit, err := models.GetAuditById(context, auditId)
+	util.Must(err)
+
+	// set template bindings
+	context.Params.Set("audit", audit)
+}
+
+func ExportAudits(context *util.Context) {
+	// parse parameters
+	format := context.Params.GetRequiredString("format")
+
+	// get all matching audits
+	var audits []*models.Audit
+	util.Must(getAuditsQuery(context).Sort("-t0").All(&audits))
+
+	filename := fmt.Sprintf("audits-%s.%s", time.Now().UTC().Format("20060102-150405"), format)
+	context.ResponseWriter.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%s", filename))
+
+	switch format {
+	case "json":
+		context.ResponseWriter.Header().Set("Content-Type", "application/json")
+
+		encoder := json.NewEncoder(context)
+		encoder.SetIndent("", "\t")
+		util.Must(encoder.Encode(audits))
+
+	case "csv":
+		context.ResponseWriter.Header().Set("Content-Type", "text/csv")
+
+		// one row per changed field (or a single row for actions without changes)
+		writer := csv.NewWriter(context)
+		util.Must(writer.Write([]string { "time", "actorId", "actor", "action", "targetType", "targetId", "target", "field", "before", "after" }))
+		for _, audit := range audits {
+			row := []string {
+				audit.CreatedTime.UTC().Format(time.RFC3339),
+				audit.ActorID.Hex(),
+				audit.ActorName,
+				audit.Action,
+				audit.TargetType,
+				audit.TargetID.Hex(),
+				audit.TargetName,
+			}
+
+			if len(audit.Changes) == 0 {
+				util.Must(writer.Write(append(row, "", "", "")))
+			}
+			for _, change := range audit.Changes {
+				util.Must(writer.Write(append(row, change.Field, formatAuditValue(change.Before), formatAuditValue(change.After))))
+			}
+		}
+		writer.Flush()
+		util.Must(writer.Error())
+
+	default:
+		panic(fmt.Sprintf("Unsupported export format: %s", format))
+	}
+}
+
+func formatAuditValue(value interface{}) string {
+	if value == nil {
+		return ""
+	}
+
+	// encode nested documents and arrays as JSON
+	switch value.(type) {
+	case bson.M, []interface{}:
+		raw, err := json.Marshal(value)
+		if err == nil {
+			return string(raw)
+		}
+	}
+	return fmt.Sprintf("%v", value)
+}
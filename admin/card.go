@@ -13,8 +13,18 @@ import (
 )
 
 func handleAdminCards() {
-	handleAdminTemplate("/admin/cards/edit", system.TokenAuthentication, EditCard, "")
-	handleAdminTemplate("/admin/cards/delete", system.TokenAuthentication, DeleteCard, "")
+	handleAdminTemplate("/admin/cards/edit", system.TokenAuthentication, models.PermissionEditCards, EditCard, "").Describe("Edit a player card").Params(
+		system.Required("playerId", util.IdParam, "Player ID"),
+		system.Required("card", util.IntParam, "Card data ID"),
+		system.Required("level", util.IntParam, "Card level"),
+		system.Required("cardCount", util.IntParam, "Card count"),
+		system.Required("winCount", util.IntParam, "Win count"),
+		system.Required("leaderWinCount", util.IntParam, "Leader win count"),
+	)
+	handleAdminTemplate("/admin/cards/delete", system.TokenAuthentication, models.PermissionDeleteCards, DeleteCard, "").Methods("POST").Describe("Delete a player card").Params(
+		system.Required("playerId", util.IdParam, "Player ID"),
+		system.Required("card", util.IntParam, "Card data ID"),
+	)
 }
 
 func EditCard(context *util.Context) {
@@ -25,6 +35,8 @@ func EditCard(context *util.Context) {
 	player, err := models.GetPlayerById(context, playerId)
 	util.Must(err)
 
+	before := models.AuditSnapshot(player)
+
 	for i, card := range player.Cards {
 		if card.DataID == cardId {
 			player.Cards[i].Level = context.Params.GetRequiredInt("level")
@@ -35,6 +47,8 @@ func EditCard(context *util.Context) {
 			player.Save(context)
 		}
 	}
+
+	recordAudit(context, "cards.edit", "player", player.ID, fmt.Sprintf("card %d", cardId), before, models.AuditSnapshot(player))
 	
 	context.Redirect(fmt.Sprintf("/admin/users/edit?userId=%s", player.UserID.Hex()), 302)
 }
@@ -47,6 +61,8 @@ func DeleteCard(context *util.Context) {
 	player, err := models.GetPlayerById(context, playerId)
 	util.Must(err)
 
+	before := models.AuditSnapshot(player)
+
 	// make sure player will maintain min cards
 	if len(player.Cards) > 9 {
 		// remove card from inventory
@@ -76,6 +92,8 @@ func DeleteCard(context *util.Context) {
 
 			// update DB
 			player.Save(context)
+
+			recordAudit(context, "cards.delete", "player", player.ID, fmt.Sprintf("card %d", cardId), before, models.AuditSnapshot(player))
 		}
 	} else {
 		context.Fail("Must maintain minimum of 9 cards for each player")
@@ -0,0 +1,104 @@
+package admin
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/pprof"
+
+	"bloodtales/config"
+	"bloodtales/system"
+	"bloodtales/models"
+	"bloodtales/util"
+)
+
+func handleAdminDebug() {
+	handleAdminTemplate("/admin/debug", system.TokenAuthentication, models.PermissionProfile, ViewDebug, "debug.tmpl.html").Describe("Profiling page")
+	handleAdminTemplate("/admin/debug/cpu/start", system.TokenAuthentication, models.PermissionProfile, StartCPUProfile, "").Describe("Start CPU profile")
+	handleAdminTemplate("/admin/debug/cpu/stop", system.TokenAuthentication, models.PermissionProfile, StopCPUProfile, "").Describe("Stop CPU profile")
+	handleAdminTemplate("/admin/debug/heap", system.TokenAuthentication, models.PermissionProfile, WriteHeapProfile, "").Describe("Write heap profile")
+	handleAdminTemplate("/admin/debug/download", system.TokenAuthentication, models.PermissionProfile, DownloadProfile, "").Methods("GET").Describe("Download a profile").Params(
+		system.Required("name", util.StringParam, "Profile file name"),
+	)
+
+	// pprof handlers are open in development, otherwise restricted to admins with the profile permission
+	authType, permission := system.TokenAuthentication, models.PermissionProfile
+	if config.Env.Development {
+		authType, permission = system.NoAuthentication, models.PermissionNone
+	}
+
+	// each handler is wired on the admin routes, the package's own DefaultServeMux registration is never served
+	handleAdminPprof("/debug/pprof/", authType, permission, pprof.Index)
+	handleAdminPprof("/debug/pprof/cmdline", authType, permission, pprof.Cmdline)
+	handleAdminPprof("/debug/pprof/profile", authType, permission, pprof.Profile)
+	handleAdminPprof("/debug/pprof/symbol", authType, permission, pprof.Symbol)
+	handleAdminPprof("/debug/pprof/trace", authType, permission, pprof.Trace)
+	for _, name := range pprofProfiles {
+		handleAdminPprof("/debug/pprof/" + name, authType, permission, pprof.Handler(name).ServeHTTP)
+	}
+}
+
+// named runtime profiles listed by the pprof index
+var pprofProfiles = []string { "allocs", "block", "goroutine", "heap", "mutex", "threadcreate" }
+
+func handleAdminPprof(pattern string, authType system.AuthenticationType, permission models.AdminPermission, handler http.HandlerFunc) {
+	handleAdminTemplate(pattern, authType, permission, func(context *util.Context) {
+		if permission != models.PermissionNone {
+			recordAudit(context, "debug.pprof", "server", "", context.Request.URL.Path, nil, nil)
+		}
+
+		context.SetResponseWritten()
+		handler(context.ResponseWriter, context.Request)
+	}, "")
+}
+
+func ViewDebug(context *util.Context) {
+	profiles, err := util.GetProfiles()
+	util.Must(err)
+
+	// set template bindings
+	context.Params.Set("cpuProfiling", util.IsCPUProfiling())
+	context.Params.Set("profiles", profiles)
+}
+
+func StartCPUProfile(context *util.Context) {
+	name, err := util.StartCPUProfile()
+	util.Must(err)
+
+	recordAudit(context, "debug.cpu.start", "server", "", name, nil, nil)
+
+	context.Redirect("/admin/debug", 302)
+}
+
+func StopCPUProfile(context *util.Context) {
+	name := util.StopCPUProfile()
+	if name == "" {
+		panic("No CPU profile capture in progress")
+	}
+
+	recordAudit(context, "debug.cpu.stop", "server", "", name, nil, nil)
+
+	context.Redirect("/admin/debug", 302)
+}
+
+func WriteHeapProfile(context *util.Context) {
+	name, err := util.WriteHeapProfile()
+	util.Must(err)
+
+	recordAudit(context, "debug.heap", "server", "", name, nil, nil)
+
+	context.Redirect("/admin/debug", 302)
+}
+
+func DownloadProfile(context *util.Context) {
+	// parse parameters
+	name := context.Params.GetRequiredString("name")
+
+	path, err := util.GetProfileFile(name)
+	util.Must(err)
+
+	recordAudit(context, "debug.download", "server", "", name, nil, nil)
+
+	context.SetResponseWritten()
+	context.ResponseWriter.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%s", name))
+	http.ServeFile(context.ResponseWriter, context.Request, path)
+}
@@ -12,9 +12,17 @@ import (
 )
 
 func handleAdminFaults() {
-	handleAdminTemplate("/admin/faults", system.TokenAuthentication, ViewFaults, "faults.tmpl.html")
-	handleAdminTemplate("/admin/faults/view", system.TokenAuthentication, ViewFault, "fault.tmpl.html")
-	handleAdminTemplate("/admin/faults/delete", system.TokenAuthentication, DeleteFault, "")
+	handleAdminTemplate("/admin/faults", system.TokenAuthentication, models.PermissionViewFaults, ViewFaults, "faults.tmpl.html").Describe("List faults").Params(
+		system.Optional("search", util.StringParam, nil, "Message, user or request ID search"),
+		system.Optional("page", util.IntParam, 1, "Page"),
+	)
+	handleAdminTemplate("/admin/faults/view", system.TokenAuthentication, models.PermissionViewFaults, ViewFault, "fault.tmpl.html").Describe("View a fault").Params(
+		system.Required("faultId", util.IdParam, "Fault ID"),
+	)
+	handleAdminTemplate("/admin/faults/delete", system.TokenAuthentication, models.PermissionDeleteFaults, DeleteFault, "").Methods("POST").Describe("Delete a fault").Params(
+		system.Required("faultId", util.IdParam, "Fault ID"),
+		system.Optional("page", util.IntParam, 1, "List page to return to"),
+	)
 }
 
 func ViewFaults(context *util.Context) {
@@ -26,7 +34,7 @@ func ViewFaults(context *util.Context) {
 	if search != "" {
 		// find users matching name search
 		var users []*models.User
-		util.Must(context.DB.C(models.UserCollectionName).Find(bson.M {
+		util.Must(context.DB().C(models.UserCollectionName).Find(bson.M {
 			"nm": bson.M {
 				"$regex": bson.RegEx {
 					Pattern: fmt.Sprintf(".*%s.*", search),
@@ -40,13 +48,14 @@ func ViewFaults(context *util.Context) {
 		}
 
 		// build query
-		query = context.DB.C(util.FaultCollectionName).Find(bson.M {
+		query = context.DB().C(util.FaultCollectionName).Find(bson.M {
 			"$or": []bson.M {
 				bson.M { "us":
 					bson.M {
 						"$in": userIDs,
 					},
 				},
+				bson.M { "rid": search },
 				bson.M { "err":
 					bson.M {
 						"$regex": bson.RegEx {
@@ -58,7 +67,7 @@ func ViewFaults(context *util.Context) {
 			},
 		})
 	} else {
-		query = context.DB.C(util.FaultCollectionName).Find(nil)
+		query = context.DB().C(util.FaultCollectionName).Find(nil)
 	}
 
 	// sorting
@@ -90,12 +99,14 @@ func ViewFault(context *util.Context) {
 func DeleteFault(context *util.Context) {
 	// parse parameters
 	faultId := context.Params.GetRequiredId("faultId")
-	page := context.Params.GetInt("page", 1)
+	page := context.Params.GetRequiredInt("page")
 
 	fault, err := util.GetFaultById(context, faultId)
 	util.Must(err)
 
 	fault.Delete(context)
 
+	recordAudit(context, "faults.delete", "fault", fault.ID, fault.Error, models.AuditSnapshot(fault), nil)
+
 	context.Redirect(fmt.Sprintf("/admin/faults?page=%d", page), 302)
 }
@@ -2,19 +2,36 @@ package admin
 
 import (
 	"fmt"
+	"time"
 
 	"gopkg.in/mgo.v2"
 	"gopkg.in/mgo.v2/bson"
 
+	"bloodtales/config"
 	"bloodtales/system"
 	"bloodtales/models"
 	"bloodtales/util"
 )
 
 func handleAdminGuilds() {
-	handleAdminTemplate("/admin/guilds", system.TokenAuthentication, ViewGuilds, "guilds.tmpl.html")
-	handleAdminTemplate("/admin/guilds/edit", system.TokenAuthentication, EditGuild, "guild.tmpl.html")
-	handleAdminTemplate("/admin/guilds/delete", system.TokenAuthentication, DeleteGuild, "")
+	handleAdminTemplate("/admin/guilds", system.TokenAuthentication, models.PermissionViewGuilds, ViewGuilds, "guilds.tmpl.html").Describe("List guilds").Params(
+		system.Optional("search", util.StringParam, nil, "Guild name or tag search"),
+		system.Optional("page", util.IntParam, 1, "Page"),
+	)
+	handleAdminTemplate("/admin/guilds/edit", system.TokenAuthentication, models.PermissionViewGuilds, EditGuild, "guild.tmpl.html").Describe("View or edit a guild").Params(
+		system.Required("guildId", util.IdParam, "Guild ID"),
+		system.Optional("name", util.StringParam, nil, "Guild name"),
+		system.Optional("xp", util.IntParam, nil, "Experience"),
+		system.Optional("rating", util.IntParam, nil, "Rating"),
+		system.Optional("winCount", util.IntParam, nil, "Win count"),
+		system.Optional("lossCount", util.IntParam, nil, "Loss count"),
+		system.Optional("matchCount", util.IntParam, nil, "Match count"),
+	)
+	handleAdminTemplate("/admin/guilds/delete", system.TokenAuthentication, models.PermissionDeleteGuilds, DeleteGuild, "").Methods("POST").Describe("Delete a guild").Params(
+		system.Required("guildId", util.IdParam, "Guild ID"),
+		system.Optional("page", util.IntParam, 1, "List page to return to"),
+	)
+	handleAdminTemplate("/admin/guilds/recoverDonations", system.TokenAuthentication, models.PermissionEditGuilds, RecoverDonations, "").Methods("POST").Describe("Settle card donations interrupted for longer than the donation timeout (can be run from a scheduler)")
 }
 
 func ViewGuilds(context *util.Context) {
@@ -25,7 +42,7 @@ func ViewGuilds(context *util.Context) {
 	var query *mgo.Query = nil
 	if search != "" {
 		// build query
-		query = context.DB.C(models.GuildCollectionName).Find(bson.M {
+		query = context.DB().C(models.GuildCollectionName).Find(bson.M {
 			"nm": bson.M {
 				"$regex": bson.RegEx {
 					Pattern: fmt.Sprintf(".*%s.*", search),
@@ -34,7 +51,7 @@ func ViewGuilds(context *util.Context) {
 			},
 		})
 	} else {
-		query = context.DB.C(models.GuildCollectionName).Find(nil)
+		query = context.DB().C(models.GuildCollectionName).Find(nil)
 	}
 
 	// sorting
@@ -61,12 +78,51 @@ func EditGuild(context *util.Context) {
 
 	// get members
 	var members []*models.Player
-	util.Must(context.DB.C(models.PlayerCollectionName).Find(bson.M { "gd": guild.ID } ).All(&members))
+	util.Must(context.DB().C(models.PlayerCollectionName).Find(bson.M { "gd": guild.ID } ).All(&members))
 
 	// handle request method
 	switch context.Request.Method {
 	case "POST":
-		// TODO
+		if !checkPermission(context, models.PermissionEditGuilds) {
+			return
+		}
+
+		before := models.AuditSnapshot(guild)
+
+		name := context.Params.GetString("name", "")
+		if name != "" {
+			guild.Name = name
+		}
+
+		xp := context.Params.GetInt("xp", -1)
+		if xp >= 0 {
+			guild.XP = xp
+		}
+
+		rating := context.Params.GetInt("rating", -1)
+		if rating >= 0 {
+			guild.Rating = rating
+		}
+
+		winCount := context.Params.GetInt("winCount", -1)
+		if winCount >= 0 {
+			guild.WinCount = winCount
+		}
+
+		lossCount := context.Params.GetInt("lossCount", -1)
+		if lossCount >= 0 {
+			guild.LossCount = lossCount
+		}
+
+		matchCount := context.Params.GetInt("matchCount", -1)
+		if matchCount >= 0 {
+			guild.MatchCount = matchCount
+		}
+
+		util.Must(guild.Save(context))
+		guild.UpdateRatingPlace(context)
+
+		recordAudit(context, "guilds.edit", "guild", guild.ID, guild.Name, before, models.AuditSnapshot(guild))
 		context.Message("Guild updated!")
 	}
 	
@@ -78,12 +134,24 @@ func EditGuild(context *util.Context) {
 func DeleteGuild(context *util.Context) {
 	// parse parameters
 	guildId := context.Params.GetRequiredId("guildId")
-	page := context.Params.GetInt("page", 1)
+	page := context.Params.GetRequiredInt("page")
 
 	guild, err := models.GetGuildById(context, guildId)
 	util.Must(err)
 
 	guild.Delete(context)
 
+	recordAudit(context, "guilds.delete", "guild", guild.ID, guild.Name, models.AuditSnapshot(guild), nil)
+
 	context.Redirect(fmt.Sprintf("/admin/guilds?page=%d", page), 302)
 }
+
+func RecoverDonations(context *util.Context) {
+	sent, failed, err := models.RecoverCardDonations(context, time.Now().Add(-config.Config.Guilds.DonationTimeout.Duration))
+	util.Must(err)
+
+	recordAudit(context, "guilds.donations.recover", "cardDonations", "", fmt.Sprintf("%d sent, %d failed", sent, failed), nil, nil)
+
+	context.Messagef("Recovered %d interrupted card donations (%d sent, %d released)", sent + failed, sent, failed)
+	context.Redirect("/admin/guilds", 302)
+}
@@ -1,65 +1,52 @@
 package admin
 
 import (
-	"gopkg.in/mgo.v2/bson"
+	"fmt"
+	"time"
 
+	"bloodtales/config"
+	"bloodtales/data"
 	"bloodtales/system"
 	"bloodtales/models"
 	"bloodtales/util"
 )
 
 func handleAdminLeaderboards() {
-	handleAdminTemplate("/leaderboard", system.NoAuthentication, ViewLeaderboard, "leaderboard.tmpl.html")
-	handleAdminTemplate("/admin/leaderboard/refresh", system.TokenAuthentication, RefreshLeaderboard, "")
+	handleAdminTemplate("/leaderboard", system.NoAuthentication, models.PermissionNone, ViewLeaderboard, "leaderboard.tmpl.html").Describe("Leaderboard page").Params(
+		system.Optional("page", util.IntParam, 1, "Page"),
+		system.Optional("scope", util.StringParam, "global", "Leaderboard").OneOf("global", "league", "season", "guilds", "guildRating"),
+		system.Optional("league", util.IntParam, 0, "League (league scope)"),
+		system.Optional("season", util.IntParam, 0, "Season number (season scope, defaults to the current season)"),
+	)
+	handleAdminTemplate("/admin/leaderboard/refresh", system.TokenAuthentication, models.PermissionRefreshLeaderboard, RefreshLeaderboard, "").Methods("POST").Describe("Refresh leaderboard places (rebuilds all boards in the background)").Params(
+		system.Optional("playerId", util.IdParam, nil, "Only refresh this player"),
+		system.Optional("batchSize", util.IntParam, nil, "Players per rebuild batch (defaults to Leaderboards.RebuildBatchSize)"),
+		system.Optional("delay", util.IntParam, nil, "Milliseconds between rebuild batches (defaults to Leaderboards.RebuildBatchDelay)"),
+	)
 }
 
 func ViewLeaderboard(context *util.Context) {
 	// parse parameters
-	page := context.Params.GetInt("page", 1)
-
-	// TODO - correct pagination
-	pageStart := DefaultPageSize * (page - 1)
-	pageStop := DefaultPageSize * page - 1
-	playerIds := context.Cache.GetRankRange("Leaderboard", pageStart, pageStop)
-
-	// convert to ObjectIds
-	playerObjectIds := make([]bson.ObjectId, len(playerIds))
-	for i, id := range playerIds {
-		playerObjectIds[i] = bson.ObjectIdHex(id)
+	page := context.Params.GetRequiredInt("page")
+	scope, err := models.GetLeaderboardScope(context.Params.GetRequiredString("scope"))
+	util.Must(err)
+	if page < 1 {
+		page = 1
 	}
 
-	// get players
-	var unsortedPlayers []*models.Player
-	util.Must(context.DB.C(models.PlayerCollectionName).Find(bson.M {
-		"_id": bson.M { "$in": playerObjectIds, },
-	}).All(&unsortedPlayers))
-	
-	// reorder
-	var players []*models.Player
-	for _, playerId := range playerObjectIds {
-		for _, player := range unsortedPlayers {
-			if playerId == player.ID {
-				players = append(players, player)
-				break
-			}
-		}
-	}
-
-	// paginate players query
-	// pagination, err := context.Paginate(context.DB.C(models.PlayerCollectionName).Find(nil).Sort("lb"), DefaultPageSize)
-	// if err != nil {
-	// 	panic(err)
-	// }
-
-	// // get resulting players
-	// var players []*models.Player
-	// err = pagination.All(&players)
-	// if err != nil {
-	// 	panic(err)
-	// }
+	leaderboard, err := models.GetLeaderboard(context, &models.LeaderboardQuery {
+		Scope: scope,
+		League: data.League(context.Params.GetRequiredInt("league")),
+		Season: context.Params.GetRequiredInt("season"),
+		Offset: DefaultPageSize * (page - 1),
+		Limit: DefaultPageSize,
+	})
+	util.Must(err)
 
 	// set template bindings
-	context.Params.Set("players", players)
+	context.Params.Set("leaderboard", leaderboard)
+	context.Params.Set("rebuild", models.GetLeaderboardRebuild(context))
+	context.Params.Set("pagination", util.PaginateCount(leaderboard.Count, DefaultPageSize, page))
 }
 
 func RefreshLeaderboard(context *util.Context) {
@@ -72,11 +59,20 @@ func RefreshLeaderboard(context *util.Context) {
 
 		player.UpdatePlace(context)
 
+		recordAudit(context, "leaderboard.refresh", "player", player.ID, "", nil, nil)
+
 		context.Redirect("/users/edit?userId=" + player.UserID.Hex(), 302)
 	} else {
-		// HACK - inefficient
-		models.UpdateAllPlayersPlace(context)
+		// parse parameters
+		batchSize := context.Params.GetInt("batchSize", config.Config.Leaderboards.RebuildBatchSize)
+		delay := time.Duration(context.Params.GetInt("delay", int(config.Config.Leaderboards.RebuildBatchDelay.Duration / time.Millisecond))) * time.Millisecond
+
+		rebuild, err := models.StartLeaderboardRebuild(context, batchSize, delay)
+		util.Must(err)
+
+		recordAudit(context, "leaderboard.refresh", "leaderboard", "", fmt.Sprintf("%d players", rebuild.Total), nil, nil)
 
+		context.Messagef("Rebuilding leaderboards for %d players in the background", rebuild.Total)
 		context.Redirect("/leaderboard", 302)
 	}
 }
\ No newline at end of file
@@ -9,14 +9,21 @@ import (
 )
 
 func handleAdminMatches() {
-	handleAdminTemplate("/admin/matches", system.TokenAuthentication, ViewMatches, "matches.tmpl.html")
-	handleAdminTemplate("/admin/matches/edit", system.TokenAuthentication, EditMatch, "match.tmpl.html")
-	handleAdminTemplate("/admin/matches/delete", system.TokenAuthentication, DeleteMatch, "")
+	handleAdminTemplate("/admin/matches", system.TokenAuthentication, models.PermissionViewMatches, ViewMatches, "matches.tmpl.html").Describe("List matches").Params(
+		system.Optional("page", util.IntParam, 1, "Page"),
+	)
+	handleAdminTemplate("/admin/matches/edit", system.TokenAuthentication, models.PermissionViewMatches, EditMatch, "match.tmpl.html").Describe("View a match").Params(
+		system.Required("matchId", util.IdParam, "Match ID"),
+	)
+	handleAdminTemplate("/admin/matches/delete", system.TokenAuthentication, models.PermissionDeleteMatches, DeleteMatch, "").Methods("POST").Describe("Delete a match").Params(
+		system.Required("matchId", util.IdParam, "Match ID"),
+		system.Optional("page", util.IntParam, 1, "List page to return to"),
+	)
 }
 
 func ViewMatches(context *util.Context) {
 	// paginate players query
-	pagination, err := context.Paginate(context.DB.C(models.MatchCollectionName).Find(nil).Sort("-t0"), DefaultPageSize)
+	pagination, err := context.Paginate(context.DB().C(models.MatchCollectionName).Find(nil).Sort("-t0"), DefaultPageSize)
 	util.Must(err)
 
 	// get resulting matches
@@ -37,22 +44,36 @@ func EditMatch(context *util.Context) {
 	// handle request method
 	switch context.Request.Method {
 	case "POST":
+		if !checkPermission(context, models.PermissionEditMatches) {
+			return
+		}
+
+		before := models.AuditSnapshot(match)
+
+		recordAudit(context, "matches.edit", "match", match.ID, "", before, models.AuditSnapshot(match))
+
 		context.Message("Match updated!")
 	}
 	
+	replayInfos, err := models.GetReplayInfosByMatch(context, match.ID)
+	util.Must(err)
+
 	// set template bindings
 	context.Params.Set("match", match)
+	context.Params.Set("replays", replayInfos)
 }
 
 func DeleteMatch(context *util.Context) {
 	// parse parameters
 	matchId := context.Params.GetRequiredId("matchId")
-	page := context.Params.GetInt("page", 1)
+	page := context.Params.GetRequiredInt("page")
 
 	match, err := models.GetMatchById(context, matchId)
 	util.Must(err)
 
 	match.Delete(context)
 
+	recordAudit(context, "matches.delete", "match", match.ID, "", models.AuditSnapshot(match), nil)
+
 	context.Redirect(fmt.Sprintf("/admin/matches?page=%d", page), 302)
 }
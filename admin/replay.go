@@ -0,0 +1,34 @@
+package admin
+
+import (
+	"fmt"
+
+	"bloodtales/system"
+	"bloodtales/models"
+	"bloodtales/util"
+)
+
+func handleAdminReplays() {
+	handleAdminTemplate("/admin/replays/expire", system.TokenAuthentication, models.PermissionMaintainReplays, ExpireReplays, "").Describe("Delete replays past retention, keeping the top ranked")
+	handleAdminTemplate("/admin/replays/migrate", system.TokenAuthentication, models.PermissionMaintainReplays, MigrateReplays, "").Describe("Compress legacy replays")
+}
+
+func ExpireReplays(context *util.Context) {
+	count, err := models.ExpireReplays(context)
+	util.Must(err)
+
+	recordAudit(context, "replays.expire", "replays", "", fmt.Sprintf("%d expired", count), nil, nil)
+
+	context.Messagef("Expired %d replays", count)
+	context.Redirect("/admin/dashboard", 302)
+}
+
+func MigrateReplays(context *util.Context) {
+	count, err := models.MigrateReplays(context)
+	util.Must(err)
+
+	recordAudit(context, "replays.migrate", "replays", "", fmt.Sprintf("%d migrated", count), nil, nil)
+
+	context.Messagef("Migrated %d replays", count)
+	context.Redirect("/admin/dashboard", 302)
+}
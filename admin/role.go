@@ -0,0 +1,82 @@
+package admin
+
+import (
+	"fmt"
+
+	"gopkg.in/mgo.v2/bson"
+
+	"bloodtales/system"
+	"bloodtales/models"
+	"bloodtales/util"
+)
+
+func handleAdminRoles() {
+	handleAdminTemplate("/admin/roles", system.TokenAuthentication, models.PermissionManageRoles, ViewRoles, "roles.tmpl.html").Describe("List admin roles").Params(
+		system.Optional("search", util.StringParam, nil, "User tag or username"),
+	)
+	handleAdminTemplate("/admin/roles/edit", system.TokenAuthentication, models.PermissionManageRoles, EditRole, "").Methods("POST").Describe("Set a user role").Params(
+		system.Required("userId", util.IdParam, "User ID"),
+		system.Optional("role", util.StringParam, nil, "Role (empty to remove)"),
+	)
+}
+
+func ViewRoles(context *util.Context) {
+	// parse parameters
+	search := context.Params.GetString("search", "")
+
+	// get all current admins
+	admins, err := models.GetAdminUsers(context)
+	util.Must(err)
+
+	// find user to grant a role to
+	var found *models.User
+	if search != "" {
+		err = context.DB().C(models.UserCollectionName).Find(bson.M { "$or": []bson.M {
+			bson.M { "tag": search },
+			bson.M { "un": search },
+		} }).One(&found)
+		util.MustIgnoreNotFound(err)
+
+		if found == nil {
+			context.Messagef("No user found with tag or username: %s", search)
+		} else if !found.IsAdmin() {
+			// list found user first, so a role can be granted
+			admins = append([]*models.User { found }, admins...)
+		}
+	}
+
+	// set template bindings
+	context.Params.Set("admins", admins)
+	context.Params.Set("found", found)
+	context.Params.Set("roles", models.AdminRoles)
+	context.Params.Set("permissions", models.AdminPermissions)
+}
+
+func EditRole(context *util.Context) {
+	// parse parameters
+	userID := context.Params.GetRequiredId("userId")
+	role := models.AdminRole(context.Params.GetString("role", ""))
+
+	if role != models.RoleNone && !models.IsValidAdminRole(role) {
+		panic(fmt.Sprintf("Invalid admin role: %s", role))
+	}
+
+	// prevent admins from locking themselves out
+	if userID == context.UserID {
+		panic("Cannot change your own admin role")
+	}
+
+	user, err := models.GetUserById(context, userID)
+	util.Must(err)
+
+	before := models.AuditSnapshot(user)
+
+	// update role (keeping legacy admin flag in sync)
+	user.Role = role
+	user.Admin = role != models.RoleNone
+	util.Must(user.Save(context))
+
+	recordAudit(context, "roles.edit", "user", user.ID, user.Tag, before, models.AuditSnapshot(user))
+
+	context.Redirect("/admin/roles", 302)
+}
@@ -0,0 +1,67 @@
+package admin
+
+import (
+	"fmt"
+	"time"
+
+	"bloodtales/system"
+	"bloodtales/models"
+	"bloodtales/util"
+)
+
+func handleAdminSanctions() {
+	handleAdminTemplate("/admin/sanctions/add", system.TokenAuthentication, models.PermissionEditSanctions, AddSanction, "").Methods("POST").Describe("Sanction a user").Params(
+		system.Required("userId", util.IdParam, "User ID"),
+		system.Required("type", util.StringParam, "Sanction type"),
+		system.Required("reason", util.StringParam, "Reason"),
+		system.Optional("hours", util.IntParam, 0, "Duration in hours (required unless permanent)"),
+		system.Optional("permanent", util.BoolParam, false, "Permanent sanction"),
+	)
+	handleAdminTemplate("/admin/sanctions/revoke", system.TokenAuthentication, models.PermissionEditSanctions, RevokeSanction, "").Describe("Revoke a sanction").Params(
+		system.Required("sanctionId", util.IdParam, "Sanction ID"),
+	)
+}
+
+func AddSanction(context *util.Context) {
+	// parse parameters
+	userID := context.Params.GetRequiredId("userId")
+	sanctionType, err := models.GetSanctionType(context.Params.GetRequiredString("type"))
+	util.Must(err)
+	reason := context.Params.GetRequiredString("reason")
+	hours := context.Params.GetRequiredInt("hours")
+	permanent := context.Params.GetRequiredBool("permanent")
+
+	// permanent sanctions must be explicit, never a missing duration
+	var duration time.Duration
+	if !permanent {
+		if hours <= 0 {
+			panic("Sanction duration must be a positive number of hours, or permanent")
+		}
+		duration = time.Hour * time.Duration(hours)
+	}
+
+	user, err := models.GetUserById(context, userID)
+	util.Must(err)
+
+	sanction, err := models.InsertSanction(context, user.ID, sanctionType, reason, duration, system.GetUser(context))
+	util.Must(err)
+
+	recordAudit(context, "sanctions.add", "user", user.ID, user.Tag, nil, models.AuditSnapshot(sanction))
+
+	context.Redirect(fmt.Sprintf("/admin/users/edit?userId=%s", user.ID.Hex()), 302)
+}
+
+func RevokeSanction(context *util.Context) {
+	// parse parameters
+	sanctionID := context.Params.GetRequiredId("sanctionId")
+
+	sanction, err := models.GetSanctionById(context, sanctionID)
+	util.Must(err)
+
+	before := models.AuditSnapshot(sanction)
+	util.Must(sanction.Revoke(context, system.GetUser(context)))
+
+	recordAudit(context, "sanctions.revoke", "user", sanction.UserID, "", before, models.AuditSnapshot(sanction))
+
+	context.Redirect(fmt.Sprintf("/admin/users/edit?userId=%s", sanction.UserID.Hex()), 302)
+}
@@ -0,0 +1,68 @@
+package admin
+
+import (
+	"fmt"
+	"time"
+
+	"bloodtales/system"
+	"bloodtales/models"
+	"bloodtales/util"
+)
+
+// format of datetime-local inputs (UTC)
+const seasonTimeFormat = "2006-01-02T15:04"
+
+func handleAdminSeasons() {
+	handleAdminTemplate("/admin/seasons", system.TokenAuthentication, models.PermissionViewDashboard, ViewSeasons, "seasons.tmpl.html").Describe("List seasons")
+	handleAdminTemplate("/admin/seasons/add", system.TokenAuthentication, models.PermissionManageSeasons, AddSeason, "").Methods("POST").Describe("Schedule a season").Params(
+		system.Required("name", util.StringParam, "Season name"),
+		system.Required("start", util.StringParam, "Start time (UTC, e.g. 2017-01-31T12:00)"),
+		system.Required("end", util.StringParam, "End time (UTC, e.g. 2017-02-28T12:00)"),
+	)
+	handleAdminTemplate("/admin/seasons/rollover", system.TokenAuthentication, models.PermissionManageSeasons, RolloverSeason, "").Describe("Archive results and soft reset players for an ended season (resumes an interrupted rollover)").Params(
+		system.Required("seasonId", util.IdParam, "Season ID"),
+	)
+}
+
+func ViewSeasons(context *util.Context) {
+	seasons, err := models.GetSeasons(context)
+	util.Must(err)
+
+	// set template bindings
+	context.Params.Set("seasons", seasons)
+	context.Params.Set("now", time.Now())
+}
+
+func AddSeason(context *util.Context) {
+	// parse parameters
+	name := context.Params.GetRequiredString("name")
+	start, err := time.Parse(seasonTimeFormat, context.Params.GetRequiredString("start"))
+	util.Must(err)
+	end, err := time.Parse(seasonTimeFormat, context.Params.GetRequiredString("end"))
+	util.Must(err)
+
+	season, err := models.CreateSeason(context, name, start, end)
+	util.Must(err)
+
+	recordAudit(context, "seasons.add", "season", season.ID, season.Name, nil, models.AuditSnapshot(season))
+
+	context.Messagef("Scheduled season %d", season.Number)
+	context.Redirect("/admin/seasons", 302)
+}
+
+func RolloverSeason(context *util.Context) {
+	// parse parameters
+	seasonID := context.Params.GetRequiredId("seasonId")
+
+	season, err := models.GetSeasonById(context, seasonID)
+	util.Must(err)
+
+	before := models.AuditSnapshot(season)
+	count, err := season.Rollover(context)
+	util.Must(err)
+
+	recordAudit(context, "seasons.rollover", "season", season.ID, fmt.Sprintf("%s (%d players)", season.Name, count), before, models.AuditSnapshot(season))
+
+	context.Messagef("Rolled over %d players for season %d", count, season.Number)
+	context.Redirect("/admin/seasons", 302)
+}
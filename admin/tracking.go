@@ -9,14 +9,21 @@ import (
 )
 
 func handleAdminTracking() {
-	handleAdminTemplate("/admin/trackings", system.TokenAuthentication, ViewTrackings, "trackings.tmpl.html")
-	handleAdminTemplate("/admin/trackings/view", system.TokenAuthentication, ViewTracking, "tracking.tmpl.html")
-	handleAdminTemplate("/admin/trackings/delete", system.TokenAuthentication, DeleteTracking, "")
+	handleAdminTemplate("/admin/trackings", system.TokenAuthentication, models.PermissionViewTrackings, ViewTrackings, "trackings.tmpl.html").Describe("List tracking events").Params(
+		system.Optional("page", util.IntParam, 1, "Page"),
+	)
+	handleAdminTemplate("/admin/trackings/view", system.TokenAuthentication, models.PermissionViewTrackings, ViewTracking, "tracking.tmpl.html").Describe("View a tracking event").Params(
+		system.Required("trackingId", util.IdParam, "Tracking ID"),
+	)
+	handleAdminTemplate("/admin/trackings/delete", system.TokenAuthentication, models.PermissionDeleteTrackings, DeleteTracking, "").Methods("POST").Describe("Delete a tracking event").Params(
+		system.Required("trackingId", util.IdParam, "Tracking ID"),
+		system.Optional("page", util.IntParam, 1, "List page to return to"),
+	)
 }
 
 func ViewTrackings(context *util.Context) {
 	// paginate players query
-	pagination, err := context.Paginate(context.DB.C(models.TrackingCollectionName).Find(nil).Sort("-t0"), DefaultPageSize)
+	pagination, err := context.Paginate(context.DB().C(models.TrackingCollectionName).Find(nil).Sort("-t0"), DefaultPageSize)
 	util.Must(err)
 
 	// get resulting trackings
@@ -41,12 +48,14 @@ func ViewTracking(context *util.Context) {
 func DeleteTracking(context *util.Context) {
 	// parse parameters
 	trackingId := context.Params.GetRequiredId("trackingId")
-	page := context.Params.GetInt("page", 1)
+	page := context.Params.GetRequiredInt("page")
 
 	tracking, err := models.GetTrackingById(context, trackingId)
 	util.Must(err)
 
 	tracking.Delete(context)
 
+	recordAudit(context, "trackings.delete", "tracking", tracking.ID, tracking.Event, models.AuditSnapshot(tracking), nil)
+
 	context.Redirect(fmt.Sprintf("/admin/trackings?page=%d", page), 302)
 }
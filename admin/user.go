@@ -12,10 +12,32 @@ import (
 )
 
 func handleAdminUsers() {
-	handleAdminTemplate("/admin/users", system.TokenAuthentication, ViewUsers, "users.tmpl.html")
-	handleAdminTemplate("/admin/users/edit", system.TokenAuthentication, EditUser, "user.tmpl.html")
-	handleAdminTemplate("/admin/users/reset", system.TokenAuthentication, ResetUser, "")
-	handleAdminTemplate("/admin/users/delete", system.TokenAuthentication, DeleteUser, "")
+	handleAdminTemplate("/admin/users", system.TokenAuthentication, models.PermissionViewUsers, ViewUsers, "users.tmpl.html").Describe("List users").Params(
+		system.Optional("search", util.StringParam, nil, "Name or tag search"),
+		system.Optional("page", util.IntParam, 1, "Page"),
+	)
+	handleAdminTemplate("/admin/users/edit", system.TokenAuthentication, models.PermissionViewUsers, EditUser, "user.tmpl.html").Describe("View or edit a user").Params(
+		system.Required("userId", util.IdParam, "User ID"),
+		system.Optional("tag", util.StringParam, nil, "New player tag"),
+		system.Optional("name", util.StringParam, nil, "New user name"),
+		system.Optional("standardCurrency", util.IntParam, nil, "Standard currency"),
+		system.Optional("premiumCurrency", util.IntParam, nil, "Premium currency"),
+		system.Optional("xp", util.IntParam, nil, "Experience"),
+		system.Optional("rating", util.IntParam, nil, "Rating"),
+		system.Optional("rankPoints", util.IntParam, nil, "Rank points"),
+		system.Optional("arenaPoints", util.IntParam, nil, "Arena points"),
+		system.Optional("winCount", util.IntParam, nil, "Win count"),
+		system.Optional("lossCount", util.IntParam, nil, "Loss count"),
+		system.Optional("matchCount", util.IntParam, nil, "Match count"),
+	)
+	handleAdminTemplate("/admin/users/reset", system.TokenAuthentication, models.PermissionResetUsers, ResetUser, "").Methods("POST").Describe("Reset a player").Params(
+		system.Optional("userId", util.IdParam, nil, "User ID"),
+		system.Optional("development", util.BoolParam, false, "Reset with development data"),
+	)
+	handleAdminTemplate("/admin/users/delete", system.TokenAuthentication, models.PermissionDeleteUsers, DeleteUser, "").Methods("POST").Describe("Delete a user").Params(
+		system.Required("userId", util.IdParam, "User ID"),
+		system.Optional("page", util.IntParam, 1, "List page to return to"),
+	)
 }
 
 func ViewUsers(context *util.Context) {
@@ -26,7 +48,7 @@ func ViewUsers(context *util.Context) {
 	var query *mgo.Query = nil
 	if search != "" {
 		// build query
-		query = context.DB.C(models.UserCollectionName).Find(bson.M {
+		query = context.DB().C(models.UserCollectionName).Find(bson.M {
 			"$or": []bson.M {
 				bson.M {
 					"nm": bson.M {
@@ -47,7 +69,7 @@ func ViewUsers(context *util.Context) {
 			},
 		})
 	} else {
-		query = context.DB.C(models.UserCollectionName).Find(nil)
+		query = context.DB().C(models.UserCollectionName).Find(nil)
 	}
 
 	// sorting
@@ -78,6 +100,11 @@ func EditUser(context *util.Context) {
 	// handle request method
 	switch context.Request.Method {
 	case "POST":
+		if !checkPermission(context, models.PermissionEditUsers) {
+			return
+		}
+
+		before := bson.M { "user": models.AuditSnapshot(user), "player": models.AuditSnapshot(player) }
 		userUpdated := false
 
 		tag := context.Params.GetString("tag", "")
@@ -145,18 +172,31 @@ func EditUser(context *util.Context) {
 			player.Save(context)
 		}
 
+		recordAudit(context, "users.edit", "user", user.ID, user.Tag, before, bson.M { "user": models.AuditSnapshot(user), "player": models.AuditSnapshot(player) })
+
 		context.Message("Player updated!")
 	}
 	
+	// get sanction history
+	sanctions, err := models.GetSanctionsByUser(context, userID)
+	util.Must(err)
+
+	sanctionTypes := make([]string, len(models.SanctionTypes))
+	for i, sanctionType := range models.SanctionTypes {
+		sanctionTypes[i] = models.GetSanctionTypeName(sanctionType)
+	}
+
 	// set template bindings
 	context.Params.Set("user", user)
 	context.Params.Set("player", player)
+	context.Params.Set("sanctions", sanctions)
+	context.Params.Set("sanctionTypes", sanctionTypes)
 }
 
 func ResetUser(context *util.Context) {
 	// parse parameters
 	userID := context.Params.GetId("userId")
-	development := context.Params.GetBool("development", false)
+	development := context.Params.GetRequiredBool("development")
 
 	if userID.Valid() {
 		player, err := models.GetPlayerByUser(context, userID)
@@ -166,23 +206,29 @@ func ResetUser(context *util.Context) {
 			util.Must(err)
 
 			util.Must(player.Save(context))
+
+			recordAudit(context, "users.reset", "user", userID, "", nil, bson.M { "player": models.AuditSnapshot(player) })
 		} else {
 			util.Must(err)
 
 			// clear user name
 			user, err := models.GetUserById(context, userID)
 			util.Must(err)
+			before := bson.M { "user": models.AuditSnapshot(user), "player": models.AuditSnapshot(player) }
+
 			user.Name = ""
 			util.Must(user.Save(context))
 
 			util.Must(player.Reset(context, development))
+
+			recordAudit(context, "users.reset", "user", userID, user.Tag, before, bson.M { "user": models.AuditSnapshot(user), "player": models.AuditSnapshot(player) })
 		}
 
 		context.Redirect(fmt.Sprintf("/admin/users/edit?userId=%s", userID.Hex()), 302)
 	} else {
 		// get all players
 		var players []*models.Player
-		context.DB.C(models.PlayerCollectionName).Find(nil).All(&players)
+		context.DB().C(models.PlayerCollectionName).Find(nil).All(&players)
 
 		for _, player := range players {
 			// clear user name
@@ -194,6 +240,9 @@ func ResetUser(context *util.Context) {
 			player.Reset(context, development)
 		}
 
+		// bulk reset is recorded as a single entry without diffs
+		recordAudit(context, "users.reset.all", "players", "", fmt.Sprintf("%d players", len(players)), nil, nil)
+
 		context.Redirect("/admin/users", 302)
 	}
 }
@@ -201,7 +250,7 @@ func ResetUser(context *util.Context) {
 func DeleteUser(context *util.Context) {
 	// parse parameters
 	userID := context.Params.GetRequiredId("userId")
-	page := context.Params.GetInt("page", 1)
+	page := context.Params.GetRequiredInt("page")
 
 	user, err := models.GetUserById(context, userID)
 	util.Must(err)
@@ -212,5 +261,7 @@ func DeleteUser(context *util.Context) {
 	util.Must(user.Delete(context))
 	util.Must(player.Delete(context))
 
+	recordAudit(context, "users.delete", "user", user.ID, user.Tag, bson.M { "user": models.AuditSnapshot(user), "player": models.AuditSnapshot(player) }, nil)
+
 	context.Redirect(fmt.Sprintf("/admin/users?page=%d", page), 302)
 }
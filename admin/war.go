@@ -0,0 +1,82 @@
+package admin
+
+import (
+	"fmt"
+	"time"
+
+	"bloodtales/system"
+	"bloodtales/models"
+	"bloodtales/util"
+)
+
+// completed wars listed below the open ones
+const completedWarsLimit = 20
+
+func handleAdminWars() {
+	handleAdminTemplate("/admin/wars", system.TokenAuthentication, models.PermissionViewGuilds, ViewWars, "wars.tmpl.html").Describe("List open and recently completed guild wars with standings")
+	handleAdminTemplate("/admin/wars/schedule", system.TokenAuthentication, models.PermissionManageWars, ScheduleWars, "").Methods("POST").Describe("Pair guilds not at war by rating for a war window").Params(
+		system.Required("start", util.StringParam, "Start time (UTC, e.g. 2017-01-31T12:00)"),
+		system.Required("end", util.StringParam, "End time (UTC, e.g. 2017-02-02T12:00)"),
+	)
+	handleAdminTemplate("/admin/wars/complete", system.TokenAuthentication, models.PermissionManageWars, CompleteWar, "").Methods("POST").Describe("Decide an ended guild war and reward the winning guild").Params(
+		system.Required("warId", util.IdParam, "Guild war ID"),
+	)
+	handleAdminTemplate("/admin/wars/completeEnded", system.TokenAuthentication, models.PermissionManageWars, CompleteEndedWars, "").Methods("POST").Describe("Decide all ended guild wars (can be run from a scheduler)")
+}
+
+func ViewWars(context *util.Context) {
+	open, err := models.GetOpenGuildWars(context)
+	util.Must(err)
+
+	completed, err := models.GetCompletedGuildWars(context, completedWarsLimit)
+	util.Must(err)
+
+	// set template bindings
+	context.Params.Set("open", open)
+	context.Params.Set("completed", completed)
+	context.Params.Set("now", time.Now())
+}
+
+func ScheduleWars(context *util.Context) {
+	// parse parameters
+	start, err := time.Parse(seasonTimeFormat, context.Params.GetRequiredString("start"))
+	util.Must(err)
+	end, err := time.Parse(seasonTimeFormat, context.Params.GetRequiredString("end"))
+	util.Must(err)
+
+	wars, err := models.ScheduleGuildWars(context, start, end)
+	util.Must(err)
+
+	for _, war := range wars {
+		recordAudit(context, "wars.schedule", "guildWar", war.ID, war.GetName(), nil, models.AuditSnapshot(war))
+	}
+
+	context.Messagef("Scheduled %d guild wars", len(wars))
+	context.Redirect("/admin/wars", 302)
+}
+
+func CompleteWar(context *util.Context) {
+	// parse parameters
+	warID := context.Params.GetRequiredId("warId")
+
+	war, err := models.GetGuildWarById(context, warID)
+	util.Must(err)
+
+	before := models.AuditSnapshot(war)
+	util.Must(war.Complete(context))
+
+	recordAudit(context, "wars.complete", "guildWar", war.ID, war.GetName(), before, models.AuditSnapshot(war))
+
+	context.Messagef("Completed guild war %s", war.GetName())
+	context.Redirect("/admin/wars", 302)
+}
+
+func CompleteEndedWars(context *util.Context) {
+	count, err := models.CompleteGuildWars(context)
+	util.Must(err)
+
+	recordAudit(context, "wars.complete.all", "guildWars", "", fmt.Sprintf("%d completed", count), nil, nil)
+
+	context.Messagef("Completed %d guild wars", count)
+	context.Redirect("/admin/wars", 302)
+}
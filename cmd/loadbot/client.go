@@ -0,0 +1,135 @@
+package main
+
+import (
+	"fmt"
+	"time"
+	"errors"
+	"strings"
+	"net/url"
+	"net/http"
+	"io/ioutil"
+	"encoding/json"
+
+	"github.com/gorilla/websocket"
+)
+
+// simulated game client, keeping its token and the player data merged from responses
+type Client struct {
+	ID              int
+	UUID            string
+	Token           string
+	Player          map[string]interface{}
+
+	// internal
+	bot             *Bot
+	socket          *websocket.Conn
+}
+
+// API response envelope
+type Response struct {
+	Token           string                 `json:"token"`
+	Success         bool                   `json:"success"`
+	Messages        []string               `json:"messages"`
+	Data            map[string]interface{} `json:"data"`
+}
+
+// POST form parameters to an API endpoint, recording latency and failures
+func (client *Client) Call(endpoint string, params url.Values) (response *Response, err error) {
+	start := time.Now()
+	defer func() {
+		client.bot.Stats.Record(endpoint, time.Since(start), err)
+	}()
+
+	if params == nil {
+		params = url.Values {}
+	}
+	if client.Token != "" {
+		params.Set("token", client.Token)
+	}
+
+	httpResponse, err := client.bot.HTTP.PostForm(client.bot.URL + endpoint, params)
+	if err != nil {
+		return
+	}
+	defer httpResponse.Body.Close()
+
+	raw, err := ioutil.ReadAll(httpResponse.Body)
+	if err != nil {
+		return
+	}
+	if httpResponse.StatusCode != http.StatusOK {
+		err = errors.New(fmt.Sprintf("HTTP %d", httpResponse.StatusCode))
+		return
+	}
+
+	response = &Response {}
+	if err = json.Unmarshal(raw, response); err != nil {
+		return
+	}
+
+	// keep refreshed token and player data deltas
+	if response.Token != "" {
+		client.Token = response.Token
+	}
+	if playerData, ok := response.Data["playerData"].(map[string]interface{}); ok {
+		if client.Player == nil {
+			client.Player = map[string]interface{} {}
+		}
+		for key, value := range playerData {
+			client.Player[key] = value
+		}
+	}
+
+	if !response.Success {
+		err = errors.New(summarize(strings.Join(response.Messages, "; ")))
+	}
+	return
+}
+
+// open notification socket, counting messages until closed
+func (client *Client) ConnectSocket() (err error) {
+	start := time.Now()
+	defer func() {
+		client.bot.Stats.Record("/socket/connect", time.Since(start), err)
+	}()
+
+	socketURL := strings.Replace(client.bot.URL, "http", "ws", 1) + "/socket/connect?token=" + url.QueryEscape(client.Token)
+	client.socket, _, err = websocket.DefaultDialer.Dial(socketURL, nil)
+	if err != nil {
+		return
+	}
+
+	go func() {
+		for {
+			if _, _, err := client.socket.ReadMessage(); err != nil {
+				return
+			}
+			client.bot.SocketMessages.Inc()
+		}
+	}()
+	return
+}
+
+func (client *Client) Close() {
+	if client.socket != nil {
+		client.socket.WriteMessage(websocket.CloseMessage, websocket.FormatCloseMessage(websocket.CloseNormalClosure, ""))
+		client.socket.Close()
+	}
+}
+
+// player data value as a number (JSON numbers decode as floats)
+func (client *Client) PlayerInt(name string) int {
+	value, _ := client.Player[name].(float64)
+	return int(value)
+}
+
+// keep error messages short enough to group in the report
+func summarize(message string) string {
+	if message == "" {
+		return "request failed"
+	}
+	if len(message) > 120 {
+		return message[:117] + "..."
+	}
+	return message
+}
@@ -0,0 +1,170 @@
+// Load test bot fleet, run against a local (development) server:
+//
+//	go run ./cmd/loadbot -url http://localhost:5000 -clients 50 -duration 5m -mix match=6,tome=3,store=1
+//
+// Each client connects, logs in with a new device UUID, opens the notification socket and then loops over
+// scenarios picked by weight (match find/result, tome unlock/open/rush, store purchases with debug currency).
+// Debug currency requires a development server (or a user with the debug permission).
+// Latency percentiles and error rates are reported per endpoint when the run ends or is interrupted.
+package main
+
+import (
+	"os"
+	"fmt"
+	"flag"
+	"sync"
+	"time"
+	"strings"
+	"net/http"
+	"os/signal"
+	"math/rand"
+	"sync/atomic"
+	crypto "crypto/rand"
+)
+
+// shared settings and results for all clients
+type Bot struct {
+	URL             string
+	Version         string
+	Platform        string
+	Socket          bool
+	MatchType       string
+	MatchTimeout    time.Duration
+	MatchDuration   time.Duration
+	Think           time.Duration
+	Grant           int
+
+	HTTP            *http.Client
+	Stats           *Stats
+	SocketMessages  Counter
+}
+
+type Counter struct {
+	value           int64
+}
+
+func (counter *Counter) Inc() {
+	atomic.AddInt64(&counter.value, 1)
+}
+
+func (counter *Counter) Value() int64 {
+	return atomic.LoadInt64(&counter.value)
+}
+
+func main() {
+	bot := &Bot {
+		Stats: NewStats(),
+	}
+
+	clients := flag.Int("clients", 10, "Simulated clients")
+	duration := flag.Duration("duration", time.Minute, "Run time (after ramp up)")
+	rampUp := flag.Duration("ramp", 10 * time.Second, "Time over which clients are started")
+	mix := flag.String("mix", "match=6,tome=3,store=1", "Scenario weights (match, tome, store)")
+	flag.StringVar(&bot.URL, "url", "http://localhost:5000", "Server URL")
+	flag.StringVar(&bot.Version, "version", "0.5", "Client version sent to /connect")
+	flag.StringVar(&bot.Platform, "platform", "android", "Client platform sent to /connect")
+	flag.BoolVar(&bot.Socket, "socket", true, "Open a notification socket per client")
+	flag.StringVar(&bot.MatchType, "match-type", "Ranked", "Match type (Unranked, Ranked or Elite)")
+	flag.DurationVar(&bot.MatchTimeout, "match-timeout", 30 * time.Second, "Time to search for a match before giving up")
+	flag.DurationVar(&bot.MatchDuration, "match-duration", 5 * time.Second, "Simulated match length")
+	flag.DurationVar(&bot.Think, "think", time.Second, "Maximum pause between scenarios")
+	flag.IntVar(&bot.Grant, "grant", 10000, "Debug currency granted when a client runs low")
+	flag.Parse()
+
+	scenarios, err := ParseScenarios(*mix)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(2)
+	}
+
+	bot.URL = strings.TrimSuffix(bot.URL, "/")
+	bot.HTTP = &http.Client {
+		Timeout: 30 * time.Second,
+		Transport: &http.Transport {
+			MaxIdleConnsPerHost: *clients,
+		},
+	}
+	rand.Seed(time.Now().UnixNano())
+
+	// stop at the deadline or on interrupt
+	stop := make(chan bool)
+	interrupt := make(chan os.Signal, 1)
+	signal.Notify(interrupt, os.Interrupt)
+	go func() {
+		select {
+		case <-time.After(*rampUp + *duration):
+		case <-interrupt:
+		}
+		close(stop)
+	}()
+
+	fmt.Printf("Running %d clients against %s for %s (ramp up %s)\n", *clients, bot.URL, *duration, *rampUp)
+
+	var group sync.WaitGroup
+	for i := 0; i < *clients; i++ {
+		client := &Client {
+			ID: i,
+			UUID: newDeviceUUID(),
+			bot: bot,
+		}
+
+		group.Add(1)
+		go func(delay time.Duration) {
+			defer group.Done()
+			bot.run(client, scenarios, delay, stop)
+		}(*rampUp * time.Duration(i) / time.Duration(*clients))
+	}
+	group.Wait()
+
+	fmt.Println()
+	bot.Stats.Report(os.Stdout)
+	fmt.Printf("\n%d socket messages received\n", bot.SocketMessages.Value())
+}
+
+func (bot *Bot) run(client *Client, scenarios []Scenario, delay time.Duration, stop chan bool) {
+	defer client.Close()
+
+	select {
+	case <-time.After(delay):
+	case <-stop:
+		return
+	}
+
+	// retry login until it succeeds (e.g. while the server starts up)
+	for login(client) != nil {
+		select {
+		case <-time.After(time.Second):
+		case <-stop:
+			return
+		}
+	}
+
+	for {
+		select {
+		case <-stop:
+			return
+		default:
+		}
+
+		// failures are recorded per request (and per scenario), keep going
+		scenario := pickScenario(scenarios)
+		start := time.Now()
+		err := scenario.Run(client)
+		bot.Stats.Record("[" + scenario.Name + "]", time.Since(start), err)
+
+		if bot.Think > 0 {
+			select {
+			case <-time.After(time.Duration(rand.Int63n(int64(bot.Think)))):
+			case <-stop:
+				return
+			}
+		}
+	}
+}
+
+// random device UUID, so every run creates new users
+func newDeviceUUID() string {
+	raw := make([]byte, 16)
+	crypto.Read(raw)
+	return fmt.Sprintf("loadbot-%x-%x-%x-%x-%x", raw[0:4], raw[4:6], raw[6:8], raw[8:10], raw[10:])
+}
@@ -0,0 +1,236 @@
+package main
+
+import (
+	"fmt"
+	"time"
+	"errors"
+	"strconv"
+	"strings"
+	"net/url"
+	"hash/fnv"
+	"math/rand"
+)
+
+// flow run repeatedly by a logged in client
+type Scenario struct {
+	Name            string
+	Weight          int
+	Run             func(client *Client) error
+}
+
+var scenarios map[string]func(client *Client) error = map[string]func(client *Client) error {
+	"match": playMatch,
+	"tome": openTome,
+	"store": purchaseStoreItem,
+}
+
+// parse scenario mix, e.g. "match=6,tome=3,store=1"
+func ParseScenarios(mix string) (result []Scenario, err error) {
+	for _, entry := range strings.Split(mix, ",") {
+		parts := strings.SplitN(strings.TrimSpace(entry), "=", 2)
+		run, ok := scenarios[parts[0]]
+		if !ok {
+			return nil, errors.New(fmt.Sprintf("Unknown scenario: %s", parts[0]))
+		}
+
+		weight := 1
+		if len(parts) == 2 {
+			if weight, err = strconv.Atoi(parts[1]); err != nil || weight < 0 {
+				return nil, errors.New(fmt.Sprintf("Invalid scenario weight: %s", entry))
+			}
+		}
+		if weight > 0 {
+			result = append(result, Scenario { Name: parts[0], Weight: weight, Run: run })
+		}
+	}
+
+	if len(result) == 0 {
+		err = errors.New("No scenarios to run")
+	}
+	return
+}
+
+func pickScenario(scenarios []Scenario) Scenario {
+	total := 0
+	for _, scenario := range scenarios {
+		total += scenario.Weight
+	}
+
+	pick := rand.Intn(total)
+	for _, scenario := range scenarios {
+		if pick < scenario.Weight {
+			return scenario
+		}
+		pick -= scenario.Weight
+	}
+	return scenarios[len(scenarios) - 1]
+}
+
+// check version, log in with a new device and open the notification socket
+func login(client *Client) (err error) {
+	params := url.Values {}
+	params.Set("version", client.bot.Version)
+	params.Set("platform", client.bot.Platform)
+	if _, err = client.Call("/connect", params); err != nil {
+		return
+	}
+
+	params = url.Values {}
+	params.Set("uuid", client.UUID)
+	if _, err = client.Call("/login", params); err != nil {
+		return
+	}
+	if client.Token == "" {
+		return errors.New("Login responded without a token")
+	}
+
+	if client.bot.Socket {
+		err = client.ConnectSocket()
+	}
+	return
+}
+
+// queue for a public match, then report a result agreed with the opponent
+func playMatch(client *Client) (err error) {
+	params := url.Values {}
+	params.Set("type", client.bot.MatchType)
+
+	// poll until matched
+	var match map[string]interface{}
+	deadline := time.Now().Add(client.bot.MatchTimeout)
+	for match == nil {
+		var response *Response
+		if response, err = client.Call("/match/find", params); err != nil {
+			return
+		}
+		match, _ = response.Data["match"].(map[string]interface{})
+
+		if match == nil {
+			if time.Now().After(deadline) {
+				_, err = client.Call("/match/clear", nil)
+				return
+			}
+			time.Sleep(time.Second)
+		}
+	}
+
+	roomID, _ := match["roomId"].(string)
+	hosting, _ := match["hosting"].(bool)
+
+	// play
+	time.Sleep(client.bot.MatchDuration)
+
+	// both players derive the winner from the room
+	hash := fnv.New32a()
+	hash.Write([]byte(roomID))
+	hostWins := hash.Sum32() % 2 == 0
+
+	outcome, playerScore, opponentScore := "-1", "1", "3"
+	if hosting == hostWins {
+		outcome, playerScore, opponentScore = "1", "3", "1"
+	}
+
+	params = url.Values {}
+	params.Set("roomId", roomID)
+	params.Set("outcome", outcome)
+	params.Set("playerScore", playerScore)
+	params.Set("opponentScore", opponentScore)
+	_, err = client.Call("/match/result", params)
+	return
+}
+
+// open an unlocked tome, otherwise rush an unlocking tome or start unlocking a locked one
+func openTome(client *Client) (err error) {
+	tomes, _ := client.Player["tomes"].([]interface{})
+
+	locked, unlocking, unlocked := -1, -1, -1
+	for index, value := range tomes {
+		tome, _ := value.(map[string]interface{})
+		if id, _ := tome["tomeId"].(string); id == "" || id == "INVALID" {
+			continue
+		}
+
+		remaining, _ := tome["unlockTime"].(float64)
+		switch tome["state"] {
+		case "Locked":
+			if locked < 0 {
+				locked = index
+			}
+		case "Unlocking":
+			if remaining > 0 {
+				unlocking = index
+			} else if unlocked < 0 {
+				unlocked = index
+			}
+		case "Unlocked":
+			if unlocked < 0 {
+				unlocked = index
+			}
+		}
+	}
+
+	params := url.Values {}
+	switch {
+	case unlocked >= 0:
+		params.Set("tomeId", strconv.Itoa(unlocked))
+		_, err = client.Call("/tome/open", params)
+
+	case unlocking >= 0:
+		if err = client.grant("Premium"); err != nil {
+			return
+		}
+		params.Set("tomeId", strconv.Itoa(unlocking))
+		_, err = client.Call("/tome/rush", params)
+
+	case locked >= 0:
+		params.Set("tomeId", strconv.Itoa(locked))
+		_, err = client.Call("/tome/unlock", params)
+	}
+	return
+}
+
+// buy a random standard or premium currency offer, granting debug currency to afford it
+func purchaseStoreItem(client *Client) (err error) {
+	response, err := client.Call("/store/offers", nil)
+	if err != nil {
+		return
+	}
+
+	var offers []map[string]interface{}
+	items, _ := response.Data["storeItems"].([]interface{})
+	for _, value := range items {
+		item, _ := value.(map[string]interface{})
+		currency, _ := item["currency"].(string)
+		available, _ := item["numAvailable"].(float64)
+		if (currency == "Standard" || currency == "Premium") && available != 0 {
+			offers = append(offers, item)
+		}
+	}
+	if len(offers) == 0 {
+		return
+	}
+
+	offer := offers[rand.Intn(len(offers))]
+	currency := offer["currency"].(string)
+	if err = client.grant(currency); err != nil {
+		return
+	}
+
+	params := url.Values {}
+	params.Set("id", fmt.Sprintf("%v", offer["id"]))
+	_, err = client.Call("/purchase", params)
+	return
+}
+
+// top up debug currency ("Standard" or "Premium") when below the grant amount
+func (client *Client) grant(currency string) (err error) {
+	balance := client.PlayerInt(strings.ToLower(currency) + "Currency")
+	if balance >= client.bot.Grant {
+		return
+	}
+
+	params := url.Values {}
+	params.Set("amount", strconv.Itoa(client.bot.Grant))
+	_, err = client.Call("/debug/add" + currency + "Currency", params)
+	return
+}
@@ -0,0 +1,140 @@
+package main
+
+import (
+	"io"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+	"strings"
+)
+
+// latency samples and errors per endpoint
+type Stats struct {
+	mutex           sync.Mutex
+	endpoints       map[string]*endpointStats
+	started         time.Time
+}
+
+type endpointStats struct {
+	durations       []time.Duration
+	errors          int
+	messages        map[string]int
+}
+
+func NewStats() *Stats {
+	return &Stats {
+		endpoints: map[string]*endpointStats {},
+		started: time.Now(),
+	}
+}
+
+func (stats *Stats) Record(endpoint string, duration time.Duration, err error) {
+	stats.mutex.Lock()
+	defer stats.mutex.Unlock()
+
+	entry, ok := stats.endpoints[endpoint]
+	if !ok {
+		entry = &endpointStats {
+			messages: map[string]int {},
+		}
+		stats.endpoints[endpoint] = entry
+	}
+
+	entry.durations = append(entry.durations, duration)
+	if err != nil {
+		entry.errors++
+		entry.messages[err.Error()]++
+	}
+}
+
+// duration at percentile of sorted durations
+func percentile(durations []time.Duration, percent float64) time.Duration {
+	if len(durations) == 0 {
+		return 0
+	}
+	index := int(float64(len(durations)) * percent / 100 + 0.5) - 1
+	if index < 0 {
+		index = 0
+	}
+	if index >= len(durations) {
+		index = len(durations) - 1
+	}
+	return durations[index]
+}
+
+func milliseconds(duration time.Duration) string {
+	return fmt.Sprintf("%.1f", float64(duration) / float64(time.Millisecond))
+}
+
+// write table of request counts, error rates and latency percentiles (ms), then the most common errors
+func (stats *Stats) Report(writer io.Writer) {
+	stats.mutex.Lock()
+	defer stats.mutex.Unlock()
+
+	elapsed := time.Since(stats.started)
+
+	names := make([]string, 0, len(stats.endpoints))
+	for name, _ := range stats.endpoints {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	total, totalErrors := 0, 0
+	fmt.Fprintf(writer, "%-28s %8s %8s %7s %8s %8s %8s %8s\n", "endpoint", "requests", "errors", "error%", "p50", "p90", "p99", "max")
+	for _, name := range names {
+		endpoint := stats.endpoints[name]
+
+		durations := append([]time.Duration {}, endpoint.durations...)
+		sort.Slice(durations, func(i, j int) bool {
+			return durations[i] < durations[j]
+		})
+
+		// scenario rows ("[match]") span several requests, keep them out of the totals
+		count := len(durations)
+		if !strings.HasPrefix(name, "[") {
+			total += count
+			totalErrors += endpoint.errors
+		}
+
+		fmt.Fprintf(writer, "%-28s %8d %8d %6.2f%% %8s %8s %8s %8s\n",
+			name,
+			count,
+			endpoint.errors,
+			100 * float64(endpoint.errors) / float64(count),
+			milliseconds(percentile(durations, 50)),
+			milliseconds(percentile(durations, 90)),
+			milliseconds(percentile(durations, 99)),
+			milliseconds(percentile(durations, 100)))
+	}
+
+	errorRate := 0.0
+	if total > 0 {
+		errorRate = 100 * float64(totalErrors) / float64(total)
+	}
+	fmt.Fprintf(writer, "\n%d requests in %s (%.1f/s), %d errors (%.2f%%)\n", total, elapsed.Round(time.Second), float64(total) / elapsed.Seconds(), totalErrors, errorRate)
+
+	// most common errors per endpoint
+	for _, name := range names {
+		endpoint := stats.endpoints[name]
+		if len(endpoint.messages) == 0 {
+			continue
+		}
+
+		messages := make([]string, 0, len(endpoint.messages))
+		for message, _ := range endpoint.messages {
+			messages = append(messages, message)
+		}
+		sort.Slice(messages, func(i, j int) bool {
+			return endpoint.messages[messages[i]] > endpoint.messages[messages[j]]
+		})
+		if len(messages) > 3 {
+			messages = messages[:3]
+		}
+
+		fmt.Fprintf(writer, "\n%s errors:\n", name)
+		for _, message := range messages {
+			fmt.Fprintf(writer, "  %6d  %s\n", endpoint.messages[message], message)
+		}
+	}
+}
@@ -4,9 +4,16 @@ import (
 	"time"
 	"fmt"
 	"os"
+	"bytes"
+	"errors"
 	"strconv"
+	"strings"
+	"reflect"
 	"io/ioutil"
+	"path/filepath"
 	"encoding/json"
+
+	"bloodtales/log"
 )
 
 type LogLevel string
@@ -16,66 +23,453 @@ const (
 	FullLogging = "FullLogging"
 )
 
+// environment variable override prefix (e.g. CONFIG_AUTHENTICATION_TOKENSECRET)
+const EnvPrefix = "CONFIG_"
+
+// replacement for secret values in logs
+const Redacted = "[REDACTED]"
+
+// prefix of the placeholder secrets committed in config.development.json
+const DevelopmentSecretPrefix = "dev-only-"
+
+// duration configured as seconds (number) or a duration string (e.g. "1h30m")
+type Duration struct {
+	time.Duration
+}
+
 type LoggingConfiguration struct {
 		Requests            LogLevel
+		Format              string           // console or json
+		Level               string           // debug, info, warning or error
+		Sampling            map[string]int   // log 1 in N messages for noisy keys (e.g. socket)
 }
 
-type Configuration struct {
-	Platform struct {
-		Version             string
-	}
-	Authentication struct {
-		TokenSecret         string
-		TokenExpiration     time.Duration    `json:"TokenExpiration,int"`
+type AuthenticationConfiguration struct {
+	TokenSecret         string           `config:"required,secret"`
+	TokenExpiration     Duration
 
-		DebugToken          string
+	DebugToken          string           `config:"secret"`
 
-		AdminUsername       string
-		AdminPassword       string
+	AdminUsername       string           `config:"required"`
+	AdminPassword       string           `config:"required,secret"`
 
-		OAuthID             string
-		OAuthSecret         string
-		OAuthStateToken     string
-	}
-	Sessions struct {
-		CookieSecret        string
-		OfflineTimeout      time.Duration    `json:"OfflineTimeout,int"`
-	}
+	OAuthID             string
+	OAuthSecret         string           `config:"secret"`
+	OAuthStateToken     string           `config:"secret"`
+}
+
+type CredentialsConfiguration struct {
+	GoogleKeysURL       string
+	GoogleIssuers       []string
+	GoogleClientIDs     []string
+
+	AppleKeysURL        string
+	AppleIssuer         string
+	AppleClientIDs      []string
+
+	GameCenterKeyURLs   []string
+	GameCenterBundleIDs []string
+	GameCenterMaxAge    Duration
+
+	KeysExpiration      Duration
+	KeysRefetchInterval Duration         // least time between fetches of a key set for unknown key IDs
+}
+
+type SessionsConfiguration struct {
+	CookieSecret        string           `config:"required,secret"`
+	OfflineTimeout      Duration
+}
+
+type MatchesConfiguration struct {
+	MatchTicketExpire   Duration
+	MatchResultExpire   Duration
+	MaxMMRDeltas        []int
+}
+
+type ReplaysConfiguration struct {
+	MaxSize             int              // largest accepted replay data (bytes, 0 for no limit)
+	InlineLimit         int              // compressed bytes stored in the replay document, larger go to GridFS
+	UserLimit           int              // replays kept per user, oldest removed first (0 for no limit)
+	UserQuota           int              // compressed bytes kept per user (0 for no limit)
+	Retention           Duration         // age at which replays expire (0 keeps them)
+	KeepTop             int              // highest ranked replays which never expire
+}
+
+type LeaderboardsConfiguration struct {
+	RebuildBatchSize    int              // players read and written per rebuild batch
+	RebuildBatchDelay   Duration         // pause between rebuild batches (throttling)
+}
+
+type SeasonLeagueConfiguration struct {
+	RankPoints          int              // soft reset target for rank points
+	RankPointsKeep      float64          // fraction of rank points above the target kept at rollover
+	Rating              int              // soft reset target for rating
+	RatingKeep          float64          // fraction of rating above the target kept at rollover
+	Reward              string           // reward data ID granted when claimed (optional)
+	StandardCurrency    int
+	PremiumCurrency     int
+}
+
+type SeasonsConfiguration struct {
+	Leagues             []SeasonLeagueConfiguration // by final league tier, the last applies to higher tiers
+}
+
+type GuildDonationConfiguration struct {
+	Rarity              string           // card rarity (e.g. COMMON)
+	RequestCopies       int              // copies a card request asks for
+	DonationCopies      int              // copies one member may donate to a request
+	RequestCooldown     Duration         // between a member's requests of this rarity
+	StandardCurrency    int              // donor reward per copy
+	XP                  int              // donor XP per copy
+}
+
+type GuildsConfiguration struct {
+	MatchXP             int              // guild XP per completed member match
+	WinXP               int              // additional guild XP per member win
+	QuestXP             int              // guild XP per collected member quest
+	DonationXP          int              // guild XP per donated copy
+	WinRating           int              // guild rating gained per member win
+	LossRating          int              // guild rating lost per member loss (rating stays at 0 or above)
+
+	RequestDuration     Duration         // how long card requests stay open
+	DonationTimeout     Duration         // pending donations older than this are recovered as interrupted
+	Donations           []GuildDonationConfiguration // rarities which can be requested
+}
+
+type GuildWarRewardConfiguration struct {
+	Reward              string           // reward data ID granted when claimed (optional)
+	StandardCurrency    int
+	PremiumCurrency     int
+}
+
+type GuildWarsConfiguration struct {
+	MinMembers          int              // members a guild needs to be paired
+	MaxRatingGap        int              // largest rating difference between paired guilds (0 for no limit)
+	WinScore            int              // war score per battle won
+	DrawScore           int              // war score per battle drawn (for both guilds)
+	MaxPlayerBattles    int              // battles scored per player in a war (0 for no limit)
+	MaxOpponentBattles  int              // battles scored per player against the same opponent (0 for no limit)
+	MinClaimBattles     int              // scored battles a participant needs to claim a reward
+	WinRating           int              // guild rating for winning a war
+	WinXP               int              // guild XP for winning a war
+	Win                 GuildWarRewardConfiguration // participants' rewards by war outcome
+	Draw                GuildWarRewardConfiguration
+	Loss                GuildWarRewardConfiguration
+}
+
+type PlatformConfiguration struct {
+	Version             string            `config:"required"`
+	MinimumVersions     map[string]string // oldest supported client version per platform (defaults to Version)
+	StoreURLs           map[string]string // where clients are sent to update, per platform
+}
+
+type ServerConfiguration struct {
+	ShutdownDelay       Duration         // readiness fails for this long before the listener closes, so load balancers stop routing
+	ShutdownTimeout     Duration
+	MetricsToken        string           `config:"secret"`
+	GzipThreshold       int              // minimum API response bytes to compress (0 disables)
+}
+
+type Configuration struct {
+	Platform            PlatformConfiguration
+	Server              ServerConfiguration
+	Authentication      AuthenticationConfiguration
+	Credentials         CredentialsConfiguration
+	Sessions            SessionsConfiguration
 	Logging struct {
 		Production          LoggingConfiguration
 		Development         LoggingConfiguration
 	}
-	Matches struct {
-		MatchTicketExpire   int
-		MatchResultExpire   int
-		MaxMMRDeltas        []int
-	}
+	Matches             MatchesConfiguration
+	Replays             ReplaysConfiguration
+	Seasons             SeasonsConfiguration
+	Leaderboards        LeaderboardsConfiguration
+	Guilds              GuildsConfiguration
+	Wars                GuildWarsConfiguration
 }
 
 type Environment struct {
 	Name                    string
 	Development             bool
+	Test                    bool     // running as a test binary (go test)
 }
 
 var Config Configuration
 var Env Environment
 
+var (
+	// internal
+	durationType reflect.Type = reflect.TypeOf(Duration {})
+)
+
+// load a configuration file layer over existing values, rejecting unknown keys
 func Load(path string, config *Configuration) (err error) {
 	file, err := ioutil.ReadFile(path)
 	if err != nil {
 		return
 	}
 
-	err = json.Unmarshal(file, config)
+	decoder := json.NewDecoder(bytes.NewReader(file))
+	decoder.DisallowUnknownFields()
+	if err = decoder.Decode(config); err != nil {
+		err = errors.New(fmt.Sprintf("%s: %v", path, err))
+	}
 	return
 }
 
-func init() {
-	// load config
-	configPath := "./config.json"
-	err := Load(configPath, &Config)
+// load an optional configuration file layer
+func LoadOptional(path string, config *Configuration) (loaded bool, err error) {
+	if _, err = os.Stat(path); os.IsNotExist(err) {
+		return false, nil
+	}
+
+	return true, Load(path, config)
+}
+
+// apply environment variable overrides (CONFIG_<SECTION>_<FIELD>), rejecting unknown variables
+func LoadEnvironment(environ []string, config *Configuration) (err error) {
+	// gather overrides
+	overrides := map[string]string {}
+	for _, variable := range environ {
+		if !strings.HasPrefix(variable, EnvPrefix) {
+			continue
+		}
+
+		parts := strings.SplitN(variable, "=", 2)
+		if len(parts) == 2 {
+			overrides[parts[0]] = parts[1]
+		}
+	}
+
+	// apply matching overrides
+	walkConfiguration(config, func(path []string, field reflect.StructField, value reflect.Value) {
+		name := EnvPrefix + strings.ToUpper(strings.Join(path, "_"))
+		raw, ok := overrides[name]
+		if !ok || err != nil {
+			return
+		}
+		delete(overrides, name)
+
+		if parseErr := json.Unmarshal(environmentToJSON(raw, value.Type()), value.Addr().Interface()); parseErr != nil {
+			err = errors.New(fmt.Sprintf("%s: %v", name, parseErr))
+		}
+	})
 	if err != nil {
-		panic(fmt.Sprintf("Config file (%s) failed to load: %v", configPath, err))
+		return
+	}
+
+	for name, _ := range overrides {
+		return errors.New(fmt.Sprintf("Unknown configuration environment variable: %s", name))
+	}
+	return
+}
+
+// convert an environment variable value to JSON for the field type
+func environmentToJSON(raw string, fieldType reflect.Type) []byte {
+	switch {
+	case fieldType == durationType:
+		if _, err := strconv.ParseFloat(raw, 64); err == nil {
+			return []byte(raw)
+		}
+
+	case fieldType.Kind() == reflect.Slice:
+		// comma separated list
+		values := []interface{} {}
+		for _, value := range strings.Split(raw, ",") {
+			value = strings.TrimSpace(value)
+			if value == "" {
+				continue
+			}
+			if fieldType.Elem().Kind() == reflect.String {
+				values = append(values, value)
+			} else {
+				values = append(values, json.RawMessage(value))
+			}
+		}
+		encoded, _ := json.Marshal(values)
+		return encoded
+
+	case fieldType.Kind() != reflect.String:
+		return []byte(raw)
+	}
+
+	encoded, _ := json.Marshal(raw)
+	return encoded
+}
+
+// check all required fields are set, and production does not run on development secrets
+func (config *Configuration) Validate() (err error) {
+	missing := []string {}
+	placeholders := []string {}
+	walkConfiguration(config, func(path []string, field reflect.StructField, value reflect.Value) {
+		if hasConfigTag(field, "required") && isZero(value) {
+			missing = append(missing, strings.Join(path, "."))
+		}
+		if !Env.Development && hasConfigTag(field, "secret") && value.Kind() == reflect.String && strings.HasPrefix(value.String(), DevelopmentSecretPrefix) {
+			placeholders = append(placeholders, strings.Join(path, "."))
+		}
+	})
+
+	if len(missing) > 0 {
+		err = errors.New(fmt.Sprintf("Missing required configuration: %s", strings.Join(missing, ", ")))
+	} else if len(placeholders) > 0 {
+		err = errors.New(fmt.Sprintf("Development secrets in production configuration: %s", strings.Join(placeholders, ", ")))
+	}
+	return
+}
+
+// get configuration as JSON, with secrets redacted
+func (config *Configuration) Redacted() string {
+	redacted := *config
+	walkConfiguration(&redacted, func(path []string, field reflect.StructField, value reflect.Value) {
+		if hasConfigTag(field, "secret") && value.Kind() == reflect.String && value.String() != "" {
+			value.SetString(Redacted)
+		}
+	})
+
+	raw, err := json.Marshal(&redacted)
+	if err != nil {
+		return fmt.Sprintf("(%v)", err)
+	}
+	return string(raw)
+}
+
+// get oldest supported client version for a platform
+func (platform *PlatformConfiguration) GetMinimumVersion(name string) string {
+	if version, ok := platform.MinimumVersions[strings.ToLower(name)]; ok && version != "" {
+		return version
+	}
+	return platform.Version
+}
+
+func (platform *PlatformConfiguration) GetStoreURL(name string) string {
+	return platform.StoreURLs[strings.ToLower(name)]
+}
+
+// season rollover rules for a final league tier
+func (seasons *SeasonsConfiguration) GetLeague(tier int) SeasonLeagueConfiguration {
+	if len(seasons.Leagues) == 0 {
+		return SeasonLeagueConfiguration { RankPointsKeep: 1, RatingKeep: 1 }
+	}
+	if tier < 0 {
+		tier = 0
+	}
+	if tier >= len(seasons.Leagues) {
+		tier = len(seasons.Leagues) - 1
+	}
+	return seasons.Leagues[tier]
+}
+
+// donation rules of a card rarity (nil when the rarity cannot be requested)
+func (guilds *GuildsConfiguration) GetDonation(rarity string) *GuildDonationConfiguration {
+	for i, donation := range guilds.Donations {
+		if donation.Rarity == rarity {
+			return &guilds.Donations[i]
+		}
+	}
+	return nil
+}
+
+func (config *Configuration) GetLogging() (logging *LoggingConfiguration) {
+	if Env.Development {
+		return &config.Logging.Development;
+	} else {
+		return &config.Logging.Production;
+	}
+}
+
+// get logger options for the current environment
+func (logging *LoggingConfiguration) GetOptions() (options log.Options, err error) {
+	options.Sampling = logging.Sampling
+
+	if options.Format, err = log.ParseFormat(logging.Format); err != nil {
+		return
+	}
+	options.Level, err = log.ParseLevel(logging.Level)
+	return
+}
+
+func (duration *Duration) UnmarshalJSON(raw []byte) (err error) {
+	var value interface{}
+	if err = json.Unmarshal(raw, &value); err != nil {
+		return
+	}
+
+	switch value := value.(type) {
+	case float64:
+		duration.Duration = time.Duration(value * float64(time.Second))
+	case string:
+		duration.Duration, err = time.ParseDuration(value)
+	default:
+		err = errors.New(fmt.Sprintf("Invalid duration: %s", raw))
+	}
+	return
+}
+
+func (duration Duration) MarshalJSON() ([]byte, error) {
+	return json.Marshal(duration.String())
+}
+
+// call handler for every leaf field with its path
+func walkConfiguration(config *Configuration, handler func(path []string, field reflect.StructField, value reflect.Value)) {
+	walkStruct(reflect.ValueOf(config).Elem(), []string {}, handler)
+}
+
+func walkStruct(value reflect.Value, path []string, handler func(path []string, field reflect.StructField, value reflect.Value)) {
+	for i := 0; i < value.NumField(); i++ {
+		field := value.Type().Field(i)
+		fieldValue := value.Field(i)
+		fieldPath := append(append([]string {}, path...), field.Name)
+
+		if field.Type.Kind() == reflect.Struct && field.Type != durationType {
+			walkStruct(fieldValue, fieldPath, handler)
+		} else {
+			handler(fieldPath, field, fieldValue)
+		}
+	}
+}
+
+func hasConfigTag(field reflect.StructField, name string) bool {
+	for _, tag := range strings.Split(field.Tag.Get("config"), ",") {
+		if tag == name {
+			return true
+		}
+	}
+	return false
+}
+
+func isZero(value reflect.Value) bool {
+	return reflect.DeepEqual(value.Interface(), reflect.Zero(value.Type()).Interface())
+}
+
+// move to the nearest directory holding the base config (test binaries start in their package directory)
+func changeToServerDirectory() (err error) {
+	directory, err := os.Getwd()
+	if err != nil {
+		return
+	}
+
+	for {
+		if _, err = os.Stat(filepath.Join(directory, "config.json")); err == nil {
+			return os.Chdir(directory)
+		}
+
+		parent := filepath.Dir(directory)
+		if parent == directory {
+			return errors.New("Server directory not found")
+		}
+		directory = parent
+	}
+}
+
+func init() {
+	// test binaries load the server directory's files and default to development
+	Env.Test = strings.HasSuffix(os.Args[0], ".test")
+	if Env.Test {
+		if err := changeToServerDirectory(); err != nil {
+			panic(fmt.Sprintf("Config failed to load for tests: %v", err))
+		}
+		Env.Development = true
 	}
 
 	// initialize environment
@@ -89,12 +483,41 @@ func init() {
 	} else {
 		Env.Name = "Production"
 	}
-}
 
-func (config *Configuration) GetLogging() (logging *LoggingConfiguration) {
-	if Env.Development {
-		return &config.Logging.Development;
-	} else {
-		return &config.Logging.Production;
+	// load config layers: base, environment, environment variables, secrets
+	configPath := "./config.json"
+	if err = Load(configPath, &Config); err != nil {
+		panic(fmt.Sprintf("Config file (%s) failed to load: %v", configPath, err))
 	}
-}
\ No newline at end of file
+
+	envConfigPath := fmt.Sprintf("./config.%s.json", strings.ToLower(Env.Name))
+	if _, err = LoadOptional(envConfigPath, &Config); err != nil {
+		panic(fmt.Sprintf("Config file (%s) failed to load: %v", envConfigPath, err))
+	}
+
+	if err = LoadEnvironment(os.Environ(), &Config); err != nil {
+		panic(fmt.Sprintf("Config environment failed to load: %v", err))
+	}
+
+	secretsPath := os.Getenv("SECRETS_PATH")
+	if secretsPath == "" {
+		secretsPath = "./secrets.json"
+	}
+	if _, err = LoadOptional(secretsPath, &Config); err != nil {
+		panic(fmt.Sprintf("Secrets file (%s) failed to load: %v", secretsPath, err))
+	}
+
+	// validate
+	if err = Config.Validate(); err != nil {
+		panic(fmt.Sprintf("Config is invalid: %v", err))
+	}
+
+	// configure logger
+	logOptions, err := Config.GetLogging().GetOptions()
+	if err != nil {
+		panic(fmt.Sprintf("Config is invalid: %v", err))
+	}
+	log.Configure(logOptions)
+
+	log.Printf("[cyan]Configuration loaded (%s): %s[-]", Env.Name, Config.Redacted())
+}
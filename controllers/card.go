@@ -14,9 +14,20 @@ import (
 )
 
 func handleCard() {
-	handleGameAPI("/card/upgrade", system.TokenAuthentication, UpgradeCard)
-	handleGameAPI("/card/craft", system.TokenAuthentication, CraftCard)
-	handleGameAPI("/card/viewed", system.TokenAuthentication, OnCardViewed)
+	handleGameAPI("/card/upgrade", system.TokenAuthentication, UpgradeCard).Describe("Upgrade a card").Params(
+		system.Required("cardId", util.StringParam, "Card data ID"),
+	).Returns(
+		system.Data("card", "object", "Upgraded card"),
+	)
+	handleGameAPI("/card/craft", system.TokenAuthentication, CraftCard).Describe("Craft a card from other cards").Params(
+		system.Required("rarity", util.StringParam, "Rarity of card to craft"),
+		system.Required("cards", util.JSONParam, "Cards consumed (JSON object of card data ID to count)"),
+	).Returns(
+		system.Data("reward", "object", "Crafted card reward"),
+	)
+	handleGameAPI("/card/viewed", system.TokenAuthentication, OnCardViewed).Describe("Mark a card as viewed").Params(
+		system.Required("cardId", util.StringParam, "Card data ID"),
+	)
 }
 
 func UpgradeCard(context *util.Context) {
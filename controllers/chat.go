@@ -11,7 +11,10 @@ import (
 )
 
 func handleChat() {
-	handleGameAPI("/chat", system.TokenAuthentication, Chat)
+	handleGameAPI("/chat", system.TokenAuthentication, Chat).Describe("Send a chat message").Params(
+		system.Optional("channel", util.StringParam, nil, "Chat channel"),
+		system.Required("message", util.StringParam, "Message"),
+	)
 }
 
 func sendChatNotification(context *util.Context, channel string, message string) {
@@ -67,5 +70,10 @@ func Chat(context *util.Context) {
 	channel := context.Params.GetString("channel", "")
 	message := context.Params.GetRequiredString("message")
 
+	// muted players cannot chat
+	if !system.RequireNoSanction(context, models.SanctionChatMute) {
+		return
+	}
+
 	sendChatNotification(context, channel, message)
 }
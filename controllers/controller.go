@@ -18,27 +18,42 @@ func HandleGame() {
 	handleStore()
 	handleFriends()
 	handleGuild()
+	handleWar()
 	handleTutorial()
 	handleChat()
 	handleReplay()
+	handleSeason()
+	handleLeaderboard()
 	handleTracking()
 	handleDebug()
 }
 
-func handleGameAPI(pattern string, authType system.AuthenticationType, handler func(*util.Context)) {
-	// all template requests start here
-	system.App.HandleAPI(pattern, authType, func(context *util.Context) {
-		handler(context)
+// game routes, with player data deltas added to every response
+var gameRoutes *system.RouteGroup = system.App.Group("", playerDataMiddleware)
 
-		// handle player data deltas
-		player := GetPlayer(context)
-		if player != nil {
-			playerData := player.MarshalDirty(context)
+func handleGameAPI(pattern string, authType system.AuthenticationType, handler func(*util.Context)) *system.Route {
+	return gameRoutes.HandleAPI(pattern, authType, handler).Returns(
+		system.Data("playerData", "object", "Changed player data (authenticated requests)"),
+		system.Data("playerDataMask", "integer", "Changed player data flags"),
+	)
+}
+
+func playerDataMiddleware(context *util.Context, next func(*util.Context)) {
+	next(context)
+
+	// only authenticated requests have a player
+	if !context.UserID.Valid() {
+		return
+	}
+
+	// handle player data deltas
+	player := GetPlayer(context)
+	if player != nil {
+		playerData := player.MarshalDirty(context)
 
-			if playerData != nil {
-				context.SetData("playerData", playerData)
-				context.SetData("playerDataMask", player.DirtyMask)
-			}
+		if playerData != nil {
+			context.SetData("playerData", playerData)
+			context.SetData("playerDataMask", player.DirtyMask)
 		}
-	})
+	}
 }
@@ -0,0 +1,33 @@
+package controllers
+
+import (
+	"testing"
+	"net/http/httptest"
+
+	"bloodtales/models"
+	"bloodtales/system"
+	"bloodtales/util"
+)
+
+// request context on emptied memory storage, authenticated as a new player
+func newTestContext(t *testing.T) (*util.Context, *models.Player) {
+	models.ResetMemoryStorage()
+
+	request := httptest.NewRequest("POST", "/", nil)
+	context := util.CreateContext(httptest.NewRecorder(), request)
+
+	user, err := models.InsertUserWithDevice(context, util.GenerateUUID(), nil)
+	if err != nil {
+		t.Fatalf("Failed to insert user: %v", err)
+	}
+	system.SetUser(context, user)
+
+	player, err := models.CreatePlayer(user.ID, false)
+	if err != nil {
+		t.Fatalf("Failed to create player: %v", err)
+	}
+	if err = player.Save(context); err != nil {
+		t.Fatalf("Failed to save player: %v", err)
+	}
+	return context, player
+}
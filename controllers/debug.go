@@ -1,6 +1,9 @@
 package controllers 
 
 import(
+	"strings"
+
+	"bloodtales/config"
 	"bloodtales/system"
 	"bloodtales/util"
 	"bloodtales/data"
@@ -8,14 +11,50 @@ import(
 )
 
 func handleDebug() {
-	handleGameAPI("/debug/addTome", system.TokenAuthentication, DebugAddTome)
-	handleGameAPI("/debug/addVictoryTome", system.TokenAuthentication, DebugAddNextVictoryTome)
-	handleGameAPI("/debug/addCards", system.TokenAuthentication, DebugAddCards)
-	handleGameAPI("/debug/addPremiumCurrency", system.TokenAuthentication, DebugAddPremiumCurrency)
-	handleGameAPI("/debug/addStandardCurrency", system.TokenAuthentication, DebugAddStandardCurrency)
-	handleGameAPI("/debug/setRank", system.TokenAuthentication, DebugSetRank)
-	handleGameAPI("/debug/refreshStore", system.TokenAuthentication, DebugRefreshStore)
-	handleGameAPI("/debug/clearStoreHistory", system.TokenAuthentication, DebugClearStoreHistory)
+	handleDebugAPI("/debug/addTome", DebugAddTome).Params(
+		system.Required("tomeId", util.StringParam, "Tome data ID"),
+	)
+	handleDebugAPI("/debug/addVictoryTome", DebugAddNextVictoryTome).Params(
+		system.Required("winCount", util.IntParam, "Win count"),
+	)
+	handleDebugAPI("/debug/addCards", DebugAddCards).Params(
+		system.Required("cardId", util.StringParam, "Card data ID"),
+		system.Required("count", util.IntParam, "Number of cards"),
+	)
+	handleDebugAPI("/debug/addPremiumCurrency", DebugAddPremiumCurrency).Params(
+		system.Required("amount", util.IntParam, "Amount"),
+	)
+	handleDebugAPI("/debug/addStandardCurrency", DebugAddStandardCurrency).Params(
+		system.Required("amount", util.IntParam, "Amount"),
+	)
+	handleDebugAPI("/debug/setRank", DebugSetRank).Params(
+		system.Required("stars", util.IntParam, "Rank stars"),
+	)
+	handleDebugAPI("/debug/refreshStore", DebugRefreshStore)
+	handleDebugAPI("/debug/clearStoreHistory", DebugClearStoreHistory)
+}
+
+// debug endpoints are open in development, otherwise restricted to users with the debug permission
+func handleDebugAPI(pattern string, handler func(*util.Context)) *system.Route {
+	action := strings.Replace(strings.TrimPrefix(pattern, "/"), "/", ".", -1)
+
+	return handleGameAPI(pattern, system.TokenAuthentication, func(context *util.Context) {
+		user := system.GetUser(context)
+		if !config.Env.Development && (user == nil || !user.HasPermission(models.PermissionDebug)) {
+			context.Fail("Debug endpoints are not available")
+			return
+		}
+
+		// audit every debug grant, with changes made to player
+		player := GetPlayer(context)
+		before := models.AuditSnapshot(player)
+
+		handler(context)
+
+		if context.Success && player != nil {
+			util.Must(models.InsertAudit(context, user, action, "player", player.ID, player.Name, before, models.AuditSnapshot(player)))
+		}
+	}).Describe("Debug: " + action).Internal()
 }
 
 func DebugAddTome(context *util.Context) {
@@ -8,9 +8,16 @@ import (
 )
 
 func handleDeck() {
-	handleGameAPI("/deck/setLeader", system.TokenAuthentication, SetLeaderCard)
-	handleGameAPI("/deck/setCard", system.TokenAuthentication, SetDeckCard)
-	handleGameAPI("/deck/switch", system.TokenAuthentication, SwitchDeck)
+	handleGameAPI("/deck/setLeader", system.TokenAuthentication, SetLeaderCard).Describe("Set leader card of current deck").Params(
+		system.Required("cardId", util.StringParam, "Card data ID"),
+	)
+	handleGameAPI("/deck/setCard", system.TokenAuthentication, SetDeckCard).Describe("Set a card in current deck").Params(
+		system.Required("cardId", util.StringParam, "Card data ID"),
+		system.Required("index", util.IntParam, "Deck slot index"),
+	)
+	handleGameAPI("/deck/switch", system.TokenAuthentication, SwitchDeck).Describe("Switch current deck").Params(
+		system.Required("currentDeck", util.IntParam, "Deck index"),
+	)
 }
 
 func SetLeaderCard(context *util.Context) {
@@ -13,9 +13,17 @@ import (
 )
 
 func handleFriends() {
-	handleGameAPI("/friends/get", system.TokenAuthentication, GetFriends)
-	handleGameAPI("/friends/add", system.TokenAuthentication, FriendRequest)
-	handleGameAPI("/friends/battle", system.TokenAuthentication, FriendBattle)
+	handleGameAPI("/friends/get", system.TokenAuthentication, GetFriends).Describe("Get friends").Returns(
+		system.Data("friends", "array", "Friends"),
+	)
+	handleGameAPI("/friends/add", system.TokenAuthentication, FriendRequest).Describe("Send a friend request").Params(
+		system.Required("tag", util.StringParam, "Player tag"),
+	)
+	handleGameAPI("/friends/battle", system.TokenAuthentication, FriendBattle).Describe("Challenge a friend to a battle").Params(
+		system.Required("tag", util.StringParam, "Friend player tag"),
+	).Returns(
+		system.Data("roomId", "string", "Match room ID"),
+	)
 }
 
 func sendFriendNotification(context *util.Context, tag string, notificationType string, image string, message string, acceptName string, acceptAction string, declineName string, declineAction string, data map[string]interface{}, expiresAt time.Time) {
@@ -87,10 +95,8 @@ func GetFriends(context *util.Context) {
 
 	if friends != nil {
 		// get friend players
-		var friendPlayers []*models.Player
-		util.Must(context.DB.C(models.PlayerCollectionName).Find(bson.M {
-			"_id": bson.M { "$in": friends.FriendIDs, },
-		}).All(&friendPlayers))
+		friendPlayers, err := models.GetPlayersByIds(context, friends.FriendIDs)
+		util.Must(err)
 
 		// create client array
 		for _, friendPlayer := range friendPlayers {
@@ -144,6 +150,11 @@ func FriendBattle(context *util.Context) {
 	// parse parameters
 	tag := context.Params.GetRequiredString("tag")
 
+	// matchmaking banned players cannot battle
+	if !system.RequireNoSanction(context, models.SanctionMatchmakingBan) {
+		return
+	}
+
 	// generate Room ID
 	roomID := util.GenerateUUID()
 
@@ -161,6 +172,11 @@ func FriendBattle(context *util.Context) {
 
 func respondFriendBattle(context *util.Context, notification *models.Notification, action string) {
 	if action == "accept" {
+		// matchmaking banned players cannot battle
+		if !system.RequireNoSanction(context, models.SanctionMatchmakingBan) {
+			return
+		}
+
 		// create private match
 		roomID := notification.Data["roomId"].(string)
 		_, err := models.StartPrivateMatch(context, notification.SenderID, notification.ReceiverID, models.MatchRanked, roomID, data.GetRandomArena())
@@ -15,20 +15,95 @@ import (
 )
 
 func handleGuild() {
-	handleGameAPI("/guild/create", system.TokenAuthentication, CreateGuild)
-	handleGameAPI("/guild/delete", system.TokenAuthentication, DeleteGuild)
-	handleGameAPI("/guild/getGuilds", system.TokenAuthentication, GetGuilds)
-	handleGameAPI("/guild/getGuildById", system.TokenAuthentication, GetGuildById)
-	handleGameAPI("/guild/requestJoin", system.TokenAuthentication, RequestToJoin)
-	handleGameAPI("/guild/inviteGuild", system.TokenAuthentication, InviteToGuild)
-	handleGameAPI("/guild/addMember", system.TokenAuthentication, AddMember)
-	handleGameAPI("/guild/removeMember", system.TokenAuthentication, RemoveMember)
-	handleGameAPI("/guild/chat", system.TokenAuthentication, GuildChat)
-	handleGameAPI("/guild/shareReplay", system.TokenAuthentication, ShareReplayToGuild)
-	handleGameAPI("/guild/guildBattle", system.TokenAuthentication, GuildBattle)
-	handleGameAPI("/guild/updateGuildIcon", system.TokenAuthentication, UpdateGuildIcon)
-	handleGameAPI("/guild/promote", system.TokenAuthentication, PromoteGuildMember)
-	handleGameAPI("/guild/demote", system.TokenAuthentication, DemoteGuildMember)
+	handleGameAPI("/guild/create", system.TokenAuthentication, CreateGuild).Describe("Create a guild").Params(
+		system.Required("name", util.StringParam, "Guild name"),
+		system.Required("iconId", util.StringParam, "Guild icon"),
+		system.Optional("description", util.StringParam, nil, "Guild description"),
+		system.Optional("private", util.BoolParam, false, "Join by invitation only"),
+	)
+	handleGameAPI("/guild/delete", system.TokenAuthentication, DeleteGuild).Describe("Delete own guild")
+	handleGameAPI("/guild/getGuilds", system.TokenAuthentication, GetGuilds).Describe("Search guilds").Params(
+		system.Optional("name", util.StringParam, nil, "Guild name search"),
+	).Returns(
+		system.Data("guilds", "array", "Guilds"),
+	)
+	handleGameAPI("/guild/getGuildById", system.TokenAuthentication, GetGuildById).Describe("Get a guild").Params(
+		system.Optional("id", util.StringParam, nil, "Guild ID"),
+	).Returns(
+		system.Data("guild", "object", "Guild"),
+	)
+	handleGameAPI("/guild/requestJoin", system.TokenAuthentication, RequestToJoin).Describe("Request to join a guild").Params(
+		system.Required("guildTag", util.StringParam, "Guild tag"),
+		system.Required("playerTag", util.StringParam, "Player tag"),
+	)
+	handleGameAPI("/guild/inviteGuild", system.TokenAuthentication, InviteToGuild).Describe("Invite a player to a guild").Params(
+		system.Required("guildTag", util.StringParam, "Guild tag"),
+		system.Required("playerTag", util.StringParam, "Invited player tag"),
+	)
+	handleGameAPI("/guild/addMember", system.TokenAuthentication, AddMember).Describe("Add a member to a guild").Params(
+		system.Required("guildTag", util.StringParam, "Guild tag"),
+		system.Required("tag", util.StringParam, "Player tag"),
+	)
+	handleGameAPI("/guild/removeMember", system.TokenAuthentication, RemoveMember).Describe("Remove a member from a guild").Params(
+		system.Required("guildTag", util.StringParam, "Guild tag"),
+		system.Required("playerTag", util.StringParam, "Player tag"),
+	)
+	handleGameAPI("/guild/chat", system.TokenAuthentication, GuildChat).Describe("Send a guild chat message").Params(
+		system.Required("message", util.StringParam, "Message"),
+	)
+	handleGameAPI("/guild/shareReplay", system.TokenAuthentication, ShareReplayToGuild).Describe("Share a replay with the guild").Params(
+		system.Required("infoId", util.StringParam, "Replay info ID"),
+		system.Required("message", util.StringParam, "Message"),
+	)
+	handleGameAPI("/guild/replays", system.TokenAuthentication, GetGuildReplays).Describe("List replays shared with the guild").Params(
+		system.Optional("cursor", util.StringParam, nil, "Cursor from the previous page"),
+		system.Optional("limit", util.IntParam, 20, "Page size (at most 50)"),
+	).Returns(
+		system.Data("replays", "array", "Replay shares, newest first"),
+		system.Data("cursor", "string", "Cursor of the next page (empty on the last page)"),
+	)
+	handleGameAPI("/guild/requestCard", system.TokenAuthentication, RequestGuildCard).Describe("Ask guildmates for copies of an owned card").Params(
+		system.Required("cardId", util.StringParam, "Card data ID"),
+	).Returns(
+		system.Data("request", "object", "Card request"),
+	)
+	handleGameAPI("/guild/donateCard", system.TokenAuthentication, DonateGuildCard).Describe("Donate copies of a card to a guildmate's request").Params(
+		system.Required("requestId", util.IdParam, "Card request ID"),
+		system.Optional("count", util.IntParam, 1, "Copies donated"),
+	).Returns(
+		system.Data("donation", "object", "Donation"),
+	)
+	handleGameAPI("/guild/cardRequests", system.TokenAuthentication, GetGuildCardRequests).Describe("List open card requests of the guild").Returns(
+		system.Data("requests", "array", "Open card requests, newest first"),
+	)
+	handleGameAPI("/guild/collectDonations", system.TokenAuthentication, CollectGuildDonations).Describe("Add donated cards to the player").Returns(
+		system.Data("donations", "array", "Collected donations"),
+	)
+	handleGameAPI("/guild/guildBattle", system.TokenAuthentication, GuildBattle).Describe("Open a guild battle challenge").Params(
+		system.Required("message", util.StringParam, "Message"),
+		system.Required("arenaName", util.StringParam, "Arena name"),
+	).Returns(
+		system.Data("roomId", "string", "Match room ID"),
+		system.Data("arenaName", "string", "Arena name"),
+	)
+	handleGameAPI("/guild/updateGuildIcon", system.TokenAuthentication, UpdateGuildIcon).Describe("Update guild icon").Params(
+		system.Required("iconId", util.StringParam, "Guild icon"),
+	)
+	handleGameAPI("/guild/updateBanner", system.TokenAuthentication, UpdateGuildBanner).Describe("Update guild banner (unlocked by guild level)").Params(
+		system.Optional("banner", util.StringParam, nil, "Banner (empty for none)"),
+	)
+	handleGameAPI("/guild/promote", system.TokenAuthentication, PromoteGuildMember).Describe("Promote a guild member").Params(
+		system.Required("guildTag", util.StringParam, "Guild tag"),
+		system.Required("playerTag", util.StringParam, "Player tag"),
+	).Returns(
+		system.Data("guildRole", "string", "New guild role"),
+	)
+	handleGameAPI("/guild/demote", system.TokenAuthentication, DemoteGuildMember).Describe("Demote a guild member").Params(
+		system.Required("guildTag", util.StringParam, "Guild tag"),
+		system.Required("playerTag", util.StringParam, "Player tag"),
+	).Returns(
+		system.Data("guildRole", "string", "New guild role"),
+	)
 }
 
 func CreateGuild(context *util.Context) {
@@ -36,7 +111,7 @@ func CreateGuild(context *util.Context) {
 	name := context.Params.GetRequiredString("name")
 	iconId := context.Params.GetRequiredString("iconId")
 	description := context.Params.GetString("description", "")
-	private := context.Params.GetBool("private", false)
+	private := context.Params.GetRequiredBool("private")
 
 	// get player
 	player := GetPlayer(context)
@@ -66,14 +141,9 @@ func CreateGuild(context *util.Context) {
 	//Make sure that the guild name is unique
 	var guilds []*models.Guild
 	if name != "" {
-		util.Must(context.DB.C(models.GuildCollectionName).Find(bson.M{
-			"nm": bson.M{
-				"$regex": bson.RegEx{
-					Pattern: fmt.Sprintf("%s", name),
-					Options: "i",
-				},
-			},
-		}).All(&guilds))
+		var err error
+		guilds, err = models.FindGuildsByName(context, fmt.Sprintf("%s", name))
+		util.Must(err)
 	}
 
 	if len(guilds) > 0 {
@@ -98,8 +168,7 @@ func DeleteGuild(context *util.Context) {
 	guild, err := models.GetGuildById(context, player.GuildID)
 	util.Must(err)
 
-	var memberPlayers []*models.Player
-	err = context.DB.C(models.PlayerCollectionName).Find(bson.M{"gd": guild.ID}).All(&memberPlayers)
+	memberPlayers, err := models.GetPlayersByGuild(context, guild.ID)
 	util.Must(err)
 
 	// Remove all members except for owner first
@@ -137,18 +206,13 @@ func GetGuilds(context *util.Context) {
 	name := context.Params.GetString("name", "")
 
 	var guilds []*models.Guild
+	var err error
 	if name != "" {
-		util.Must(context.DB.C(models.GuildCollectionName).Find(bson.M{
-			"nm": bson.M{
-				"$regex": bson.RegEx{
-					Pattern: fmt.Sprintf(".*%s.*", name),
-					Options: "i",
-				},
-			},
-		}).All(&guilds))
+		guilds, err = models.FindGuildsByName(context, fmt.Sprintf(".*%s.*", name))
 	} else {
-		util.Must(context.DB.C(models.GuildCollectionName).Find(nil).All(&guilds))
+		guilds, err = models.GetGuilds(context)
 	}
+	util.Must(err)
 
 	var guildClients []*models.GuildClient
 	var deleteGuilds []*models.Guild
@@ -395,8 +459,7 @@ func SendGuildChatNotification(context *util.Context, senderPlayer *models.Playe
 		util.Must(err)
 	}
 
-	var memberPlayers []*models.Player
-	err = context.DB.C(models.PlayerCollectionName).Find(bson.M{"gd": guild.ID}).All(&memberPlayers)
+	memberPlayers, err := models.GetPlayersByGuild(context, guild.ID)
 	util.Must(err)
 
 	// create notification
@@ -445,6 +508,11 @@ func GuildChat(context *util.Context) {
 	//channel := context.Params.GetString("channel", "")
 	message := context.Params.GetRequiredString("message")
 
+	// muted players cannot chat
+	if !system.RequireNoSanction(context, models.SanctionChatMute) {
+		return
+	}
+
 	SendGuildChatNotification(context, nil, "GuildChat", message, models.PlayerDataMask_Guild, "Accept", "accept", "Decline", "decline", nil, time.Now().Add(time.Hour*time.Duration(168)), nil, false)
 }
 
@@ -458,14 +526,16 @@ func SendReplayGuildNotification(context *util.Context, replayInfoId string, mes
 	guild, err := models.GetGuildById(context, player.GuildID)
 	util.Must(err)
 
-	var memberPlayers []*models.Player
-	err = context.DB.C(models.PlayerCollectionName).Find(bson.M{"gd": guild.ID}).All(&memberPlayers)
+	memberPlayers, err := models.GetPlayersByGuild(context, guild.ID)
 	util.Must(err)
 
-	fmt.Println("infoID:", replayInfoId)
 	replayInfo, err := models.GetReplayInfoById(context, bson.ObjectIdHex(replayInfoId))
 	util.Must(err)
 
+	// keep in the guild feed
+	_, err = models.ShareReplay(context, player, replayInfo, message)
+	util.Must(err)
+
 	data := bson.M{"requestType": "ShareReplay", "replayInfo": replayInfo}
 
 	// create notification
@@ -495,12 +565,101 @@ func ShareReplayToGuild(context *util.Context) {
 	SendReplayGuildNotification(context, replayInfoId, message)
 }
 
+func GetGuildReplays(context *util.Context) {
+	// parse parameters
+	cursor := context.Params.GetCursor("cursor")
+	limit := context.Params.GetRequiredInt("limit")
+
+	player := GetPlayer(context)
+	if !player.GuildID.Valid() {
+		context.Fail("Player is not in a guild")
+		return
+	}
+
+	replayShares, next, err := models.GetGuildReplayFeed(context, player.GuildID, cursor, limit)
+	util.Must(err)
+
+	context.SetData("replays", replayShares)
+	context.SetData("cursor", cursorString(next))
+}
+
+func RequestGuildCard(context *util.Context) {
+	// parse parameters
+	cardId := context.Params.GetRequiredString("cardId")
+
+	player := GetPlayer(context)
+
+	request, err := player.RequestCard(context, data.ToDataId(cardId))
+	util.Must(err)
+
+	client := request.GetClient(context)
+	context.SetData("request", client)
+
+	// post to the guild feed
+	requestData := map[string]interface{}{"requestType": "CardRequest", "request": client}
+	SendGuildChatNotification(context, nil, "GuildCardRequest", "", models.PlayerDataMask_None, "", "", "", "", requestData, request.ExpiresAt, nil, false)
+}
+
+func DonateGuildCard(context *util.Context) {
+	// parse parameters
+	requestId := context.Params.GetRequiredId("requestId")
+	count := context.Params.GetRequiredInt("count")
+
+	player := GetPlayer(context)
+
+	donation, err := player.DonateCard(context, requestId, count)
+	util.Must(err)
+
+	request, err := models.GetCardRequestById(context, requestId)
+	util.Must(err)
+
+	context.SetData("donation", donation)
+
+	// post to the guild feed (the recipient collects with /guild/collectDonations)
+	donationData := map[string]interface{}{"requestType": "CardDonation", "donation": donation, "request": request.GetClient(context)}
+	SendGuildChatNotification(context, nil, "GuildCardDonation", "", models.PlayerDataMask_None, "", "", "", "", donationData, request.ExpiresAt, nil, false)
+}
+
+func GetGuildCardRequests(context *util.Context) {
+	player := GetPlayer(context)
+	if !player.GuildID.Valid() {
+		context.Fail("Player is not in a guild")
+		return
+	}
+
+	requests, err := models.GetGuildCardRequests(context, player.GuildID)
+	util.Must(err)
+
+	clients := []*models.CardRequestClient {}
+	for _, request := range requests {
+		clients = append(clients, request.GetClient(context))
+	}
+	context.SetData("requests", clients)
+}
+
+func CollectGuildDonations(context *util.Context) {
+	player := GetPlayer(context)
+
+	donations, err := player.CollectCardDonations(context)
+	util.Must(err)
+
+	if donations == nil {
+		donations = []*models.CardDonation {}
+	}
+	context.SetData("donations", donations)
+}
+
 func GuildBattle(context *util.Context) {
 	// parse parameters
 	message := context.Params.GetRequiredString("message")
 	arenaName := context.Params.GetRequiredString("arenaName")
 	//tag := context.Params.GetRequiredString("tag")
 
+	// matchmaking banned players cannot battle
+	if !system.RequireNoSanction(context, models.SanctionMatchmakingBan) {
+		return
+	}
+
 	// generate Room ID
 	roomID := util.GenerateUUID()
 	//message := fmt.Sprintf("Battle Request from: %s", models.GetUserName(context, context.UserID))
@@ -522,6 +681,11 @@ func GuildBattle(context *util.Context) {
 
 func respondGuildBattle(context *util.Context, notification *models.Notification, action string) {
 	if action == "accept" && notification.Data["matchStarted"] == false{
+		// matchmaking banned players cannot battle
+		if !system.RequireNoSanction(context, models.SanctionMatchmakingBan) {
+			return
+		}
+
 		// create private match
 		roomID := notification.Data["roomId"].(string)
 		arenaName := notification.Data["arenaName"].(string)
@@ -560,3 +724,17 @@ func UpdateGuildIcon(context *util.Context) {
 
 	SendGuildChatNotification(context, nil, "UpdateGuildInfo", "", models.PlayerDataMask_Guild, "", "", "", "", nil, time.Now().Add(time.Hour*time.Duration(1)), guild, true)
 }
+
+func UpdateGuildBanner(context *util.Context) {
+	banner := context.Params.GetString("banner", "")
+
+	player := GetPlayer(context)
+
+	guild, err := models.GetGuildById(context, player.GuildID)
+	util.Must(err)
+
+	err = models.UpdateGuildBanner(context, player, guild, banner)
+	util.Must(err)
+
+	SendGuildChatNotification(context, nil, "UpdateGuildInfo", "", models.PlayerDataMask_Guild, "", "", "", "", nil, time.Now().Add(time.Hour*time.Duration(1)), guild, true)
+}
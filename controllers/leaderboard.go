@@ -0,0 +1,56 @@
+package controllers
+
+import (
+	"bloodtales/data"
+	"bloodtales/util"
+	"bloodtales/system"
+	"bloodtales/models"
+)
+
+func handleLeaderboard() {
+	handleGameAPI("/leaderboard/get", system.TokenAuthentication, GetLeaderboard).Describe("Get leaderboard top places and the places around the player").Params(
+		system.Optional("scope", util.StringParam, "global", "Leaderboard").OneOf("global", "league", "season", "guild", "friends", "guilds", "guildRating"),
+		system.Optional("league", util.IntParam, -1, "League (league scope, defaults to the player's league)"),
+		system.Optional("season", util.IntParam, 0, "Season number (season scope, defaults to the current season)"),
+		system.Optional("guildTag", util.StringParam, nil, "Guild tag (guild scope, defaults to the player's guild)"),
+		system.Optional("offset", util.IntParam, 0, "First top place (0 based)"),
+		system.Optional("limit", util.IntParam, 10, "Top places (at most 100)"),
+		system.Optional("around", util.IntParam, 5, "Places on either side of the player (or their guild)"),
+	).Returns(
+		system.Data("leaderboard", "object", "Place count, player place, top and around entries"),
+	)
+}
+
+func GetLeaderboard(context *util.Context) {
+	// parse parameters
+	scope, err := models.GetLeaderboardScope(context.Params.GetRequiredString("scope"))
+	util.Must(err)
+	league := context.Params.GetRequiredInt("league")
+	guildTag := context.Params.GetString("guildTag", "")
+
+	player := GetPlayer(context)
+
+	query := &models.LeaderboardQuery {
+		Scope: scope,
+		League: player.GetLeague(),
+		Season: context.Params.GetRequiredInt("season"),
+		GuildID: player.GuildID,
+		Player: player,
+		Offset: context.Params.GetRequiredInt("offset"),
+		Limit: context.Params.GetRequiredInt("limit"),
+		Around: context.Params.GetRequiredInt("around"),
+	}
+	if league >= 0 {
+		query.League = data.League(league)
+	}
+	if guildTag != "" {
+		guild, err := models.GetGuildByTag(context, guildTag)
+		util.Must(err)
+		query.GuildID = guild.ID
+	}
+
+	leaderboard, err := models.GetLeaderboard(context, query)
+	util.Must(err)
+
+	context.SetData("leaderboard", leaderboard)
+}
@@ -10,11 +10,33 @@ import (
 )
 
 func handleMatch() {
-	handleGameAPI("/match/clear", system.TokenAuthentication, MatchClear)
-	handleGameAPI("/match/find", system.TokenAuthentication, MatchFind)
-	handleGameAPI("/match/fail", system.TokenAuthentication, MatchFail)
-	handleGameAPI("/match/result", system.TokenAuthentication, MatchResult)
-	handleGameAPI("/match/practice", system.TokenAuthentication, PracticeMatchResult)
+	handleGameAPI("/match/clear", system.TokenAuthentication, MatchClear).Describe("Clear pending matches")
+	handleGameAPI("/match/find", system.TokenAuthentication, MatchFind).Describe("Find or queue a public match").Params(
+		system.Optional("type", util.StringParam, "Ranked", "Match type").OneOf(models.GetMatchTypeNames()...),
+	).Returns(
+		system.Data("match", "object", "Matched or queued match"),
+	)
+	handleGameAPI("/match/fail", system.TokenAuthentication, MatchFail).Describe("Fail current match")
+	handleGameAPI("/match/result", system.TokenAuthentication, MatchResult).Describe("Report match result").Params(
+		system.Required("outcome", util.IntParam, "Match outcome (-2 surrender, -1 loss, 0 draw, 1 win)").OneOf("-2", "-1", "0", "1"),
+		system.Required("playerScore", util.IntParam, "Player score"),
+		system.Required("opponentScore", util.IntParam, "Opponent score"),
+		system.Required("roomId", util.StringParam, "Match room ID"),
+	).Returns(
+		system.Data("previousRankPoints", "integer", "Rank points before the match"),
+		system.Data("reward", "object", "Victory reward"),
+	)
+	handleGameAPI("/match/history", system.TokenAuthentication, MatchHistory).Describe("List completed matches").Params(
+		system.Optional("tag", util.StringParam, nil, "Player tag (defaults to the current player)"),
+		system.Optional("cursor", util.StringParam, nil, "Cursor from the previous page"),
+		system.Optional("limit", util.IntParam, 20, "Page size (at most 50)"),
+	).Returns(
+		system.Data("matches", "array", "Matches from the player's side, newest first"),
+		system.Data("cursor", "string", "Cursor of the next page (empty on the last page)"),
+	)
+	handleGameAPI("/match/practice", system.TokenAuthentication, PracticeMatchResult).Describe("Report practice match result").Params(
+		system.Required("outcome", util.IntParam, "Match outcome (-2 surrender, -1 loss, 0 draw, 1 win)").OneOf("-2", "-1", "0", "1"),
+	)
 }
 
 func MatchClear(context *util.Context) {
@@ -24,12 +46,37 @@ func MatchClear(context *util.Context) {
 	util.Must(models.ClearMatches(context, []bson.ObjectId { player.ID }, models.MatchOpen))
 }
 
+func MatchHistory(context *util.Context) {
+	// parse parameters
+	tag := context.Params.GetString("tag", "")
+	cursor := context.Params.GetCursor("cursor")
+	limit := context.Params.GetRequiredInt("limit")
+
+	player := GetPlayer(context)
+	if tag != "" {
+		var err error
+		player, err = models.GetPlayerByTag(context, tag)
+		util.Must(err)
+	}
+
+	entries, next, err := models.GetMatchHistory(context, player, cursor, limit)
+	util.Must(err)
+
+	context.SetData("matches", entries)
+	context.SetData("cursor", cursorString(next))
+}
+
 func MatchFind(context *util.Context) {
 	// parse parameters
-	matchTypeName := context.Params.GetString("type", "Ranked")
+	matchTypeName := context.Params.GetRequiredString("type")
 
 	matchType := models.GetMatchType(matchTypeName)
 
+	// matchmaking banned players cannot queue
+	if !system.RequireNoSanction(context, models.SanctionMatchmakingBan) {
+		return
+	}
+
 	player := GetPlayer(context)
 
 	// find or queue match
@@ -12,9 +12,19 @@ import (
 )
 
 func handleNotification() {
-	handleGameAPI("/notifications/get", system.TokenAuthentication, GetNotifications)
-	handleGameAPI("/notifications/respond", system.TokenAuthentication, RespondNotification)
-	handleGameAPI("/notifications/view", system.TokenAuthentication, ViewNotifications)
+	handleGameAPI("/notifications/get", system.TokenAuthentication, GetNotifications).Describe("Get received notifications").Params(
+		system.Optional("types", util.StringsParam, nil, "Notification types to include"),
+	).Returns(
+		system.Data("notifications", "array", "Notifications"),
+		system.Data("senderClientData", "array", "Sender player data"),
+	)
+	handleGameAPI("/notifications/respond", system.TokenAuthentication, RespondNotification).Describe("Respond to a notification").Params(
+		system.Required("id", util.IdParam, "Notification ID"),
+		system.Required("action", util.StringParam, "Response action"),
+	)
+	handleGameAPI("/notifications/view", system.TokenAuthentication, ViewNotifications).Describe("Mark notifications as viewed").Params(
+		system.Required("ids", util.IdsParam, "Notification IDs"),
+	)
 }
 
 func GetNotifications(context *util.Context) {
@@ -44,12 +54,9 @@ func GetNotifications(context *util.Context) {
 	for _, notification := range notifications {
 		prepareNotification(context, notification)
 		senderPlayerIds = append(senderPlayerIds, notification.SenderID)
-		//var senderPlayer *models.Player
-		//err = context.DB.C(models.PlayerCollectionName).Find(bson.M{"_id": notification.SenderID}).One(&senderPlayer)
-		//util.Must(err)
 	}
 
-	err = context.DB.C(models.PlayerCollectionName).Find(bson.M{"_id": bson.M{"$in": senderPlayerIds}}).All(&senderPlayers)
+	senderPlayers, err = models.GetPlayersByIds(context, senderPlayerIds)
 	util.Must(err)
 
 	for _, senderPlayer := range senderPlayers {
@@ -121,6 +128,11 @@ func respondNotification(context *util.Context, notification *models.Notificatio
 	case "FriendBattle":
 		// handle friend battle
 		respondFriendBattle(context, notification, action)
+
+		// battle refused (e.g. matchmaking ban) is a decline for the sender
+		if !context.Success {
+			action = "decline"
+		}
 		
 		// notify sender
 		if notification.SenderID.Valid() {
@@ -138,8 +150,7 @@ func respondNotification(context *util.Context, notification *models.Notificatio
 			guild, err := models.GetGuildById(context, GetPlayer(context).GuildID)
 			util.Must(err)
 
-			var memberPlayers []*models.Player
-			err = context.DB.C(models.PlayerCollectionName).Find(bson.M{"gd": guild.ID}).All(&memberPlayers)
+			memberPlayers, err := models.GetPlayersByGuild(context, guild.ID)
 			util.Must(err)
 
 			for _, memberPlayer := range memberPlayers {
@@ -154,6 +165,28 @@ func respondNotification(context *util.Context, notification *models.Notificatio
 			}
 		}
 
+		break
+
+	case "GuildWarBattle":
+		// handle guild war battle
+		respondGuildWarBattle(context, notification, action)
+
+		// an accepted challenge is gone for the rest of the challenged guild
+		if action == "accept" {
+			memberPlayers, err := models.GetPlayersByGuild(context, notification.ReceiverID)
+			util.Must(err)
+
+			for _, memberPlayer := range memberPlayers {
+				socketData := map[string]interface{}{"notificationId": notification.ID}
+				system.SocketSend(context, memberPlayer.UserID, "GuildWarBattle-clear", socketData)
+			}
+
+			if notification.SenderID.Valid() {
+				senderUserID := models.GetUserIdByPlayerId(context, notification.SenderID)
+				system.SocketSend(context, senderUserID, fmt.Sprintf("%s-%s", notification.Type, action), nil)
+			}
+		}
+
 		break
 	}
 
@@ -168,8 +201,7 @@ func respondNotification(context *util.Context, notification *models.Notificatio
 				guild, err := models.GetGuildById(context, GetPlayer(context).GuildID)
 				util.Must(err)
 		
-				var memberPlayers []*models.Player
-				err = context.DB.C(models.PlayerCollectionName).Find(bson.M{"gd": guild.ID}).All(&memberPlayers)
+				memberPlayers, err := models.GetPlayersByGuild(context, guild.ID)
 				util.Must(err)
 		
 				for _, memberPlayer := range memberPlayers {
@@ -11,8 +11,15 @@ import (
 
 func handlePlayer() {
 	//handleGameAPI("/player/set", system.TokenAuthentication, OverwritePlayer) // HACK - do not allow in production
-	handleGameAPI("/player/name", system.TokenAuthentication, SetPlayerName)
-	handleGameAPI("/player/view", system.NoAuthentication, ViewPlayerProfile)
+	handleGameAPI("/player/name", system.TokenAuthentication, SetPlayerName).Describe("Set player name").Params(
+		system.Required("name", util.StringParam, "New player name"),
+	)
+	handleGameAPI("/player/view", system.NoAuthentication, ViewPlayerProfile).Describe("View a player profile").Params(
+		system.Required("tag", util.StringParam, "Player tag"),
+	).Returns(
+		system.Data("player", "object", "Player profile"),
+		system.Data("guild", "object", "Player guild"),
+	)
 
 	// template functions
 	util.AddTemplateFunc("getUserName", models.GetUserName)
@@ -12,13 +12,19 @@ import (
 )
 
 func handlePurchase() {
-	handleGameAPI("/purchase", system.TokenAuthentication, Purchase)
+	handleGameAPI("/purchase", system.TokenAuthentication, Purchase).Describe("Purchase a store item").Params(
+		system.Required("id", util.StringParam, "Store item ID"),
+		system.Optional("bulk", util.BoolParam, false, "Purchase all available"),
+	).Returns(
+		system.Data("rewards", "array", "Purchase rewards"),
+		system.Data("storeItem", "object", "Updated store item"),
+	)
 }
 
 func Purchase(context *util.Context) {
 	// parse parameters
 	id := context.Params.GetRequiredString("id")
-	bulk := context.Params.GetBool("bulk", false)
+	bulk := context.Params.GetRequiredBool("bulk")
 
 	// get player
 	player := GetPlayer(context)
@@ -114,6 +120,8 @@ func Purchase(context *util.Context) {
 		// analytics
 		tome := data.GetTome(data.ToDataId(storeItem.ItemID))
 		if tome != nil {
+			models.MetricTomesOpened.Inc(tome.Name)
+
 			if util.HasSQLDatabase() {
 				InsertTrackingSQL(context, "tomeOpened", currentTime, tome.Name, "Premium", 1, 0, nil)
 			}else{
@@ -133,6 +141,10 @@ func Purchase(context *util.Context) {
 
 	player.SetDirty(models.PlayerDataMask_Currency, models.PlayerDataMask_Cards)
 
+	// metrics
+	categoryName, _ := data.StoreCategoryToString(storeItem.Category)
+	models.MetricPurchases.Inc(currencyType, categoryName)
+
 	if util.HasSQLDatabase() {
 		InsertTrackingSQL(context, "purchase", currentTime, storeItem.Name, currencyType, 1, purchasePrice, bson.M { "time": currentTime,
 													"productId":storeItem.Name,
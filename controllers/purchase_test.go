@@ -0,0 +1,107 @@
+package controllers
+
+import (
+	"testing"
+
+	"bloodtales/data"
+	"bloodtales/models"
+)
+
+func TestPurchase(t *testing.T) {
+	tests := []struct {
+		name            string
+		id              string // store item (first card offer when empty)
+		premium         int    // starting premium currency
+		purchases       int
+		success         bool   // of the last purchase
+	}{
+		{"currency for premium", "STORE_GOLD_SMALL", 100, 1, true},
+		{"insufficient funds", "STORE_GOLD_SMALL", 10, 1, false},
+		{"tome", "STORE_TOME_RARE", 100, 1, true},
+		{"card offer", "", 100, 1, true},
+		{"one-time offer", "STORE_STARTER_PACK", 100, 1, true},
+		{"one-time offer again", "STORE_STARTER_PACK", 200, 2, false},
+		{"unknown item", "STORE_MISSING", 100, 1, false},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			context, player := newTestContext(t)
+			player.PremiumCurrency = test.premium
+			if err := player.Save(context); err != nil {
+				t.Fatalf("Failed to save player: %v", err)
+			}
+
+			for i := 0; i < test.purchases; i++ {
+				player = GetPlayer(context)
+				standardCurrency, premiumCurrency := player.StandardCurrency, player.PremiumCurrency
+
+				// price as offered before buying
+				var offer *models.StoreItem
+				for _, item := range player.GetCurrentStoreOffers(context) {
+					if item.Name == test.id || (test.id == "" && item.Category == data.StoreCategoryCards) {
+						offer = &item
+						break
+					}
+				}
+
+				id := test.id
+				if offer != nil {
+					id = offer.Name
+				}
+				context.Success = true
+				context.Data = map[string]interface{} {}
+				context.Params.Set("id", id)
+				context.Params.Set("bulk", false)
+				Purchase(context)
+
+				stored, err := models.GetPlayerById(context, player.ID)
+				if err != nil {
+					t.Fatalf("Failed to get player: %v", err)
+				}
+
+				last := i == test.purchases - 1
+				if !last {
+					continue
+				}
+				if context.Success != test.success {
+					t.Fatalf("Purchase success = %v (%v), want %v", context.Success, context.Messages, test.success)
+				}
+				if !test.success {
+					if stored.StandardCurrency != standardCurrency || stored.PremiumCurrency != premiumCurrency {
+						t.Errorf("Failed purchase changed currency: %d/%d, was %d/%d", stored.StandardCurrency, stored.PremiumCurrency, standardCurrency, premiumCurrency)
+					}
+					return
+				}
+
+				// currency spent, rewards (or the card) received
+				wantStandard, wantPremium := standardCurrency, premiumCurrency
+				switch offer.Currency {
+				case data.CurrencyStandard:
+					wantStandard -= int(offer.Cost)
+				case data.CurrencyPremium:
+					wantPremium -= int(offer.Cost)
+				}
+				if rewards, ok := context.Data["rewards"].([]*models.Reward); ok {
+					for _, reward := range rewards {
+						wantStandard += reward.StandardCurrency + reward.OverflowCurrency
+						wantPremium += reward.PremiumCurrency
+					}
+				}
+				if stored.StandardCurrency != wantStandard || stored.PremiumCurrency != wantPremium {
+					t.Errorf("Currency = %d/%d, want %d/%d", stored.StandardCurrency, stored.PremiumCurrency, wantStandard, wantPremium)
+				}
+
+				if offer.Category == data.StoreCategoryCards {
+					card := stored.GetCard(data.ToDataId(offer.ItemID))
+					if card == nil || card.CardCount < 1 {
+						t.Errorf("Purchased card %s was not added", offer.ItemID)
+					}
+				}
+				if offer.Category == data.StoreCategoryOneTimeOffers && !stored.Store.OneTimePurchaseHistory[offer.Name].Purchased {
+					t.Errorf("One-time offer %s was not recorded", offer.Name)
+				}
+			}
+		})
+	}
+}
@@ -13,9 +13,15 @@ import (
 )
 
 func handleQuests() {
-	handleGameAPI("/quests/complete", system.TokenAuthentication, CompleteQuest)
-	handleGameAPI("/quests/clear", system.TokenAuthentication, ClearQuest)
-	handleGameAPI("/quests/refresh", system.TokenAuthentication, RefreshQuests)
+	handleGameAPI("/quests/complete", system.TokenAuthentication, CompleteQuest).Describe("Complete a quest").Params(
+		system.Required("index", util.IntParam, "Quest slot index"),
+	).Returns(
+		system.Data("reward", "object", "Quest reward"),
+	)
+	handleGameAPI("/quests/clear", system.TokenAuthentication, ClearQuest).Describe("Clear a quest").Params(
+		system.Required("index", util.IntParam, "Quest slot index"),
+	)
+	handleGameAPI("/quests/refresh", system.TokenAuthentication, RefreshQuests).Describe("Refresh quests")
 }
 
 func CompleteQuest(context *util.Context) {
@@ -1,18 +1,49 @@
 package controllers
 
 import (
+	"bloodtales/data"
 	"bloodtales/util"
 	"bloodtales/system"
 	"bloodtales/models"
 )
 
 func handleReplay() {
-	handleGameAPI("/replay/list", system.TokenAuthentication, GetReplayList)
-	handleGameAPI("/replay/get", system.TokenAuthentication, GetReplay)
-	handleGameAPI("/replay/getLastReplay", system.TokenAuthentication, GetLastReplayInfoByUser)
-	handleGameAPI("/replay/getTopReplays", system.TokenAuthentication, GetTopReplays)
-	handleGameAPI("/replay/set", system.TokenAuthentication, SetReplay)
-	handleGameAPI("/replay/delete", system.TokenAuthentication, DeleteReplay)
+	handleGameAPI("/replay/list", system.TokenAuthentication, GetReplayList).Describe("List own replays").Returns(
+		system.Data("replays", "array", "Replay infos"),
+	)
+	handleGameAPI("/replay/get", system.TokenAuthentication, GetReplay).Describe("Get replay data").Params(
+		system.Required("id", util.IdParam, "Replay info ID"),
+	).Returns(
+		system.Data("replayData", "object", "Replay data"),
+	)
+	handleGameAPI("/replay/getLastReplay", system.TokenAuthentication, GetLastReplayInfoByUser).Describe("Get last replay of a player").Params(
+		system.Required("tag", util.StringParam, "Player tag"),
+	).Returns(
+		system.Data("replay", "object", "Replay info"),
+	)
+	handleGameAPI("/replay/getTopReplays", system.TokenAuthentication, GetTopReplays).Describe("List own highest ranked replays").Returns(
+		system.Data("replays", "array", "Replay infos"),
+	)
+	handleGameAPI("/replay/search", system.TokenAuthentication, SearchReplays).Describe("Search top replays").Params(
+		system.Optional("league", util.IntParam, nil, "League tier"),
+		system.Optional("card", util.StringParam, nil, "Card used by either player"),
+		system.Optional("arena", util.StringParam, nil, "Arena name"),
+		system.Optional("player", util.StringParam, nil, "Player tag"),
+		system.Optional("cursor", util.StringParam, nil, "Cursor from the previous page"),
+		system.Optional("limit", util.IntParam, 20, "Page size (at most 50)"),
+	).Returns(
+		system.Data("replays", "array", "Replay infos, highest rank first"),
+		system.Data("cursor", "string", "Cursor of the next page (empty on the last page)"),
+	)
+	handleGameAPI("/replay/set", system.TokenAuthentication, SetReplay).Describe("Upload a replay").Params(
+		system.Required("info", util.StringParam, "Replay info"),
+		system.Required("data", util.StringParam, "Replay data"),
+		system.Required("rank", util.IntParam, "Player rank (replaced by the player's rank points when linked to a match)"),
+		system.Optional("roomId", util.StringParam, nil, "Room ID of the recorded match"),
+	)
+	handleGameAPI("/replay/delete", system.TokenAuthentication, DeleteReplay).Describe("Delete a replay").Params(
+		system.Required("id", util.IdParam, "Replay info ID"),
+	)
 }
 
 func GetReplayList(context *util.Context) {
@@ -29,6 +60,33 @@ func GetTopReplays(context *util.Context) {
 	context.SetData("replays", replayInfos)
 }
 
+func SearchReplays(context *util.Context) {
+	// parse parameters
+	filter := &models.ReplayFilter {
+		Arena: context.Params.GetString("arena", ""),
+	}
+	if context.Params.Has("league") {
+		filter.Leagues = []data.League { data.League(context.Params.GetRequiredInt("league")) }
+	}
+	if card := context.Params.GetString("card", ""); card != "" {
+		filter.CardID = data.ToDataId(card)
+	}
+	if tag := context.Params.GetString("player", ""); tag != "" {
+		player, err := models.GetPlayerByTag(context, tag)
+		util.Must(err)
+
+		filter.PlayerID = player.ID
+	}
+	cursor := context.Params.GetCursor("cursor")
+	limit := context.Params.GetRequiredInt("limit")
+
+	replayInfos, next, err := models.SearchReplays(context, filter, cursor, limit)
+	util.Must(err)
+
+	context.SetData("replays", replayInfos)
+	context.SetData("cursor", cursorString(next))
+}
+
 func GetLastReplayInfoByUser(context *util.Context) {
 	playerTag := context.Params.GetRequiredString("tag")
 
@@ -56,8 +114,9 @@ func SetReplay(context *util.Context) {
 	info := context.Params.GetRequiredString("info")
 	data := context.Params.GetRequiredString("data")
 	rank := context.Params.GetRequiredInt("rank")
+	roomID := context.Params.GetString("roomId", "")
 
-	util.Must(models.CreateReplay(context, info, data, rank))
+	util.Must(models.CreateReplay(context, info, data, rank, roomID))
 }
 
 func DeleteReplay(context *util.Context) {
@@ -68,3 +127,11 @@ func DeleteReplay(context *util.Context) {
 
 	replayInfo.Delete(context)
 }
+
+// next page cursor parameter (empty on the last page)
+func cursorString(cursor *util.Cursor) string {
+	if cursor == nil {
+		return ""
+	}
+	return cursor.String()
+}
@@ -0,0 +1,44 @@
+package controllers
+
+import (
+	"bloodtales/util"
+	"bloodtales/system"
+	"bloodtales/models"
+)
+
+func handleSeason() {
+	handleGameAPI("/season/current", system.TokenAuthentication, GetCurrentSeason).Describe("Get the current season and past season results").Returns(
+		system.Data("season", "object", "Current season (null between seasons)"),
+		system.Data("results", "array", "Past season results, newest first"),
+	)
+	handleGameAPI("/season/claim", system.TokenAuthentication, ClaimSeasonReward).Describe("Claim the reward for a past season").Params(
+		system.Required("seasonId", util.IdParam, "Season ID"),
+	).Returns(
+		system.Data("rewards", "array", "Season rewards"),
+	)
+}
+
+func GetCurrentSeason(context *util.Context) {
+	player := GetPlayer(context)
+
+	season, err := models.GetCurrentSeason(context)
+	util.Must(err)
+
+	results, err := models.GetSeasonResults(context, player.ID)
+	util.Must(err)
+
+	context.SetData("season", season)
+	context.SetData("results", results)
+}
+
+func ClaimSeasonReward(context *util.Context) {
+	// parse parameters
+	seasonId := context.Params.GetRequiredId("seasonId")
+
+	player := GetPlayer(context)
+
+	rewards, err := player.ClaimSeasonReward(context, seasonId)
+	util.Must(err)
+
+	context.SetData("rewards", rewards)
+}
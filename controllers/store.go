@@ -7,7 +7,12 @@ import (
 )
 
 func handleStore() {
-	handleGameAPI("/store/offers", system.TokenAuthentication, GetStoreOffers)
+	handleGameAPI("/store/offers", system.TokenAuthentication, GetStoreOffers).Describe("Get current store offers").Returns(
+		system.Data("storeItems", "array", "Current store items"),
+		system.Data("productIds", "array", "In-app product IDs"),
+		system.Data("newSpecialOffer", "string", "New special offer name"),
+		system.Data("newCardsCount", "integer", "Number of new card offers"),
+	)
 }
 
 func GetStoreOffers(context *util.Context) {
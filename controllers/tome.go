@@ -12,12 +12,28 @@ import (
 )
 
 func handleTome() {
-	handleGameAPI("/tome/unlock", system.TokenAuthentication, UnlockTome)
-	handleGameAPI("/tome/open", system.TokenAuthentication, OpenTome)
-	handleGameAPI("/tome/rush", system.TokenAuthentication, RushTome)
-	handleGameAPI("/tome/free", system.TokenAuthentication, ClaimFreeTome)
-	handleGameAPI("/tome/arena", system.TokenAuthentication, ClaimArenaTome)
-	handleGameAPI("/tome/guild", system.TokenAuthentication, ClaimGuildTome)
+	handleGameAPI("/tome/unlock", system.TokenAuthentication, UnlockTome).Describe("Start unlocking a tome").Params(
+		system.Required("tomeId", util.IntParam, "Tome slot index"),
+	)
+	handleGameAPI("/tome/open", system.TokenAuthentication, OpenTome).Describe("Open an unlocked tome").Params(
+		system.Required("tomeId", util.IntParam, "Tome slot index"),
+	).Returns(
+		system.Data("reward", "object", "Tome reward"),
+	)
+	handleGameAPI("/tome/rush", system.TokenAuthentication, RushTome).Describe("Open a tome immediately for premium currency").Params(
+		system.Required("tomeId", util.StringParam, "Tome slot index, or active for the active tome"),
+	).Returns(
+		system.Data("reward", "object", "Tome reward"),
+	)
+	handleGameAPI("/tome/free", system.TokenAuthentication, ClaimFreeTome).Describe("Claim the free tome").Returns(
+		system.Data("reward", "object", "Tome reward"),
+	)
+	handleGameAPI("/tome/arena", system.TokenAuthentication, ClaimArenaTome).Describe("Claim the arena tome").Returns(
+		system.Data("reward", "object", "Tome reward"),
+	)
+	handleGameAPI("/tome/guild", system.TokenAuthentication, ClaimGuildTome).Describe("Claim the guild tome").Returns(
+		system.Data("reward", "object", "Tome reward"),
+	)
 }
 
 func UnlockTome(context *util.Context) {
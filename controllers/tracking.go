@@ -53,7 +53,10 @@ func (eventStruct *SQLevent) GetFloatField(field string) (val float64){
 }
 
 func handleTracking() {
-	handleGameAPI("/tracking", system.TokenAuthentication, PostTracking)
+	handleGameAPI("/tracking", system.TokenAuthentication, PostTracking).Describe("Post a batch of tracking events (event0, data0, event1, data1, ...)").Params(
+		system.Optional("event0", util.StringParam, nil, "First event name"),
+		system.Optional("data0", util.JSONParam, nil, "First event data"),
+	)
 }
 
 func PostTracking(context *util.Context) {
@@ -7,8 +7,19 @@ import (
 )
 
 func handleTutorial() {
-	handleGameAPI("/tutorial/updateProgress", system.TokenAuthentication, UpdateTutorialProgress)
-	handleGameAPI("/tutorial/claimReward", system.TokenAuthentication, ClaimTutorialReward)
+	handleGameAPI("/tutorial/updateProgress", system.TokenAuthentication, UpdateTutorialProgress).Describe("Update tutorial progress").Params(
+		system.Required("name", util.StringParam, "Tutorial name"),
+		system.Required("complete", util.BoolParam, "Tutorial completed"),
+		system.Required("page", util.IntParam, "Current page"),
+		system.Required("progress", util.IntParam, "Progress"),
+	)
+	handleGameAPI("/tutorial/claimReward", system.TokenAuthentication, ClaimTutorialReward).Describe("Claim tutorial reward").Params(
+		system.Required("name", util.StringParam, "Tutorial name"),
+	).Returns(
+		system.Data("previousRankPoints", "integer", "Rank points before reward"),
+		system.Data("tome", "object", "Rewarded tome"),
+		system.Data("reward", "object", "Reward"),
+	)
 }
 
 func UpdateTutorialProgress(context *util.Context) {
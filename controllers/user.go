@@ -9,38 +9,58 @@ import (
 )
 
 func handleUser() {
-	handleGameAPI("/connect", system.NoAuthentication, UserConnect)
-	handleGameAPI("/login", system.DeviceAuthentication, UserLogin)
-	handleGameAPI("/reauth", system.NoAuthentication, UserReauth)
-	handleGameAPI("/logout", system.TokenAuthentication, UserLogout)
+	handleGameAPI("/connect", system.NoAuthentication, UserConnect).Describe("Check client version and get gameplay config").Params(
+		system.Required("version", util.StringParam, "Client version"),
+		system.Optional("platform", util.StringParam, nil, "Client platform (ios, android)"),
+	).Returns(
+		system.Data("config", "object", "Gameplay config"),
+		system.Data("serverVersion", "string", "Current server version"),
+		system.Data("updateRequired", "boolean", "Client must update to connect"),
+		system.Data("storeUrl", "string", "Where to update the client"),
+	)
+	handleGameAPI("/login", system.DeviceAuthentication, UserLogin).Describe("Log in with device or credentials, responding with all player data").Params(
+		system.Optional("reset", util.BoolParam, false, "Reset player data"),
+		system.Optional("development", util.BoolParam, false, "Create development player data"),
+	)
+	handleGameAPI("/reauth", system.NoAuthentication, UserReauth).Describe("Issue a new token for an expired token").Params(
+		system.Required("token", util.StringParam, "Expired authentication token"),
+	)
+	handleGameAPI("/logout", system.TokenAuthentication, UserLogout).Describe("Log out and clear token")
 }
 
 func UserConnect(context *util.Context) {
 	// parse parameters
 	version := context.Params.GetRequiredString("version")
+	platform := context.Params.GetString("platform", "")
 
-	// check version (major and minor)
-	compatibility := util.CompareVersion(config.Config.Platform.Version, version, 2)
-	switch compatibility {
-
-	case -1:
-		context.Fail("Client version is behind server.  Please update client!")
-
-	case 1:
+	// check version is not ahead of server (major and minor)
+	if util.CompareVersion(config.Config.Platform.Version, version, 2) > 0 {
 		context.Fail("Client version is ahead of server.  Please update server!")
+		return
+	}
 
+	// check version is still supported, older supported clients get adapted responses
+	if util.CompareVersion(config.Config.Platform.GetMinimumVersion(platform), version, 2) < 0 {
+		context.SetData("updateRequired", true)
+		if storeURL := config.Config.Platform.GetStoreURL(platform); storeURL != "" {
+			context.SetData("storeUrl", storeURL)
+		}
+		context.Fail("Client version is behind server.  Please update client!")
+		return
 	}
 
 	// update client values
-	context.Client.Version = version
-	context.Client.Save()
+	context.Client().Version = version
+	context.Client().Platform = platform
+	context.Client().Save()
 	context.SetData("config", data.GameplayConfigJSON)
+	context.SetData("serverVersion", config.Config.Platform.Version)
 }
 
 func UserLogin(context *util.Context) {
 	// parse parameters
-	reset := context.Params.GetBool("reset", false)
-	development := context.Params.GetBool("development", false)
+	reset := context.Params.GetRequiredBool("reset")
+	development := context.Params.GetRequiredBool("development")
 
 	// reset player data, if requested
 	if reset {
@@ -0,0 +1,178 @@
+package controllers
+
+import (
+	"fmt"
+	"time"
+
+	"gopkg.in/mgo.v2/bson"
+
+	"bloodtales/models"
+	"bloodtales/system"
+	"bloodtales/util"
+)
+
+func handleWar() {
+	handleGameAPI("/guild/war/current", system.TokenAuthentication, GetCurrentGuildWar).Describe("Get the newest war of the player's guild").Returns(
+		system.Data("war", "object", "Guild war with scores (null when the guild has never been paired)"),
+	)
+	handleGameAPI("/guild/war/battle", system.TokenAuthentication, GuildWarBattle).Describe("Challenge the opposing guild to a war battle").Params(
+		system.Required("message", util.StringParam, "Message"),
+		system.Required("arenaName", util.StringParam, "Arena name"),
+	).Returns(
+		system.Data("roomId", "string", "Match room ID"),
+		system.Data("arenaName", "string", "Arena name"),
+	)
+	handleGameAPI("/guild/war/claim", system.TokenAuthentication, ClaimGuildWarReward).Describe("Claim the reward for a completed war the player battled in").Params(
+		system.Required("warId", util.IdParam, "Guild war ID"),
+	).Returns(
+		system.Data("rewards", "array", "War rewards"),
+	)
+}
+
+func GetCurrentGuildWar(context *util.Context) {
+	player := GetPlayer(context)
+
+	var client *models.GuildWarClient
+	if player.IsInGuild() {
+		war, err := models.GetGuildWar(context, player.GuildID)
+		util.Must(err)
+
+		if war != nil {
+			client = war.GetClient(player)
+		}
+	}
+
+	context.SetData("war", client)
+}
+
+func GuildWarBattle(context *util.Context) {
+	// parse parameters
+	message := context.Params.GetRequiredString("message")
+	arenaName := context.Params.GetRequiredString("arenaName")
+
+	// matchmaking banned players cannot battle
+	if !system.RequireNoSanction(context, models.SanctionMatchmakingBan) {
+		return
+	}
+
+	player := GetPlayer(context)
+	if !player.IsInGuild() {
+		context.Fail("Player is not in a guild")
+		return
+	}
+
+	war, err := models.GetGuildWar(context, player.GuildID)
+	util.Must(err)
+	if war == nil || !war.IsActive(time.Now()) {
+		context.Fail("Guild is not at war")
+		return
+	}
+	opponent := war.Sides[1 - war.GetSide(player.GuildID)]
+
+	// generate Room ID
+	roomID := util.GenerateUUID()
+	data := map[string]interface{}{
+		"roomId": roomID,
+		"arenaName": arenaName,
+		"warId": war.ID.Hex(),
+		"matchStarted": false,
+	}
+	expiresAt := time.Now().Add(time.Hour)
+	if expiresAt.After(war.EndTime) {
+		expiresAt = war.EndTime
+	}
+
+	sendGuildWarNotification(context, player, opponent.GuildID, "GuildWarBattle", message, data, expiresAt)
+
+	context.SetData("roomId", roomID)
+	context.SetData("arenaName", arenaName)
+}
+
+// challenge the members of the opposing guild, stored in their guild feed
+func sendGuildWarNotification(context *util.Context, senderPlayer *models.Player, guildId bson.ObjectId, notificationType string, message string, data map[string]interface{}, expiresAt time.Time) {
+	playerClient, err := senderPlayer.GetPlayerClient(context)
+	util.Must(err)
+
+	memberPlayers, err := models.GetPlayersByGuild(context, guildId)
+	util.Must(err)
+
+	// create notification
+	notification := &models.Notification{
+		SenderID:   senderPlayer.ID,
+		ReceiverID: guildId,
+		Guild:      true,
+		ExpiresAt:  expiresAt,
+		Type:       notificationType,
+		Message:    message,
+		SenderName: playerClient.Name,
+		Actions: []models.NotificationAction{
+			models.NotificationAction{
+				Name:  "Accept",
+				Value: "accept",
+			},
+			models.NotificationAction{
+				Name:  "Decline",
+				Value: "decline",
+			},
+		},
+		Data: data,
+	}
+	util.Must(notification.Save(context))
+
+	for _, memberPlayer := range memberPlayers {
+		// notify receiver
+		socketData := map[string]interface{}{"notification": notification, "player": playerClient}
+		system.SocketSend(context, memberPlayer.UserID, notificationType, socketData)
+	}
+}
+
+func respondGuildWarBattle(context *util.Context, notification *models.Notification, action string) {
+	if action != "accept" {
+		return
+	}
+	if notification.Data["matchStarted"] != false {
+		util.Must(util.NewError("Guild war battle has already begun"))
+	}
+
+	// matchmaking banned players cannot battle
+	if !system.RequireNoSanction(context, models.SanctionMatchmakingBan) {
+		return
+	}
+
+	// only the challenged guild can accept
+	player := GetPlayer(context)
+	if !player.IsInGuild() || player.GuildID != notification.ReceiverID {
+		util.Must(util.NewError("Guild war battle is for another guild"))
+	}
+
+	warId, _ := notification.Data["warId"].(string)
+	if !bson.IsObjectIdHex(warId) {
+		util.Must(util.NewError(fmt.Sprintf("Invalid guild war: %s", warId)))
+	}
+	war, err := models.GetGuildWarById(context, bson.ObjectIdHex(warId))
+	util.Must(err)
+
+	// claim the challenge before starting the match, so concurrent accepts cannot both start one
+	started, err := notification.SwapData(context, "matchStarted", false, true)
+	util.Must(err)
+	if !started {
+		util.Must(util.NewError("Guild war battle has already begun"))
+	}
+
+	roomID := notification.Data["roomId"].(string)
+	arenaName := notification.Data["arenaName"].(string)
+	_, err = models.StartWarMatch(context, war, notification.SenderID, player.ID, roomID, arenaName)
+	util.Must(err)
+}
+
+func ClaimGuildWarReward(context *util.Context) {
+	// parse parameters
+	warId := context.Params.GetRequiredId("warId")
+
+	player := GetPlayer(context)
+
+	rewards, err := player.ClaimGuildWarReward(context, warId)
+	util.Must(err)
+
+	context.SetData("rewards", rewards)
+}
@@ -0,0 +1,82 @@
+package data
+
+import (
+	"encoding/json"
+
+	"bloodtales/util"
+)
+
+// guild level and the perks it unlocks
+type GuildLevelData struct {
+	ID 							int 		`json:"id,string"`
+	XPRequired 					int 		`json:"xpRequired,string"`
+	MemberLimit 				int 		`json:"memberLimit,string"`
+	TomeMultiplier 				float64 	`json:"tomeMultiplier,string"`
+	Banner 						string 		`json:"banner"` // cosmetic banner unlocked at this level (optional)
+}
+
+var guildLevels []GuildLevelData
+
+type GuildLevelsParsed struct {
+	GuildLevels 			[]GuildLevelData
+}
+
+// data processor
+func LoadGuildLevels(raw []byte) {
+	container := &GuildLevelsParsed {}
+	util.Must(json.Unmarshal(raw, container))
+
+	guildLevels = container.GuildLevels
+}
+
+// level reached with the given XP (1 when there is no guild level data)
+func GetGuildLevel(xp int) (level int) {
+	level = 1
+	for _, levelData := range guildLevels {
+		if xp >= levelData.XPRequired {
+			level = levelData.ID
+		} else {
+			break
+		}
+	}
+	return
+}
+
+// perks of a level, levels without data have the gameplay defaults
+func GetGuildLevelData(level int) *GuildLevelData {
+	for i, levelData := range guildLevels {
+		if levelData.ID == level {
+			return &guildLevels[i]
+		}
+	}
+
+	return &GuildLevelData {
+		ID: level,
+		MemberLimit: GameplayConfig.GuildMemberLimit,
+		TomeMultiplier: 1,
+	}
+}
+
+// XP required for the level after the given one (0 at the highest level)
+func GetGuildNextLevelXP(level int) int {
+	for _, levelData := range guildLevels {
+		if levelData.ID > level {
+			return levelData.XPRequired
+		}
+	}
+	return 0
+}
+
+// banners unlocked up to a level
+func GetGuildBanners(level int) (banners []string) {
+	banners = []string {}
+	for _, levelData := range guildLevels {
+		if levelData.ID > level {
+			break
+		}
+		if levelData.Banner != "" {
+			banners = append(banners, levelData.Banner)
+		}
+	}
+	return
+}
@@ -5,10 +5,16 @@ import (
 	"strings"
 	"io/ioutil"
 	"net/http"
+	"os"
 
+	"bloodtales/config"
+	"bloodtales/log"
 	"bloodtales/util"
 )
 
+// data set used by test binaries when DATA_URL is not set
+const TestDataURL = "file://testing/data"
+
 // initialize data system
 func init() {
 	// create data table
@@ -33,36 +39,97 @@ func init() {
 	loadDataFile("GameData/ExcelConverted/Rarity.json", LoadRarityData)
 	loadDataFile("GameData/Definitions/QuestTypes.txt", LoadQuestData)
 	loadDataFile("GameData/ExcelConverted/TutorialRewards.json", LoadTutorialRewards)
+	loadOptionalDataFile("GameData/ExcelConverted/GuildLevels.json", LoadGuildLevels)
 	// ------------------------------------------
 
 	// template funcs
 	util.AddTemplateFunc("toDataName", ToDataName)
 }
 
+// check that the required data sets have entries (a file which parses to nothing leaves its set empty)
+func CheckLoaded() error {
+	sets := []struct {
+		name    string
+		count   int
+	}{
+		{"player levels", len(playerLevelProgression)},
+		{"cards", len(cards)},
+		{"card leveling", len(cardLeveling)},
+		{"tomes", len(tomes)},
+		{"tome order", len(tomeOrder)},
+		{"ranks", len(ranks)},
+		{"leagues", len(leagues)},
+		{"rewards", len(rewards)},
+		{"store items", len(storeItems)},
+		{"rarities", len(rarityData)},
+		{"quests", len(quests)},
+	}
+
+	for _, set := range sets {
+		if set.count == 0 {
+			return util.NewError(fmt.Sprintf("Game data has no %s", set.name))
+		}
+	}
+	return nil
+}
+
 // load a particular file into a container
 func loadDataFile(fileName string, processor func([]byte)) {
+	body, found, err := readDataFile(fileName)
+	util.Must(err)
+	if !found {
+		util.Must(util.NewError(fmt.Sprintf("Data file not found: %s", fileName)))
+	}
+
+	// process
+	processor(body)
+}
+
+// load a file which older data sets may not have yet (the processor is skipped when missing)
+func loadOptionalDataFile(fileName string, processor func([]byte)) {
+	body, found, err := readDataFile(fileName)
+	util.Must(err)
+	if !found {
+		log.Warningf("Optional data file not found: %s", fileName)
+		return
+	}
+
+	// process
+	processor(body)
+}
+
+func readDataFile(fileName string) (body []byte, found bool, err error) {
 	// get file path
-	dataPath := util.Env.GetRequiredString("DATA_URL")
+	var dataPath string
+	if config.Env.Test {
+		dataPath = util.Env.GetString("DATA_URL", TestDataURL)
+	} else {
+		dataPath = util.Env.GetRequiredString("DATA_URL")
+	}
 	filePath := fmt.Sprintf("%s/%s", dataPath, fileName)
 
-	var body []byte
-	var err error
-
 	if strings.HasPrefix(filePath, "file://") {
 		// read file from local
-		body, err = ioutil.ReadFile(filePath)
-		util.Must(err)
+		body, err = ioutil.ReadFile(strings.TrimPrefix(filePath, "file://"))
+		if os.IsNotExist(err) {
+			return nil, false, nil
+		}
 	} else {
 		// read file from URL
 		var response *http.Response
 		response, err = http.Get(filePath)
+		if err != nil {
+			return
+		}
 		defer response.Body.Close()
-		util.Must(err)
+
+		if response.StatusCode == http.StatusNotFound {
+			return nil, false, nil
+		}
 
 		body, err = ioutil.ReadAll(response.Body)
-		util.Must(err)
 	}
 
-	// process
-	processor(body)
+	found = err == nil
+	return
 }
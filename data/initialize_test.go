@@ -0,0 +1,21 @@
+package data
+
+import (
+	"testing"
+)
+
+func TestCheckLoaded(t *testing.T) {
+	if err := CheckLoaded(); err != nil {
+		t.Fatalf("Test data failed the load check: %v", err)
+	}
+
+	// an empty data set fails it
+	loadedCards := cards
+	cards = map[DataId]*CardData {}
+	defer func() {
+		cards = loadedCards
+	}()
+	if err := CheckLoaded(); err == nil {
+		t.Errorf("Load check passed without cards")
+	}
+}
@@ -2,8 +2,15 @@ package log
 
 import (
 	golog "log"
+	"os"
 	"fmt"
+	"sort"
+	"sync"
+	"time"
+	"errors"
 	"regexp"
+	"strings"
+	"encoding/json"
 )
 
 type Color int
@@ -19,85 +26,307 @@ const (
 	ColorWhite
 )
 
+// log level
+type Level int
+const (
+	LevelDebug Level = iota
+	LevelInfo
+	LevelWarning
+	LevelError
+)
+
+// output format
+type Format string
+const (
+	ConsoleFormat Format = "console"
+	JSONFormat = "json"
+)
+
+// structured entry fields
+type Fields map[string]interface{}
+
+// log entry with fields attached to every message
+type Entry struct {
+	fields          Fields
+}
+
+// logger options
+type Options struct {
+	Format          Format
+	Level           Level
+	Sampling        map[string]int // log 1 in N messages for sampled keys
+}
+
 //const escape = "\x1b"
 const escape = "\033"
 
+var (
+	// internal
+	colorTags       *regexp.Regexp = regexp.MustCompile("\\[[a-z\\-!]*\\]") // TODO - allow "\\[" and "\\]"   (?)
+	colorEscapes    *regexp.Regexp = regexp.MustCompile(escape + "\\[[0-9;]*m")
+	levelNames      []string = []string { "debug", "info", "warning", "error" }
+	options         Options = Options { Format: ConsoleFormat, Level: LevelDebug }
+	mutex           sync.Mutex
+	samples         map[string]int = map[string]int {}
+)
+
+// set logger options (format, level and sampling)
+func Configure(newOptions Options) {
+	mutex.Lock()
+	defer mutex.Unlock()
+
+	options = newOptions
+	samples = map[string]int {}
+}
+
+func ParseLevel(name string) (Level, error) {
+	for i, levelName := range levelNames {
+		if strings.EqualFold(name, levelName) {
+			return Level(i), nil
+		}
+	}
+	return LevelInfo, errors.New(fmt.Sprintf("Invalid log level: %s", name))
+}
+
+func ParseFormat(name string) (Format, error) {
+	switch Format(strings.ToLower(name)) {
+	case ConsoleFormat:
+		return ConsoleFormat, nil
+	case JSONFormat:
+		return JSONFormat, nil
+	}
+	return ConsoleFormat, errors.New(fmt.Sprintf("Invalid log format: %s", name))
+}
+
+func (level Level) String() string {
+	if level >= LevelDebug && int(level) < len(levelNames) {
+		return levelNames[level]
+	}
+	return "unknown"
+}
+
+// check if the next message for a sampled key should be logged
+func Sampled(key string) bool {
+	mutex.Lock()
+	defer mutex.Unlock()
+
+	rate := options.Sampling[key]
+	if rate <= 1 {
+		return true
+	}
+
+	count := samples[key]
+	samples[key] = (count + 1) % rate
+	return count == 0
+}
+
+func WithField(name string, value interface{}) *Entry {
+	return (&Entry {}).WithField(name, value)
+}
+
+func WithFields(fields Fields) *Entry {
+	return (&Entry {}).WithFields(fields)
+}
+
+func (entry *Entry) WithField(name string, value interface{}) *Entry {
+	return entry.WithFields(Fields { name: value })
+}
+
+func (entry *Entry) WithFields(fields Fields) *Entry {
+	combined := Fields {}
+	for name, value := range entry.fields {
+		combined[name] = value
+	}
+	for name, value := range fields {
+		combined[name] = value
+	}
+	return &Entry { fields: combined }
+}
+
+func (entry *Entry) Debugf(format string, v ...interface{}) {
+	entry.write(LevelDebug, fmt.Sprintf(format, v...))
+}
+
+func (entry *Entry) Printf(format string, v ...interface{}) {
+	entry.write(LevelInfo, fmt.Sprintf(format, v...))
+}
+
+func (entry *Entry) Warningf(format string, v ...interface{}) {
+	entry.write(LevelWarning, fmt.Sprintf("[yellow]WARNING: %s[-]", fmt.Sprintf(format, v...)))
+}
+
+func (entry *Entry) Errorf(format string, v ...interface{}) {
+	entry.write(LevelError, fmt.Sprintf("[red!]ERROR: %s[-]", fmt.Sprintf(format, v...)))
+}
+
+// write a message (with colour tags) at a level
+func (entry *Entry) write(level Level, message string) {
+	mutex.Lock()
+	current := options
+	mutex.Unlock()
+
+	if level < current.Level {
+		return
+	}
+
+	switch current.Format {
+	case JSONFormat:
+		record := map[string]interface{} {}
+		for name, value := range entry.fields {
+			if err, ok := value.(error); ok {
+				value = err.Error()
+			}
+			record[name] = value
+		}
+		record["time"] = time.Now().UTC().Format(time.RFC3339Nano)
+		record["level"] = level.String()
+		record["msg"] = Strip(message)
+
+		raw, err := json.Marshal(record)
+		if err != nil {
+			raw = []byte(fmt.Sprintf("{\"level\":\"error\",\"msg\":%q}", err.Error()))
+		}
+		fmt.Fprintln(os.Stderr, string(raw))
+
+	default:
+		golog.Println(colorize(message) + entry.formatFields())
+	}
+}
+
+// format fields for console output
+func (entry *Entry) formatFields() string {
+	if len(entry.fields) == 0 {
+		return ""
+	}
+
+	names := make([]string, 0, len(entry.fields))
+	for name, _ := range entry.fields {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	pairs := make([]string, len(names))
+	for i, name := range names {
+		pairs[i] = fmt.Sprintf("%s=%v", name, entry.fields[name])
+	}
+	return colorize(fmt.Sprintf(" [white](%s)[-]", strings.Join(pairs, " ")))
+}
+
 func RawPrint(value string) {
+	mutex.Lock()
+	format := options.Format
+	mutex.Unlock()
+
+	if format == JSONFormat {
+		(&Entry {}).write(LevelError, value)
+		return
+	}
+
 	prefix := golog.Prefix()
 	golog.SetPrefix("")
-	Print(value)
+	golog.Print(Sprintf(value))
 	golog.SetPrefix(prefix)
 }
 
+func Debug(value string) {
+	(&Entry {}).write(LevelDebug, value)
+}
+
+func Debugf(format string, v ...interface{}) {
+	(&Entry {}).Debugf(format, v...)
+}
+
 func Print(value string) {
-	golog.Print(Sprintf(value))
+	(&Entry {}).write(LevelInfo, value)
 }
 
 func Println(value string) {
-	golog.Println(Sprintf(value))
+	(&Entry {}).write(LevelInfo, value)
 }
 
 func Printf(format string, v ...interface{}) {
-	golog.Println(Sprintf(format, v...))
+	(&Entry {}).Printf(format, v...)
 }
 
 func Warning(value interface{}) {
-	Printf("[yellow]WARNING: %v[-]", value)
+	(&Entry {}).Warningf("%v", value)
 }
 
 func Warningf(format string, v ...interface{}) {
-	Printf(fmt.Sprintf("[yellow]WARNING: %s[-]", format), v...)
+	(&Entry {}).Warningf(format, v...)
 }
 
 func Error(value interface{}) {
-	Printf("[red!]ERROR: %v[-]", value)
+	(&Entry {}).Errorf("%v", value)
 }
 
 func Errorf(format string, v ...interface{}) {
-	Printf(fmt.Sprintf("[red!]ERROR: %s[-]", format), v...)
+	(&Entry {}).Errorf(format, v...)
 }
 
 func Sprintf(format string, v ...interface{}) string {
-	r, _ := regexp.Compile("\\[[a-z\\-!]*\\]") // TODO - allow "\\[" and "\\]"   (?)
-	return fmt.Sprintf(r.ReplaceAllStringFunc(format, func(match string) string {
-		switch match {
-			case "[black]":
-				return formatColor(ColorBlack, false)
-			case "[red]":
-				return formatColor(ColorRed, false)
-			case "[green]":
-				return formatColor(ColorGreen, false)
-			case "[yellow]":
-				return formatColor(ColorYellow, false)
-			case "[blue]":
-				return formatColor(ColorBlue, false)
-			case "[magenta]":
-				return formatColor(ColorMagenta, false)
-			case "[cyan]":
-				return formatColor(ColorCyan, false)
-			case "[white]":
-				return formatColor(ColorWhite, false)
-			case "[black!]":
-				return formatColor(ColorBlack, true)
-			case "[red!]":
-				return formatColor(ColorRed, true)
-			case "[green!]":
-				return formatColor(ColorGreen, true)
-			case "[yellow!]":
-				return formatColor(ColorYellow, true)
-			case "[blue!]":
-				return formatColor(ColorBlue, true)
-			case "[magenta!]":
-				return formatColor(ColorMagenta, true)
-			case "[cyan!]":
-				return formatColor(ColorCyan, true)
-			case "[white!]":
-				return formatColor(ColorWhite, true)
-			case "[-]":
-				return formatColor(ColorClear, false)
+	return fmt.Sprintf(colorize(format), v...)
+}
+
+// remove colour tags (and already formatted colours)
+func Strip(value string) string {
+	value = colorEscapes.ReplaceAllString(value, "")
+	return colorTags.ReplaceAllStringFunc(value, func(match string) string {
+		if _, ok := getColor(match); ok {
+			return ""
+		}
+		return match
+	})
+}
+
+// replace colour tags with terminal escapes
+func colorize(value string) string {
+	return colorTags.ReplaceAllStringFunc(value, func(match string) string {
+		if color, ok := getColor(match); ok {
+			return color
 		}
 		return match
-	}), v...)
+	})
+}
+
+func getColor(tag string) (string, bool) {
+	switch tag {
+		case "[black]":
+			return formatColor(ColorBlack, false), true
+		case "[red]":
+			return formatColor(ColorRed, false), true
+		case "[green]":
+			return formatColor(ColorGreen, false), true
+		case "[yellow]":
+			return formatColor(ColorYellow, false), true
+		case "[blue]":
+			return formatColor(ColorBlue, false), true
+		case "[magenta]":
+			return formatColor(ColorMagenta, false), true
+		case "[cyan]":
+			return formatColor(ColorCyan, false), true
+		case "[white]":
+			return formatColor(ColorWhite, false), true
+		case "[black!]":
+			return formatColor(ColorBlack, true), true
+		case "[red!]":
+			return formatColor(ColorRed, true), true
+		case "[green!]":
+			return formatColor(ColorGreen, true), true
+		case "[yellow!]":
+			return formatColor(ColorYellow, true), true
+		case "[blue!]":
+			return formatColor(ColorBlue, true), true
+		case "[magenta!]":
+			return formatColor(ColorMagenta, true), true
+		case "[cyan!]":
+			return formatColor(ColorCyan, true), true
+		case "[white!]":
+			return formatColor(ColorWhite, true), true
+		case "[-]":
+			return formatColor(ColorClear, false), true
+	}
+	return "", false
 }
 
 func formatColor(color Color, bold bool) string {
@@ -107,4 +336,4 @@ func formatColor(color Color, bold bool) string {
 	}
 
 	return fmt.Sprintf(format, escape, int(color))
-}
\ No newline at end of file
+}
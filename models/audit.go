@@ -0,0 +1,190 @@
+package models
+
+import (
+	"fmt"
+	"time"
+	"sort"
+	"strings"
+	"reflect"
+	"crypto/sha256"
+
+	"gopkg.in/mgo.v2"
+	"gopkg.in/mgo.v2/bson"
+
+	"bloodtales/config"
+	"bloodtales/util"
+)
+
+const AuditCollectionName = "audits"
+
+// single changed field (dotted bson path)
+type AuditChange struct {
+	Field           string        `bson:"f" json:"field"`
+	Before          interface{}   `bson:"b" json:"before"`
+	After           interface{}   `bson:"a" json:"after"`
+}
+
+// admin action record
+type Audit struct {
+	ID              bson.ObjectId `bson:"_id,omitempty" json:"-"`
+	ActorID         bson.ObjectId `bson:"ac" json:"actorId"`
+	ActorName       string        `bson:"an" json:"actorName"`
+	Action          string        `bson:"act" json:"action"`
+	TargetType      string        `bson:"tt" json:"targetType"`
+	TargetID        bson.ObjectId `bson:"tid,omitempty" json:"targetId"`
+	TargetName      string        `bson:"tn,omitempty" json:"targetName"`
+	Changes         []AuditChange `bson:"ch,omitempty" json:"changes"`
+	CreatedTime     time.Time     `bson:"t0" json:"created"`
+}
+
+func ensureIndexAudit(database *mgo.Database) {
+	c := database.C(AuditCollectionName)
+
+	// actor index
+	util.Must(c.EnsureIndex(mgo.Index {
+		Key:          []string { "ac", "-t0" },
+		Background:   true,
+	}))
+
+	// target index
+	util.Must(c.EnsureIndex(mgo.Index {
+		Key:          []string { "tid", "-t0" },
+		Background:   true,
+		Sparse:       true,
+	}))
+
+	// time index
+	util.Must(c.EnsureIndex(mgo.Index {
+		Key:          []string { "-t0" },
+		Background:   true,
+	}))
+}
+
+// capture a generic snapshot of a model for later diffing, fields tagged `audit:"redact"` (secrets) keep only a fingerprint
+func AuditSnapshot(value interface{}) (snapshot bson.M) {
+	if value == nil || (reflect.ValueOf(value).Kind() == reflect.Ptr && reflect.ValueOf(value).IsNil()) {
+		return nil
+	}
+
+	raw, err := bson.Marshal(value)
+	util.Must(err)
+	util.Must(bson.Unmarshal(raw, &snapshot))
+
+	redactAuditSnapshot(reflect.Indirect(reflect.ValueOf(value)), snapshot)
+	return
+}
+
+func redactAuditSnapshot(model reflect.Value, snapshot bson.M) {
+	if model.Kind() != reflect.Struct {
+		return
+	}
+
+	modelType := model.Type()
+	for i := 0; i < modelType.NumField(); i++ {
+		field := modelType.Field(i)
+		if field.Tag.Get("audit") != "redact" {
+			continue
+		}
+
+		key := strings.Split(field.Tag.Get("bson"), ",")[0]
+		if key == "" {
+			key = strings.ToLower(field.Name)
+		}
+		if _, ok := snapshot[key]; ok {
+			snapshot[key] = auditFingerprint(model.Field(i).Interface())
+		}
+	}
+}
+
+// short hash of a redacted field value (not the snapshot map, its order varies), so audits still show it changed
+func auditFingerprint(value interface{}) string {
+	raw, err := bson.Marshal(bson.M { "v": value })
+	util.Must(err)
+
+	sum := sha256.Sum256(raw)
+	return fmt.Sprintf("%s %x", config.Redacted, sum[:4])
+}
+
+// compare two snapshots and return all changed fields
+func DiffAudit(before bson.M, after bson.M) (changes []AuditChange) {
+	diffAuditValue("", before, after, &changes)
+	return
+}
+
+func diffAuditValue(path string, before interface{}, after interface{}, changes *[]AuditChange) {
+	if reflect.DeepEqual(before, after) {
+		return
+	}
+
+	// recurse into matching documents and same length arrays
+	beforeDoc, beforeIsDoc := before.(bson.M)
+	afterDoc, afterIsDoc := after.(bson.M)
+	if beforeIsDoc && afterIsDoc {
+		// sorted union of keys for stable output
+		keys := []string {}
+		for key, _ := range beforeDoc {
+			keys = append(keys, key)
+		}
+		for key, _ := range afterDoc {
+			if _, ok := beforeDoc[key]; !ok {
+				keys = append(keys, key)
+			}
+		}
+		sort.Strings(keys)
+
+		for _, key := range keys {
+			diffAuditValue(joinAuditPath(path, key), beforeDoc[key], afterDoc[key], changes)
+		}
+		return
+	}
+
+	beforeList, beforeIsList := before.([]interface{})
+	afterList, afterIsList := after.([]interface{})
+	if beforeIsList && afterIsList && len(beforeList) == len(afterList) {
+		for i, _ := range beforeList {
+			diffAuditValue(joinAuditPath(path, fmt.Sprintf("%d", i)), beforeList[i], afterList[i], changes)
+		}
+		return
+	}
+
+	*changes = append(*changes, AuditChange {
+		Field: path,
+		Before: before,
+		After: after,
+	})
+}
+
+func joinAuditPath(path string, key string) string {
+	if path == "" {
+		return key
+	}
+	return fmt.Sprintf("%s.%s", path, key)
+}
+
+func InsertAudit(context *util.Context, actor *User, action string, targetType string, targetID bson.ObjectId, targetName string, before bson.M, after bson.M) (err error) {
+	audit := &Audit {
+		ID: bson.NewObjectId(),
+		Action: action,
+		TargetType: targetType,
+		TargetID: targetID,
+		TargetName: targetName,
+		Changes: DiffAudit(before, after),
+		CreatedTime: time.Now(),
+	}
+
+	if actor != nil {
+		audit.ActorID = actor.ID
+		audit.ActorName = actor.Username
+		if audit.ActorName == "" {
+			audit.ActorName = actor.Name
+		}
+	}
+
+	err = Audits.Insert(context, audit)
+	return
+}
+
+func GetAuditById(context *util.Context, id bson.ObjectId) (audit *Audit, err error) {
+	return Audits.GetById(context, id)
+}
+
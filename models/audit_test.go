@@ -0,0 +1,37 @@
+package models
+
+import (
+	"strings"
+	"testing"
+
+	"bloodtales/config"
+)
+
+func TestAuditSnapshotRedactsUserSecrets(t *testing.T) {
+	user := newUserWithUsername("admin", "secret", "UTC", true)
+	user.Credentials = []Credential { Credential { Provider: "google", ID: "google-subject" } }
+	user.Devices = []Device { Device { ID: "device-uuid" } }
+
+	before := AuditSnapshot(user)
+	for _, key := range []string { "ps", "cds", "dvs" } {
+		value, ok := before[key].(string)
+		if !ok || !strings.HasPrefix(value, config.Redacted) {
+			t.Errorf("Snapshot %s = %v, want it redacted", key, before[key])
+		}
+	}
+	if before["un"] != "admin" {
+		t.Errorf("Snapshot un = %v, want admin", before["un"])
+	}
+
+	// changed secrets still show up as changed, without their values
+	user.HashPassword("changed")
+	changes := DiffAudit(before, AuditSnapshot(user))
+	if len(changes) != 1 || changes[0].Field != "ps" {
+		t.Fatalf("Changes = %v, want only ps", changes)
+	}
+	for _, value := range []interface{} { changes[0].Before, changes[0].After } {
+		if text, ok := value.(string); !ok || !strings.HasPrefix(text, config.Redacted) {
+			t.Errorf("Changed password = %v, want it redacted", value)
+		}
+	}
+}
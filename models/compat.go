@@ -0,0 +1,27 @@
+package models
+
+import (
+	"bloodtales/util"
+)
+
+// client payload shapes (as written by custom marshalling)
+var (
+	StoreItemPayload *util.PayloadType = util.NewPayloadType("storeItem", "productId", "itemId", "rewardIds", "currency")
+	TomePayload *util.PayloadType = util.NewPayloadType("tome", "tomeId", "state", "unlockTime")
+	QuestPayload *util.PayloadType = util.NewPayloadType("quest", "id", "expireTime", "properties")
+)
+
+// adapters for supported older clients, newest first
+func init() {
+	// 0.4 clients predate leagues on tomes and quests, and bulk store purchases
+	TomePayload.Adapt("0.4", func(payload map[string]interface{}) {
+		delete(payload, "league")
+	})
+	QuestPayload.Adapt("0.4", func(payload map[string]interface{}) {
+		delete(payload, "league")
+	})
+	StoreItemPayload.Adapt("0.4", func(payload map[string]interface{}) {
+		delete(payload, "numAvailable")
+		delete(payload, "bulkCost")
+	})
+}
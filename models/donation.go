@@ -0,0 +1,429 @@
+package models
+
+import (
+	"fmt"
+	"time"
+	"encoding/json"
+
+	"gopkg.in/mgo.v2"
+	"gopkg.in/mgo.v2/bson"
+
+	"bloodtales/config"
+	"bloodtales/data"
+	"bloodtales/util"
+)
+
+const CardRequestCollectionName = "cardRequests"
+const CardDonationCollectionName = "cardDonations"
+
+// donations recorded on the donor when debited (enough to outlast the recovery timeout)
+const maxDebitedDonations = 20
+
+// guild member's request for copies of a card
+type CardRequest struct {
+	ID              bson.ObjectId  `bson:"_id,omitempty" json:"id"`
+	GuildID         bson.ObjectId  `bson:"gd" json:"-"`
+	PlayerID        bson.ObjectId  `bson:"pl" json:"-"`
+	CardID          data.DataId    `bson:"cd" json:"-"`
+	Rarity          string         `bson:"ra" json:"rarity"`
+	Requested       int            `bson:"rq" json:"requested"`
+	Remaining       int            `bson:"rm" json:"remaining"` // copies not yet reserved by donations
+	Donated         map[string]int `bson:"dn,omitempty" json:"-"` // copies reserved by each donor (by player ID hex)
+	Reservations    []bson.ObjectId `bson:"rs,omitempty" json:"-"` // donations holding reserved copies
+	OpenPlayerID    bson.ObjectId  `bson:"op,omitempty" json:"-"` // requester until the request is closed (unique)
+	CreatedAt       time.Time      `bson:"t0" json:"created"`
+	ExpiresAt       time.Time      `bson:"t1" json:"expires"`
+}
+
+// client model
+type CardRequestClientAlias CardRequest
+type CardRequestClient struct {
+	CardID          string         `json:"cardId"`
+	Name            string         `json:"name"`
+	Tag             string         `json:"tag"`
+
+	*CardRequestClientAlias
+}
+
+type CardDonationState int
+const (
+	CardDonationPending CardDonationState = iota // copies reserved on the request
+	CardDonationSent                             // donor's copies removed and donor rewarded
+	CardDonationReceived                         // copies added to the recipient
+	CardDonationFailed                           // reservation released
+)
+
+// transfer of card copies between two guild members, applied to the donor when donated
+// and to the recipient when collected, each side exactly once
+type CardDonation struct {
+	ID              bson.ObjectId      `bson:"_id,omitempty" json:"id"`
+	RequestID       bson.ObjectId      `bson:"rq" json:"requestId"`
+	GuildID         bson.ObjectId      `bson:"gd" json:"-"`
+	DonorID         bson.ObjectId      `bson:"dr" json:"-"`
+	RecipientID     bson.ObjectId      `bson:"rc" json:"-"`
+	CardID          data.DataId        `bson:"cd" json:"-"`
+	Count           int                `bson:"n" json:"count"`
+	State           CardDonationState  `bson:"st" json:"-"`
+	CreatedAt       time.Time          `bson:"t0" json:"created"`
+	UpdatedAt       time.Time          `bson:"t1" json:"-"`
+}
+
+// client model
+type CardDonationClientAlias CardDonation
+type CardDonationClient struct {
+	CardID          string         `json:"cardId"`
+
+	*CardDonationClientAlias
+}
+
+func ensureIndexDonation(database *mgo.Database) {
+	c := database.C(CardRequestCollectionName)
+
+	// guild index
+	util.Must(c.EnsureIndex(mgo.Index {
+		Key:        []string { "gd", "-t0" },
+		Background: true,
+	}))
+
+	// player index
+	util.Must(c.EnsureIndex(mgo.Index {
+		Key:        []string { "pl", "ra", "-t0" },
+		Background: true,
+	}))
+
+	// one open request per player
+	util.Must(c.EnsureIndex(mgo.Index {
+		Key:        []string { "op" },
+		Unique:     true,
+		Sparse:     true,
+		Background: true,
+	}))
+
+	c = database.C(CardDonationCollectionName)
+
+	// recipient index
+	util.Must(c.EnsureIndex(mgo.Index {
+		Key:        []string { "rc", "st" },
+		Background: true,
+	}))
+
+	// request/donor index
+	util.Must(c.EnsureIndex(mgo.Index {
+		Key:        []string { "rq", "dr" },
+		Background: true,
+	}))
+
+	// recovery index
+	util.Must(c.EnsureIndex(mgo.Index {
+		Key:        []string { "st", "t1" },
+		Background: true,
+	}))
+}
+
+// custom marshalling
+func (donation *CardDonation) MarshalJSON() ([]byte, error) {
+	return json.Marshal(&CardDonationClient {
+		CardID: data.ToDataName(donation.CardID),
+		CardDonationClientAlias: (*CardDonationClientAlias)(donation),
+	})
+}
+
+func (request *CardRequest) IsOpen(now time.Time) bool {
+	return request.Remaining > 0 && now.Before(request.ExpiresAt)
+}
+
+// copies reserved by a donor
+func (request *CardRequest) GetDonated(donorId bson.ObjectId) int {
+	return request.Donated[donorId.Hex()]
+}
+
+// donor copies with a change applied (for repositories without $inc)
+func (request *CardRequest) withDonated(donorId bson.ObjectId, count int) map[string]int {
+	donated := map[string]int {}
+	for id, copies := range request.Donated {
+		donated[id] = copies
+	}
+	donated[donorId.Hex()] += count
+	return donated
+}
+
+// donation recorded on a donor by the debit (for repositories without $push)
+func withDebitedDonation(ids []bson.ObjectId, id bson.ObjectId) []bson.ObjectId {
+	ids = append(append([]bson.ObjectId {}, ids...), id)
+	if len(ids) > maxDebitedDonations {
+		ids = ids[len(ids) - maxDebitedDonations:]
+	}
+	return ids
+}
+
+func (player *Player) HasDebitedDonation(id bson.ObjectId) bool {
+	for _, debited := range player.DonationIDs {
+		if debited == id {
+			return true
+		}
+	}
+	return false
+}
+
+// requester's name and tag for clients
+func (request *CardRequest) GetClient(context *util.Context) *CardRequestClient {
+	client := &CardRequestClient {
+		CardID: data.ToDataName(request.CardID),
+		CardRequestClientAlias: (*CardRequestClientAlias)(request),
+	}
+	if player, err := GetPlayerById(context, request.PlayerID); err == nil {
+		if user, err := GetUserById(context, player.UserID); err == nil {
+			client.Name = user.Name
+			client.Tag = user.Tag
+		}
+	}
+	return client
+}
+
+func GetCardRequestById(context *util.Context, id bson.ObjectId) (request *CardRequest, err error) {
+	return Donations.GetRequestById(context, id)
+}
+
+// open requests of a guild, newest first
+func GetGuildCardRequests(context *util.Context, guildId bson.ObjectId) (requests []*CardRequest, err error) {
+	return Donations.GetOpenRequestsByGuild(context, guildId, time.Now())
+}
+
+// ask guildmates for copies of an owned card, one open request at a time (marked on the request, so
+// concurrent requests cannot both be inserted) and once per rarity cooldown
+func (player *Player) RequestCard(context *util.Context, cardId data.DataId) (request *CardRequest, err error) {
+	if !player.IsInGuild() {
+		err = util.NewError("Player is not in a guild")
+		return
+	}
+
+	card := player.GetCard(cardId)
+	if card == nil {
+		err = util.NewError("Player does not own the card")
+		return
+	}
+
+	rarity := card.GetData().Rarity
+	rules := config.Config.Guilds.GetDonation(rarity)
+	if rules == nil {
+		err = util.NewError(fmt.Sprintf("Cards of rarity %s cannot be requested", rarity))
+		return
+	}
+
+	now := time.Now()
+	last, err := Donations.GetLatestRequest(context, player.ID, rarity)
+	if err == nil {
+		if available := last.CreatedAt.Add(rules.RequestCooldown.Duration); now.Before(available) {
+			err = util.NewError(fmt.Sprintf("Next %s card request available in %v", rarity, available.Sub(now)))
+			return
+		}
+	} else if err != mgo.ErrNotFound {
+		return
+	}
+
+	request = &CardRequest {
+		ID: bson.NewObjectId(),
+		GuildID: player.GuildID,
+		PlayerID: player.ID,
+		CardID: cardId,
+		Rarity: rarity,
+		Requested: rules.RequestCopies,
+		Remaining: rules.RequestCopies,
+		CreatedAt: now,
+		ExpiresAt: now.Add(config.Config.Guilds.RequestDuration.Duration),
+		OpenPlayerID: player.ID,
+	}
+
+	// unmark closed requests, so only a still open one blocks the insert
+	if err = Donations.CloseRequests(context, player.ID, now); err != nil {
+		return
+	}
+	if err = Donations.InsertRequest(context, request); mgo.IsDup(err) {
+		request = nil
+		err = util.NewError("Player already has an open card request")
+	}
+	return
+}
+
+// donate copies to a guildmate's request. The copies are reserved on the request first (so concurrent
+// donors cannot overfill it or exceed their cap), then removed from the donor in one conditional update
+// (so concurrent donations cannot overspend), rewarding the donor; the recipient collects them. Both
+// steps are recorded under the donation, so RecoverCardDonations can settle an interrupted one.
+func (donor *Player) DonateCard(context *util.Context, requestId bson.ObjectId, count int) (donation *CardDonation, err error) {
+	request, err := Donations.GetRequestById(context, requestId)
+	if err != nil {
+		return
+	}
+
+	now := time.Now()
+	switch {
+	case !donor.IsInGuild() || request.GuildID != donor.GuildID:
+		err = util.NewError("Card request is not from the player's guild")
+	case request.PlayerID == donor.ID:
+		err = util.NewError("Players cannot donate to their own card request")
+	case !request.IsOpen(now):
+		err = util.NewError("Card request is closed")
+	case count <= 0:
+		err = util.NewError("Donation must be at least one card")
+	}
+	if err != nil {
+		return
+	}
+
+	rules := config.Config.Guilds.GetDonation(request.Rarity)
+	if rules == nil {
+		err = util.NewError(fmt.Sprintf("Cards of rarity %s cannot be donated", request.Rarity))
+		return
+	}
+
+	// per donor cap (enforced again when reserving)
+	capError := util.NewError(fmt.Sprintf("At most %d %s cards can be donated per request", rules.DonationCopies, request.Rarity))
+	if request.GetDonated(donor.ID) + count > rules.DonationCopies {
+		err = capError
+		return
+	}
+
+	card := donor.GetCard(request.CardID)
+	if card == nil || card.CardCount < count {
+		err = util.NewError("Not enough cards to donate")
+		return
+	}
+
+	donation = &CardDonation {
+		ID: bson.NewObjectId(),
+		RequestID: request.ID,
+		GuildID: request.GuildID,
+		DonorID: donor.ID,
+		RecipientID: request.PlayerID,
+		CardID: request.CardID,
+		Count: count,
+		State: CardDonationPending,
+		CreatedAt: now,
+		UpdatedAt: now,
+	}
+	if err = Donations.InsertDonation(context, donation); err != nil {
+		return
+	}
+
+	// reserve
+	if err = Donations.ReserveCopies(context, donation, rules.DonationCopies, now); err != nil {
+		Donations.SetDonationState(context, donation.ID, CardDonationPending, CardDonationFailed)
+		if err == mgo.ErrNotFound {
+			err = util.NewError("Card request is already filled")
+			if current, getErr := Donations.GetRequestById(context, request.ID); getErr == nil && current.GetDonated(donor.ID) + count > rules.DonationCopies {
+				err = capError
+			}
+		}
+		return
+	}
+
+	// apply to the donor, failing when the copies were spent concurrently
+	standardCurrency, xp := rules.StandardCurrency * count, rules.XP * count
+	if err = Players.DebitDonation(context, donation, bson.M { "cs": standardCurrency, "xp": xp }); err != nil {
+		Donations.ReleaseCopies(context, donation)
+		Donations.SetDonationState(context, donation.ID, CardDonationPending, CardDonationFailed)
+		if err == mgo.ErrNotFound {
+			err = util.NewError("Not enough cards to donate")
+		}
+		return
+	}
+	card.CardCount -= count
+	donor.StandardCurrency += standardCurrency
+	donor.XP += xp
+	donor.DonationIDs = withDebitedDonation(donor.DonationIDs, donation.ID)
+
+	if err = Donations.SetDonationState(context, donation.ID, CardDonationPending, CardDonationSent); err != nil {
+		return
+	}
+	donation.State = CardDonationSent
+	donor.SetDirty(PlayerDataMask_Cards, PlayerDataMask_Currency, PlayerDataMask_XP)
+
+	// donations count towards the guild
+	donor.addGuildProgress(context, GuildProgress { XP: config.Config.Guilds.DonationXP * count })
+	return
+}
+
+// settle pending donations interrupted before their final state (e.g. by a restart): sent when the donor
+// was debited, failed with the reserved copies released otherwise. Only donations last updated before the
+// given time are settled, since newer ones may still be in progress.
+func RecoverCardDonations(context *util.Context, before time.Time) (sent int, failed int, err error) {
+	donations, err := Donations.GetStalePendingDonations(context, before)
+	if err != nil {
+		return
+	}
+
+	for _, donation := range donations {
+		donor, getErr := GetPlayerById(context, donation.DonorID)
+		if getErr != nil && getErr != mgo.ErrNotFound {
+			err = getErr
+			return
+		}
+
+		if getErr == nil && donor.HasDebitedDonation(donation.ID) {
+			if err = Donations.SetDonationState(context, donation.ID, CardDonationPending, CardDonationSent); err == nil {
+				sent++
+			}
+		} else {
+			// the copies may never have been reserved
+			if err = Donations.ReleaseCopies(context, donation); err != nil && err != mgo.ErrNotFound {
+				return
+			}
+			if err = Donations.SetDonationState(context, donation.ID, CardDonationPending, CardDonationFailed); err == nil {
+				failed++
+			}
+		}
+
+		// skip donations settled concurrently
+		if err == mgo.ErrNotFound {
+			err = nil
+		} else if err != nil {
+			return
+		}
+	}
+	return
+}
+
+// add donated copies waiting for the player, each donation once: claimed first (so concurrent collects
+// skip it), then credited in one update, returning it to be collected again when crediting fails
+func (player *Player) CollectCardDonations(context *util.Context) (collected []*CardDonation, err error) {
+	donations, err := Donations.GetDonationsByRecipient(context, player.ID, CardDonationSent)
+	if err != nil {
+		return
+	}
+
+	for _, donation := range donations {
+		// skip donations collected concurrently
+		if err = Donations.SetDonationState(context, donation.ID, CardDonationSent, CardDonationReceived); err == mgo.ErrNotFound {
+			err = nil
+			continue
+		} else if err != nil {
+			return
+		}
+
+		if err = player.creditDonation(context, donation); err != nil {
+			Donations.SetDonationState(context, donation.ID, CardDonationReceived, CardDonationSent)
+			return
+		}
+		donation.State = CardDonationReceived
+		collected = append(collected, donation)
+	}
+	return
+}
+
+// add donated copies to the stored player in one update. Requests are only made for owned cards,
+// so the whole player is saved only as a fallback when the card is missing.
+func (player *Player) creditDonation(context *util.Context, donation *CardDonation) (err error) {
+	owned := player.GetCard(donation.CardID) != nil
+	if owned {
+		if err = Players.UpdateCardCount(context, player.ID, donation.CardID, donation.Count, nil); err != nil {
+			return
+		}
+	}
+
+	player.AddCards(donation.CardID, donation.Count)
+	player.SetDirty(PlayerDataMask_Cards)
+	if !owned {
+		err = player.Save(context)
+	}
+	return
+}
\ No newline at end of file
@@ -0,0 +1,316 @@
+package models
+
+import (
+	"sync"
+	"time"
+	"testing"
+
+	"gopkg.in/mgo.v2/bson"
+
+	"bloodtales/data"
+	"bloodtales/util"
+)
+
+func TestDonateCard(t *testing.T) {
+	cardID := data.ToDataId("CARD_MERC_SOLDIERS")
+
+	tests := []struct {
+		name       string
+		owned      int   // donor's copies
+		stored     int   // donor's stored copies when donating (spent concurrently when lower)
+		donations  []int // earlier donations, then the tested one
+		success    bool
+		donated    int   // copies donated in total
+	}{
+		{"single donation", 10, 10, []int { 3 }, true, 3},
+		{"up to the donor cap", 10, 10, []int { 5, 3 }, true, 8},
+		{"over the donor cap", 20, 20, []int { 5, 4 }, false, 5},
+		{"more than owned", 2, 2, []int { 3 }, false, 0},
+		{"copies spent concurrently", 10, 1, []int { 3 }, false, 0},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			context := newTestContext()
+			recipient := newTestPlayer(t, context)
+			donor := newTestPlayer(t, context)
+			newTestGuild(t, context, recipient, donor)
+
+			recipient.AddCards(cardID, 1)
+			donor.AddCards(cardID, test.owned - testCardCount(donor, cardID))
+			for _, player := range []*Player { recipient, donor } {
+				if err := player.Save(context); err != nil {
+					t.Fatalf("Failed to save player: %v", err)
+				}
+			}
+
+			request, err := recipient.RequestCard(context, cardID)
+			if err != nil {
+				t.Fatalf("Failed to request card: %v", err)
+			}
+
+			donor = reloadTestPlayer(t, context, donor)
+			standardCurrency := donor.StandardCurrency
+			for i, count := range test.donations {
+				last := i == len(test.donations) - 1
+				if last && test.stored != test.owned {
+					spent := test.owned - donated(test.donations[:i]) - test.stored
+					if err := Players.UpdateCardCount(context, donor.ID, cardID, -spent, nil); err != nil {
+						t.Fatalf("Failed to spend cards: %v", err)
+					}
+				}
+
+				_, err = donor.DonateCard(context, request.ID, count)
+				if !last && err != nil {
+					t.Fatalf("Failed to donate: %v", err)
+				}
+			}
+			if (err == nil) != test.success {
+				t.Fatalf("Donation error = %v, want success %v", err, test.success)
+			}
+
+			// reservations, donor's cards and rewards match the successful donations only
+			request, err = GetCardRequestById(context, request.ID)
+			if err != nil {
+				t.Fatalf("Failed to get request: %v", err)
+			}
+			if request.Requested - request.Remaining != test.donated || request.GetDonated(donor.ID) != test.donated {
+				t.Errorf("Reserved %d (%d by donor), want %d", request.Requested - request.Remaining, request.GetDonated(donor.ID), test.donated)
+			}
+
+			stored := reloadTestPlayer(t, context, donor)
+			if count := testCardCount(stored, cardID); count != test.stored - test.donated {
+				t.Errorf("Donor cards = %d, want %d", count, test.stored - test.donated)
+			}
+			if reward := stored.StandardCurrency - standardCurrency; reward != test.donated * 5 {
+				t.Errorf("Donor reward = %d, want %d", reward, test.donated * 5)
+			}
+
+			sent, err := Donations.GetDonationsByRecipient(context, recipient.ID, CardDonationSent)
+			if err != nil {
+				t.Fatalf("Failed to get donations: %v", err)
+			}
+			if donated(donationCounts(sent)) != test.donated {
+				t.Errorf("Sent donations = %d copies, want %d", donated(donationCounts(sent)), test.donated)
+			}
+		})
+	}
+}
+
+func TestCollectCardDonations(t *testing.T) {
+	cardID := data.ToDataId("CARD_MERC_SOLDIERS")
+
+	tests := []struct {
+		name      string
+		deleted   bool // recipient missing from storage when crediting
+		collected int
+	}{
+		{"credited once", false, 4},
+		{"failed credit is collected again", true, 0},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			context := newTestContext()
+			recipient := newTestPlayer(t, context)
+			donor := newTestPlayer(t, context)
+			newTestGuild(t, context, recipient, donor)
+
+			recipient.AddCards(cardID, 1)
+			donor.AddCards(cardID, 10)
+			for _, player := range []*Player { recipient, donor } {
+				if err := player.Save(context); err != nil {
+					t.Fatalf("Failed to save player: %v", err)
+				}
+			}
+
+			request, err := recipient.RequestCard(context, cardID)
+			if err != nil {
+				t.Fatalf("Failed to request card: %v", err)
+			}
+			donor = reloadTestPlayer(t, context, donor)
+			if _, err = donor.DonateCard(context, request.ID, 4); err != nil {
+				t.Fatalf("Failed to donate: %v", err)
+			}
+
+			recipient = reloadTestPlayer(t, context, recipient)
+			before := testCardCount(recipient, cardID)
+			if test.deleted {
+				if err = Players.Delete(context, recipient.ID); err != nil {
+					t.Fatalf("Failed to delete player: %v", err)
+				}
+			}
+
+			collected, err := recipient.CollectCardDonations(context)
+			if test.deleted {
+				if err == nil {
+					t.Fatalf("Collected %d donations, want an error", len(collected))
+				}
+				sent, _ := Donations.GetDonationsByRecipient(context, recipient.ID, CardDonationSent)
+				if len(sent) != 1 {
+					t.Errorf("Donations left to collect = %d, want 1", len(sent))
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Failed to collect: %v", err)
+			}
+
+			recipient = reloadTestPlayer(t, context, recipient)
+			if count := testCardCount(recipient, cardID) - before; count != test.collected || donated(donationCounts(collected)) != test.collected {
+				t.Errorf("Collected %d copies (%d reported), want %d", count, donated(donationCounts(collected)), test.collected)
+			}
+
+			// each donation is collected once
+			again, err := recipient.CollectCardDonations(context)
+			if err != nil || len(again) != 0 {
+				t.Errorf("Collected again %d donations (%v), want none", len(again), err)
+			}
+			if count := testCardCount(reloadTestPlayer(t, context, recipient), cardID) - before; count != test.collected {
+				t.Errorf("Copies after collecting again = %d, want %d", count, test.collected)
+			}
+		})
+	}
+}
+
+// saved guildmates owning copies of a card: a recipient and a donor
+func newTestDonationPlayers(t *testing.T, context *util.Context, cardID data.DataId, owned int) (recipient *Player, donor *Player) {
+	recipient, donor = newTestPlayer(t, context), newTestPlayer(t, context)
+	newTestGuild(t, context, recipient, donor)
+
+	recipient.AddCards(cardID, 1)
+	donor.AddCards(cardID, owned - testCardCount(donor, cardID))
+	for _, player := range []*Player { recipient, donor } {
+		if err := player.Save(context); err != nil {
+			t.Fatalf("Failed to save player: %v", err)
+		}
+	}
+	return reloadTestPlayer(t, context, recipient), reloadTestPlayer(t, context, donor)
+}
+
+func TestRequestCardOnce(t *testing.T) {
+	cardID := data.ToDataId("CARD_MERC_SOLDIERS")
+	context := newTestContext()
+	recipient, _ := newTestDonationPlayers(t, context, cardID, 10)
+
+	// concurrent requests insert one
+	var group sync.WaitGroup
+	var mutex sync.Mutex
+	requested := 0
+	for i := 0; i < 10; i++ {
+		group.Add(1)
+		go func() {
+			defer group.Done()
+			if _, err := recipient.RequestCard(context, cardID); err == nil {
+				mutex.Lock()
+				requested++
+				mutex.Unlock()
+			}
+		}()
+	}
+	group.Wait()
+
+	if requested != 1 {
+		t.Errorf("Requested %d times, want once", requested)
+	}
+	if requests, err := GetGuildCardRequests(context, recipient.GuildID); err != nil || len(requests) != 1 {
+		t.Errorf("Open requests = %d (%v), want 1", len(requests), err)
+	}
+}
+
+func TestRecoverCardDonations(t *testing.T) {
+	cardID := data.ToDataId("CARD_MERC_SOLDIERS")
+
+	tests := []struct {
+		name       string
+		age        time.Duration // since the donation was last updated
+		reserved   bool
+		debited    bool
+		state      CardDonationState
+		remaining  int           // copies left on the request
+	}{
+		{"debited", time.Hour, true, true, CardDonationSent, 36},
+		{"reserved", time.Hour, true, false, CardDonationFailed, 40},
+		{"not reserved", time.Hour, false, false, CardDonationFailed, 40},
+		{"in progress", time.Minute, true, false, CardDonationPending, 36},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			context := newTestContext()
+			recipient, donor := newTestDonationPlayers(t, context, cardID, 10)
+			request, err := recipient.RequestCard(context, cardID)
+			if err != nil {
+				t.Fatalf("Failed to request card: %v", err)
+			}
+
+			// a donation interrupted after its recorded steps
+			now := time.Now()
+			donation := &CardDonation {
+				ID: bson.NewObjectId(),
+				RequestID: request.ID,
+				GuildID: request.GuildID,
+				DonorID: donor.ID,
+				RecipientID: recipient.ID,
+				CardID: cardID,
+				Count: 4,
+				State: CardDonationPending,
+				CreatedAt: now.Add(-test.age),
+				UpdatedAt: now.Add(-test.age),
+			}
+			if err = Donations.InsertDonation(context, donation); err != nil {
+				t.Fatalf("Failed to insert donation: %v", err)
+			}
+			if test.reserved {
+				if err = Donations.ReserveCopies(context, donation, 8, now); err != nil {
+					t.Fatalf("Failed to reserve copies: %v", err)
+				}
+			}
+			if test.debited {
+				if err = Players.DebitDonation(context, donation, nil); err != nil {
+					t.Fatalf("Failed to debit donor: %v", err)
+				}
+			}
+
+			// recovered once
+			for i := 0; i < 2; i++ {
+				if _, _, err = RecoverCardDonations(context, now.Add(-10 * time.Minute)); err != nil {
+					t.Fatalf("Failed to recover donations: %v", err)
+				}
+			}
+
+			if donations, err := Donations.GetDonationsByRecipient(context, recipient.ID, test.state); err != nil || len(donations) != 1 {
+				t.Errorf("Donations in state %d = %d (%v), want 1", test.state, len(donations), err)
+			}
+			request, err = GetCardRequestById(context, request.ID)
+			if err != nil {
+				t.Fatalf("Failed to get request: %v", err)
+			}
+			if request.Remaining != test.remaining {
+				t.Errorf("Remaining = %d, want %d", request.Remaining, test.remaining)
+			}
+		})
+	}
+}
+
+// copies of a card owned by a player
+func testCardCount(player *Player, cardID data.DataId) int {
+	if card := player.GetCard(cardID); card != nil {
+		return card.CardCount
+	}
+	return 0
+}
+
+func donationCounts(donations []*CardDonation) (counts []int) {
+	for _, donation := range donations {
+		counts = append(counts, donation.Count)
+	}
+	return
+}
+
+func donated(counts []int) (total int) {
+	for _, count := range counts {
+		total += count
+	}
+	return
+}
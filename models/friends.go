@@ -34,13 +34,13 @@ func (friends* Friends) Save(context *util.Context) (err error) {
 	}
 
 	// update in DB
-	_, err = context.DB.C(FriendsCollectionName).Upsert(bson.M { "_id": friends.ID }, friends)
+	err = FriendLists.Save(context, friends)
 	return
 }
 
 func GetFriendsByPlayerId(context *util.Context, playerID bson.ObjectId, allowCreate bool) (friends *Friends, err error) {
 	// find friends by player ID
-	err = context.DB.C(FriendsCollectionName).Find(bson.M { "pid": playerID } ).One(&friends)
+	friends, err = FriendLists.GetByPlayer(context, playerID)
 
 	if err == mgo.ErrNotFound {
 		err = nil
@@ -7,6 +7,7 @@ import (
 	"gopkg.in/mgo.v2"
 	"gopkg.in/mgo.v2/bson"
 
+	"bloodtales/config"
 	"bloodtales/data"
 	"bloodtales/util"
 )
@@ -33,16 +34,32 @@ type Guild struct {
 	XP          int           `bson:"xp" json:"xp"`
 	Rating      int           `bson:"rt" json:"rating"`
 	MemberCount int           `bson:"ms" json:"memberCount"`
+	Banner      string        `bson:"bn,omitempty" json:"banner"`
 
 	WinCount   int `bson:"wc" json:"winCount"`
 	LossCount  int `bson:"lc" json:"lossCount"`
 	MatchCount int `bson:"mc" json:"matchCount"`
 }
 
+// counters added by member activity
+type GuildProgress struct {
+	XP         int
+	Rating     int
+	WinCount   int
+	LossCount  int
+	MatchCount int
+}
+
 // client model
 type GuildClientAlias Guild
 type GuildClient struct {
-	Members []*PlayerClient `json:"members"`
+	Members        []*PlayerClient `json:"members"`
+	Level          int             `json:"level"`
+	NextLevelXP    int             `json:"nextLevelXp"` // 0 at the highest level
+	MemberLimit    int             `json:"memberLimit"`
+	TomeMultiplier float64         `json:"tomeMultiplier"`
+	Banners        []string        `json:"banners"` // unlocked banners
+	Place          int             `json:"place"`   // 1 based place on the guild rating leaderboard (0 when not placed)
 
 	*GuildClientAlias
 }
@@ -91,7 +108,7 @@ func DemoteGuildRole(guildRole GuildRole) GuildRole {
 func (guild *Guild) CreateGuildClient(context *util.Context) (client *GuildClient, err error) {
 	// get member players
 	var memberPlayers []*Player
-	err = context.DB.C(PlayerCollectionName).Find(bson.M{"gd": guild.ID}).All(&memberPlayers)
+	memberPlayers, err = GetPlayersByGuild(context, guild.ID)
 	if err != nil {
 		return
 	}
@@ -109,8 +126,16 @@ func (guild *Guild) CreateGuildClient(context *util.Context) (client *GuildClien
 	}
 
 	// create client model
+	level := guild.GetLevel()
+	levelData := data.GetGuildLevelData(level)
 	client = &GuildClient{
 		Members: members,
+		Level: level,
+		NextLevelXP: data.GetGuildNextLevelXP(level),
+		MemberLimit: levelData.MemberLimit,
+		TomeMultiplier: levelData.TomeMultiplier,
+		Banners: data.GetGuildBanners(level),
+		Place: guild.GetRatingPlace(context),
 
 		GuildClientAlias: (*GuildClientAlias)(guild),
 	}
@@ -132,20 +157,26 @@ func ensureIndexGuild(database *mgo.Database) {
 
 func GetGuildById(context *util.Context, id bson.ObjectId) (guild *Guild, err error) {
 	// find guild by ID
-	err = context.DB.C(GuildCollectionName).Find(bson.M{"_id": id}).One(&guild)
-	return
+	return Guilds.GetById(context, id)
 }
 
 func GetGuildByTag(context *util.Context, tag string) (guild *Guild, err error) {
 	// find guild by ID
-	err = context.DB.C(GuildCollectionName).Find(bson.M{"tg": tag}).One(&guild)
-	return
+	return Guilds.GetByTag(context, tag)
 }
 
 func GetGuildByOwner(context *util.Context, ownerId bson.ObjectId) (guild *Guild, err error) {
 	// find guild by owner ID
-	err = context.DB.C(GuildCollectionName).Find(bson.M{"ow": ownerId}).One(&guild)
-	return
+	return Guilds.GetByOwner(context, ownerId)
+}
+
+func GetGuilds(context *util.Context) (guilds []*Guild, err error) {
+	return Guilds.GetAll(context)
+}
+
+// find guilds by name (case insensitive regular expression)
+func FindGuildsByName(context *util.Context, pattern string) (guilds []*Guild, err error) {
+	return Guilds.FindByName(context, pattern)
 }
 
 func (guild *Guild) initialize() {
@@ -154,6 +185,7 @@ func (guild *Guild) initialize() {
 	guild.WinCount = 0
 	guild.LossCount = 0
 	guild.MatchCount = 0
+	guild.Banner = ""
 }
 
 func CreateGuild(context *util.Context, owner *Player, name string, iconId string, description string, private bool) (guild *Guild, err error) {
@@ -175,6 +207,7 @@ func CreateGuild(context *util.Context, owner *Player, name string, iconId strin
 	if err != nil {
 		return
 	}
+	guild.UpdateRatingPlace(context)
 
 	// set guild and role for player
 	owner.GuildID = guild.ID
@@ -197,8 +230,8 @@ func CreateGuild(context *util.Context, owner *Player, name string, iconId strin
 func AddMember(context *util.Context, player *Player, guild *Guild) (err error) {
 	guild.MemberCount++
 
-	if guild.MemberCount > data.GameplayConfig.GuildMemberLimit {
-		err := util.NewError(fmt.Sprintf("Guild is Full. Memeber limit: %d", data.GameplayConfig.GuildMemberLimit))
+	if guild.MemberCount > guild.GetMemberLimit() {
+		err := util.NewError(fmt.Sprintf("Guild is Full. Memeber limit: %d", guild.GetMemberLimit()))
 		util.Must(err)
 		return err
 	}
@@ -219,6 +252,8 @@ func AddMember(context *util.Context, player *Player, guild *Guild) (err error)
 	player.GuildJoinTime = time.Now().UTC()
 	player.Save(context)
 	player.SetDirty(PlayerDataMask_Guild)
+
+	UpdateGuildPlace(context, guild.ID)
 	return
 }
 
@@ -234,7 +269,7 @@ func RemoveMember(context *util.Context, player *Player, guild *Guild) (err erro
 	if (player.GuildRole == GuildOwner && guild.MemberCount > 0) {
 		fmt.Printf("Assigning a new owner")
 		var memberPlayers []*Player
-		err = context.DB.C(PlayerCollectionName).Find(bson.M{"gd": guild.ID}).All(&memberPlayers)
+		memberPlayers, err = GetPlayersByGuild(context, guild.ID)
 		util.Must(err)
 
 		// Find member of highest rank first
@@ -289,6 +324,8 @@ func RemoveMember(context *util.Context, player *Player, guild *Guild) (err erro
 
 	if guild.MemberCount <= 0 {
 		guild.Delete(context)
+	} else {
+		UpdateGuildPlace(context, guild.ID)
 	}
 
 	return
@@ -325,24 +362,105 @@ func UpdateGuildIcon(context *util.Context, player *Player, guild *Guild, iconId
 	return
 }
 
+// set the guild banner to one unlocked by its level
+func UpdateGuildBanner(context *util.Context, player *Player, guild *Guild, banner string) (err error) {
+	if banner != "" {
+		unlocked := false
+		for _, available := range data.GetGuildBanners(guild.GetLevel()) {
+			unlocked = unlocked || available == banner
+		}
+		if !unlocked {
+			err = util.NewError(fmt.Sprintf("Guild banner is not unlocked: %s", banner))
+			return
+		}
+	}
+
+	guild.Banner = banner
+
+	err = guild.Save(context)
+
+	player.SetDirty(PlayerDataMask_Guild)
+	return
+}
+
+// add member activity to a guild, returning the updated guild and whether it reached a new level
+func AddGuildProgress(context *util.Context, guildId bson.ObjectId, progress GuildProgress) (guild *Guild, levelUp bool, err error) {
+	guild, err = Guilds.AddProgress(context, guildId, progress)
+	if err != nil {
+		return
+	}
+
+	levelUp = progress.XP > 0 && data.GetGuildLevel(guild.XP - progress.XP) < guild.GetLevel()
+
+	if progress.Rating != 0 {
+		guild.UpdateRatingPlace(context)
+	}
+	return
+}
+
+// a member's completed match counts towards their guild
+func (player *Player) addGuildMatchProgress(context *util.Context, won bool, lost bool) {
+	if !player.IsInGuild() {
+		return
+	}
+
+	rules := config.Config.Guilds
+	progress := GuildProgress {
+		XP: rules.MatchXP,
+		MatchCount: 1,
+	}
+	if won {
+		progress.XP += rules.WinXP
+		progress.Rating = rules.WinRating
+		progress.WinCount = 1
+	} else if lost {
+		progress.Rating = -rules.LossRating
+		progress.LossCount = 1
+	}
+
+	player.addGuildProgress(context, progress)
+}
+
+func (player *Player) addGuildProgress(context *util.Context, progress GuildProgress) {
+	_, levelUp, err := AddGuildProgress(context, player.GuildID, progress)
+	if err != nil {
+		context.Log().Errorf("Failed to add guild progress for player %s: %v", player.ID.Hex(), err)
+		return
+	}
+
+	if levelUp {
+		player.SetDirty(PlayerDataMask_Guild)
+	}
+}
+
 func (guild *Guild) Save(context *util.Context) (err error) {
 	if !guild.ID.Valid() {
 		guild.ID = bson.NewObjectId()
 	}
 
 	// update entire guild to database
-	_, err = context.DB.C(GuildCollectionName).Upsert(bson.M{"_id": guild.ID}, guild)
+	err = Guilds.Save(context, guild)
 	return
 }
 
 func (guild *Guild) Delete(context *util.Context) (err error) {
+	context.Cache().RemoveScore(leaderboardKey(LeaderboardGuilds, nil), guild.ID.Hex())
+	context.Cache().RemoveScore(leaderboardKey(LeaderboardGuildRating, nil), guild.ID.Hex())
+
 	// delete guild from database
-	return context.DB.C(GuildCollectionName).Remove(bson.M{"_id": guild.ID})
+	return Guilds.Delete(context, guild.ID)
 }
 
 func (guild *Guild) GetLevel() int {
-	// TODO - different function for guilds?
-	return data.GetAccountLevel(guild.XP)
+	return data.GetGuildLevel(guild.XP)
+}
+
+func (guild *Guild) GetLevelData() *data.GuildLevelData {
+	return data.GetGuildLevelData(guild.GetLevel())
+}
+
+func (guild *Guild) GetMemberLimit() int {
+	return guild.GetLevelData().MemberLimit
 }
 
 func (player *Player) IsInGuild() bool {
@@ -0,0 +1,168 @@
+package models
+
+import (
+	"sync"
+	"testing"
+
+	"bloodtales/config"
+	"bloodtales/util"
+)
+
+// guild progression rules for a test, restored when the test ends
+func useTestGuildRules(t *testing.T) {
+	rules := config.Config.Guilds
+	t.Cleanup(func() {
+		config.Config.Guilds = rules
+	})
+
+	config.Config.Guilds.MatchXP = 2
+	config.Config.Guilds.WinXP = 3
+	config.Config.Guilds.QuestXP = 10
+	config.Config.Guilds.WinRating = 10
+	config.Config.Guilds.LossRating = 5
+}
+
+func getTestGuild(t *testing.T, context *util.Context, guild *Guild) *Guild {
+	stored, err := GetGuildById(context, guild.ID)
+	if err != nil {
+		t.Fatalf("Failed to get guild: %v", err)
+	}
+	return stored
+}
+
+func TestGuildMatchProgress(t *testing.T) {
+	useTestGuildRules(t)
+	context := newTestContext()
+	host, guest := newTestPlayer(t, context), newTestPlayer(t, context)
+	hostGuild, guestGuild := newTestGuild(t, context, host), newTestGuild(t, context, guest)
+
+	// host wins twice
+	playTestMatch(t, context, host, guest)
+	playTestMatch(t, context, host, guest)
+
+	tests := []struct {
+		name        string
+		guild       *Guild
+		xp          int
+		rating      int
+		wins        int
+		losses      int
+	}{
+		{"winner", hostGuild, 10, 20, 2, 0},
+		{"loser", guestGuild, 4, 0, 0, 2}, // rating stays at 0
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			guild := getTestGuild(t, context, test.guild)
+			if guild.XP != test.xp || guild.Rating != test.rating {
+				t.Errorf("Guild has %d XP and %d rating, want %d and %d", guild.XP, guild.Rating, test.xp, test.rating)
+			}
+			if guild.WinCount != test.wins || guild.LossCount != test.losses || guild.MatchCount != 2 {
+				t.Errorf("Guild record = %d/%d of %d, want %d/%d of 2", guild.WinCount, guild.LossCount, guild.MatchCount, test.wins, test.losses)
+			}
+		})
+	}
+
+	if place := getTestGuild(t, context, hostGuild).GetRatingPlace(context); place != 1 {
+		t.Errorf("Winning guild rating place = %d, want 1", place)
+	}
+}
+
+func TestAddGuildProgress(t *testing.T) {
+	context := newTestContext()
+	guild := newTestGuild(t, context, newTestPlayer(t, context))
+
+	// concurrent member activity is all counted
+	var group sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		group.Add(1)
+		go func() {
+			defer group.Done()
+			if _, _, err := AddGuildProgress(context, guild.ID, GuildProgress { XP: 20, Rating: 1, MatchCount: 1 }); err != nil {
+				t.Errorf("Failed to add guild progress: %v", err)
+			}
+		}()
+	}
+	group.Wait()
+
+	guild = getTestGuild(t, context, guild)
+	if guild.XP != 400 || guild.Rating != 20 || guild.MatchCount != 20 {
+		t.Fatalf("Guild has %d XP, %d rating and %d matches, want 400, 20 and 20", guild.XP, guild.Rating, guild.MatchCount)
+	}
+
+	// levels from the test data: 2 at 500 XP, 3 at 2000 XP
+	tests := []struct {
+		name        string
+		xp          int
+		levelUp     bool
+		level       int
+		memberLimit int
+		banners     int
+	}{
+		{"below the next level", 99, false, 1, 20, 0},
+		{"reaches the next level", 1, true, 2, 30, 1},
+		{"within the level", 1000, false, 2, 30, 1},
+		{"skips to the top level", 5000, true, 3, 40, 2},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			updated, levelUp, err := AddGuildProgress(context, guild.ID, GuildProgress { XP: test.xp })
+			if err != nil {
+				t.Fatalf("Failed to add guild progress: %v", err)
+			}
+			if levelUp != test.levelUp || updated.GetLevel() != test.level {
+				t.Errorf("Level = %d (level up %v), want %d (%v)", updated.GetLevel(), levelUp, test.level, test.levelUp)
+			}
+
+			client, err := getTestGuild(t, context, guild).CreateGuildClient(context)
+			if err != nil {
+				t.Fatalf("Failed to create guild client: %v", err)
+			}
+			if client.Level != test.level || client.MemberLimit != test.memberLimit || len(client.Banners) != test.banners {
+				t.Errorf("Client level %d has %d members and %v, want %d with %d members and %d banners", client.Level, client.MemberLimit, client.Banners, test.level, test.memberLimit, test.banners)
+			}
+		})
+	}
+}
+
+func TestUpdateGuildBanner(t *testing.T) {
+	context := newTestContext()
+	owner := newTestPlayer(t, context)
+	guild := newTestGuild(t, context, owner)
+	if _, _, err := AddGuildProgress(context, guild.ID, GuildProgress { XP: 500 }); err != nil {
+		t.Fatalf("Failed to add guild progress: %v", err)
+	}
+
+	tests := []struct {
+		name        string
+		banner      string
+		valid       bool
+	}{
+		{"unlocked", "BANNER_BRONZE", true},
+		{"locked", "BANNER_SILVER", false},
+		{"unknown", "BANNER_UNKNOWN", false},
+		{"cleared", "", true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			guild := getTestGuild(t, context, guild)
+			before := guild.Banner
+
+			err := UpdateGuildBanner(context, owner, guild, test.banner)
+			if (err == nil) != test.valid {
+				t.Fatalf("Banner error = %v, want valid %v", err, test.valid)
+			}
+
+			want := before
+			if test.valid {
+				want = test.banner
+			}
+			if banner := getTestGuild(t, context, guild).Banner; banner != want {
+				t.Errorf("Banner = %q, want %q", banner, want)
+			}
+		})
+	}
+}
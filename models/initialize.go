@@ -6,6 +6,11 @@ import (
 
 // initialize models and collections
 func init() {
+	// no indexes with memory storage
+	if util.Storage != util.MongoStorage {
+		return
+	}
+
 	// no-sql database
 	db := util.GetDatabaseConnection()
 	defer db.Session.Close()
@@ -22,6 +27,13 @@ func init() {
 	ensureIndexMatch(db)
 	ensureIndexNotification(db)
 	ensureIndexFriends(db)
+	ensureIndexAudit(db)
+	ensureIndexSanction(db)
+	ensureIndexReplay(db)
+	ensureIndexSeason(db)
+	ensureIndexDonation(db)
+	ensureIndexWar(db)
+	ensureIndexSocket(db)
 
 	util.EnsureIndexFault(db)
 }
@@ -0,0 +1,785 @@
+package models
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+	"encoding/json"
+
+	"gopkg.in/mgo.v2/bson"
+
+	"bloodtales/data"
+	"bloodtales/util"
+)
+
+type LeaderboardScope string
+const (
+	LeaderboardGlobal  LeaderboardScope = "global"  // current season, all players
+	LeaderboardLeague                   = "league"  // current season, players in a league
+	LeaderboardSeason                   = "season"  // a season's places (kept after rollover)
+	LeaderboardGuild                    = "guild"   // members of a guild
+	LeaderboardFriends                  = "friends" // a player and their friends
+	LeaderboardGuilds                   = "guilds"  // guilds by their members' total
+	LeaderboardGuildRating              = "guildRating" // guilds by rating (not seasonal)
+)
+
+// scores hold the value above a tie break favouring whoever reached it first (minutes since the season started)
+const leaderboardTieBits = 20
+const leaderboardTieMax = 1 << leaderboardTieBits - 1
+
+// entries per page at most
+const LeaderboardPageLimit = 100
+
+// how long the current season start is reused for tie breaks
+const leaderboardEpochExpiration = time.Minute
+
+type LeaderboardQuery struct {
+	Scope           LeaderboardScope
+	League          data.League    // league scope
+	Season          int            // season scope (number)
+	GuildID         bson.ObjectId  // guild scope
+	Player          *Player        // placed around this player (or their guild), and friends scope
+
+	Offset          int            // first place of the top page (0 based)
+	Limit           int            // top page size
+	Around          int            // entries on either side of the player
+}
+
+type LeaderboardEntry struct {
+	Place           int            `json:"place"`
+	ID              bson.ObjectId  `json:"-"` // player (or guild)
+	Name            string         `json:"name"`
+	Tag             string         `json:"tag"`
+	Score           int            `json:"score"`
+	League          data.League    `json:"league"`
+	Level           int            `json:"level"` // guild boards
+	ReachedTime     time.Time      `json:"reachedTime"`
+
+	// internal
+	Player          *Player        `json:"-"`
+	Guild           *Guild         `json:"-"`
+	score           int
+}
+
+type Leaderboard struct {
+	Scope           LeaderboardScope    `json:"scope"`
+	Count           int                 `json:"count"`
+	Place           int                 `json:"place"` // 1 based place of the player or their guild (0 when not placed)
+	Top             []*LeaderboardEntry `json:"top"`
+	Around          []*LeaderboardEntry `json:"around"`
+}
+
+var (
+	// internal
+	leaderboardEpochMutex   sync.Mutex
+	leaderboardEpoch        time.Time
+	leaderboardSeason       *Season
+	leaderboardEpochExpires time.Time
+)
+
+func GetLeaderboardScope(name string) (scope LeaderboardScope, err error) {
+	scope = LeaderboardScope(name)
+	switch scope {
+	case LeaderboardGlobal, LeaderboardLeague, LeaderboardSeason, LeaderboardGuild, LeaderboardFriends, LeaderboardGuilds, LeaderboardGuildRating:
+	default:
+		err = util.NewError(fmt.Sprintf("Invalid leaderboard scope: %s", name))
+	}
+	return
+}
+
+// cache key of a stored board
+func leaderboardKey(scope LeaderboardScope, id interface{}) string {
+	switch scope {
+	case LeaderboardLeague:
+		return fmt.Sprintf("Leaderboard:League:%d", id)
+	case LeaderboardSeason:
+		return fmt.Sprintf("Leaderboard:Season:%d", id)
+	case LeaderboardGuilds:
+		return "Leaderboard:Guilds"
+	case LeaderboardGuildRating:
+		return "Leaderboard:GuildRating"
+	}
+	return "Leaderboard"
+}
+
+// start of the current season (cached briefly, with the season), tie breaks count from it
+func getLeaderboardEpoch(context *util.Context) (epoch time.Time, season *Season) {
+	leaderboardEpochMutex.Lock()
+	defer leaderboardEpochMutex.Unlock()
+
+	now := time.Now()
+	if now.Before(leaderboardEpochExpires) {
+		return leaderboardEpoch, leaderboardSeason
+	}
+
+	// between seasons ties count from the start of the month
+	epoch = time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, time.UTC)
+	season, _ = GetCurrentSeason(context)
+	if season != nil {
+		epoch = season.StartTime
+	}
+
+	leaderboardEpoch = epoch
+	leaderboardSeason = season
+	leaderboardEpochExpires = now.Add(leaderboardEpochExpiration)
+	return
+}
+
+func encodeLeaderboardScore(value int, reached time.Time, epoch time.Time) int {
+	minutes := int(reached.Sub(epoch) / time.Minute)
+	if minutes < 0 {
+		minutes = 0
+	} else if minutes > leaderboardTieMax {
+		minutes = leaderboardTieMax
+	}
+	return value << leaderboardTieBits | (leaderboardTieMax - minutes)
+}
+
+func decodeLeaderboardScore(score int, epoch time.Time) (value int, reached time.Time) {
+	minutes := leaderboardTieMax - score & leaderboardTieMax
+	return score >> leaderboardTieBits, epoch.Add(time.Duration(minutes) * time.Minute)
+}
+
+// placed by this season's matches
+func (player *Player) IsPlaced() bool {
+	return player.SeasonMatchCount > 0
+}
+
+func (player *Player) GetLeaderboardValue() int {
+	winsFactor := (player.SeasonWinCount - player.SeasonLossCount) * 1000000 // / matches
+	matchesFactor := player.SeasonMatchCount * 1000
+	pointsFactor := player.ArenaPoints
+	return winsFactor + matchesFactor + pointsFactor
+}
+
+// 1-based place on the global leaderboard (0 when not placed)
+func (player *Player) GetLeaderboardPlace(context *util.Context) int {
+	return context.Cache().GetRevRank(leaderboardKey(LeaderboardGlobal, nil), player.ID.Hex()) + 1
+}
+
+// store the player's score in the global, league and season boards (and their guild's total)
+func (player *Player) UpdatePlace(context *util.Context) {
+	if !player.IsPlaced() {
+		return
+	}
+
+	epoch, season := getLeaderboardEpoch(context)
+
+	reached := player.PlaceTime
+	if reached.IsZero() {
+		reached = epoch
+	}
+	score := encodeLeaderboardScore(player.GetLeaderboardValue(), reached, epoch)
+	member := player.ID.Hex()
+
+	// also update boards being rebuilt, so the swapped in boards include this change
+	suffixes := []string { "" }
+	if context.Cache().Has(leaderboardRebuildRunningKey) {
+		suffixes = append(suffixes, leaderboardShadowSuffix)
+	}
+
+	league := player.GetLeague()
+	for _, suffix := range suffixes {
+		context.Cache().SetScore(leaderboardKey(LeaderboardGlobal, nil) + suffix, member, score)
+		if season != nil {
+			context.Cache().SetScore(leaderboardKey(LeaderboardSeason, season.Number) + suffix, member, score)
+		}
+
+		// only in the current league
+		for other := data.LeagueZero; other <= data.LeagueSix; other++ {
+			if other != league {
+				context.Cache().RemoveScore(leaderboardKey(LeaderboardLeague, int(other)) + suffix, member)
+			}
+		}
+		context.Cache().SetScore(leaderboardKey(LeaderboardLeague, int(league)) + suffix, member, score)
+	}
+
+	if player.GuildID.Valid() {
+		UpdateGuildPlace(context, player.GuildID)
+	}
+}
+
+// remove the player from the current boards (e.g. when reset or deleted)
+func (player *Player) RemovePlace(context *util.Context) {
+	member := player.ID.Hex()
+	context.Cache().RemoveScore(leaderboardKey(LeaderboardGlobal, nil), member)
+	for league := data.LeagueZero; league <= data.LeagueSix; league++ {
+		context.Cache().RemoveScore(leaderboardKey(LeaderboardLeague, int(league)), member)
+	}
+}
+
+// store a guild's total of its placed members, reached when the latest member's score was
+// (large totals lose tie break precision, redis scores are doubles)
+func UpdateGuildPlace(context *util.Context, guildId bson.ObjectId) {
+	members, err := GetPlayersByGuild(context, guildId)
+	if err != nil {
+		return
+	}
+
+	total, placed := 0, false
+	var reached time.Time
+	for _, member := range members {
+		if member.IsPlaced() {
+			total += member.GetLeaderboardValue()
+			placed = true
+			if member.PlaceTime.After(reached) {
+				reached = member.PlaceTime
+			}
+		}
+	}
+
+	key := leaderboardKey(LeaderboardGuilds, nil)
+	if !placed {
+		context.Cache().RemoveScore(key, guildId.Hex())
+		return
+	}
+
+	epoch, _ := getLeaderboardEpoch(context)
+	if reached.IsZero() {
+		reached = epoch
+	}
+	context.Cache().SetScore(key, guildId.Hex(), encodeLeaderboardScore(total, reached, epoch))
+}
+
+// 1-based place on the guild rating leaderboard (0 when not placed)
+func (guild *Guild) GetRatingPlace(context *util.Context) int {
+	return context.Cache().GetRevRank(leaderboardKey(LeaderboardGuildRating, nil), guild.ID.Hex()) + 1
+}
+
+// store the guild's rating (without a tie break, rating is kept across seasons)
+func (guild *Guild) UpdateRatingPlace(context *util.Context) {
+	suffixes := []string { "" }
+	if context.Cache().Has(leaderboardRebuildRunningKey) {
+		suffixes = append(suffixes, leaderboardShadowSuffix)
+	}
+
+	for _, suffix := range suffixes {
+		context.Cache().SetScore(leaderboardKey(LeaderboardGuildRating, nil) + suffix, guild.ID.Hex(), guild.getRatingScore())
+	}
+}
+
+func (guild *Guild) getRatingScore() int {
+	return guild.Rating << leaderboardTieBits | leaderboardTieMax
+}
+
+// empty the boards of the current season (season boards are kept)
+func ResetLeaderboards(context *util.Context) {
+	context.Cache().ClearScores(leaderboardKey(LeaderboardGlobal, nil))
+	context.Cache().ClearScores(leaderboardKey(LeaderboardGuilds, nil))
+	for league := data.LeagueZero; league <= data.LeagueSix; league++ {
+		context.Cache().ClearScores(leaderboardKey(LeaderboardLeague, int(league)))
+	}
+
+	// tie breaks count from the next season
+	leaderboardEpochMutex.Lock()
+	leaderboardEpochExpires = time.Time {}
+	leaderboardEpochMutex.Unlock()
+}
+
+// top entries and the entries around the player (or their guild)
+func GetLeaderboard(context *util.Context, query *LeaderboardQuery) (leaderboard *Leaderboard, err error) {
+	if query.Limit <= 0 || query.Limit > LeaderboardPageLimit {
+		query.Limit = LeaderboardPageLimit
+	}
+	if query.Offset < 0 {
+		query.Offset = 0
+	}
+	if query.Around < 0 {
+		query.Around = 0
+	} else if query.Around > LeaderboardPageLimit / 2 {
+		query.Around = LeaderboardPageLimit / 2
+	}
+
+	switch query.Scope {
+	case LeaderboardGlobal, LeaderboardGuilds, LeaderboardGuildRating:
+		return getStoredLeaderboard(context, query, leaderboardKey(query.Scope, nil))
+
+	case LeaderboardLeague:
+		return getStoredLeaderboard(context, query, leaderboardKey(query.Scope, int(query.League)))
+
+	case LeaderboardSeason:
+		if query.Season <= 0 {
+			season, _ := GetCurrentSeason(context)
+			if season == nil {
+				err = util.NewError("No season is running")
+				return
+			}
+			query.Season = season.Number
+		}
+		return getStoredLeaderboard(context, query, leaderboardKey(query.Scope, query.Season))
+
+	case LeaderboardGuild:
+		if !query.GuildID.Valid() && query.Player != nil {
+			query.GuildID = query.Player.GuildID
+		}
+		if !query.GuildID.Valid() {
+			err = util.NewError("Guild leaderboard requires a guild")
+			return
+		}
+
+		var players []*Player
+		if players, err = GetPlayersByGuild(context, query.GuildID); err != nil {
+			return
+		}
+		return getComputedLeaderboard(context, query, players)
+
+	case LeaderboardFriends:
+		if query.Player == nil {
+			err = util.NewError("Friends leaderboard requires a player")
+			return
+		}
+
+		var friends *Friends
+		if friends, err = GetFriendsByPlayerId(context, query.Player.ID, false); err != nil {
+			return
+		}
+
+		players := []*Player { query.Player }
+		if friends != nil && len(friends.FriendIDs) > 0 {
+			var friendPlayers []*Player
+			if friendPlayers, err = GetPlayersByIds(context, friends.FriendIDs); err != nil {
+				return
+			}
+			players = append(players, friendPlayers...)
+		}
+		return getComputedLeaderboard(context, query, players)
+	}
+
+	err = util.NewError(fmt.Sprintf("Invalid leaderboard scope: %s", query.Scope))
+	return
+}
+
+// board kept in the cache
+func getStoredLeaderboard(context *util.Context, query *LeaderboardQuery, key string) (leaderboard *Leaderboard, err error) {
+	leaderboard = &Leaderboard {
+		Scope: query.Scope,
+		Count: context.Cache().GetScoreCount(key),
+	}
+
+	leaderboard.Top = getStoredEntries(context, key, query.Offset, query.Offset + query.Limit - 1)
+
+	// around the player (or their guild)
+	if query.Player != nil {
+		member := query.Player.ID.Hex()
+		if query.Scope == LeaderboardGuilds || query.Scope == LeaderboardGuildRating {
+			member = query.Player.GuildID.Hex()
+		}
+
+		if rank := context.Cache().GetRevRank(key, member); rank >= 0 {
+			leaderboard.Place = rank + 1
+			if query.Around > 0 {
+				start := rank - query.Around
+				if start < 0 {
+					start = 0
+				}
+				leaderboard.Around = getStoredEntries(context, key, start, rank + query.Around)
+			}
+		}
+	}
+
+	err = loadLeaderboardEntries(context, query.Scope, leaderboard.Top, leaderboard.Around)
+	return
+}
+
+func getStoredEntries(context *util.Context, key string, start int, stop int) (entries []*LeaderboardEntry) {
+	entries = []*LeaderboardEntry {}
+	if stop < start {
+		return
+	}
+
+	for i, member := range context.Cache().GetRankRangeWithScores(key, start, stop) {
+		if !bson.IsObjectIdHex(member.Name) {
+			continue
+		}
+		entries = append(entries, &LeaderboardEntry {
+			Place: start + i + 1,
+			ID: bson.ObjectIdHex(member.Name),
+			score: member.Score,
+		})
+	}
+	return
+}
+
+// board sorted from the given players (few enough to load)
+func getComputedLeaderboard(context *util.Context, query *LeaderboardQuery, players []*Player) (leaderboard *Leaderboard, err error) {
+	epoch, _ := getLeaderboardEpoch(context)
+
+	var entries []*LeaderboardEntry
+	for _, player := range players {
+		if player.IsPlaced() {
+			reached := player.PlaceTime
+			if reached.IsZero() {
+				reached = epoch
+			}
+			entries = append(entries, &LeaderboardEntry {
+				ID: player.ID,
+				Player: player,
+				score: encodeLeaderboardScore(player.GetLeaderboardValue(), reached, epoch),
+			})
+		}
+	}
+
+	// same order as the stored boards (ties by ID, descending)
+	sort.SliceStable(entries, func(i, j int) bool {
+		if entries[i].score != entries[j].score {
+			return entries[i].score > entries[j].score
+		}
+		return entries[i].ID.Hex() > entries[j].ID.Hex()
+	})
+	for i, entry := range entries {
+		entry.Place = i + 1
+	}
+
+	leaderboard = &Leaderboard {
+		Scope: query.Scope,
+		Count: len(entries),
+		Top: sliceLeaderboardEntries(entries, query.Offset, query.Offset + query.Limit),
+	}
+
+	if query.Player != nil {
+		for rank, entry := range entries {
+			if entry.ID == query.Player.ID {
+				leaderboard.Place = rank + 1
+				if query.Around > 0 {
+					leaderboard.Around = sliceLeaderboardEntries(entries, rank - query.Around, rank + query.Around + 1)
+				}
+				break
+			}
+		}
+	}
+
+	err = loadLeaderboardEntries(context, query.Scope, leaderboard.Top, leaderboard.Around)
+	return
+}
+
+func sliceLeaderboardEntries(entries []*LeaderboardEntry, start int, end int) []*LeaderboardEntry {
+	if start < 0 {
+		start = 0
+	}
+	if end > len(entries) {
+		end = len(entries)
+	}
+	if start >= end {
+		return []*LeaderboardEntry {}
+	}
+	return entries[start:end]
+}
+
+// fill in names, tags, leagues and scores
+func loadLeaderboardEntries(context *util.Context, scope LeaderboardScope, pages ...[]*LeaderboardEntry) (err error) {
+	epoch, _ := getLeaderboardEpoch(context)
+
+	var ids []bson.ObjectId
+	for _, entries := range pages {
+		for _, entry := range entries {
+			entry.Score, entry.ReachedTime = decodeLeaderboardScore(entry.score, epoch)
+			if entry.Player == nil && !containsId(ids, entry.ID) {
+				ids = append(ids, entry.ID)
+			}
+		}
+	}
+
+	// guild boards
+	if scope == LeaderboardGuilds || scope == LeaderboardGuildRating {
+		guilds := map[bson.ObjectId]*Guild {}
+		if len(ids) > 0 {
+			var found []*Guild
+			if found, err = Guilds.GetByIds(context, ids); err != nil {
+				return
+			}
+			for _, guild := range found {
+				guilds[guild.ID] = guild
+			}
+		}
+
+		for _, entries := range pages {
+			for _, entry := range entries {
+				if guild := guilds[entry.ID]; guild != nil {
+					entry.Guild = guild
+					entry.Name = guild.Name
+					entry.Tag = guild.Tag
+					entry.Level = guild.GetLevel()
+				}
+				if scope == LeaderboardGuildRating {
+					entry.ReachedTime = time.Time {}
+				}
+			}
+		}
+		return
+	}
+
+	// player boards
+	players := map[bson.ObjectId]*Player {}
+	if len(ids) > 0 {
+		var found []*Player
+		if found, err = GetPlayersByIds(context, ids); err != nil {
+			return
+		}
+		for _, player := range found {
+			players[player.ID] = player
+		}
+	}
+
+	var userIds []bson.ObjectId
+	for _, entries := range pages {
+		for _, entry := range entries {
+			if entry.Player == nil {
+				entry.Player = players[entry.ID]
+			}
+			if entry.Player != nil && !containsId(userIds, entry.Player.UserID) {
+				userIds = append(userIds, entry.Player.UserID)
+			}
+		}
+	}
+
+	users := map[bson.ObjectId]*User {}
+	if len(userIds) > 0 {
+		var found []*User
+		if found, err = Users.GetByIds(context, userIds); err != nil {
+			return
+		}
+		for _, user := range found {
+			users[user.ID] = user
+		}
+	}
+
+	for _, entries := range pages {
+		for _, entry := range entries {
+			if entry.Player == nil {
+				continue
+			}
+			entry.League = entry.Player.GetLeague()
+			if user := users[entry.Player.UserID]; user != nil {
+				entry.Name = user.Name
+				entry.Tag = user.Tag
+			}
+		}
+	}
+	return
+}
+
+// rebuild progress (JSON) and a marker which exists while a rebuild runs
+const leaderboardRebuildKey = "LeaderboardRebuild"
+const leaderboardRebuildRunningKey = "LeaderboardRebuild:Running"
+
+// boards are rebuilt under this suffix, then renamed over the live boards
+const leaderboardShadowSuffix = ":Rebuild"
+
+// a rebuild without progress for this long is considered dead (seconds)
+const leaderboardRebuildTimeout = 300
+
+// fields needed to place players
+var leaderboardPlayerFields []string = []string { "_id", "rk", "gd", "ap", "sw", "sl", "sm", "pt" }
+
+type LeaderboardRebuild struct {
+	StartTime       time.Time      `json:"start"`
+	UpdateTime      time.Time      `json:"update"`
+	EndTime         time.Time      `json:"end"`
+	Total           int            `json:"total"` // players when started
+	Processed       int            `json:"processed"`
+	Placed          int            `json:"placed"`
+	Error           string         `json:"error"`
+}
+
+// progress of the running or last rebuild (nil when never run)
+func GetLeaderboardRebuild(context *util.Context) (rebuild *LeaderboardRebuild) {
+	rebuild = &LeaderboardRebuild {}
+	if !context.Cache().GetJSON(leaderboardRebuildKey, rebuild) {
+		return nil
+	}
+	return
+}
+
+func (rebuild *LeaderboardRebuild) IsRunning() bool {
+	return rebuild.EndTime.IsZero()
+}
+
+func (rebuild *LeaderboardRebuild) GetPercent() int {
+	if rebuild.Total == 0 {
+		return 100
+	}
+	percent := rebuild.Processed * 100 / rebuild.Total
+	if percent > 100 {
+		percent = 100
+	}
+	return percent
+}
+
+func (rebuild *LeaderboardRebuild) save(context *util.Context) {
+	rebuild.UpdateTime = time.Now()
+	raw, _ := json.Marshal(rebuild)
+	context.Cache().Set(leaderboardRebuildKey, string(raw))
+
+	// progress keeps the running marker alive
+	if rebuild.IsRunning() {
+		context.Cache().Expire(leaderboardRebuildRunningKey, leaderboardRebuildTimeout)
+	} else {
+		context.Cache().Set(leaderboardRebuildRunningKey, nil)
+	}
+}
+
+// rebuild the current boards in the background, streaming players in batches (with a delay between them)
+// into shadow boards which replace the live boards when done, so they are never empty
+func StartLeaderboardRebuild(context *util.Context, batchSize int, delay time.Duration) (rebuild *LeaderboardRebuild, err error) {
+	if batchSize <= 0 {
+		batchSize = 100
+	}
+
+	rebuild = &LeaderboardRebuild {
+		StartTime: time.Now(),
+	}
+	if !rebuild.acquire(context) {
+		rebuild = nil
+		err = util.NewError("Leaderboard rebuild is already running")
+		return
+	}
+
+	rebuild.Total, err = Players.Count(context)
+	if err != nil {
+		context.Cache().Set(leaderboardRebuildRunningKey, nil)
+		rebuild = nil
+		return
+	}
+	rebuild.save(context)
+
+	go rebuild.run(batchSize, delay)
+	return
+}
+
+// atomically create the running marker (false when another rebuild holds it)
+func (rebuild *LeaderboardRebuild) acquire(context *util.Context) bool {
+	return context.Cache().SetIfAbsent(leaderboardRebuildRunningKey, rebuild.StartTime.Format(time.RFC3339), leaderboardRebuildTimeout)
+}
+
+func (rebuild *LeaderboardRebuild) run(batchSize int, delay time.Duration) {
+	context := util.CreateBackgroundContext()
+	defer context.Close()
+
+	defer func() {
+		if recovered := recover(); recovered != nil {
+			rebuild.Error = fmt.Sprintf("%v", recovered)
+		}
+		rebuild.EndTime = time.Now()
+		rebuild.save(context)
+
+		if rebuild.Error != "" {
+			context.Log().Errorf("Leaderboard rebuild failed after %d players: %s", rebuild.Processed, rebuild.Error)
+		} else {
+			context.Log().Printf("Leaderboard rebuilt: %d players placed of %d", rebuild.Placed, rebuild.Processed)
+		}
+	}()
+
+	if err := rebuild.rebuild(context, batchSize, delay); err != nil {
+		rebuild.Error = err.Error()
+	}
+}
+
+type leaderboardGuildTotal struct {
+	total           int
+	reached         time.Time
+}
+
+func (rebuild *LeaderboardRebuild) rebuild(context *util.Context, batchSize int, delay time.Duration) (err error) {
+	epoch, season := getLeaderboardEpoch(context)
+
+	keys := []string { leaderboardKey(LeaderboardGlobal, nil), leaderboardKey(LeaderboardGuilds, nil), leaderboardKey(LeaderboardGuildRating, nil) }
+	for league := data.LeagueZero; league <= data.LeagueSix; league++ {
+		keys = append(keys, leaderboardKey(LeaderboardLeague, int(league)))
+	}
+	if season != nil {
+		keys = append(keys, leaderboardKey(LeaderboardSeason, season.Number))
+	}
+
+	// start from empty shadow boards
+	for _, key := range keys {
+		context.Cache().ClearScores(key + leaderboardShadowSuffix)
+	}
+
+	guilds := map[bson.ObjectId]*leaderboardGuildTotal {}
+	err = Players.Stream(context, leaderboardPlayerFields, batchSize, func(players []*Player) error {
+		scores := map[string]int {}
+		leagues := map[data.League]map[string]int {}
+
+		for _, player := range players {
+			if !player.IsPlaced() {
+				continue
+			}
+
+			reached := player.PlaceTime
+			if reached.IsZero() {
+				reached = epoch
+			}
+			value := player.GetLeaderboardValue()
+			score := encodeLeaderboardScore(value, reached, epoch)
+			member := player.ID.Hex()
+
+			scores[member] = score
+			league := player.GetLeague()
+			if leagues[league] == nil {
+				leagues[league] = map[string]int {}
+			}
+			leagues[league][member] = score
+
+			if player.GuildID.Valid() {
+				guild := guilds[player.GuildID]
+				if guild == nil {
+					guild = &leaderboardGuildTotal {}
+					guilds[player.GuildID] = guild
+				}
+				guild.total += value
+				if player.PlaceTime.After(guild.reached) {
+					guild.reached = player.PlaceTime
+				}
+			}
+		}
+
+		context.Cache().SetScores(leaderboardKey(LeaderboardGlobal, nil) + leaderboardShadowSuffix, scores)
+		if season != nil {
+			context.Cache().SetScores(leaderboardKey(LeaderboardSeason, season.Number) + leaderboardShadowSuffix, scores)
+		}
+		for league, leagueScores := range leagues {
+			context.Cache().SetScores(leaderboardKey(LeaderboardLeague, int(league)) + leaderboardShadowSuffix, leagueScores)
+		}
+
+		rebuild.Processed += len(players)
+		rebuild.Placed += len(scores)
+		rebuild.save(context)
+
+		// throttle
+		if delay > 0 {
+			time.Sleep(delay)
+		}
+		return nil
+	})
+	if err != nil {
+		return
+	}
+
+	scores := map[string]int {}
+	for id, guild := range guilds {
+		reached := guild.reached
+		if reached.IsZero() {
+			reached = epoch
+		}
+		scores[id.Hex()] = encodeLeaderboardScore(guild.total, reached, epoch)
+	}
+	context.Cache().SetScores(leaderboardKey(LeaderboardGuilds, nil) + leaderboardShadowSuffix, scores)
+
+	// guild ratings (guilds are few enough to load)
+	allGuilds, err := Guilds.GetAll(context)
+	if err != nil {
+		return
+	}
+	scores = map[string]int {}
+	for _, guild := range allGuilds {
+		scores[guild.ID.Hex()] = guild.getRatingScore()
+	}
+	context.Cache().SetScores(leaderboardKey(LeaderboardGuildRating, nil) + leaderboardShadowSuffix, scores)
+
+	// swap in the rebuilt boards
+	for _, key := range keys {
+		context.Cache().RenameScores(key + leaderboardShadowSuffix, key)
+	}
+	return
+}
@@ -0,0 +1,197 @@
+package models
+
+import (
+	"time"
+	"testing"
+
+	"gopkg.in/mgo.v2/bson"
+
+	"bloodtales/util"
+)
+
+// saved and placed player with the given season record, scored when reached
+func newTestPlacedPlayer(t *testing.T, context *util.Context, wins int, matches int, reached time.Time) *Player {
+	player := newTestPlayer(t, context)
+	player.SeasonWinCount = wins
+	player.SeasonLossCount = matches - wins
+	player.SeasonMatchCount = matches
+	player.PlaceTime = reached
+	if err := player.Save(context); err != nil {
+		t.Fatalf("Failed to save player: %v", err)
+	}
+	player.UpdatePlace(context)
+	return player
+}
+
+func leaderboardIds(entries []*LeaderboardEntry) (ids []string) {
+	for _, entry := range entries {
+		ids = append(ids, entry.ID.Hex())
+	}
+	return
+}
+
+func playerIds(players ...*Player) (ids []string) {
+	for _, player := range players {
+		ids = append(ids, player.ID.Hex())
+	}
+	return
+}
+
+func equalIds(a []string, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func TestGetLeaderboard(t *testing.T) {
+	context := newTestContext()
+	ResetLeaderboards(context)
+
+	now := time.Now()
+	first := newTestPlacedPlayer(t, context, 3, 3, now.Add(-time.Hour))
+	tiedEarly := newTestPlacedPlayer(t, context, 2, 3, now.Add(-30 * time.Minute))
+	tiedLate := newTestPlacedPlayer(t, context, 2, 3, now.Add(-10 * time.Minute))
+	fourth := newTestPlacedPlayer(t, context, 1, 3, now)
+	last := newTestPlacedPlayer(t, context, 0, 3, now)
+	unplaced := newTestPlacedPlayer(t, context, 0, 0, now)
+	guild := newTestGuild(t, context, reloadTestPlayer(t, context, fourth), reloadTestPlayer(t, context, tiedLate))
+
+	tests := []struct {
+		name        string
+		query       LeaderboardQuery
+		count       int
+		place       int
+		top         []string
+		around      []string
+	}{
+		{"top", LeaderboardQuery { Scope: LeaderboardGlobal, Limit: 3 }, 5, 0, playerIds(first, tiedEarly, tiedLate), nil},
+		{"page", LeaderboardQuery { Scope: LeaderboardGlobal, Offset: 3, Limit: 3 }, 5, 0, playerIds(fourth, last), nil},
+		{"around me", LeaderboardQuery { Scope: LeaderboardGlobal, Limit: 1, Player: fourth, Around: 1 }, 5, 4, playerIds(first), playerIds(tiedLate, fourth, last)},
+		{"around the top", LeaderboardQuery { Scope: LeaderboardGlobal, Limit: 1, Player: first, Around: 2 }, 5, 1, playerIds(first), playerIds(first, tiedEarly, tiedLate)},
+		{"not placed", LeaderboardQuery { Scope: LeaderboardGlobal, Limit: 1, Player: unplaced, Around: 2 }, 5, 0, playerIds(first), nil},
+		{"league", LeaderboardQuery { Scope: LeaderboardLeague, League: first.GetLeague(), Limit: 5 }, 5, 0, playerIds(first, tiedEarly, tiedLate, fourth, last), nil},
+		{"guild", LeaderboardQuery { Scope: LeaderboardGuild, GuildID: guild.ID, Player: fourth, Around: 1 }, 2, 2, playerIds(tiedLate, fourth), playerIds(tiedLate, fourth)},
+		{"friends", LeaderboardQuery { Scope: LeaderboardFriends, Player: last, Limit: 5 }, 1, 1, playerIds(last), nil},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			query := test.query
+			leaderboard, err := GetLeaderboard(context, &query)
+			if err != nil {
+				t.Fatalf("Failed to get leaderboard: %v", err)
+			}
+			if leaderboard.Count != test.count || leaderboard.Place != test.place {
+				t.Errorf("Leaderboard has %d entries with place %d, want %d with place %d", leaderboard.Count, leaderboard.Place, test.count, test.place)
+			}
+			if top := leaderboardIds(leaderboard.Top); !equalIds(top, test.top) {
+				t.Errorf("Top = %v, want %v", top, test.top)
+			}
+			if around := leaderboardIds(leaderboard.Around); !equalIds(around, test.around) {
+				t.Errorf("Around = %v, want %v", around, test.around)
+			}
+			for i, entry := range leaderboard.Top {
+				if entry.Place != query.Offset + i + 1 {
+					t.Errorf("Entry %d place = %d", i, entry.Place)
+				}
+			}
+		})
+	}
+
+	// ties keep the time they were reached (to the minute)
+	leaderboard, err := GetLeaderboard(context, &LeaderboardQuery { Scope: LeaderboardGlobal, Offset: 1, Limit: 2 })
+	if err != nil {
+		t.Fatalf("Failed to get leaderboard: %v", err)
+	}
+	for i, player := range []*Player { tiedEarly, tiedLate } {
+		entry := leaderboard.Top[i]
+		if entry.Score != player.GetLeaderboardValue() || entry.ReachedTime.Sub(player.PlaceTime) > time.Minute || player.PlaceTime.Sub(entry.ReachedTime) > time.Minute {
+			t.Errorf("Entry %d = %d reached %v, want %d reached %v", i, entry.Score, entry.ReachedTime, player.GetLeaderboardValue(), player.PlaceTime)
+		}
+	}
+}
+
+// player repository checking the live board while players are streamed
+type boardCheckingPlayerRepository struct {
+	PlayerRepository
+	check           func()
+}
+
+func (repository boardCheckingPlayerRepository) Stream(context *util.Context, fields []string, batchSize int, visit func(players []*Player) error) error {
+	return repository.PlayerRepository.Stream(context, fields, batchSize, func(players []*Player) error {
+		repository.check()
+		return visit(players)
+	})
+}
+
+func TestLeaderboardRebuild(t *testing.T) {
+	context := newTestContext()
+	ResetLeaderboards(context)
+
+	now := time.Now()
+	var placed []*Player
+	for wins := 5; wins > 0; wins-- {
+		placed = append(placed, newTestPlacedPlayer(t, context, wins, 5, now))
+	}
+	newTestPlacedPlayer(t, context, 0, 0, now)
+
+	// stale live board: an unknown member, a missing player and an outdated score
+	key := leaderboardKey(LeaderboardGlobal, nil)
+	context.Cache().SetScore(key, bson.NewObjectId().Hex(), 1)
+	placed[0].RemovePlace(context)
+	changed := reloadTestPlayer(t, context, placed[4])
+	changed.SeasonWinCount = 5
+	changed.SeasonLossCount = 0
+	changed.PlaceTime = now.Add(-time.Hour)
+	if err := changed.Save(context); err != nil {
+		t.Fatalf("Failed to save player: %v", err)
+	}
+	liveCount := context.Cache().GetScoreCount(key)
+
+	// the live board stays in place until the rebuilt board replaces it
+	Players = boardCheckingPlayerRepository { Players, func() {
+		if count := context.Cache().GetScoreCount(key); count != liveCount {
+			t.Errorf("Live board has %d entries during the rebuild, want %d", count, liveCount)
+		}
+	} }
+	defer func() {
+		Players = Players.(boardCheckingPlayerRepository).PlayerRepository
+	}()
+
+	rebuild := &LeaderboardRebuild { StartTime: now, Total: 6 }
+	if !rebuild.acquire(context) {
+		t.Fatalf("Failed to acquire the rebuild")
+	}
+	rebuild.save(context)
+	if _, err := StartLeaderboardRebuild(context, 2, 0); err == nil {
+		t.Errorf("Started a second rebuild while one is running")
+	}
+
+	if err := rebuild.rebuild(context, 2, 0); err != nil {
+		t.Fatalf("Rebuild failed: %v", err)
+	}
+	if rebuild.Processed != 6 || rebuild.Placed != 5 {
+		t.Errorf("Rebuild processed %d players and placed %d, want 6 and 5", rebuild.Processed, rebuild.Placed)
+	}
+	if progress := GetLeaderboardRebuild(context); progress == nil || progress.Processed != 6 || progress.GetPercent() != 100 {
+		t.Errorf("Rebuild progress = %+v, want all players processed", progress)
+	}
+
+	leaderboard, err := GetLeaderboard(context, &LeaderboardQuery { Scope: LeaderboardGlobal })
+	if err != nil {
+		t.Fatalf("Failed to get leaderboard: %v", err)
+	}
+	want := playerIds(changed, placed[0], placed[1], placed[2], placed[3])
+	if top := leaderboardIds(leaderboard.Top); !equalIds(top, want) {
+		t.Errorf("Rebuilt board = %v, want %v", top, want)
+	}
+	if count := context.Cache().GetScoreCount(key + leaderboardShadowSuffix); count != 0 {
+		t.Errorf("Shadow board has %d entries left after the rebuild", count)
+	}
+}
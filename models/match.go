@@ -26,6 +26,14 @@ const (
 	MatchTournament
 )
 
+// all match types
+var MatchTypes []MatchType = []MatchType {
+	MatchUnranked,
+	MatchRanked,
+	MatchElite,
+	MatchTournament,
+}
+
 // match state
 type MatchState int
 const (
@@ -59,6 +67,9 @@ type Match struct {
 	GuestScore      int           `bson:"s2" json:"guestScore"`
 	StartTime       time.Time     `bson:"t0" json:"-"`
 	EndTime	        time.Time     `bson:"t1" json:"-"`
+	HostResult      *MatchPlayerSnapshot `bson:"r1,omitempty" json:"-"`
+	GuestResult     *MatchPlayerSnapshot `bson:"r2,omitempty" json:"-"`
+	WarID           bson.ObjectId `bson:"wr,omitempty" json:"-"` // guild war the battle counts towards
 
 	// client
 	Hosting         bool          `bson:"-" json:"hosting"`
@@ -98,7 +109,37 @@ type MatchResult struct {
 	Outcome         MatchOutcome      `json:"oc"`
 	Host            MatchPlayerResult `json:"p1"`
 	Guest           MatchPlayerResult `json:"p2"`
-}
+	HostSnapshot    *MatchPlayerSnapshot `json:"h1,omitempty"`
+	GuestSnapshot   *MatchPlayerSnapshot `json:"h2,omitempty"`
+}
+
+// player as of match completion, so history stays accurate after later rank changes
+type MatchPlayerSnapshot struct {
+	Name            string        `bson:"nm" json:"name"`
+	Tag             string        `bson:"tg" json:"tag"`
+	Deck            Deck          `bson:"dk" json:"deck"`
+	RankPoints      int           `bson:"rk" json:"rankPoints"`       // before the match
+	RankPointsDelta int           `bson:"drk" json:"rankPointsChange"`
+	Rating          int           `bson:"rt" json:"rating"`           // before the match
+	RatingDelta     int           `bson:"drt" json:"ratingChange"`
+}
+
+// completed match from a player's side
+type MatchHistoryEntry struct {
+	MatchID         bson.ObjectId        `json:"matchId"`
+	Type            string               `json:"type"`
+	Arena           string               `json:"arena"`
+	Outcome         MatchOutcome         `json:"outcome"`
+	PlayerScore     int                  `json:"playerScore"`
+	OpponentScore   int                  `json:"opponentScore"`
+	Player          *MatchPlayerSnapshot `json:"player"`
+	Opponent        *MatchPlayerSnapshot `json:"opponent"`
+	ReplayID        bson.ObjectId        `json:"replayId,omitempty"`
+	Time            time.Time            `json:"time"`
+}
+
+// most history entries returned per page
+const MatchHistoryPageLimit = 50
 
 // client rewards
 type MatchReward struct {
@@ -123,6 +164,15 @@ func ensureIndexMatch(database *mgo.Database) {
 		Key:        []string { "id1", "st", "tp" },
 		Background: true,
 	}))
+	// history indexes
+	util.Must(c.EnsureIndex(mgo.Index {
+		Key:        []string { "id1", "st", "-_id" },
+		Background: true,
+	}))
+	util.Must(c.EnsureIndex(mgo.Index {
+		Key:        []string { "id2", "st", "-_id" },
+		Background: true,
+	}))
 }
 
 // custom marshalling
@@ -170,6 +220,15 @@ func GetMatchType(matchName string) MatchType {
 	}
 }
 
+// names of all match types (accepted by GetMatchType)
+func GetMatchTypeNames() []string {
+	names := make([]string, len(MatchTypes))
+	for i, matchType := range MatchTypes {
+		names[i] = GetMatchTypeName(matchType)
+	}
+	return names
+}
+
 func GetMatchTypeName(matchType MatchType) string {
 	switch matchType {
 	default:
@@ -186,22 +245,26 @@ func GetMatchTypeName(matchType MatchType) string {
 }
 
 func GetMatchById(context *util.Context, id bson.ObjectId) (match *Match, err error) {
-	err = context.DB.C(MatchCollectionName).Find(bson.M { "_id": id } ).One(&match)
+	defer util.ObserveDatabase(MatchCollectionName, "getById", time.Now(), &err)
+
+	match, err = Matches.GetById(context, id)
 	return
 }
 
 func (match *Match) Save(context *util.Context) (err error) {
+	defer util.ObserveDatabase(MatchCollectionName, "save", time.Now(), &err)
+
 	if !match.ID.Valid() {
 		match.ID = bson.NewObjectId()
 	}
 
 	// update match in database
-	_, err = context.DB.C(MatchCollectionName).Upsert(bson.M { "_id": match.ID }, match)
+	err = Matches.Save(context, match)
 	return
 }
 
 func (match *Match) Delete(context *util.Context) (err error) {
-	return context.DB.C(MatchCollectionName).Remove(bson.M { "_id": match.ID })
+	return Matches.Delete(context, match.ID)
 }
 
 func (matchResult *MatchResult) String() string {
@@ -218,7 +281,7 @@ func GetMatchResult(context *util.Context, roomID string) (matchResult *MatchRes
 	key := fmt.Sprintf("MatchResult:%s", roomID)
 
 	// get cached result
-	ok = context.Cache.GetJSON(key, &matchResult)
+	ok = context.Cache().GetJSON(key, &matchResult)
 	return
 }
 
@@ -227,11 +290,11 @@ func SetMatchResult(context *util.Context, roomID string, matchResult *MatchResu
 	key := fmt.Sprintf("MatchResult:%s", roomID)
 
 	// set cached result
-	context.Cache.Set(key, matchResult)
+	context.Cache().Set(key, matchResult)
 
 	// expire temp results after some time
 	if matchResult != nil {
-		context.Cache.Expire(key, config.Config.Matches.MatchResultExpire)
+		context.Cache().Expire(key, int(config.Config.Matches.MatchResultExpire.Seconds()))
 	}
 }
 
@@ -253,7 +316,7 @@ func GetMatchTicket(context *util.Context, playerID bson.ObjectId) (ticket *Matc
 	key := fmt.Sprintf("MatchTicket:%s", playerID.Hex())
 
 	// get cached ticket
-	ok = context.Cache.GetJSON(key, &ticket)
+	ok = context.Cache().GetJSON(key, &ticket)
 	return
 }
 
@@ -262,13 +325,13 @@ func AddMatchTicket(context *util.Context, ticket *MatchTicket) {
 	key := fmt.Sprintf("MatchTicket:%s", ticket.PlayerID)
 
 	// set cached ticket
-	context.Cache.Set(key, ticket)
+	context.Cache().Set(key, ticket)
 
 	// expire temp ticket after some time
-	context.Cache.Expire(key, config.Config.Matches.MatchTicketExpire)
+	context.Cache().Expire(key, int(config.Config.Matches.MatchTicketExpire.Seconds()))
 
 	// set MMR score
-	context.Cache.SetScore("MMR", ticket.PlayerID, ticket.MMR)
+	context.Cache().SetScore("MMR", ticket.PlayerID, ticket.MMR)
 }
 
 func ClearMatchTicket(context *util.Context, playerID bson.ObjectId) {
@@ -276,24 +339,15 @@ func ClearMatchTicket(context *util.Context, playerID bson.ObjectId) {
 	key := fmt.Sprintf("MatchTicket:%s", playerID.Hex())
 
 	// clear cached ticket
-	context.Cache.Set(key, nil)
+	context.Cache().Set(key, nil)
 
 	// remove MMR score
-	context.Cache.RemoveScore("MMR", playerID.Hex())
+	context.Cache().RemoveScore("MMR", playerID.Hex())
 }
 
 func ClearMatches(context *util.Context, playerIDs []bson.ObjectId, states ...MatchState) (err error) {
 	// find and remove all invalid matches with player
-	_, err = context.DB.C(MatchCollectionName).RemoveAll(bson.M {
-		"$or": []bson.M {
-			bson.M { "id1": bson.M { "$in": playerIDs }, },
-			bson.M { "id2": bson.M { "$in": playerIDs }, },
-		},
-		"st": bson.M {
-			"$in": states,
-		},
- 	})
- 	return
+	return Matches.RemoveByPlayers(context, playerIDs, states...)
 }
 
 func StartPrivateMatch(context *util.Context, hostID bson.ObjectId, guestID bson.ObjectId, matchType MatchType, roomID string, arenaName string) (match *Match, err error) {
@@ -386,15 +440,15 @@ func FindPublicMatch(context *util.Context, player *Player, matchType MatchType)
 	// find matchmaking players within MMR window
 	window := 1 // NOTE FIXME? - should only have to get the players directly adjacent to requesting,
 	// since those are the closest MMRs.  Unless we have other criteria for matching beyond MMR...
-	playerPlace := context.Cache.GetRank("MMR", player.ID.Hex())
-	opponentIds := context.Cache.GetRankRange("MMR", playerPlace - window, playerPlace + window)
+	playerPlace := context.Cache().GetRank("MMR", player.ID.Hex())
+	opponentIds := context.Cache().GetRankRange("MMR", playerPlace - window, playerPlace + window)
 
 	// iterate through window to find optimal MMR opponent
 	optimalOpponentId := ""
 	optimalMMRDelta := maxMMRDelta + 1
 	for _, opponentId := range opponentIds {
 		if opponentId != player.ID.Hex() {
-			opponentMMR := context.Cache.GetScore("MMR", opponentId)
+			opponentMMR := context.Cache().GetScore("MMR", opponentId)
 			mmrDelta := (opponentMMR - ticket.MMR)
 			if mmrDelta < 0 {
 				mmrDelta = -mmrDelta
@@ -430,6 +484,10 @@ func FindPublicMatch(context *util.Context, player *Player, matchType MatchType)
 				return
 			}
 
+			// matchmaking wait times for both players
+			MetricMatchmakingWait.Observe(durationSearching.Seconds(), match.GetTypeName())
+			MetricMatchmakingWait.ObserveSince(opponentTicket.StartTime, match.GetTypeName())
+
 			// clear current player ticket
 			ClearMatchTicket(context, player.ID)
 
@@ -449,18 +507,7 @@ func FindPublicMatch(context *util.Context, player *Player, matchType MatchType)
 func FailMatch(context *util.Context, playerID bson.ObjectId) (err error) {
 	// find and remove all invalid matches with player
 	var matches []*Match
-	err = context.DB.C(MatchCollectionName).Find(bson.M {
-		"$or": []bson.M {
-			bson.M { "id1": playerID, },
-			bson.M { "id2": playerID, },
-		},
-		"st": bson.M {
-			"$in": []interface{} {
-				MatchOpen,
-				MatchActive,
-			},
-		},
-	}).All(&matches)
+	matches, err = Matches.GetByPlayer(context, playerID, MatchOpen, MatchActive)
 
 	if err == nil {
 		// fix all found matches
@@ -484,9 +531,9 @@ func FailMatch(context *util.Context, playerID bson.ObjectId) (err error) {
 
 func CompleteMatch(context *util.Context, player *Player, roomID string, outcome MatchOutcome, playerScore int, opponentScore int) (match *Match, matchReward *MatchReward, err error) {
 	// get match from database
-	err = context.DB.C(MatchCollectionName).Find(bson.M {
-		"rm": roomID,
-	}).One(&match)
+	start := time.Now()
+	match, err = Matches.GetByRoom(context, roomID)
+	util.ObserveDatabase(MatchCollectionName, "getByRoom", start, &err)
 	if err != nil {
 		return
 	}
@@ -546,12 +593,27 @@ func CompleteMatch(context *util.Context, player *Player, roomID string, outcome
 			}
 		}
 
+		// keep player snapshots for history
+		if match.State == MatchComplete {
+			match.HostResult = matchResult.HostSnapshot
+			match.GuestResult = matchResult.GuestSnapshot
+		}
+
 		// update match in database
 		saveErr := match.Save(context)
 		if saveErr != nil {
 			log.Error(saveErr)
 		}
 
+		if match.State == MatchComplete {
+			MetricMatchesCompleted.Inc(match.GetTypeName())
+
+			// count towards the players' guild war
+			if match.WarID.Valid() {
+				match.addWarResult(context)
+			}
+		}
+
 		// clear results in cache
 		ClearMatchResult(context, roomID)
 	} else {
@@ -570,6 +632,10 @@ func CompleteMatch(context *util.Context, player *Player, roomID string, outcome
 		// process results
 		matchResult = match.ProcessMatchResults(outcome, host, guest, hostScore, guestScore)
 
+		// snapshot players before either applies the results
+		matchResult.HostSnapshot = newMatchPlayerSnapshot(context, host, matchResult.Host)
+		matchResult.GuestSnapshot = newMatchPlayerSnapshot(context, guest, matchResult.Guest)
+
 		// set results to cache
 		SetMatchResult(context, roomID, matchResult)
 	}
@@ -581,6 +647,8 @@ func CompleteMatch(context *util.Context, player *Player, roomID string, outcome
 
 		// modify player stats and add tome
 		player.MatchCount += 1
+		player.SeasonMatchCount += 1
+		player.PlaceTime = time.Now()
 		if isHost {
 			playerResults = &matchResult.Host
 		} else {
@@ -607,12 +675,14 @@ func CompleteMatch(context *util.Context, player *Player, roomID string, outcome
 		if isWinner {
 			matchReward.TomeIndex, matchReward.Tome = player.AddVictoryTome(context)
 			player.WinCount += 1
+			player.SeasonWinCount += 1
 
 			if playerScore == 3 {
 				player.ThreeTowerWinCount += 1
 			}
 		} else if (isLoser) {
 			player.LossCount += 1
+			player.SeasonLossCount += 1
 		}
 	
 		player.UpdateDeckStats(isWinner)
@@ -628,10 +698,103 @@ func CompleteMatch(context *util.Context, player *Player, roomID string, outcome
 
 		// update cached player leaderboard place
 		player.UpdatePlace(context)
+
+		// count towards the player's guild
+		player.addGuildMatchProgress(context, isWinner, isLoser || outcome == MatchSurrender)
 	} 
 	return
 }
 
+func newMatchPlayerSnapshot(context *util.Context, player *Player, result MatchPlayerResult) *MatchPlayerSnapshot {
+	snapshot := &MatchPlayerSnapshot {
+		RankPoints: player.RankPoints,
+		RankPointsDelta: result.RankPoints,
+		Rating: player.Rating,
+		RatingDelta: result.Rating,
+	}
+
+	if user, err := GetUserById(context, player.UserID); err == nil {
+		snapshot.Name = user.Name
+		snapshot.Tag = user.Tag
+	}
+	if player.CurrentDeck >= 0 && player.CurrentDeck < len(player.Decks) {
+		snapshot.Deck = player.Decks[player.CurrentDeck]
+	}
+	return snapshot
+}
+
+// completed matches of a player, newest first, returning the cursor of the next page (nil on the last page)
+func GetMatchHistory(context *util.Context, player *Player, cursor *util.Cursor, limit int) (entries []*MatchHistoryEntry, next *util.Cursor, err error) {
+	if limit <= 0 || limit > MatchHistoryPageLimit {
+		limit = MatchHistoryPageLimit
+	}
+
+	matches, err := Matches.GetHistory(context, player.ID, cursor, limit)
+	if err != nil {
+		return
+	}
+	if len(matches) == limit {
+		next = &util.Cursor { ID: matches[len(matches) - 1].ID }
+	}
+
+	// replays of these matches, preferring the player's own
+	matchIds := make([]bson.ObjectId, len(matches))
+	for i, match := range matches {
+		matchIds[i] = match.ID
+	}
+	replayInfos, err := Replays.GetInfosByMatches(context, matchIds)
+	if err != nil {
+		return
+	}
+	replayIds := map[bson.ObjectId]bson.ObjectId {}
+	for _, replayInfo := range replayInfos {
+		if _, ok := replayIds[replayInfo.MatchID]; !ok || replayInfo.UserID == player.UserID {
+			replayIds[replayInfo.MatchID] = replayInfo.ID
+		}
+	}
+
+	for _, match := range matches {
+		entry := match.GetHistoryEntry(context, player.ID)
+		entry.ReplayID = replayIds[match.ID]
+		entries = append(entries, entry)
+	}
+	return
+}
+
+// match from a player's side (matches completed before snapshots only have current names and tags)
+func (match *Match) GetHistoryEntry(context *util.Context, playerID bson.ObjectId) *MatchHistoryEntry {
+	entry := &MatchHistoryEntry {
+		MatchID: match.ID,
+		Type: match.GetTypeName(),
+		Arena: match.Arena,
+		Outcome: match.Outcome,
+		PlayerScore: match.HostScore,
+		OpponentScore: match.GuestScore,
+		Player: match.HostResult,
+		Opponent: match.GuestResult,
+		Time: match.EndTime,
+	}
+	opponentID := match.GuestID
+
+	if match.GuestID == playerID {
+		entry.Outcome = invertOutcome(match.Outcome)
+		entry.PlayerScore, entry.OpponentScore = match.GuestScore, match.HostScore
+		entry.Player, entry.Opponent = match.GuestResult, match.HostResult
+		opponentID = match.HostID
+	}
+
+	if entry.Opponent == nil {
+		entry.Opponent = &MatchPlayerSnapshot {}
+		if opponent, err := GetPlayerById(context, opponentID); err == nil {
+			if user, err := GetUserById(context, opponent.UserID); err == nil {
+				entry.Opponent.Name = user.Name
+				entry.Opponent.Tag = user.Tag
+			}
+		}
+	}
+	return entry
+}
+
 func (match *Match) ProcessMatchResults(outcome MatchOutcome, host *Player, guest *Player, hostScore int, guestScore int) (matchResult *MatchResult) {
 	matchResult = &MatchResult {
 		MatchID: match.ID,
@@ -760,6 +923,23 @@ func (match *Match) GetOutcomeName() string {
 	}
 }
 
+// host and guest snapshots (nil for matches completed before snapshots)
+func (match *Match) GetResults() []*MatchPlayerSnapshot {
+	return []*MatchPlayerSnapshot { match.HostResult, match.GuestResult }
+}
+
+// rank points and rating changes, e.g. "+1 / -1" (empty without snapshots)
+func (match *Match) GetResultChanges() string {
+	if match.HostResult == nil || match.GuestResult == nil {
+		return ""
+	}
+
+	if match.Type == MatchElite {
+		return fmt.Sprintf("%+d / %+d", match.HostResult.RatingDelta, match.GuestResult.RatingDelta)
+	}
+	return fmt.Sprintf("%+d / %+d", match.HostResult.RankPointsDelta, match.GuestResult.RankPointsDelta)
+}
+
 func invertOutcome(outcome MatchOutcome) MatchOutcome {
 	switch outcome {
 	case MatchSurrender:
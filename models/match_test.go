@@ -0,0 +1,188 @@
+package models
+
+import (
+	"testing"
+
+	"gopkg.in/mgo.v2/bson"
+
+	"bloodtales/util"
+)
+
+func TestCompleteMatch(t *testing.T) {
+	tests := []struct {
+		name            string
+		matchType       MatchType
+		hostOutcome     MatchOutcome // as reported by the host
+		hostScore       int
+		guestOutcome    MatchOutcome // as reported by the guest
+		guestScore      int
+		state           MatchState
+		outcome         MatchOutcome
+		hostRankPoints  int
+		guestRankPoints int
+		hostWins        int
+		guestWins       int
+	}{
+		{"ranked host win", MatchRanked, MatchWin, 3, MatchLoss, 1, MatchComplete, MatchWin, 1, 0, 1, 0},
+		{"ranked guest win", MatchRanked, MatchLoss, 0, MatchWin, 2, MatchComplete, MatchLoss, 0, 1, 0, 1},
+		{"ranked draw", MatchRanked, MatchDraw, 1, MatchDraw, 1, MatchComplete, MatchDraw, 0, 0, 0, 0},
+		{"unranked host win", MatchUnranked, MatchWin, 2, MatchLoss, 0, MatchComplete, MatchWin, 0, 0, 1, 0},
+		{"guest surrenders", MatchRanked, MatchWin, 1, MatchSurrender, 0, MatchComplete, MatchWin, 1, 0, 1, 0},
+		{"both report a win", MatchRanked, MatchWin, 3, MatchWin, 3, MatchInvalid, MatchDraw, 1, 0, 1, 0},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			context := newTestContext()
+			host := newTestPlayer(t, context)
+			guest := newTestPlayer(t, context)
+
+			roomID := util.GenerateUUID()
+			if _, err := StartPrivateMatch(context, host.ID, guest.ID, test.matchType, roomID, "ARENA_TEST"); err != nil {
+				t.Fatalf("Failed to start match: %v", err)
+			}
+
+			// host reports first, the guest's report completes the match
+			if _, _, err := CompleteMatch(context, host, roomID, test.hostOutcome, test.hostScore, test.guestScore); err != nil {
+				t.Fatalf("Host result failed: %v", err)
+			}
+			_, _, err := CompleteMatch(context, guest, roomID, test.guestOutcome, test.guestScore, test.hostScore)
+			if test.state == MatchInvalid {
+				if err == nil {
+					t.Errorf("Guest result succeeded for non-symmetrical outcomes")
+				}
+			} else if err != nil {
+				t.Fatalf("Guest result failed: %v", err)
+			}
+
+			match, err := Matches.GetByRoom(context, roomID)
+			if err != nil {
+				t.Fatalf("Failed to get match: %v", err)
+			}
+			if match.State != test.state {
+				t.Errorf("Match state = %s, want %d", match.GetStateName(), test.state)
+			}
+			if match.State == MatchComplete {
+				if match.Outcome != test.outcome || match.HostScore != test.hostScore || match.GuestScore != test.guestScore {
+					t.Errorf("Match result = %d %d:%d, want %d %d:%d", match.Outcome, match.HostScore, match.GuestScore, test.outcome, test.hostScore, test.guestScore)
+				}
+				if match.HostResult == nil || match.GuestResult == nil {
+					t.Errorf("Match is missing player snapshots")
+				}
+			}
+
+			host = reloadTestPlayer(t, context, host)
+			guest = reloadTestPlayer(t, context, guest)
+			if host.RankPoints != test.hostRankPoints || guest.RankPoints != test.guestRankPoints {
+				t.Errorf("Rank points = %d/%d, want %d/%d", host.RankPoints, guest.RankPoints, test.hostRankPoints, test.guestRankPoints)
+			}
+			if host.WinCount != test.hostWins || guest.WinCount != test.guestWins {
+				t.Errorf("Wins = %d/%d, want %d/%d", host.WinCount, guest.WinCount, test.hostWins, test.guestWins)
+			}
+			if host.MatchCount != 1 {
+				t.Errorf("Host match count = %d, want 1", host.MatchCount)
+			}
+
+			// winners earn a victory tome
+			for _, player := range []*Player { host, guest } {
+				_, empty := player.GetEmptyTomeSlot()
+				won := player.WinCount > 0
+				if won != (player.Tomes[0].State == TomeLocked) || empty == nil {
+					t.Errorf("Player %s tomes = %v after %d wins", player.ID.Hex(), player.Tomes, player.WinCount)
+				}
+			}
+		})
+	}
+}
+
+// ranked match between the players completed with a host win
+func playTestMatch(t *testing.T, context *util.Context, host *Player, guest *Player) {
+	roomID := util.GenerateUUID()
+	if _, err := StartPrivateMatch(context, host.ID, guest.ID, MatchRanked, roomID, "ARENA_TEST"); err != nil {
+		t.Fatalf("Failed to start match: %v", err)
+	}
+	if _, _, err := CompleteMatch(context, reloadTestPlayer(t, context, host), roomID, MatchWin, 2, 1); err != nil {
+		t.Fatalf("Host result failed: %v", err)
+	}
+	if _, _, err := CompleteMatch(context, reloadTestPlayer(t, context, guest), roomID, MatchLoss, 1, 2); err != nil {
+		t.Fatalf("Guest result failed: %v", err)
+	}
+}
+
+func TestGetMatchHistory(t *testing.T) {
+	context := newTestContext()
+	host := newTestPlayer(t, context)
+	guest := newTestPlayer(t, context)
+
+	user, err := GetUserById(context, guest.UserID)
+	if err != nil {
+		t.Fatalf("Failed to get user: %v", err)
+	}
+	user.Name = "Guest"
+	if err = user.Save(context); err != nil {
+		t.Fatalf("Failed to save user: %v", err)
+	}
+
+	for i := 0; i < 3; i++ {
+		playTestMatch(t, context, host, guest)
+	}
+
+	// a later rank reset doesn't change recorded history
+	host = reloadTestPlayer(t, context, host)
+	host.RankPoints = 0
+	if err = host.Save(context); err != nil {
+		t.Fatalf("Failed to save player: %v", err)
+	}
+
+	// replay recorded by the guest for the newest match
+	matches, err := Matches.GetHistory(context, host.ID, nil, 1)
+	if err != nil || len(matches) != 1 {
+		t.Fatalf("Failed to get newest match: %v", err)
+	}
+	replayInfo := &ReplayInfo { ID: bson.NewObjectId(), UserID: guest.UserID, MatchID: matches[0].ID }
+	if err = Replays.InsertInfo(context, replayInfo); err != nil {
+		t.Fatalf("Failed to insert replay: %v", err)
+	}
+
+	// newest first, two per page
+	var entries []*MatchHistoryEntry
+	var cursor *util.Cursor
+	for page := 0; page < 2; page++ {
+		pageEntries, next, err := GetMatchHistory(context, host, cursor, 2)
+		if err != nil {
+			t.Fatalf("Failed to get history page %d: %v", page, err)
+		}
+		if (next == nil) != (page == 1) {
+			t.Errorf("Page %d next cursor = %v", page, next)
+		}
+		entries, cursor = append(entries, pageEntries...), next
+	}
+	if len(entries) != 3 {
+		t.Fatalf("History has %d entries, want 3", len(entries))
+	}
+
+	for i, entry := range entries {
+		rankPoints := len(entries) - 1 - i
+		if entry.Outcome != MatchWin || entry.PlayerScore != 2 || entry.OpponentScore != 1 {
+			t.Errorf("Entry %d result = %d %d:%d, want a 2:1 win", i, entry.Outcome, entry.PlayerScore, entry.OpponentScore)
+		}
+		if entry.Player == nil || entry.Player.RankPoints != rankPoints || entry.Player.RankPointsDelta != 1 {
+			t.Errorf("Entry %d player = %+v, want %d rank points before a +1 change", i, entry.Player, rankPoints)
+		}
+		if entry.Opponent == nil || entry.Opponent.Name != "Guest" || entry.Opponent.RankPointsDelta != 0 {
+			t.Errorf("Entry %d opponent = %+v, want Guest without a change", i, entry.Opponent)
+		}
+		if (entry.ReplayID == replayInfo.ID) != (i == 0) {
+			t.Errorf("Entry %d replay = %v", i, entry.ReplayID)
+		}
+	}
+
+	// the guest sees the same matches as losses
+	guestEntries, _, err := GetMatchHistory(context, guest, nil, 0)
+	if err != nil || len(guestEntries) != 3 {
+		t.Fatalf("Guest history = %d entries (%v), want 3", len(guestEntries), err)
+	}
+	if entry := guestEntries[0]; entry.Outcome != MatchLoss || entry.PlayerScore != 1 || entry.Player.Name != "Guest" {
+		t.Errorf("Guest entry = %+v, want a 1:2 loss", entry)
+	}
+}
@@ -0,0 +1,1583 @@
+package models
+
+import (
+	"sort"
+	"time"
+	"sync"
+	"regexp"
+
+	"gopkg.in/mgo.v2"
+	"gopkg.in/mgo.v2/bson"
+
+	"bloodtales/data"
+	"bloodtales/util"
+)
+
+// in-memory repositories for memory storage (no indexes, expiry or aggregation)
+type memoryUserRepository struct {
+	documents       *memoryCollection
+}
+
+type memoryPlayerRepository struct {
+	documents       *memoryCollection
+	updates         sync.Mutex
+}
+
+type memoryMatchRepository struct {
+	documents       *memoryCollection
+}
+
+type memoryGuildRepository struct {
+	documents       *memoryCollection
+	progress        sync.Mutex
+}
+
+type memoryNotificationRepository struct {
+	documents       *memoryCollection
+	updates         sync.Mutex
+}
+
+type memoryReplayRepository struct {
+	infos           *memoryCollection
+	datas           *memoryCollection
+	files           *memoryCollection
+	shares          *memoryCollection
+}
+
+type memorySeasonRepository struct {
+	seasons         *memoryCollection
+	results         *memoryCollection
+	claims          sync.Mutex
+}
+
+type memoryDonationRepository struct {
+	requests        *memoryCollection
+	donations       *memoryCollection
+	updates         sync.Mutex
+}
+
+type memoryWarRepository struct {
+	documents       *memoryCollection
+	updates         sync.Mutex
+}
+
+type memorySanctionRepository struct {
+	documents       *memoryCollection
+}
+
+type memoryAuditRepository struct {
+	documents       *memoryCollection
+}
+
+type memoryFriendsRepository struct {
+	documents       *memoryCollection
+}
+
+type memoryTrackingRepository struct {
+	documents       *memoryCollection
+}
+
+type memorySocketRepository struct {
+	documents       *memoryCollection
+}
+
+type memoryFile struct {
+	ID              bson.ObjectId `bson:"_id"`
+	Data            []byte        `bson:"d"`
+}
+
+// documents stored as BSON in insertion order, so callers never share state with the store
+type memoryCollection struct {
+	mutex           sync.RWMutex
+	documents       map[bson.ObjectId][]byte
+	ids             []bson.ObjectId
+}
+
+func newMemoryCollection() *memoryCollection {
+	return &memoryCollection {
+		documents: map[bson.ObjectId][]byte {},
+	}
+}
+
+func (collection *memoryCollection) insert(id bson.ObjectId, document interface{}) error {
+	raw, err := bson.Marshal(document)
+	if err != nil {
+		return err
+	}
+
+	collection.mutex.Lock()
+	defer collection.mutex.Unlock()
+
+	if _, ok := collection.documents[id]; ok {
+		return &mgo.LastError { Code: 11000, Err: "duplicate key: " + id.Hex() }
+	}
+	collection.documents[id] = raw
+	collection.ids = append(collection.ids, id)
+	return nil
+}
+
+func (collection *memoryCollection) upsert(id bson.ObjectId, document interface{}) error {
+	raw, err := bson.Marshal(document)
+	if err != nil {
+		return err
+	}
+
+	collection.mutex.Lock()
+	defer collection.mutex.Unlock()
+
+	if _, ok := collection.documents[id]; !ok {
+		collection.ids = append(collection.ids, id)
+	}
+	collection.documents[id] = raw
+	return nil
+}
+
+// set top level fields
+func (collection *memoryCollection) update(id bson.ObjectId, updates bson.M) error {
+	collection.mutex.Lock()
+	defer collection.mutex.Unlock()
+
+	raw, ok := collection.documents[id]
+	if !ok {
+		return mgo.ErrNotFound
+	}
+
+	var document bson.M
+	if err := bson.Unmarshal(raw, &document); err != nil {
+		return err
+	}
+	for key, value := range updates {
+		document[key] = value
+	}
+
+	raw, err := bson.Marshal(document)
+	if err != nil {
+		return err
+	}
+	collection.documents[id] = raw
+	return nil
+}
+
+func (collection *memoryCollection) remove(id bson.ObjectId) error {
+	collection.mutex.Lock()
+	defer collection.mutex.Unlock()
+
+	if _, ok := collection.documents[id]; !ok {
+		return mgo.ErrNotFound
+	}
+	delete(collection.documents, id)
+	for i, existing := range collection.ids {
+		if existing == id {
+			collection.ids = append(collection.ids[:i], collection.ids[i + 1:]...)
+			break
+		}
+	}
+	return nil
+}
+
+func (collection *memoryCollection) get(id bson.ObjectId, result interface{}) error {
+	collection.mutex.RLock()
+	raw, ok := collection.documents[id]
+	collection.mutex.RUnlock()
+
+	if !ok {
+		return mgo.ErrNotFound
+	}
+	return bson.Unmarshal(raw, result)
+}
+
+// visit a snapshot of all documents in insertion order
+func (collection *memoryCollection) each(visit func(raw []byte) error) error {
+	collection.mutex.RLock()
+	raws := make([][]byte, len(collection.ids))
+	for i, id := range collection.ids {
+		raws[i] = collection.documents[id]
+	}
+	collection.mutex.RUnlock()
+
+	for _, raw := range raws {
+		if err := visit(raw); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func containsId(ids []bson.ObjectId, id bson.ObjectId) bool {
+	for _, existing := range ids {
+		if existing == id {
+			return true
+		}
+	}
+	return false
+}
+
+func containsMatchState(states []MatchState, state MatchState) bool {
+	for _, existing := range states {
+		if existing == state {
+			return true
+		}
+	}
+	return false
+}
+
+// users
+
+func (repository *memoryUserRepository) find(match func(user *User) bool) (users []*User, err error) {
+	err = repository.documents.each(func(raw []byte) error {
+		user := &User {}
+		if err := bson.Unmarshal(raw, user); err != nil {
+			return err
+		}
+		if match(user) {
+			users = append(users, user)
+		}
+		return nil
+	})
+	return
+}
+
+func (repository *memoryUserRepository) findOne(match func(user *User) bool) (*User, error) {
+	users, err := repository.find(match)
+	if err != nil {
+		return nil, err
+	}
+	if len(users) == 0 {
+		return nil, mgo.ErrNotFound
+	}
+	return users[0], nil
+}
+
+func (repository *memoryUserRepository) Insert(context *util.Context, user *User) error {
+	return repository.documents.insert(user.ID, user)
+}
+
+func (repository *memoryUserRepository) Save(context *util.Context, user *User) error {
+	return repository.documents.upsert(user.ID, user)
+}
+
+func (repository *memoryUserRepository) Delete(context *util.Context, id bson.ObjectId) error {
+	return repository.documents.remove(id)
+}
+
+func (repository *memoryUserRepository) GetById(context *util.Context, id bson.ObjectId) (user *User, err error) {
+	user = &User {}
+	if err = repository.documents.get(id, user); err != nil {
+		user = nil
+	}
+	return
+}
+
+func (repository *memoryUserRepository) GetByDevice(context *util.Context, uuid string) (*User, error) {
+	return repository.findOne(func(user *User) bool {
+		for _, device := range user.Devices {
+			if device.ID == uuid {
+				return true
+			}
+		}
+		return false
+	})
+}
+
+// any credential matching both provider and ID of any stored credential (as the mongo query on array fields)
+func (repository *memoryUserRepository) GetByCredentials(context *util.Context, credentials []Credential) (*User, error) {
+	return repository.findOne(func(user *User) bool {
+		for _, credential := range credentials {
+			provider, id := false, false
+			for _, stored := range user.Credentials {
+				provider = provider || stored.Provider == credential.Provider
+				id = id || stored.ID == credential.ID
+			}
+			if provider && id {
+				return true
+			}
+		}
+		return false
+	})
+}
+
+func (repository *memoryUserRepository) GetByTag(context *util.Context, tag string) (*User, error) {
+	return repository.findOne(func(user *User) bool {
+		return user.Tag == tag
+	})
+}
+
+func (repository *memoryUserRepository) GetByUsername(context *util.Context, username string) (*User, error) {
+	return repository.findOne(func(user *User) bool {
+		return user.Username == username
+	})
+}
+
+func (repository *memoryUserRepository) GetByIds(context *util.Context, ids []bson.ObjectId) ([]*User, error) {
+	return repository.find(func(user *User) bool {
+		return containsId(ids, user.ID)
+	})
+}
+
+func (repository *memoryUserRepository) GetAdmins(context *util.Context) (users []*User, err error) {
+	users, err = repository.find(func(user *User) bool {
+		return user.Admin || user.Role != RoleNone
+	})
+	sort.SliceStable(users, func(i, j int) bool {
+		return users[i].Username < users[j].Username
+	})
+	return
+}
+
+// players
+
+func (repository *memoryPlayerRepository) find(match func(player *Player) bool) (players []*Player, err error) {
+	err = repository.documents.each(func(raw []byte) error {
+		player := &Player {}
+		if err := bson.Unmarshal(raw, player); err != nil {
+			return err
+		}
+		if match(player) {
+			players = append(players, player)
+		}
+		return nil
+	})
+	return
+}
+
+func (repository *memoryPlayerRepository) Save(context *util.Context, player *Player) error {
+	return repository.documents.upsert(player.ID, player)
+}
+
+func (repository *memoryPlayerRepository) Update(context *util.Context, id bson.ObjectId, updates bson.M) error {
+	return repository.documents.update(id, updates)
+}
+
+func (repository *memoryPlayerRepository) UpdateCardCount(context *util.Context, id bson.ObjectId, cardId data.DataId, count int, increments bson.M) error {
+	repository.updates.Lock()
+	defer repository.updates.Unlock()
+
+	return repository.updateCardCount(id, cardId, count, increments, nil)
+}
+
+func (repository *memoryPlayerRepository) DebitDonation(context *util.Context, donation *CardDonation, increments bson.M) error {
+	repository.updates.Lock()
+	defer repository.updates.Unlock()
+
+	return repository.updateCardCount(donation.DonorID, donation.CardID, -donation.Count, increments, func(player *Player, updates bson.M) {
+		updates["dl"] = withDebitedDonation(player.DonationIDs, donation.ID)
+	})
+}
+
+// card count and increments in one update, with other updates from the stored player (requires lock)
+func (repository *memoryPlayerRepository) updateCardCount(id bson.ObjectId, cardId data.DataId, count int, increments bson.M, update func(player *Player, updates bson.M)) error {
+	player := &Player {}
+	if err := repository.documents.get(id, player); err != nil {
+		return err
+	}
+	card := player.GetCard(cardId)
+	if card == nil || card.CardCount + count < 0 {
+		return mgo.ErrNotFound
+	}
+
+	// increments through the stored document, as $inc would
+	raw := bson.M {}
+	if err := repository.documents.get(id, &raw); err != nil {
+		return err
+	}
+	updates := bson.M {}
+	for field, value := range increments {
+		current := 0
+		switch stored := raw[field].(type) {
+		case int:
+			current = stored
+		case int64:
+			current = int(stored)
+		}
+		updates[field] = current + value.(int)
+	}
+	card.CardCount += count
+	updates["cd"] = player.Cards
+	if update != nil {
+		update(player, updates)
+	}
+	return repository.documents.update(id, updates)
+}
+
+func (repository *memoryPlayerRepository) Delete(context *util.Context, id bson.ObjectId) error {
+	return repository.documents.remove(id)
+}
+
+func (repository *memoryPlayerRepository) GetById(context *util.Context, id bson.ObjectId) (player *Player, err error) {
+	player = &Player {}
+	if err = repository.documents.get(id, player); err != nil {
+		player = nil
+	}
+	return
+}
+
+func (repository *memoryPlayerRepository) GetByUser(context *util.Context, userId bson.ObjectId) (*Player, error) {
+	players, err := repository.find(func(player *Player) bool {
+		return player.UserID == userId
+	})
+	if err != nil {
+		return nil, err
+	}
+	if len(players) == 0 {
+		return nil, mgo.ErrNotFound
+	}
+	return players[0], nil
+}
+
+func (repository *memoryPlayerRepository) GetByIds(context *util.Context, ids []bson.ObjectId) ([]*Player, error) {
+	return repository.find(func(player *Player) bool {
+		return containsId(ids, player.ID)
+	})
+}
+
+func (repository *memoryPlayerRepository) GetByGuild(context *util.Context, guildId bson.ObjectId) ([]*Player, error) {
+	return repository.find(func(player *Player) bool {
+		return player.GuildID == guildId
+	})
+}
+
+func (repository *memoryPlayerRepository) GetAll(context *util.Context) ([]*Player, error) {
+	return repository.find(func(player *Player) bool {
+		return true
+	})
+}
+
+func (repository *memoryPlayerRepository) GetAfter(context *util.Context, afterId bson.ObjectId, limit int) (players []*Player, err error) {
+	players, err = repository.find(func(player *Player) bool {
+		return !afterId.Valid() || player.ID > afterId
+	})
+	sort.SliceStable(players, func(i, j int) bool {
+		return players[i].ID < players[j].ID
+	})
+	if limit > 0 && len(players) > limit {
+		players = players[:limit]
+	}
+	return
+}
+
+func (repository *memoryPlayerRepository) Stream(context *util.Context, fields []string, batchSize int, visit func(players []*Player) error) error {
+	players := make([]*Player, 0, batchSize)
+	err := repository.documents.each(func(raw []byte) error {
+		player := &Player {}
+		if err := bson.Unmarshal(raw, player); err != nil {
+			return err
+		}
+
+		players = append(players, player)
+		if len(players) < batchSize {
+			return nil
+		}
+
+		batch := players
+		players = make([]*Player, 0, batchSize)
+		return visit(batch)
+	})
+	if err != nil || len(players) == 0 {
+		return err
+	}
+	return visit(players)
+}
+
+func (repository *memoryPlayerRepository) Count(context *util.Context) (count int, err error) {
+	err = repository.documents.each(func(raw []byte) error {
+		count++
+		return nil
+	})
+	return
+}
+
+// matches
+
+func (repository *memoryMatchRepository) find(match func(match *Match) bool) (matches []*Match, err error) {
+	err = repository.documents.each(func(raw []byte) error {
+		document := &Match {}
+		if err := bson.Unmarshal(raw, document); err != nil {
+			return err
+		}
+		if match(document) {
+			matches = append(matches, document)
+		}
+		return nil
+	})
+	return
+}
+
+func (repository *memoryMatchRepository) Save(context *util.Context, match *Match) error {
+	return repository.documents.upsert(match.ID, match)
+}
+
+func (repository *memoryMatchRepository) Delete(context *util.Context, id bson.ObjectId) error {
+	return repository.documents.remove(id)
+}
+
+func (repository *memoryMatchRepository) GetById(context *util.Context, id bson.ObjectId) (match *Match, err error) {
+	match = &Match {}
+	if err = repository.documents.get(id, match); err != nil {
+		match = nil
+	}
+	return
+}
+
+func (repository *memoryMatchRepository) GetByRoom(context *util.Context, roomID string) (*Match, error) {
+	matches, err := repository.find(func(match *Match) bool {
+		return match.RoomID == roomID
+	})
+	if err != nil {
+		return nil, err
+	}
+	if len(matches) == 0 {
+		return nil, mgo.ErrNotFound
+	}
+	return matches[0], nil
+}
+
+func (repository *memoryMatchRepository) GetByPlayer(context *util.Context, playerID bson.ObjectId, states ...MatchState) ([]*Match, error) {
+	return repository.find(func(match *Match) bool {
+		return (match.HostID == playerID || match.GuestID == playerID) && containsMatchState(states, match.State)
+	})
+}
+
+func (repository *memoryMatchRepository) GetHistory(context *util.Context, playerID bson.ObjectId, cursor *util.Cursor, limit int) (matches []*Match, err error) {
+	matches, err = repository.find(func(match *Match) bool {
+		return (match.HostID == playerID || match.GuestID == playerID) && match.State == MatchComplete && (cursor == nil || match.ID < cursor.ID)
+	})
+	sort.SliceStable(matches, func(i, j int) bool {
+		return matches[i].ID > matches[j].ID
+	})
+	if limit > 0 && len(matches) > limit {
+		matches = matches[:limit]
+	}
+	return
+}
+
+func (repository *memoryMatchRepository) RemoveByPlayers(context *util.Context, playerIDs []bson.ObjectId, states ...MatchState) error {
+	matches, err := repository.find(func(match *Match) bool {
+		return (containsId(playerIDs, match.HostID) || containsId(playerIDs, match.GuestID)) && containsMatchState(states, match.State)
+	})
+	if err != nil {
+		return err
+	}
+
+	for _, match := range matches {
+		repository.documents.remove(match.ID)
+	}
+	return nil
+}
+
+// guilds
+
+func (repository *memoryGuildRepository) find(match func(guild *Guild) bool) (guilds []*Guild, err error) {
+	err = repository.documents.each(func(raw []byte) error {
+		guild := &Guild {}
+		if err := bson.Unmarshal(raw, guild); err != nil {
+			return err
+		}
+		if match(guild) {
+			guilds = append(guilds, guild)
+		}
+		return nil
+	})
+	return
+}
+
+func (repository *memoryGuildRepository) findOne(match func(guild *Guild) bool) (*Guild, error) {
+	guilds, err := repository.find(match)
+	if err != nil {
+		return nil, err
+	}
+	if len(guilds) == 0 {
+		return nil, mgo.ErrNotFound
+	}
+	return guilds[0], nil
+}
+
+func (repository *memoryGuildRepository) Save(context *util.Context, guild *Guild) error {
+	return repository.documents.upsert(guild.ID, guild)
+}
+
+func (repository *memoryGuildRepository) Delete(context *util.Context, id bson.ObjectId) error {
+	return repository.documents.remove(id)
+}
+
+func (repository *memoryGuildRepository) GetById(context *util.Context, id bson.ObjectId) (guild *Guild, err error) {
+	guild = &Guild {}
+	if err = repository.documents.get(id, guild); err != nil {
+		guild = nil
+	}
+	return
+}
+
+func (repository *memoryGuildRepository) GetByTag(context *util.Context, tag string) (*Guild, error) {
+	return repository.findOne(func(guild *Guild) bool {
+		return guild.Tag == tag
+	})
+}
+
+func (repository *memoryGuildRepository) GetByOwner(context *util.Context, ownerId bson.ObjectId) (*Guild, error) {
+	return repository.findOne(func(guild *Guild) bool {
+		return guild.OwnerID == ownerId
+	})
+}
+
+func (repository *memoryGuildRepository) GetByIds(context *util.Context, ids []bson.ObjectId) ([]*Guild, error) {
+	return repository.find(func(guild *Guild) bool {
+		return containsId(ids, guild.ID)
+	})
+}
+
+func (repository *memoryGuildRepository) GetAll(context *util.Context) ([]*Guild, error) {
+	return repository.find(func(guild *Guild) bool {
+		return true
+	})
+}
+
+func (repository *memoryGuildRepository) FindByName(context *util.Context, pattern string) ([]*Guild, error) {
+	expression, err := regexp.Compile("(?i)" + pattern)
+	if err != nil {
+		return nil, err
+	}
+
+	return repository.find(func(guild *Guild) bool {
+		return expression.MatchString(guild.Name)
+	})
+}
+
+func (repository *memoryGuildRepository) AddProgress(context *util.Context, id bson.ObjectId, progress GuildProgress) (*Guild, error) {
+	repository.progress.Lock()
+	defer repository.progress.Unlock()
+
+	guild := &Guild {}
+	if err := repository.documents.get(id, guild); err != nil {
+		return nil, err
+	}
+
+	guild.XP += progress.XP
+	guild.Rating += progress.Rating
+	if guild.Rating < 0 {
+		guild.Rating = 0
+	}
+	guild.WinCount += progress.WinCount
+	guild.LossCount += progress.LossCount
+	guild.MatchCount += progress.MatchCount
+
+	err := repository.documents.update(id, bson.M {
+		"xp": guild.XP,
+		"rt": guild.Rating,
+		"wc": guild.WinCount,
+		"lc": guild.LossCount,
+		"mc": guild.MatchCount,
+	})
+	return guild, err
+}
+
+// notifications
+
+func (repository *memoryNotificationRepository) find(match func(notification *Notification) bool) (notifications []*Notification, err error) {
+	err = repository.documents.each(func(raw []byte) error {
+		notification := &Notification {}
+		if err := bson.Unmarshal(raw, notification); err != nil {
+			return err
+		}
+		if match(notification) {
+			notifications = append(notifications, notification)
+		}
+		return nil
+	})
+
+	// oldest first
+	sort.SliceStable(notifications, func(i, j int) bool {
+		return notifications[i].CreatedAt.Before(notifications[j].CreatedAt)
+	})
+	return
+}
+
+func (repository *memoryNotificationRepository) Save(context *util.Context, notification *Notification) error {
+	return repository.documents.upsert(notification.ID, notification)
+}
+
+func (repository *memoryNotificationRepository) Delete(context *util.Context, id bson.ObjectId) error {
+	return repository.documents.remove(id)
+}
+
+func (repository *memoryNotificationRepository) GetById(context *util.Context, id bson.ObjectId) (notification *Notification, err error) {
+	notification = &Notification {}
+	if err = repository.documents.get(id, notification); err != nil {
+		notification = nil
+	}
+	return
+}
+
+func (repository *memoryNotificationRepository) GetBySender(context *util.Context, senderId bson.ObjectId) ([]*Notification, error) {
+	return repository.find(func(notification *Notification) bool {
+		return notification.SenderID == senderId
+	})
+}
+
+func (repository *memoryNotificationRepository) GetByReceiver(context *util.Context, playerId bson.ObjectId, guildId bson.ObjectId, types []string) ([]*Notification, error) {
+	return repository.find(func(notification *Notification) bool {
+		received := false
+		switch {
+		case !notification.Guild:
+			received = notification.ReceiverID == playerId || notification.ReceiverID == ""
+		case guildId.Valid():
+			received = notification.ReceiverID == guildId
+		}
+		if !received {
+			return false
+		}
+
+		if len(types) > 0 {
+			for _, notificationType := range types {
+				if notificationType == notification.Type {
+					return true
+				}
+			}
+			return false
+		}
+		return true
+	})
+}
+
+func (repository *memoryNotificationRepository) RemoveViewed(context *util.Context, ids []bson.ObjectId) error {
+	notifications, err := repository.find(func(notification *Notification) bool {
+		return containsId(ids, notification.ID) && len(notification.Actions) == 0
+	})
+	if err != nil {
+		return err
+	}
+
+	for _, notification := range notifications {
+		repository.documents.remove(notification.ID)
+	}
+	return nil
+}
+
+func (repository *memoryNotificationRepository) UpdateData(context *util.Context, id bson.ObjectId, key string, expected interface{}, value interface{}) error {
+	repository.updates.Lock()
+	defer repository.updates.Unlock()
+
+	notification := &Notification {}
+	if err := repository.documents.get(id, notification); err != nil {
+		return err
+	}
+	if current, ok := notification.Data[key]; !ok || current != expected {
+		return mgo.ErrNotFound
+	}
+
+	notification.Data[key] = value
+	return repository.documents.update(id, bson.M { "dt": notification.Data })
+}
+
+// replays
+
+func (repository *memoryReplayRepository) findInfos(match func(replayInfo *ReplayInfo) bool) (replayInfos []*ReplayInfo, err error) {
+	err = repository.infos.each(func(raw []byte) error {
+		replayInfo := &ReplayInfo {}
+		if err := bson.Unmarshal(raw, replayInfo); err != nil {
+			return err
+		}
+		if match(replayInfo) {
+			replayInfos = append(replayInfos, replayInfo)
+		}
+		return nil
+	})
+	return
+}
+
+func limitReplayInfos(replayInfos []*ReplayInfo, limit int) []*ReplayInfo {
+	if limit > 0 && len(replayInfos) > limit {
+		return replayInfos[:limit]
+	}
+	return replayInfos
+}
+
+func (repository *memoryReplayRepository) InsertInfo(context *util.Context, replayInfo *ReplayInfo) error {
+	return repository.infos.insert(replayInfo.ID, replayInfo)
+}
+
+func (repository *memoryReplayRepository) InsertData(context *util.Context, replayData *ReplayData) error {
+	if _, err := repository.GetDataByInfo(context, replayData.InfoID); err == nil {
+		return &mgo.LastError { Code: 11000, Err: "duplicate key: " + replayData.InfoID.Hex() }
+	}
+	return repository.datas.insert(replayData.ID, replayData)
+}
+
+func (repository *memoryReplayRepository) UpdateInfo(context *util.Context, replayInfo *ReplayInfo) error {
+	if err := repository.infos.get(replayInfo.ID, &ReplayInfo {}); err != nil {
+		return err
+	}
+	return repository.infos.upsert(replayInfo.ID, replayInfo)
+}
+
+func (repository *memoryReplayRepository) UpdateData(context *util.Context, replayData *ReplayData) error {
+	if err := repository.datas.get(replayData.ID, &ReplayData {}); err != nil {
+		return err
+	}
+	return repository.datas.upsert(replayData.ID, replayData)
+}
+
+func (repository *memoryReplayRepository) InsertFile(context *util.Context, id bson.ObjectId, data []byte) error {
+	return repository.files.insert(id, &memoryFile { ID: id, Data: data })
+}
+
+func (repository *memoryReplayRepository) GetFile(context *util.Context, id bson.ObjectId) (data []byte, err error) {
+	file := &memoryFile {}
+	if err = repository.files.get(id, file); err == nil {
+		data = file.Data
+	}
+	return
+}
+
+func (repository *memoryReplayRepository) Delete(context *util.Context, infoId bson.ObjectId) error {
+	// delete replay file, data and shares, then info
+	if replayData, err := repository.GetDataByInfo(context, infoId); err == nil {
+		if replayData.FileID.Valid() {
+			repository.files.remove(replayData.FileID)
+		}
+		repository.datas.remove(replayData.ID)
+	}
+
+	replayShares, _ := repository.findShares(func(replayShare *ReplayShare) bool {
+		return replayShare.InfoID == infoId
+	})
+	for _, replayShare := range replayShares {
+		repository.shares.remove(replayShare.ID)
+	}
+	return repository.infos.remove(infoId)
+}
+
+func (repository *memoryReplayRepository) GetInfoById(context *util.Context, infoId bson.ObjectId) (replayInfo *ReplayInfo, err error) {
+	replayInfo = &ReplayInfo {}
+	if err = repository.infos.get(infoId, replayInfo); err != nil {
+		replayInfo = nil
+	}
+	return
+}
+
+func (repository *memoryReplayRepository) GetDataByInfo(context *util.Context, infoId bson.ObjectId) (replayData *ReplayData, err error) {
+	err = mgo.ErrNotFound
+	repository.datas.each(func(raw []byte) error {
+		data := &ReplayData {}
+		if bson.Unmarshal(raw, data) == nil && data.InfoID == infoId {
+			replayData, err = data, nil
+		}
+		return nil
+	})
+	return
+}
+
+func (repository *memoryReplayRepository) GetInfosByUser(context *util.Context, userId bson.ObjectId, limit int) (replayInfos []*ReplayInfo, err error) {
+	replayInfos, err = repository.findInfos(func(replayInfo *ReplayInfo) bool {
+		return replayInfo.UserID == userId
+	})
+	sort.SliceStable(replayInfos, func(i, j int) bool {
+		return replayInfos[i].CreatedAt.After(replayInfos[j].CreatedAt)
+	})
+	return limitReplayInfos(replayInfos, limit), err
+}
+
+func (repository *memoryReplayRepository) GetInfosByMatches(context *util.Context, matchIds []bson.ObjectId) ([]*ReplayInfo, error) {
+	return repository.findInfos(func(replayInfo *ReplayInfo) bool {
+		return replayInfo.MatchID.Valid() && containsId(matchIds, replayInfo.MatchID)
+	})
+}
+
+func (repository *memoryReplayRepository) GetTopInfos(context *util.Context, limit int) (replayInfos []*ReplayInfo, err error) {
+	replayInfos, err = repository.findInfos(func(replayInfo *ReplayInfo) bool {
+		return true
+	})
+	sort.SliceStable(replayInfos, func(i, j int) bool {
+		return replayInfos[i].Rank > replayInfos[j].Rank
+	})
+	return limitReplayInfos(replayInfos, limit), err
+}
+
+func (repository *memoryReplayRepository) GetExpiredInfos(context *util.Context, before time.Time, keepIds []bson.ObjectId, limit int) (replayInfos []*ReplayInfo, err error) {
+	replayInfos, err = repository.findInfos(func(replayInfo *ReplayInfo) bool {
+		return replayInfo.CreatedAt.Before(before) && !containsId(keepIds, replayInfo.ID)
+	})
+	sort.SliceStable(replayInfos, func(i, j int) bool {
+		return replayInfos[i].CreatedAt.Before(replayInfos[j].CreatedAt)
+	})
+	return limitReplayInfos(replayInfos, limit), err
+}
+
+func (repository *memoryReplayRepository) GetLegacyDatas(context *util.Context, limit int) (replayDatas []*ReplayData, err error) {
+	err = repository.datas.each(func(raw []byte) error {
+		replayData := &ReplayData {}
+		if err := bson.Unmarshal(raw, replayData); err != nil {
+			return err
+		}
+		if replayData.Data != "" && (limit <= 0 || len(replayDatas) < limit) {
+			replayDatas = append(replayDatas, replayData)
+		}
+		return nil
+	})
+	return
+}
+
+func (repository *memoryReplayRepository) Search(context *util.Context, filter *ReplayFilter, cursor *util.Cursor, limit int) (replayInfos []*ReplayInfo, err error) {
+	replayInfos, err = repository.findInfos(func(replayInfo *ReplayInfo) bool {
+		if filter.UserID.Valid() && replayInfo.UserID != filter.UserID {
+			return false
+		}
+		if filter.Arena != "" && replayInfo.Arena != filter.Arena {
+			return false
+		}
+		if cursor != nil && !cursor.After(int64(replayInfo.Rank), replayInfo.ID) {
+			return false
+		}
+
+		if len(filter.Leagues) > 0 {
+			found := false
+			for _, league := range filter.Leagues {
+				found = found || league == replayInfo.League
+			}
+			if !found {
+				return false
+			}
+		}
+		if filter.CardID != 0 {
+			found := false
+			for _, cardId := range replayInfo.CardIDs {
+				found = found || cardId == filter.CardID
+			}
+			if !found {
+				return false
+			}
+		}
+		if filter.PlayerID.Valid() {
+			found := false
+			for _, replayPlayer := range replayInfo.Players {
+				found = found || replayPlayer.PlayerID == filter.PlayerID
+			}
+			if !found {
+				return false
+			}
+		}
+		return true
+	})
+	sort.SliceStable(replayInfos, func(i, j int) bool {
+		if replayInfos[i].Rank != replayInfos[j].Rank {
+			return replayInfos[i].Rank > replayInfos[j].Rank
+		}
+		return replayInfos[i].ID > replayInfos[j].ID
+	})
+	return limitReplayInfos(replayInfos, limit), err
+}
+
+func (repository *memoryReplayRepository) findShares(match func(replayShare *ReplayShare) bool) (replayShares []*ReplayShare, err error) {
+	err = repository.shares.each(func(raw []byte) error {
+		replayShare := &ReplayShare {}
+		if err := bson.Unmarshal(raw, replayShare); err != nil {
+			return err
+		}
+		if match(replayShare) {
+			replayShares = append(replayShares, replayShare)
+		}
+		return nil
+	})
+	return
+}
+
+func (repository *memoryReplayRepository) InsertShare(context *util.Context, replayShare *ReplayShare) error {
+	return repository.shares.insert(replayShare.ID, replayShare)
+}
+
+func (repository *memoryReplayRepository) GetSharesByGuild(context *util.Context, guildId bson.ObjectId, cursor *util.Cursor, limit int) (replayShares []*ReplayShare, err error) {
+	replayShares, err = repository.findShares(func(replayShare *ReplayShare) bool {
+		return replayShare.GuildID == guildId && (cursor == nil || replayShare.ID < cursor.ID)
+	})
+	sort.SliceStable(replayShares, func(i, j int) bool {
+		return replayShares[i].ID > replayShares[j].ID
+	})
+	if limit > 0 && len(replayShares) > limit {
+		replayShares = replayShares[:limit]
+	}
+	return
+}
+
+// seasons
+
+func (repository *memorySeasonRepository) findResults(match func(result *SeasonResult) bool) (results []*SeasonResult, err error) {
+	err = repository.results.each(func(raw []byte) error {
+		result := &SeasonResult {}
+		if err := bson.Unmarshal(raw, result); err != nil {
+			return err
+		}
+		if match(result) {
+			results = append(results, result)
+		}
+		return nil
+	})
+	return
+}
+
+func (repository *memorySeasonRepository) Save(context *util.Context, season *Season) error {
+	return repository.seasons.upsert(season.ID, season)
+}
+
+func (repository *memorySeasonRepository) GetById(context *util.Context, id bson.ObjectId) (season *Season, err error) {
+	season = &Season {}
+	if err = repository.seasons.get(id, season); err != nil {
+		season = nil
+	}
+	return
+}
+
+func (repository *memorySeasonRepository) GetAll(context *util.Context) (seasons []*Season, err error) {
+	err = repository.seasons.each(func(raw []byte) error {
+		season := &Season {}
+		if err := bson.Unmarshal(raw, season); err != nil {
+			return err
+		}
+		seasons = append(seasons, season)
+		return nil
+	})
+	sort.SliceStable(seasons, func(i, j int) bool {
+		return seasons[i].Number > seasons[j].Number
+	})
+	return
+}
+
+func (repository *memorySeasonRepository) InsertResult(context *util.Context, result *SeasonResult) error {
+	return repository.results.insert(result.ID, result)
+}
+
+func (repository *memorySeasonRepository) SaveResult(context *util.Context, result *SeasonResult) error {
+	return repository.results.upsert(result.ID, result)
+}
+
+func (repository *memorySeasonRepository) GetResult(context *util.Context, seasonId bson.ObjectId, playerId bson.ObjectId) (*SeasonResult, error) {
+	results, err := repository.findResults(func(result *SeasonResult) bool {
+		return result.SeasonID == seasonId && result.PlayerID == playerId
+	})
+	if err != nil {
+		return nil, err
+	}
+	if len(results) == 0 {
+		return nil, mgo.ErrNotFound
+	}
+	return results[0], nil
+}
+
+func (repository *memorySeasonRepository) GetResultsByPlayer(context *util.Context, playerId bson.ObjectId) (results []*SeasonResult, err error) {
+	results, err = repository.findResults(func(result *SeasonResult) bool {
+		return result.PlayerID == playerId
+	})
+	sort.SliceStable(results, func(i, j int) bool {
+		return results[i].SeasonNumber > results[j].SeasonNumber
+	})
+	return
+}
+
+func (repository *memorySeasonRepository) ClaimResult(context *util.Context, id bson.ObjectId) error {
+	repository.claims.Lock()
+	defer repository.claims.Unlock()
+
+	result := &SeasonResult {}
+	if err := repository.results.get(id, result); err != nil {
+		return err
+	}
+	if result.Claimed {
+		return mgo.ErrNotFound
+	}
+	return repository.results.update(id, bson.M { "cl": true })
+}
+
+func (repository *memorySeasonRepository) UnclaimResult(context *util.Context, id bson.ObjectId) error {
+	repository.claims.Lock()
+	defer repository.claims.Unlock()
+
+	result := &SeasonResult {}
+	if err := repository.results.get(id, result); err != nil {
+		return err
+	}
+	if !result.Claimed {
+		return mgo.ErrNotFound
+	}
+	return repository.results.update(id, bson.M { "cl": false })
+}
+
+// donations
+
+func (repository *memoryDonationRepository) findRequests(match func(request *CardRequest) bool) (requests []*CardRequest, err error) {
+	err = repository.requests.each(func(raw []byte) error {
+		request := &CardRequest {}
+		if err := bson.Unmarshal(raw, request); err != nil {
+			return err
+		}
+		if match(request) {
+			requests = append(requests, request)
+		}
+		return nil
+	})
+	sort.SliceStable(requests, func(i, j int) bool {
+		return requests[i].CreatedAt.After(requests[j].CreatedAt)
+	})
+	return
+}
+
+func (repository *memoryDonationRepository) findDonations(match func(donation *CardDonation) bool) (donations []*CardDonation, err error) {
+	err = repository.donations.each(func(raw []byte) error {
+		donation := &CardDonation {}
+		if err := bson.Unmarshal(raw, donation); err != nil {
+			return err
+		}
+		if match(donation) {
+			donations = append(donations, donation)
+		}
+		return nil
+	})
+	return
+}
+
+func (repository *memoryDonationRepository) InsertRequest(context *util.Context, request *CardRequest) error {
+	repository.updates.Lock()
+	defer repository.updates.Unlock()
+
+	// unique open marker
+	if request.OpenPlayerID.Valid() {
+		marked, err := repository.findRequests(func(stored *CardRequest) bool {
+			return stored.OpenPlayerID == request.OpenPlayerID
+		})
+		if err != nil {
+			return err
+		}
+		if len(marked) > 0 {
+			return &mgo.LastError { Code: 11000, Err: "duplicate key: " + request.OpenPlayerID.Hex() }
+		}
+	}
+	return repository.requests.insert(request.ID, request)
+}
+
+func (repository *memoryDonationRepository) GetRequestById(context *util.Context, id bson.ObjectId) (request *CardRequest, err error) {
+	request = &CardRequest {}
+	if err = repository.requests.get(id, request); err != nil {
+		request = nil
+	}
+	return
+}
+
+func (repository *memoryDonationRepository) GetOpenRequestsByGuild(context *util.Context, guildId bson.ObjectId, now time.Time) ([]*CardRequest, error) {
+	return repository.findRequests(func(request *CardRequest) bool {
+		return request.GuildID == guildId && request.IsOpen(now)
+	})
+}
+
+func (repository *memoryDonationRepository) CloseRequests(context *util.Context, playerId bson.ObjectId, now time.Time) error {
+	repository.updates.Lock()
+	defer repository.updates.Unlock()
+
+	closed, err := repository.findRequests(func(request *CardRequest) bool {
+		return request.OpenPlayerID == playerId && !request.IsOpen(now)
+	})
+	if err != nil {
+		return err
+	}
+	for _, request := range closed {
+		if err = repository.requests.update(request.ID, bson.M { "op": nil }); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (repository *memoryDonationRepository) GetLatestRequest(context *util.Context, playerId bson.ObjectId, rarity string) (*CardRequest, error) {
+	requests, err := repository.findRequests(func(request *CardRequest) bool {
+		return request.PlayerID == playerId && request.Rarity == rarity
+	})
+	if err != nil {
+		return nil, err
+	}
+	if len(requests) == 0 {
+		return nil, mgo.ErrNotFound
+	}
+	return requests[0], nil
+}
+
+func (repository *memoryDonationRepository) ReserveCopies(context *util.Context, donation *CardDonation, limit int, now time.Time) error {
+	repository.updates.Lock()
+	defer repository.updates.Unlock()
+
+	request := &CardRequest {}
+	if err := repository.requests.get(donation.RequestID, request); err != nil {
+		return err
+	}
+	if request.Remaining < donation.Count || !now.Before(request.ExpiresAt) || request.GetDonated(donation.DonorID) + donation.Count > limit {
+		return mgo.ErrNotFound
+	}
+	return repository.requests.update(donation.RequestID, bson.M {
+		"rm": request.Remaining - donation.Count,
+		"dn": request.withDonated(donation.DonorID, donation.Count),
+		"rs": append(request.Reservations, donation.ID),
+	})
+}
+
+func (repository *memoryDonationRepository) ReleaseCopies(context *util.Context, donation *CardDonation) error {
+	repository.updates.Lock()
+	defer repository.updates.Unlock()
+
+	request := &CardRequest {}
+	if err := repository.requests.get(donation.RequestID, request); err != nil {
+		return err
+	}
+	reservations := []bson.ObjectId {}
+	for _, id := range request.Reservations {
+		if id != donation.ID {
+			reservations = append(reservations, id)
+		}
+	}
+	if len(reservations) == len(request.Reservations) {
+		return mgo.ErrNotFound
+	}
+	return repository.requests.update(donation.RequestID, bson.M {
+		"rm": request.Remaining + donation.Count,
+		"dn": request.withDonated(donation.DonorID, -donation.Count),
+		"rs": reservations,
+	})
+}
+
+func (repository *memoryDonationRepository) InsertDonation(context *util.Context, donation *CardDonation) error {
+	return repository.donations.insert(donation.ID, donation)
+}
+
+func (repository *memoryDonationRepository) SetDonationState(context *util.Context, id bson.ObjectId, from CardDonationState, to CardDonationState) error {
+	repository.updates.Lock()
+	defer repository.updates.Unlock()
+
+	donation := &CardDonation {}
+	if err := repository.donations.get(id, donation); err != nil {
+		return err
+	}
+	if donation.State != from {
+		return mgo.ErrNotFound
+	}
+	return repository.donations.update(id, bson.M { "st": to, "t1": time.Now() })
+}
+
+func (repository *memoryDonationRepository) GetDonationsByRecipient(context *util.Context, recipientId bson.ObjectId, state CardDonationState) ([]*CardDonation, error) {
+	return repository.findDonations(func(donation *CardDonation) bool {
+		return donation.RecipientID == recipientId && donation.State == state
+	})
+}
+
+func (repository *memoryDonationRepository) GetStalePendingDonations(context *util.Context, before time.Time) ([]*CardDonation, error) {
+	return repository.findDonations(func(donation *CardDonation) bool {
+		return donation.State == CardDonationPending && donation.UpdatedAt.Before(before)
+	})
+}
+
+// guild wars
+
+func (repository *memoryWarRepository) find(match func(war *GuildWar) bool) (wars []*GuildWar, err error) {
+	err = repository.documents.each(func(raw []byte) error {
+		war := &GuildWar {}
+		if err := bson.Unmarshal(raw, war); err != nil {
+			return err
+		}
+		if match(war) {
+			wars = append(wars, war)
+		}
+		return nil
+	})
+	sort.SliceStable(wars, func(i, j int) bool {
+		return wars[i].StartTime.After(wars[j].StartTime)
+	})
+	return
+}
+
+func (repository *memoryWarRepository) Insert(context *util.Context, war *GuildWar) error {
+	return repository.documents.insert(war.ID, war)
+}
+
+func (repository *memoryWarRepository) GetById(context *util.Context, id bson.ObjectId) (war *GuildWar, err error) {
+	war = &GuildWar {}
+	if err = repository.documents.get(id, war); err != nil {
+		war = nil
+	}
+	return
+}
+
+func (repository *memoryWarRepository) GetOpen(context *util.Context) ([]*GuildWar, error) {
+	return repository.find(func(war *GuildWar) bool {
+		return !war.Completed
+	})
+}
+
+func (repository *memoryWarRepository) GetCompleted(context *util.Context, limit int) ([]*GuildWar, error) {
+	wars, err := repository.find(func(war *GuildWar) bool {
+		return war.Completed
+	})
+	if limit > 0 && len(wars) > limit {
+		wars = wars[:limit]
+	}
+	return wars, err
+}
+
+func (repository *memoryWarRepository) GetLatestByGuild(context *util.Context, guildId bson.ObjectId) (*GuildWar, error) {
+	wars, err := repository.find(func(war *GuildWar) bool {
+		return war.GetSide(guildId) >= 0
+	})
+	if err != nil {
+		return nil, err
+	}
+	if len(wars) == 0 {
+		return nil, mgo.ErrNotFound
+	}
+	return wars[0], nil
+}
+
+func (repository *memoryWarRepository) AddBattle(context *util.Context, id bson.ObjectId, guildId bson.ObjectId, score int, wins int, playerId bson.ObjectId, opponentId bson.ObjectId, maxBattles int, maxOpponentBattles int) error {
+	repository.updates.Lock()
+	defer repository.updates.Unlock()
+
+	war := &GuildWar {}
+	if err := repository.documents.get(id, war); err != nil {
+		return err
+	}
+	index := war.GetSide(guildId)
+	if war.Completed || index < 0 {
+		return mgo.ErrNotFound
+	}
+
+	side := &war.Sides[index]
+	opponentKey := warOpponentKey(playerId, opponentId)
+	if (maxBattles > 0 && side.Battles[playerId.Hex()] >= maxBattles) || (maxOpponentBattles > 0 && side.OpponentBattles[opponentKey] >= maxOpponentBattles) {
+		return mgo.ErrNotFound
+	}
+
+	side.Score += score
+	side.WinCount += wins
+	side.BattleCount += 1
+	if side.Battles == nil {
+		side.Battles = map[string]int {}
+	}
+	side.Battles[playerId.Hex()] += 1
+	if side.OpponentBattles == nil {
+		side.OpponentBattles = map[string]int {}
+	}
+	side.OpponentBattles[opponentKey] += 1
+	if war.GetParticipantSide(playerId) != index {
+		side.Participants = append(side.Participants, playerId)
+	}
+	return repository.documents.update(id, bson.M { "sd": war.Sides })
+}
+
+func (repository *memoryWarRepository) Complete(context *util.Context, id bson.ObjectId, winner int, now time.Time) error {
+	repository.updates.Lock()
+	defer repository.updates.Unlock()
+
+	war := &GuildWar {}
+	if err := repository.documents.get(id, war); err != nil {
+		return err
+	}
+	if war.Completed {
+		return mgo.ErrNotFound
+	}
+	return repository.documents.update(id, bson.M { "cp": true, "wn": winner, "tc": now })
+}
+
+func (repository *memoryWarRepository) ClaimReward(context *util.Context, id bson.ObjectId, playerId bson.ObjectId) error {
+	repository.updates.Lock()
+	defer repository.updates.Unlock()
+
+	war := &GuildWar {}
+	if err := repository.documents.get(id, war); err != nil {
+		return err
+	}
+	index := war.GetParticipantSide(playerId)
+	if !war.Completed || index < 0 || war.IsClaimed(index, playerId) {
+		return mgo.ErrNotFound
+	}
+
+	side := &war.Sides[index]
+	side.Claimed = append(side.Claimed, playerId)
+	return repository.documents.update(id, bson.M { "sd": war.Sides })
+}
+
+func (repository *memoryWarRepository) UnclaimReward(context *util.Context, id bson.ObjectId, playerId bson.ObjectId) error {
+	repository.updates.Lock()
+	defer repository.updates.Unlock()
+
+	war := &GuildWar {}
+	if err := repository.documents.get(id, war); err != nil {
+		return err
+	}
+	index := war.GetParticipantSide(playerId)
+	if index < 0 || !war.IsClaimed(index, playerId) {
+		return mgo.ErrNotFound
+	}
+
+	side := &war.Sides[index]
+	claimed := []bson.ObjectId {}
+	for _, claimedId := range side.Claimed {
+		if claimedId != playerId {
+			claimed = append(claimed, claimedId)
+		}
+	}
+	side.Claimed = claimed
+	return repository.documents.update(id, bson.M { "sd": war.Sides })
+}
+
+// sanctions
+
+func (repository *memorySanctionRepository) find(match func(sanction *Sanction) bool) (sanctions []*Sanction, err error) {
+	err = repository.documents.each(func(raw []byte) error {
+		sanction := &Sanction {}
+		if err := bson.Unmarshal(raw, sanction); err != nil {
+			return err
+		}
+		if match(sanction) {
+			sanctions = append(sanctions, sanction)
+		}
+		return nil
+	})
+
+	// newest first
+	sort.SliceStable(sanctions, func(i, j int) bool {
+		return sanctions[i].CreatedTime.After(sanctions[j].CreatedTime)
+	})
+	return
+}
+
+func (repository *memorySanctionRepository) Insert(context *util.Context, sanction *Sanction) error {
+	return repository.documents.insert(sanction.ID, sanction)
+}
+
+func (repository *memorySanctionRepository) Save(context *util.Context, sanction *Sanction) error {
+	return repository.documents.upsert(sanction.ID, sanction)
+}
+
+func (repository *memorySanctionRepository) GetById(context *util.Context, id bson.ObjectId) (sanction *Sanction, err error) {
+	sanction = &Sanction {}
+	if err = repository.documents.get(id, sanction); err != nil {
+		sanction = nil
+	}
+	return
+}
+
+func (repository *memorySanctionRepository) GetByUser(context *util.Context, userId bson.ObjectId) ([]*Sanction, error) {
+	return repository.find(func(sanction *Sanction) bool {
+		return sanction.UserID == userId
+	})
+}
+
+func (repository *memorySanctionRepository) GetActive(context *util.Context, userId bson.ObjectId, sanctionType SanctionType, now time.Time) ([]*Sanction, error) {
+	return repository.find(func(sanction *Sanction) bool {
+		return sanction.UserID == userId && sanction.Type == sanctionType && sanction.IsActiveAt(now)
+	})
+}
+
+// audits
+
+func (repository *memoryAuditRepository) Insert(context *util.Context, audit *Audit) error {
+	return repository.documents.insert(audit.ID, audit)
+}
+
+func (repository *memoryAuditRepository) GetById(context *util.Context, id bson.ObjectId) (audit *Audit, err error) {
+	audit = &Audit {}
+	if err = repository.documents.get(id, audit); err != nil {
+		audit = nil
+	}
+	return
+}
+
+// friends
+
+func (repository *memoryFriendsRepository) Save(context *util.Context, friends *Friends) error {
+	return repository.documents.upsert(friends.ID, friends)
+}
+
+func (repository *memoryFriendsRepository) GetByPlayer(context *util.Context, playerId bson.ObjectId) (friends *Friends, err error) {
+	err = repository.documents.each(func(raw []byte) error {
+		found := &Friends {}
+		if err := bson.Unmarshal(raw, found); err != nil {
+			return err
+		}
+		if friends == nil && found.PlayerID == playerId {
+			friends = found
+		}
+		return nil
+	})
+	if err == nil && friends == nil {
+		err = mgo.ErrNotFound
+	}
+	return
+}
+
+// trackings
+
+func (repository *memoryTrackingRepository) Insert(context *util.Context, tracking *Tracking) error {
+	return repository.documents.insert(tracking.ID, tracking)
+}
+
+func (repository *memoryTrackingRepository) Delete(context *util.Context, id bson.ObjectId) error {
+	return repository.documents.remove(id)
+}
+
+func (repository *memoryTrackingRepository) GetById(context *util.Context, id bson.ObjectId) (tracking *Tracking, err error) {
+	tracking = &Tracking {}
+	if err = repository.documents.get(id, tracking); err != nil {
+		tracking = nil
+	}
+	return
+}
+
+func (repository *memoryTrackingRepository) GetByUser(context *util.Context, userId bson.ObjectId) (trackings []Tracking, err error) {
+	err = repository.documents.each(func(raw []byte) error {
+		tracking := Tracking {}
+		if err := bson.Unmarshal(raw, &tracking); err != nil {
+			return err
+		}
+		if tracking.UserID == userId {
+			trackings = append(trackings, tracking)
+		}
+		return nil
+	})
+
+	// oldest first
+	sort.SliceStable(trackings, func(i, j int) bool {
+		return trackings[i].CreatedTime.Before(trackings[j].CreatedTime)
+	})
+	return
+}
+
+// socket messages
+
+func (repository *memorySocketRepository) Insert(context *util.Context, socketModel *SocketModel) error {
+	// drop expired messages, as the mongo expiry index does
+	now := time.Now()
+	var expired []bson.ObjectId
+	repository.documents.each(func(raw []byte) error {
+		existing := &SocketModel {}
+		if err := bson.Unmarshal(raw, existing); err == nil && !now.Before(existing.ExpiresAt) {
+			expired = append(expired, existing.ID)
+		}
+		return nil
+	})
+	for _, id := range expired {
+		repository.documents.remove(id)
+	}
+
+	return repository.documents.insert(socketModel.ID, socketModel)
+}
+
+func (repository *memorySocketRepository) GetSince(context *util.Context, userId bson.ObjectId, since time.Time) (socketModels []*SocketModel, err error) {
+	err = repository.documents.each(func(raw []byte) error {
+		socketModel := &SocketModel {}
+		if err := bson.Unmarshal(raw, socketModel); err != nil {
+			return err
+		}
+		if (socketModel.UserID == userId || socketModel.UserID == "") && socketModel.CreatedAt.After(since) {
+			socketModels = append(socketModels, socketModel)
+		}
+		return nil
+	})
+
+	// oldest first
+	sort.SliceStable(socketModels, func(i, j int) bool {
+		return socketModels[i].CreatedAt.Before(socketModels[j].CreatedAt)
+	})
+	return
+}
@@ -0,0 +1,25 @@
+package models
+
+import (
+	"bloodtales/util"
+)
+
+// business and matchmaking metrics
+var (
+	MetricPurchases         *util.Metric = util.NewCounter("purchases_total", "Store purchases by currency and category.", "currency", "category")
+	MetricTomesOpened       *util.Metric = util.NewCounter("tomes_opened_total", "Tomes opened by tome.", "tome")
+	MetricMatchesCompleted  *util.Metric = util.NewCounter("matches_completed_total", "Matches completed by match type.", "type")
+	MetricMatchmakingWait   *util.Metric = util.NewHistogram("matchmaking_wait_seconds", "Time spent searching before a match was found.", []float64 { 1, 2, 5, 10, 15, 20, 30, 45, 60, 90, 120 }, "type")
+	MetricMatchmakingQueue  *util.Metric = util.NewGauge("matchmaking_queue_size", "Players with an active matchmaking ticket.")
+)
+
+func init() {
+	util.AddMetricCollector(collectMatchmakingMetrics)
+}
+
+func collectMatchmakingMetrics() {
+	cache := util.GetCacheConnection()
+	defer cache.Close()
+
+	MetricMatchmakingQueue.Set(float64(cache.GetScoreCount("MMR")))
+}
@@ -0,0 +1,63 @@
+package models
+
+import (
+	"testing"
+	"net/http/httptest"
+
+	"bloodtales/util"
+)
+
+// request context on emptied memory storage
+func newTestContext() *util.Context {
+	ResetMemoryStorage()
+
+	request := httptest.NewRequest("POST", "/", nil)
+	return util.CreateContext(httptest.NewRecorder(), request)
+}
+
+// saved user and player created from the default player template
+func newTestPlayer(t *testing.T, context *util.Context) *Player {
+	user, err := InsertUserWithDevice(context, util.GenerateUUID(), nil)
+	if err != nil {
+		t.Fatalf("Failed to insert user: %v", err)
+	}
+
+	player, err := CreatePlayer(user.ID, false)
+	if err != nil {
+		t.Fatalf("Failed to create player: %v", err)
+	}
+	if err = player.Save(context); err != nil {
+		t.Fatalf("Failed to save player: %v", err)
+	}
+	return player
+}
+
+// player as currently stored
+func reloadTestPlayer(t *testing.T, context *util.Context, player *Player) *Player {
+	stored, err := GetPlayerById(context, player.ID)
+	if err != nil {
+		t.Fatalf("Failed to get player %s: %v", player.ID.Hex(), err)
+	}
+	return stored
+}
+
+func countRewardCards(reward *Reward) (count int) {
+	for _, num := range reward.NumRewarded {
+		count += num
+	}
+	return
+}
+
+// saved guild owned by the first player, with the others as members
+func newTestGuild(t *testing.T, context *util.Context, owner *Player, members ...*Player) *Guild {
+	guild, err := CreateGuild(context, owner, "Test Guild", "", "", false)
+	if err != nil {
+		t.Fatalf("Failed to create guild: %v", err)
+	}
+	for _, member := range members {
+		if err = AddMember(context, member, guild); err != nil {
+			t.Fatalf("Failed to add guild member: %v", err)
+		}
+	}
+	return guild
+}
@@ -0,0 +1,824 @@
+package models
+
+import (
+	"time"
+	"io/ioutil"
+
+	"gopkg.in/mgo.v2"
+	"gopkg.in/mgo.v2/bson"
+
+	"bloodtales/data"
+	"bloodtales/util"
+)
+
+// MongoDB repositories, using the context database session
+type mongoUserRepository struct {}
+type mongoPlayerRepository struct {}
+type mongoMatchRepository struct {}
+type mongoGuildRepository struct {}
+type mongoNotificationRepository struct {}
+type mongoReplayRepository struct {}
+type mongoSeasonRepository struct {}
+type mongoDonationRepository struct {}
+type mongoWarRepository struct {}
+type mongoSanctionRepository struct {}
+type mongoAuditRepository struct {}
+type mongoFriendsRepository struct {}
+type mongoTrackingRepository struct {}
+type mongoSocketRepository struct {}
+
+// users
+
+func (repository mongoUserRepository) Insert(context *util.Context, user *User) error {
+	return context.DB().C(UserCollectionName).Insert(user)
+}
+
+func (repository mongoUserRepository) Save(context *util.Context, user *User) (err error) {
+	_, err = context.DB().C(UserCollectionName).Upsert(bson.M { "_id": user.ID }, user)
+	return
+}
+
+func (repository mongoUserRepository) Delete(context *util.Context, id bson.ObjectId) error {
+	return context.DB().C(UserCollectionName).Remove(bson.M { "_id": id })
+}
+
+func (repository mongoUserRepository) GetById(context *util.Context, id bson.ObjectId) (user *User, err error) {
+	err = context.DB().C(UserCollectionName).Find(bson.M { "_id": id } ).One(&user)
+	return
+}
+
+func (repository mongoUserRepository) GetByDevice(context *util.Context, uuid string) (user *User, err error) {
+	err = context.DB().C(UserCollectionName).Find(bson.M { "dvs.id": uuid } ).One(&user)
+	return
+}
+
+func (repository mongoUserRepository) GetByCredentials(context *util.Context, credentials []Credential) (user *User, err error) {
+	// convert credentials into bson.M
+	var query []bson.M = make([]bson.M, len(credentials), len(credentials))
+	for i, credential := range credentials {
+		query[i] = bson.M {
+			"cds.pv": credential.Provider,
+			"cds.id": credential.ID,
+		}
+	}
+
+	err = context.DB().C(UserCollectionName).Find(bson.M { "$or": query }).One(&user)
+	return
+}
+
+func (repository mongoUserRepository) GetByTag(context *util.Context, tag string) (user *User, err error) {
+	err = context.DB().C(UserCollectionName).Find(bson.M { "tag": tag } ).One(&user)
+	return
+}
+
+func (repository mongoUserRepository) GetByUsername(context *util.Context, username string) (*User, error) {
+	return GetUserByUsernameAndDatabase(context.DB(), username)
+}
+
+func (repository mongoUserRepository) GetByIds(context *util.Context, ids []bson.ObjectId) (users []*User, err error) {
+	err = context.DB().C(UserCollectionName).Find(bson.M { "_id": bson.M { "$in": ids } }).All(&users)
+	return
+}
+
+func (repository mongoUserRepository) GetAdmins(context *util.Context) (users []*User, err error) {
+	err = context.DB().C(UserCollectionName).Find(bson.M { "$or": []bson.M {
+		bson.M { "ad": true },
+		bson.M { "rl": bson.M { "$exists": true } },
+	} }).Sort("un").All(&users)
+	return
+}
+
+// players
+
+func (repository mongoPlayerRepository) Save(context *util.Context, player *Player) (err error) {
+	_, err = context.DB().C(PlayerCollectionName).Upsert(bson.M{"_id": player.ID}, player)
+	return
+}
+
+func (repository mongoPlayerRepository) Update(context *util.Context, id bson.ObjectId, updates bson.M) error {
+	return context.DB().C(PlayerCollectionName).Update(bson.M{"_id": id}, bson.M{"$set": updates})
+}
+
+func (repository mongoPlayerRepository) UpdateCardCount(context *util.Context, id bson.ObjectId, cardId data.DataId, count int, increments bson.M) error {
+	inc := bson.M { "cd.$.nm": count }
+	for field, value := range increments {
+		inc[field] = value
+	}
+	return context.DB().C(PlayerCollectionName).Update(bson.M {
+		"_id": id,
+		"cd": bson.M { "$elemMatch": bson.M { "id": cardId, "nm": bson.M { "$gte": -count } } },
+	}, bson.M { "$inc": inc })
+}
+
+func (repository mongoPlayerRepository) DebitDonation(context *util.Context, donation *CardDonation, increments bson.M) error {
+	inc := bson.M { "cd.$.nm": -donation.Count }
+	for field, value := range increments {
+		inc[field] = value
+	}
+	return context.DB().C(PlayerCollectionName).Update(bson.M {
+		"_id": donation.DonorID,
+		"cd": bson.M { "$elemMatch": bson.M { "id": donation.CardID, "nm": bson.M { "$gte": donation.Count } } },
+	}, bson.M {
+		"$inc": inc,
+		"$push": bson.M { "dl": bson.M { "$each": []bson.ObjectId { donation.ID }, "$slice": -maxDebitedDonations } },
+	})
+}
+
+func (repository mongoPlayerRepository) Delete(context *util.Context, id bson.ObjectId) error {
+	return context.DB().C(PlayerCollectionName).Remove(bson.M{"_id": id})
+}
+
+func (repository mongoPlayerRepository) GetById(context *util.Context, id bson.ObjectId) (player *Player, err error) {
+	err = context.DB().C(PlayerCollectionName).Find(bson.M{"_id": id}).One(&player)
+	return
+}
+
+func (repository mongoPlayerRepository) GetByUser(context *util.Context, userId bson.ObjectId) (player *Player, err error) {
+	err = context.DB().C(PlayerCollectionName).Find(bson.M{"us": userId}).One(&player)
+	return
+}
+
+func (repository mongoPlayerRepository) GetByIds(context *util.Context, ids []bson.ObjectId) (players []*Player, err error) {
+	err = context.DB().C(PlayerCollectionName).Find(bson.M{"_id": bson.M{"$in": ids}}).All(&players)
+	return
+}
+
+func (repository mongoPlayerRepository) GetByGuild(context *util.Context, guildId bson.ObjectId) (players []*Player, err error) {
+	err = context.DB().C(PlayerCollectionName).Find(bson.M{"gd": guildId}).All(&players)
+	return
+}
+
+func (repository mongoPlayerRepository) GetAll(context *util.Context) (players []*Player, err error) {
+	err = context.DB().C(PlayerCollectionName).Find(nil).All(&players)
+	return
+}
+
+func (repository mongoPlayerRepository) GetAfter(context *util.Context, afterId bson.ObjectId, limit int) (players []*Player, err error) {
+	query := bson.M {}
+	if afterId.Valid() {
+		query["_id"] = bson.M { "$gt": afterId }
+	}
+
+	err = context.DB().C(PlayerCollectionName).Find(query).Sort("_id").Limit(limit).All(&players)
+	return
+}
+
+func (repository mongoPlayerRepository) Stream(context *util.Context, fields []string, batchSize int, visit func(players []*Player) error) (err error) {
+	query := context.DB().C(PlayerCollectionName).Find(nil)
+	if fields != nil {
+		selector := bson.M {}
+		for _, field := range fields {
+			selector[field] = 1
+		}
+		query = query.Select(selector)
+	}
+
+	iter := query.Batch(batchSize).Iter()
+	players := make([]*Player, 0, batchSize)
+	for {
+		player := &Player {}
+		if !iter.Next(player) {
+			break
+		}
+
+		players = append(players, player)
+		if len(players) == batchSize {
+			if err = visit(players); err != nil {
+				iter.Close()
+				return
+			}
+			players = make([]*Player, 0, batchSize)
+		}
+	}
+	if err = iter.Close(); err != nil {
+		return
+	}
+
+	if len(players) > 0 {
+		err = visit(players)
+	}
+	return
+}
+
+func (repository mongoPlayerRepository) Count(context *util.Context) (int, error) {
+	return context.DB().C(PlayerCollectionName).Count()
+}
+
+// matches
+
+func (repository mongoMatchRepository) Save(context *util.Context, match *Match) (err error) {
+	_, err = context.DB().C(MatchCollectionName).Upsert(bson.M { "_id": match.ID }, match)
+	return
+}
+
+func (repository mongoMatchRepository) Delete(context *util.Context, id bson.ObjectId) error {
+	return context.DB().C(MatchCollectionName).Remove(bson.M { "_id": id })
+}
+
+func (repository mongoMatchRepository) GetById(context *util.Context, id bson.ObjectId) (match *Match, err error) {
+	err = context.DB().C(MatchCollectionName).Find(bson.M { "_id": id } ).One(&match)
+	return
+}
+
+func (repository mongoMatchRepository) GetByRoom(context *util.Context, roomID string) (match *Match, err error) {
+	err = context.DB().C(MatchCollectionName).Find(bson.M { "rm": roomID }).One(&match)
+	return
+}
+
+func (repository mongoMatchRepository) GetHistory(context *util.Context, playerID bson.ObjectId, cursor *util.Cursor, limit int) (matches []*Match, err error) {
+	query := bson.M {
+		"$or": []bson.M {
+			bson.M { "id1": playerID, },
+			bson.M { "id2": playerID, },
+		},
+		"st": MatchComplete,
+	}
+	if cursor != nil {
+		query["_id"] = bson.M { "$lt": cursor.ID }
+	}
+
+	err = context.DB().C(MatchCollectionName).Find(query).Sort("-_id").Limit(limit).All(&matches)
+	return
+}
+
+func (repository mongoMatchRepository) GetByPlayer(context *util.Context, playerID bson.ObjectId, states ...MatchState) (matches []*Match, err error) {
+	err = context.DB().C(MatchCollectionName).Find(bson.M {
+		"$or": []bson.M {
+			bson.M { "id1": playerID, },
+			bson.M { "id2": playerID, },
+		},
+		"st": bson.M {
+			"$in": states,
+		},
+	}).All(&matches)
+	return
+}
+
+func (repository mongoMatchRepository) RemoveByPlayers(context *util.Context, playerIDs []bson.ObjectId, states ...MatchState) (err error) {
+	_, err = context.DB().C(MatchCollectionName).RemoveAll(bson.M {
+		"$or": []bson.M {
+			bson.M { "id1": bson.M { "$in": playerIDs }, },
+			bson.M { "id2": bson.M { "$in": playerIDs }, },
+		},
+		"st": bson.M {
+			"$in": states,
+		},
+	})
+	return
+}
+
+// guilds
+
+func (repository mongoGuildRepository) Save(context *util.Context, guild *Guild) (err error) {
+	_, err = context.DB().C(GuildCollectionName).Upsert(bson.M{"_id": guild.ID}, guild)
+	return
+}
+
+func (repository mongoGuildRepository) Delete(context *util.Context, id bson.ObjectId) error {
+	return context.DB().C(GuildCollectionName).Remove(bson.M{"_id": id})
+}
+
+func (repository mongoGuildRepository) GetById(context *util.Context, id bson.ObjectId) (guild *Guild, err error) {
+	err = context.DB().C(GuildCollectionName).Find(bson.M{"_id": id}).One(&guild)
+	return
+}
+
+func (repository mongoGuildRepository) GetByTag(context *util.Context, tag string) (guild *Guild, err error) {
+	err = context.DB().C(GuildCollectionName).Find(bson.M{"tg": tag}).One(&guild)
+	return
+}
+
+func (repository mongoGuildRepository) GetByOwner(context *util.Context, ownerId bson.ObjectId) (guild *Guild, err error) {
+	err = context.DB().C(GuildCollectionName).Find(bson.M{"ow": ownerId}).One(&guild)
+	return
+}
+
+func (repository mongoGuildRepository) GetByIds(context *util.Context, ids []bson.ObjectId) (guilds []*Guild, err error) {
+	err = context.DB().C(GuildCollectionName).Find(bson.M{"_id": bson.M{"$in": ids}}).All(&guilds)
+	return
+}
+
+func (repository mongoGuildRepository) GetAll(context *util.Context) (guilds []*Guild, err error) {
+	err = context.DB().C(GuildCollectionName).Find(nil).All(&guilds)
+	return
+}
+
+func (repository mongoGuildRepository) FindByName(context *util.Context, pattern string) (guilds []*Guild, err error) {
+	err = context.DB().C(GuildCollectionName).Find(bson.M{
+		"nm": bson.M{
+			"$regex": bson.RegEx{
+				Pattern: pattern,
+				Options: "i",
+			},
+		},
+	}).All(&guilds)
+	return
+}
+
+func (repository mongoGuildRepository) AddProgress(context *util.Context, id bson.ObjectId, progress GuildProgress) (guild *Guild, err error) {
+	c := context.DB().C(GuildCollectionName)
+	_, err = c.Find(bson.M{"_id": id}).Apply(mgo.Change{
+		Update: bson.M{"$inc": bson.M{
+			"xp": progress.XP,
+			"rt": progress.Rating,
+			"wc": progress.WinCount,
+			"lc": progress.LossCount,
+			"mc": progress.MatchCount,
+		}},
+		ReturnNew: true,
+	}, &guild)
+	if err != nil || guild.Rating >= 0 {
+		return
+	}
+
+	// losses do not take the rating below 0
+	err = c.Update(bson.M{"_id": id, "rt": bson.M{"$lt": 0}}, bson.M{"$set": bson.M{"rt": 0}})
+	if err == mgo.ErrNotFound {
+		err = nil
+	}
+	guild.Rating = 0
+	return
+}
+
+// notifications
+
+func (repository mongoNotificationRepository) Save(context *util.Context, notification *Notification) (err error) {
+	_, err = context.DB().C(NotificationCollectionName).Upsert(bson.M{"_id": notification.ID}, notification)
+	return
+}
+
+func (repository mongoNotificationRepository) Delete(context *util.Context, id bson.ObjectId) error {
+	return context.DB().C(NotificationCollectionName).Remove(bson.M{"_id": id})
+}
+
+func (repository mongoNotificationRepository) GetById(context *util.Context, id bson.ObjectId) (notification *Notification, err error) {
+	err = context.DB().C(NotificationCollectionName).Find(bson.M{"_id": id}).One(&notification)
+	return
+}
+
+func (repository mongoNotificationRepository) GetBySender(context *util.Context, senderId bson.ObjectId) (notifications []*Notification, err error) {
+	err = context.DB().C(NotificationCollectionName).Find(bson.M{"sid": senderId}).Sort("t0").All(&notifications)
+	return
+}
+
+func (repository mongoNotificationRepository) GetByReceiver(context *util.Context, playerId bson.ObjectId, guildId bson.ObjectId, types []string) (notifications []*Notification, err error) {
+	// player specific conditions
+	conditions := []bson.M{
+		bson.M{"gd": false, "rid": playerId},
+		bson.M{"gd": false, "rid": bson.M{"$exists": false}},
+	}
+	// if guild ID exists, add to conditions
+	if guildId.Valid() {
+		conditions = append(conditions, bson.M{"gd": true, "rid": guildId})
+	}
+	query := bson.M{"$or": conditions}
+
+	// type conditions
+	if len(types) > 0 {
+		query = bson.M{"$and": []bson.M{query, bson.M{"tp": bson.M{"$in": types}}}}
+	}
+
+	err = context.DB().C(NotificationCollectionName).Find(query).Sort("t0").All(&notifications)
+	return
+}
+
+func (repository mongoNotificationRepository) RemoveViewed(context *util.Context, ids []bson.ObjectId) (err error) {
+	_, err = context.DB().C(NotificationCollectionName).RemoveAll(bson.M{
+		"_id": bson.M{
+			"$in": ids,
+		},
+		"ac": bson.M{
+			"$size": 0,
+		},
+	})
+	return
+}
+
+func (repository mongoNotificationRepository) UpdateData(context *util.Context, id bson.ObjectId, key string, expected interface{}, value interface{}) error {
+	return context.DB().C(NotificationCollectionName).Update(bson.M { "_id": id, "dt." + key: expected }, bson.M { "$set": bson.M { "dt." + key: value } })
+}
+
+// replays
+
+func (repository mongoReplayRepository) InsertInfo(context *util.Context, replayInfo *ReplayInfo) error {
+	return context.DB().C(ReplayInfoCollectionName).Insert(replayInfo)
+}
+
+func (repository mongoReplayRepository) InsertData(context *util.Context, replayData *ReplayData) error {
+	return context.DB().C(ReplayDataCollectionName).Insert(replayData)
+}
+
+func (repository mongoReplayRepository) UpdateInfo(context *util.Context, replayInfo *ReplayInfo) error {
+	return context.DB().C(ReplayInfoCollectionName).UpdateId(replayInfo.ID, replayInfo)
+}
+
+func (repository mongoReplayRepository) UpdateData(context *util.Context, replayData *ReplayData) error {
+	return context.DB().C(ReplayDataCollectionName).UpdateId(replayData.ID, replayData)
+}
+
+func (repository mongoReplayRepository) InsertFile(context *util.Context, id bson.ObjectId, data []byte) (err error) {
+	file, err := context.DB().GridFS(ReplayFilePrefix).Create(id.Hex())
+	if err != nil {
+		return
+	}
+	file.SetId(id)
+
+	if _, err = file.Write(data); err != nil {
+		file.Abort()
+		file.Close()
+		return
+	}
+	return file.Close()
+}
+
+func (repository mongoReplayRepository) GetFile(context *util.Context, id bson.ObjectId) (data []byte, err error) {
+	file, err := context.DB().GridFS(ReplayFilePrefix).OpenId(id)
+	if err != nil {
+		return
+	}
+	defer file.Close()
+
+	return ioutil.ReadAll(file)
+}
+
+func (repository mongoReplayRepository) Delete(context *util.Context, infoId bson.ObjectId) (err error) {
+	// delete replay file, data and shares, then info
+	var replayData *ReplayData
+	err = context.DB().C(ReplayDataCollectionName).Find(bson.M { "iid": infoId }).One(&replayData)
+	if err == nil {
+		if replayData.FileID.Valid() {
+			err = context.DB().GridFS(ReplayFilePrefix).RemoveId(replayData.FileID)
+			if err != nil && err != mgo.ErrNotFound {
+				return
+			}
+		}
+		err = context.DB().C(ReplayDataCollectionName).RemoveId(replayData.ID)
+	}
+	if err == mgo.ErrNotFound {
+		err = nil
+	}
+	if err != nil {
+		return
+	}
+
+	_, err = context.DB().C(ReplayShareCollectionName).RemoveAll(bson.M { "iid": infoId })
+	if err != nil {
+		return
+	}
+
+	return context.DB().C(ReplayInfoCollectionName).Remove(bson.M{"_id": infoId})
+}
+
+func (repository mongoReplayRepository) GetInfoById(context *util.Context, infoId bson.ObjectId) (replayInfo *ReplayInfo, err error) {
+	err = context.DB().C(ReplayInfoCollectionName).Find(bson.M { "_id": infoId }).One(&replayInfo)
+	return
+}
+
+func (repository mongoReplayRepository) GetDataByInfo(context *util.Context, infoId bson.ObjectId) (replayData *ReplayData, err error) {
+	err = context.DB().C(ReplayDataCollectionName).Find(bson.M { "iid": infoId }).One(&replayData)
+	return
+}
+
+func (repository mongoReplayRepository) GetInfosByUser(context *util.Context, userId bson.ObjectId, limit int) (replayInfos []*ReplayInfo, err error) {
+	err = context.DB().C(ReplayInfoCollectionName).Find(bson.M { "us": userId }).Sort("-t0").Limit(limit).All(&replayInfos)
+	return
+}
+
+func (repository mongoReplayRepository) GetInfosByMatches(context *util.Context, matchIds []bson.ObjectId) (replayInfos []*ReplayInfo, err error) {
+	err = context.DB().C(ReplayInfoCollectionName).Find(bson.M { "mid": bson.M { "$in": matchIds } }).All(&replayInfos)
+	return
+}
+
+func (repository mongoReplayRepository) GetTopInfos(context *util.Context, limit int) (replayInfos []*ReplayInfo, err error) {
+	err = context.DB().C(ReplayInfoCollectionName).Find(nil).Sort("-rk").Limit(limit).All(&replayInfos)
+	return
+}
+
+func (repository mongoReplayRepository) GetExpiredInfos(context *util.Context, before time.Time, keepIds []bson.ObjectId, limit int) (replayInfos []*ReplayInfo, err error) {
+	query := bson.M { "t0": bson.M { "$lt": before } }
+	if len(keepIds) > 0 {
+		query["_id"] = bson.M { "$nin": keepIds }
+	}
+
+	err = context.DB().C(ReplayInfoCollectionName).Find(query).Sort("t0").Limit(limit).All(&replayInfos)
+	return
+}
+
+func (repository mongoReplayRepository) GetLegacyDatas(context *util.Context, limit int) (replayDatas []*ReplayData, err error) {
+	err = context.DB().C(ReplayDataCollectionName).Find(bson.M { "dt": bson.M { "$exists": true } }).Limit(limit).All(&replayDatas)
+	return
+}
+
+func (repository mongoReplayRepository) Search(context *util.Context, filter *ReplayFilter, cursor *util.Cursor, limit int) (replayInfos []*ReplayInfo, err error) {
+	query := bson.M {}
+	if filter.UserID.Valid() {
+		query["us"] = filter.UserID
+	}
+	if filter.PlayerID.Valid() {
+		query["pl.pid"] = filter.PlayerID
+	}
+	if len(filter.Leagues) > 0 {
+		query["lg"] = bson.M { "$in": filter.Leagues }
+	}
+	if filter.CardID != 0 {
+		query["cds"] = filter.CardID
+	}
+	if filter.Arena != "" {
+		query["ar"] = filter.Arena
+	}
+	if cursor != nil {
+		query["$and"] = []bson.M { cursor.Query("rk") }
+	}
+
+	err = context.DB().C(ReplayInfoCollectionName).Find(query).Sort("-rk", "-_id").Limit(limit).All(&replayInfos)
+	return
+}
+
+func (repository mongoReplayRepository) InsertShare(context *util.Context, replayShare *ReplayShare) error {
+	return context.DB().C(ReplayShareCollectionName).Insert(replayShare)
+}
+
+func (repository mongoReplayRepository) GetSharesByGuild(context *util.Context, guildId bson.ObjectId, cursor *util.Cursor, limit int) (replayShares []*ReplayShare, err error) {
+	query := bson.M { "gd": guildId }
+	if cursor != nil {
+		query["_id"] = bson.M { "$lt": cursor.ID }
+	}
+
+	err = context.DB().C(ReplayShareCollectionName).Find(query).Sort("-_id").Limit(limit).All(&replayShares)
+	return
+}
+
+// seasons
+
+func (repository mongoSeasonRepository) Save(context *util.Context, season *Season) (err error) {
+	_, err = context.DB().C(SeasonCollectionName).Upsert(bson.M { "_id": season.ID }, season)
+	return
+}
+
+func (repository mongoSeasonRepository) GetById(context *util.Context, id bson.ObjectId) (season *Season, err error) {
+	err = context.DB().C(SeasonCollectionName).Find(bson.M { "_id": id }).One(&season)
+	return
+}
+
+func (repository mongoSeasonRepository) GetAll(context *util.Context) (seasons []*Season, err error) {
+	err = context.DB().C(SeasonCollectionName).Find(nil).Sort("-n").All(&seasons)
+	return
+}
+
+func (repository mongoSeasonRepository) InsertResult(context *util.Context, result *SeasonResult) error {
+	return context.DB().C(SeasonResultCollectionName).Insert(result)
+}
+
+func (repository mongoSeasonRepository) SaveResult(context *util.Context, result *SeasonResult) (err error) {
+	_, err = context.DB().C(SeasonResultCollectionName).Upsert(bson.M { "_id": result.ID }, result)
+	return
+}
+
+func (repository mongoSeasonRepository) GetResult(context *util.Context, seasonId bson.ObjectId, playerId bson.ObjectId) (result *SeasonResult, err error) {
+	err = context.DB().C(SeasonResultCollectionName).Find(bson.M { "sn": seasonId, "pl": playerId }).One(&result)
+	return
+}
+
+func (repository mongoSeasonRepository) GetResultsByPlayer(context *util.Context, playerId bson.ObjectId) (results []*SeasonResult, err error) {
+	err = context.DB().C(SeasonResultCollectionName).Find(bson.M { "pl": playerId }).Sort("-n").All(&results)
+	return
+}
+
+func (repository mongoSeasonRepository) ClaimResult(context *util.Context, id bson.ObjectId) error {
+	return context.DB().C(SeasonResultCollectionName).Update(bson.M { "_id": id, "cl": false }, bson.M { "$set": bson.M { "cl": true } })
+}
+
+func (repository mongoSeasonRepository) UnclaimResult(context *util.Context, id bson.ObjectId) error {
+	return context.DB().C(SeasonResultCollectionName).Update(bson.M { "_id": id, "cl": true }, bson.M { "$set": bson.M { "cl": false } })
+}
+
+// donations
+
+func (repository mongoDonationRepository) InsertRequest(context *util.Context, request *CardRequest) error {
+	return context.DB().C(CardRequestCollectionName).Insert(request)
+}
+
+func (repository mongoDonationRepository) GetRequestById(context *util.Context, id bson.ObjectId) (request *CardRequest, err error) {
+	err = context.DB().C(CardRequestCollectionName).Find(bson.M { "_id": id }).One(&request)
+	return
+}
+
+func (repository mongoDonationRepository) GetOpenRequestsByGuild(context *util.Context, guildId bson.ObjectId, now time.Time) (requests []*CardRequest, err error) {
+	err = context.DB().C(CardRequestCollectionName).Find(bson.M {
+		"gd": guildId,
+		"rm": bson.M { "$gt": 0 },
+		"t1": bson.M { "$gt": now },
+	}).Sort("-t0").All(&requests)
+	return
+}
+
+func (repository mongoDonationRepository) CloseRequests(context *util.Context, playerId bson.ObjectId, now time.Time) (err error) {
+	_, err = context.DB().C(CardRequestCollectionName).UpdateAll(bson.M {
+		"op": playerId,
+		"$or": []bson.M {
+			bson.M { "rm": bson.M { "$lte": 0 } },
+			bson.M { "t1": bson.M { "$lte": now } },
+		},
+	}, bson.M { "$unset": bson.M { "op": 1 } })
+	return
+}
+
+func (repository mongoDonationRepository) GetLatestRequest(context *util.Context, playerId bson.ObjectId, rarity string) (request *CardRequest, err error) {
+	err = context.DB().C(CardRequestCollectionName).Find(bson.M { "pl": playerId, "ra": rarity }).Sort("-t0").One(&request)
+	return
+}
+
+func (repository mongoDonationRepository) ReserveCopies(context *util.Context, donation *CardDonation, limit int, now time.Time) error {
+	donated := "dn." + donation.DonorID.Hex()
+	return context.DB().C(CardRequestCollectionName).Update(bson.M {
+		"_id": donation.RequestID,
+		"rm": bson.M { "$gte": donation.Count },
+		"t1": bson.M { "$gt": now },
+		donated: bson.M { "$not": bson.M { "$gt": limit - donation.Count } },
+	}, bson.M {
+		"$inc": bson.M { "rm": -donation.Count, donated: donation.Count },
+		"$push": bson.M { "rs": donation.ID },
+	})
+}
+
+func (repository mongoDonationRepository) ReleaseCopies(context *util.Context, donation *CardDonation) error {
+	return context.DB().C(CardRequestCollectionName).Update(bson.M { "_id": donation.RequestID, "rs": donation.ID }, bson.M {
+		"$inc": bson.M { "rm": donation.Count, "dn." + donation.DonorID.Hex(): -donation.Count },
+		"$pull": bson.M { "rs": donation.ID },
+	})
+}
+
+func (repository mongoDonationRepository) InsertDonation(context *util.Context, donation *CardDonation) error {
+	return context.DB().C(CardDonationCollectionName).Insert(donation)
+}
+
+func (repository mongoDonationRepository) SetDonationState(context *util.Context, id bson.ObjectId, from CardDonationState, to CardDonationState) error {
+	return context.DB().C(CardDonationCollectionName).Update(bson.M { "_id": id, "st": from }, bson.M { "$set": bson.M { "st": to, "t1": time.Now() } })
+}
+
+func (repository mongoDonationRepository) GetDonationsByRecipient(context *util.Context, recipientId bson.ObjectId, state CardDonationState) (donations []*CardDonation, err error) {
+	err = context.DB().C(CardDonationCollectionName).Find(bson.M { "rc": recipientId, "st": state }).Sort("_id").All(&donations)
+	return
+}
+
+func (repository mongoDonationRepository) GetStalePendingDonations(context *util.Context, before time.Time) (donations []*CardDonation, err error) {
+	err = context.DB().C(CardDonationCollectionName).Find(bson.M { "st": CardDonationPending, "t1": bson.M { "$lt": before } }).Sort("_id").All(&donations)
+	return
+}
+
+// guild wars
+
+func (repository mongoWarRepository) Insert(context *util.Context, war *GuildWar) error {
+	return context.DB().C(GuildWarCollectionName).Insert(war)
+}
+
+func (repository mongoWarRepository) GetById(context *util.Context, id bson.ObjectId) (war *GuildWar, err error) {
+	err = context.DB().C(GuildWarCollectionName).Find(bson.M { "_id": id }).One(&war)
+	return
+}
+
+func (repository mongoWarRepository) GetOpen(context *util.Context) (wars []*GuildWar, err error) {
+	err = context.DB().C(GuildWarCollectionName).Find(bson.M { "cp": false }).Sort("-t0").All(&wars)
+	return
+}
+
+func (repository mongoWarRepository) GetCompleted(context *util.Context, limit int) (wars []*GuildWar, err error) {
+	err = context.DB().C(GuildWarCollectionName).Find(bson.M { "cp": true }).Sort("-t0").Limit(limit).All(&wars)
+	return
+}
+
+func (repository mongoWarRepository) GetLatestByGuild(context *util.Context, guildId bson.ObjectId) (war *GuildWar, err error) {
+	err = context.DB().C(GuildWarCollectionName).Find(bson.M { "sd.gd": guildId }).Sort("-t0").One(&war)
+	return
+}
+
+func (repository mongoWarRepository) AddBattle(context *util.Context, id bson.ObjectId, guildId bson.ObjectId, score int, wins int, playerId bson.ObjectId, opponentId bson.ObjectId, maxBattles int, maxOpponentBattles int) error {
+	battles, opponentBattles := "bt." + playerId.Hex(), "ob." + warOpponentKey(playerId, opponentId)
+
+	side := bson.M { "gd": guildId }
+	if maxBattles > 0 {
+		side[battles] = bson.M { "$not": bson.M { "$gte": maxBattles } }
+	}
+	if maxOpponentBattles > 0 {
+		side[opponentBattles] = bson.M { "$not": bson.M { "$gte": maxOpponentBattles } }
+	}
+
+	return context.DB().C(GuildWarCollectionName).Update(bson.M { "_id": id, "cp": false, "sd": bson.M { "$elemMatch": side } }, bson.M {
+		"$inc": bson.M { "sd.$.sc": score, "sd.$.wc": wins, "sd.$.bc": 1, "sd.$." + battles: 1, "sd.$." + opponentBattles: 1 },
+		"$addToSet": bson.M { "sd.$.pa": playerId },
+	})
+}
+
+func (repository mongoWarRepository) Complete(context *util.Context, id bson.ObjectId, winner int, now time.Time) error {
+	return context.DB().C(GuildWarCollectionName).Update(bson.M { "_id": id, "cp": false }, bson.M { "$set": bson.M { "cp": true, "wn": winner, "tc": now } })
+}
+
+func (repository mongoWarRepository) ClaimReward(context *util.Context, id bson.ObjectId, playerId bson.ObjectId) error {
+	return context.DB().C(GuildWarCollectionName).Update(bson.M {
+		"_id": id,
+		"cp": true,
+		"sd": bson.M { "$elemMatch": bson.M { "pa": playerId, "cl": bson.M { "$ne": playerId } } },
+	}, bson.M { "$addToSet": bson.M { "sd.$.cl": playerId } })
+}
+
+func (repository mongoWarRepository) UnclaimReward(context *util.Context, id bson.ObjectId, playerId bson.ObjectId) error {
+	return context.DB().C(GuildWarCollectionName).Update(bson.M { "_id": id, "sd.cl": playerId }, bson.M { "$pull": bson.M { "sd.$.cl": playerId } })
+}
+
+// sanctions
+
+func (repository mongoSanctionRepository) Insert(context *util.Context, sanction *Sanction) error {
+	return context.DB().C(SanctionCollectionName).Insert(sanction)
+}
+
+func (repository mongoSanctionRepository) Save(context *util.Context, sanction *Sanction) (err error) {
+	_, err = context.DB().C(SanctionCollectionName).Upsert(bson.M { "_id": sanction.ID }, sanction)
+	return
+}
+
+func (repository mongoSanctionRepository) GetById(context *util.Context, id bson.ObjectId) (sanction *Sanction, err error) {
+	err = context.DB().C(SanctionCollectionName).Find(bson.M { "_id": id } ).One(&sanction)
+	return
+}
+
+func (repository mongoSanctionRepository) GetByUser(context *util.Context, userId bson.ObjectId) (sanctions []*Sanction, err error) {
+	err = context.DB().C(SanctionCollectionName).Find(bson.M { "us": userId } ).Sort("-t0").All(&sanctions)
+	return
+}
+
+func (repository mongoSanctionRepository) GetActive(context *util.Context, userId bson.ObjectId, sanctionType SanctionType, now time.Time) (sanctions []*Sanction, err error) {
+	err = context.DB().C(SanctionCollectionName).Find(bson.M {
+		"us": userId,
+		"tp": sanctionType,
+		"rv": bson.M { "$exists": false },
+		"$or": []bson.M {
+			bson.M { "exp": bson.M { "$exists": false } },
+			bson.M { "exp": bson.M { "$gt": now } },
+		},
+	}).All(&sanctions)
+	return
+}
+
+// audits
+
+func (repository mongoAuditRepository) Insert(context *util.Context, audit *Audit) error {
+	return context.DB().C(AuditCollectionName).Insert(audit)
+}
+
+func (repository mongoAuditRepository) GetById(context *util.Context, id bson.ObjectId) (audit *Audit, err error) {
+	err = context.DB().C(AuditCollectionName).Find(bson.M { "_id": id } ).One(&audit)
+	return
+}
+
+// friends
+
+func (repository mongoFriendsRepository) Save(context *util.Context, friends *Friends) (err error) {
+	_, err = context.DB().C(FriendsCollectionName).Upsert(bson.M { "_id": friends.ID }, friends)
+	return
+}
+
+func (repository mongoFriendsRepository) GetByPlayer(context *util.Context, playerId bson.ObjectId) (friends *Friends, err error) {
+	err = context.DB().C(FriendsCollectionName).Find(bson.M { "pid": playerId } ).One(&friends)
+	return
+}
+
+// trackings
+
+func (repository mongoTrackingRepository) Insert(context *util.Context, tracking *Tracking) error {
+	return context.DB().C(TrackingCollectionName).Insert(tracking)
+}
+
+func (repository mongoTrackingRepository) Delete(context *util.Context, id bson.ObjectId) error {
+	return context.DB().C(TrackingCollectionName).Remove(bson.M { "_id": id })
+}
+
+func (repository mongoTrackingRepository) GetById(context *util.Context, id bson.ObjectId) (tracking *Tracking, err error) {
+	err = context.DB().C(TrackingCollectionName).Find(bson.M { "_id": id } ).One(&tracking)
+	return
+}
+
+func (repository mongoTrackingRepository) GetByUser(context *util.Context, userId bson.ObjectId) (trackings []Tracking, err error) {
+	err = context.DB().C(TrackingCollectionName).Find(bson.M { "us": userId } ).Sort("t0").All(&trackings)
+	return
+}
+
+// socket messages
+
+func (repository mongoSocketRepository) Insert(context *util.Context, socketModel *SocketModel) error {
+	return context.DB().C(SocketCollectionName).Insert(socketModel)
+}
+
+func (repository mongoSocketRepository) GetSince(context *util.Context, userId bson.ObjectId, since time.Time) (socketModels []*SocketModel, err error) {
+	err = context.DB().C(SocketCollectionName).Find(bson.M { "$and":
+		[]bson.M {
+			bson.M {
+				"$or": []bson.M {
+					bson.M { "us": userId },
+					bson.M { "us": bson.M { "$exists": false } },
+				},
+			},
+			bson.M { "t0": bson.M { "$gt": since } },
+		},
+	}).Sort("t0").All(&socketModels)
+	return
+}
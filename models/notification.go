@@ -65,67 +65,42 @@ func (notification *Notification) Save(context *util.Context) (err error) {
 	}
 
 	// update in DB
-	_, err = context.DB.C(NotificationCollectionName).Upsert(bson.M{"_id": notification.ID}, notification)
+	err = Notifications.Save(context, notification)
 	return
 }
 
 func (notification *Notification) Delete(context *util.Context) (err error) {
-	return context.DB.C(NotificationCollectionName).Remove(bson.M{"_id": notification.ID})
+	return Notifications.Delete(context, notification.ID)
+}
+
+// set a data value only while it still holds the expected one, returning whether it was set
+func (notification *Notification) SwapData(context *util.Context, key string, expected interface{}, value interface{}) (swapped bool, err error) {
+	err = Notifications.UpdateData(context, notification.ID, key, expected, value)
+	if err == mgo.ErrNotFound {
+		return false, nil
+	}
+	if err == nil {
+		notification.Data[key] = value
+	}
+	return err == nil, err
 }
 
 func GetNotificationById(context *util.Context, id bson.ObjectId) (notification *Notification, err error) {
 	// find notification by ID
-	err = context.DB.C(NotificationCollectionName).Find(bson.M{"_id": id}).One(&notification)
-	return
+	return Notifications.GetById(context, id)
 }
 
 func GetSentNotifications(context *util.Context, player *Player) (notifications []*Notification, err error) {
 	// get all notifications sent from player
-	err = context.DB.C(NotificationCollectionName).Find(bson.M{"sid": player.ID}).Sort("t0").All(&notifications)
-	return
+	return Notifications.GetBySender(context, player.ID)
 }
 
 func GetReceivedNotifications(context *util.Context, player *Player, types []string) (notifications []*Notification, err error) {
-	// Get player specific conditions
-	conditions := []bson.M{
-		bson.M{"gd": false, "rid": player.ID},
-		bson.M{"gd": false, "rid": bson.M{"$exists": false}},
-	}
-	// If guild ID exists, add to conditions
-	if player.GuildID.Valid() {
-		conditions = append(conditions, bson.M{"gd": true, "rid": player.GuildID})
-	}
-	// Or all player conditions together
-	playerConditions := bson.M{"$or": conditions}
-
-	//Get type conditions
-	var typeConditions bson.M
-	if len(types) > 0 {
-		typeConditions = bson.M{"tp": bson.M{"$in": types}}
-	}
-
-	// Array of conditions to be anded
-	finalConditions := []bson.M{playerConditions, typeConditions}
-
-	// get all pending notifications sent to player
-	err = context.DB.C(NotificationCollectionName).Find(bson.M{"$and": finalConditions}).Sort("t0").All(&notifications)
-
-	if err != nil {
-		return
-	}
-
-	return
+	// get all pending notifications sent to player, everyone or their guild
+	return Notifications.GetByReceiver(context, player.ID, player.GuildID, types)
 }
 
 func ViewNotificationsByIds(context *util.Context, ids []bson.ObjectId) (err error) {
 	// remove all viewed notifications that require no action from the user
-	_, err = context.DB.C(NotificationCollectionName).RemoveAll(bson.M{
-		"_id": bson.M{
-			"$in": ids,
-		},
-		"ac": bson.M{
-			"$size": 0,
-		},
-	})
-	return
+	return Notifications.RemoveViewed(context, ids)
 }
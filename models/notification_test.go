@@ -0,0 +1,53 @@
+package models
+
+import (
+	"sync"
+	"testing"
+
+	"gopkg.in/mgo.v2/bson"
+)
+
+func TestNotificationSwapData(t *testing.T) {
+	context := newTestContext()
+	notification := &Notification { Type: "GuildWarBattle", Data: bson.M { "matchStarted": false } }
+	if err := notification.Save(context); err != nil {
+		t.Fatalf("Failed to save notification: %v", err)
+	}
+
+	// concurrent accepts, only one starts the match
+	var group sync.WaitGroup
+	var mutex sync.Mutex
+	started := 0
+	for i := 0; i < 10; i++ {
+		group.Add(1)
+		go func() {
+			defer group.Done()
+			stored, err := GetNotificationById(context, notification.ID)
+			if err != nil {
+				t.Errorf("Failed to get notification: %v", err)
+				return
+			}
+			swapped, err := stored.SwapData(context, "matchStarted", false, true)
+			if err != nil {
+				t.Errorf("Failed to swap data: %v", err)
+			}
+			if swapped {
+				mutex.Lock()
+				started++
+				mutex.Unlock()
+			}
+		}()
+	}
+	group.Wait()
+
+	if started != 1 {
+		t.Errorf("Started %d matches, want 1", started)
+	}
+	stored, err := GetNotificationById(context, notification.ID)
+	if err != nil {
+		t.Fatalf("Failed to get notification: %v", err)
+	}
+	if stored.Data["matchStarted"] != true {
+		t.Errorf("Match started = %v, want true", stored.Data["matchStarted"])
+	}
+}
@@ -51,6 +51,10 @@ type Player struct {
 	MatchCount 				int 			`bson:"mc" json:"matchCount"`
 	PracticeWinCount 		int 			`bson:"pw" json:"practiceWinCount"`
 	PracticeMatchCount 		int 			`bson:"pc" json:"practiceMatchCount"`
+	SeasonWinCount 			int 			`bson:"sw" json:"seasonWinCount"`
+	SeasonLossCount 		int 			`bson:"sl" json:"seasonLossCount"`
+	SeasonMatchCount 		int 			`bson:"sm" json:"seasonMatchCount"`
+	PlaceTime 				time.Time 		`bson:"pt,omitempty" json:"-"` // last leaderboard score change
 
 	StandardCurrency   		int    			`bson:"cs" json:"standardCurrency"`
 	PremiumCurrency    		int    			`bson:"cp" json:"premiumCurrency"`
@@ -73,6 +77,7 @@ type Player struct {
 	GuildID   				bson.ObjectId 	`bson:"gd,omitempty" json:"-"`
 	GuildRole 				GuildRole     	`bson:"gr,omitempty" json:"-"`
 	GuildJoinTime           time.Time       `bson:"gj" json:"-"`
+	DonationIDs             []bson.ObjectId `bson:"dl,omitempty" json:"-"` // latest donations debited from the player
 
 	TutorialDisabled		bool			`bson:"td" json:"tutorialDisabled"`
 	Tutorial 				[]Tutorial 		`bson:"tl" json:"tutorial"`
@@ -122,16 +127,25 @@ func ensureIndexPlayer(database *mgo.Database) {
 
 func GetPlayerById(context *util.Context, id bson.ObjectId) (player *Player, err error) {
 	// find player data by user ID
-	err = context.DB.C(PlayerCollectionName).Find(bson.M{"_id": id}).One(&player)
-	return
+	return Players.GetById(context, id)
 }
 
 func GetPlayerByUser(context *util.Context, userId bson.ObjectId) (player *Player, err error) {
+	defer util.ObserveDatabase(PlayerCollectionName, "getByUser", time.Now(), &err)
+
 	// find player data by user ID
-	err = context.DB.C(PlayerCollectionName).Find(bson.M{"us": userId}).One(&player)
+	player, err = Players.GetByUser(context, userId)
 	return
 }
 
+func GetPlayersByIds(context *util.Context, ids []bson.ObjectId) (players []*Player, err error) {
+	return Players.GetByIds(context, ids)
+}
+
+func GetPlayersByGuild(context *util.Context, guildId bson.ObjectId) (players []*Player, err error) {
+	return Players.GetByGuild(context, guildId)
+}
+
 func GetPlayerByTag(context *util.Context, tag string) (player *Player, err error) {
 	var user *User
 	if user, err = GetUserByTag(context, tag); err != nil {
@@ -191,7 +205,7 @@ func (player *Player) GetPlayerClient(context *util.Context) (client *PlayerClie
 
 	// check if online (TODO - better validation?)
 	lastOnline := time.Now().Sub(player.LastTime)
-	online := (lastOnline < time.Second*config.Config.Sessions.OfflineTimeout)
+	online := (lastOnline < config.Config.Sessions.OfflineTimeout.Duration)
 
 	// get guild
 	guildTag := ""
@@ -260,50 +274,28 @@ func (player *Player) Reset(context *util.Context, development bool) (err error)
 	// clear cache for player
 	playerID := player.ID.Hex()
 	userID := player.UserID.Hex()
-	context.Cache.Set(fmt.Sprintf("PlayerUserId:%s", playerID), nil)
-	context.Cache.Set(fmt.Sprintf("PlayerName:%s", playerID), nil)
-	context.Cache.Set(fmt.Sprintf("UserName:%s", userID), nil)
-	context.Cache.Set(fmt.Sprintf("MatchTicket:%s", playerID), nil)
-	context.Cache.RemoveScore("Leaderboard", playerID)
+	context.Cache().Set(fmt.Sprintf("PlayerUserId:%s", playerID), nil)
+	context.Cache().Set(fmt.Sprintf("PlayerName:%s", playerID), nil)
+	context.Cache().Set(fmt.Sprintf("UserName:%s", userID), nil)
+	context.Cache().Set(fmt.Sprintf("MatchTicket:%s", playerID), nil)
+	player.RemovePlace(context)
 
+	guildID := player.GuildID
 	player.GuildID = bson.ObjectId("")
 	
 	// update database
-	return player.Save(context)
-}
-
-func ResetPlayers(context *util.Context) error {
-	// TODO - this is an example of a bulk aggregate operation, but isn't fully tested...
-	var result bson.D
-	return context.DB.Run(bson.D{
-		bson.DocElem{"update", PlayerCollectionName},
-		bson.DocElem{"updates", []bson.M{
-			bson.M{
-				"q": bson.M{},
-				"u": bson.M{
-					"xp": 0,
-					"rk": 0,
-					"rt": 1200,
-					"wc": 0,
-					"lc": 0,
-					"mc": 0,
-					"ap": 0,
-				},
-				"multi":  false,
-				"upsert": false,
-				"limit":  0,
-			},
-		}},
-		bson.DocElem{"writeConcern", bson.M{
-			"w":        1,
-			"j":        true,
-			"wtimeout": 1000,
-		}},
-		bson.DocElem{"ordered", false},
-	}, &result)
+	if err = player.Save(context); err != nil {
+		return
+	}
+	if guildID.Valid() {
+		UpdateGuildPlace(context, guildID)
+	}
+	return
 }
 
 func (player *Player) Save(context *util.Context) (err error) {
+	defer util.ObserveDatabase(PlayerCollectionName, "save", time.Now(), &err)
+
 	if !player.ID.Valid() {
 		player.ID = bson.NewObjectId()
 	}
@@ -312,7 +304,7 @@ func (player *Player) Save(context *util.Context) (err error) {
 	player.LastTime = time.Now()
 
 	// update entire player to database
-	_, err = context.DB.C(PlayerCollectionName).Upsert(bson.M{"_id": player.ID}, player)
+	err = Players.Save(context, player)
 	return
 }
 
@@ -328,13 +320,13 @@ func (player *Player) UpdateFromJson(context *util.Context, data string) (err er
 
 func (player *Player) Update(context *util.Context, updates bson.M) (err error) {
 	// update given values
-	err = context.DB.C(PlayerCollectionName).Update(bson.M{"_id": player.ID}, bson.M{"$set": updates})
+	err = Players.Update(context, player.ID, updates)
 	return
 }
 
 func (player *Player) Delete(context *util.Context) (err error) {
 	// delete player from database
-	return context.DB.C(PlayerCollectionName).Remove(bson.M{"_id": player.ID})
+	return Players.Delete(context, player.ID)
 }
 
 func GetUserIdByPlayerId(context *util.Context, playerID bson.ObjectId) bson.ObjectId {
@@ -342,7 +334,7 @@ func GetUserIdByPlayerId(context *util.Context, playerID bson.ObjectId) bson.Obj
 	key := fmt.Sprintf("PlayerUserId:%s", playerID.Hex())
 
 	// get cached ID
-	userIDHex := context.Cache.GetString(key, "")
+	userIDHex := context.Cache().GetString(key, "")
 	var userID bson.ObjectId
 
 	if bson.IsObjectIdHex(userIDHex) {
@@ -353,7 +345,7 @@ func GetUserIdByPlayerId(context *util.Context, playerID bson.ObjectId) bson.Obj
 		player, _ := GetPlayerById(context, playerID)
 		if player != nil {
 			userID = player.UserID
-			context.Cache.Set(key, userID.Hex())
+			context.Cache().Set(key, userID.Hex())
 		}
 	}
 	return userID
@@ -365,8 +357,8 @@ func (player *Player) CacheName(context *util.Context, name string) {
 	playerKey := fmt.Sprintf("PlayerName:%s", player.ID.Hex())
 
 	// refresh cached names
-	context.Cache.Set(userKey, name)
-	context.Cache.Set(playerKey, name)
+	context.Cache().Set(userKey, name)
+	context.Cache().Set(playerKey, name)
 }
 
 func GetUserName(context *util.Context, userID bson.ObjectId) string {
@@ -374,13 +366,13 @@ func GetUserName(context *util.Context, userID bson.ObjectId) string {
 	key := fmt.Sprintf("UserName:%s", userID.Hex())
 
 	// get cached name
-	name := context.Cache.GetString(key, "")
+	name := context.Cache().GetString(key, "")
 
 	// immediately cache latest name
 	if name == "" {
 		user, err := GetUserById(context, userID)
 		if err == nil && user != nil {
-			context.Cache.Set(key, user.Name)
+			context.Cache().Set(key, user.Name)
 			name = user.Name
 		}
 	}
@@ -392,7 +384,7 @@ func GetPlayerName(context *util.Context, playerID bson.ObjectId) string {
 	key := fmt.Sprintf("PlayerName:%s", playerID.Hex())
 
 	// get cached name
-	name := context.Cache.GetString(key, "")
+	name := context.Cache().GetString(key, "")
 
 	// immediately cache latest name
 	if name == "" {
@@ -400,7 +392,7 @@ func GetPlayerName(context *util.Context, playerID bson.ObjectId) string {
 		if player != nil {
 			user, _ := GetUserById(context, player.UserID)
 			if user != nil {
-				context.Cache.Set(key, user.Name)
+				context.Cache().Set(key, user.Name)
 				name = user.Name
 			}
 		}
@@ -492,36 +484,6 @@ func (player *Player) GetMMR() int {
 	return rank.Level * 1000
 }
 
-func (player *Player) GetPlace(context *util.Context) int {
-	return context.Cache.GetScore("Leaderboard", player.ID.Hex())
-}
-
-func (player *Player) UpdatePlace(context *util.Context) {
-	matches := player.MatchCount
-	if matches > 0 {
-		// calculate placement score
-		winsFactor := (player.WinCount - player.LossCount) * 1000000 // / matches
-		matchesFactor := matches * 1000
-		pointsFactor := player.ArenaPoints
-
-		score := winsFactor + matchesFactor + pointsFactor
-		context.Cache.SetScore("Leaderboard", player.ID.Hex(), score)
-	}
-}
-
-// HACK - inefficient
-func UpdateAllPlayersPlace(context *util.Context) {
-	// clear all previous places
-	context.Cache.ClearScores("Leaderboard")
-
-	var players []*Player
-	context.DB.C(PlayerCollectionName).Find(nil).All(&players)
-
-	for _, player := range players {
-		player.UpdatePlace(context)
-	}
-}
-
 func (player *Player) SetDirty(flags ...util.Bits) {
 	for _, flag := range flags {
 		player.DirtyMask = util.SetMask(player.DirtyMask, flag)
@@ -4,6 +4,7 @@ import (
 	"time"
 	"encoding/json"
 	
+	"bloodtales/config"
 	"bloodtales/data"
 	"bloodtales/util"
 )
@@ -289,6 +290,11 @@ func (player *Player) CollectQuest(index int, context *util.Context) (*Reward, b
 
 	err := player.AddRewards(reward, context)
 
+	// quests count towards the player's guild
+	if player.IsInGuild() {
+		player.addGuildProgress(context, GuildProgress { XP: config.Config.Guilds.QuestXP })
+	}
+
 	return reward, true, err
 }
 
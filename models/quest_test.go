@@ -0,0 +1,86 @@
+package models
+
+import (
+	"testing"
+
+	"bloodtales/data"
+)
+
+func TestQuestProgress(t *testing.T) {
+	tests := []struct {
+		name        string
+		questID     string
+		leaderID    string // current deck leader (starter deck leader when empty)
+		matches     int
+		wins        int
+		progress    int
+		collectable bool
+		active      bool // after collecting
+		standard    int  // currency collected
+		premium     int
+	}{
+		{"play not yet reached", "QUEST_DAILY_PLAY", "", 2, 0, 2, false, true, 0, 0},
+		{"play reached", "QUEST_DAILY_PLAY", "", 3, 1, 3, true, false, 100, 0},
+		{"losses do not count for wins", "QUEST_DAILY_WIN", "", 3, 1, 1, false, true, 0, 0},
+		{"wins reached", "QUEST_DAILY_WIN", "", 4, 2, 2, true, false, 100, 0},
+		{"leader win", "QUEST_DAILY_GOLEM_LEADER", "", 1, 1, 1, true, false, 100, 0},
+		{"win with another leader", "QUEST_DAILY_GOLEM_LEADER", "CARD_MERC_CAPTAIN", 1, 1, 0, false, true, 0, 0},
+		{"first weekly phase", "QUEST_WEEKLY_WIN", "", 8, 6, 6, true, true, 0, 10},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			context := newTestContext()
+			player := newTestPlayer(t, context)
+
+			// replace the quest in the first daily slot
+			const index = 1
+			questID := data.ToDataId(test.questID)
+			player.Quests[index].Active = false
+			player.AssignQuest(index, questID, data.GetQuestData(questID))
+			if test.leaderID != "" {
+				player.Decks[player.CurrentDeck].LeaderCardID = data.ToDataId(test.leaderID)
+			}
+			if err := player.Save(context); err != nil {
+				t.Fatalf("Failed to save player: %v", err)
+			}
+
+			// play matches, then update battle quests as completing a match does
+			player = reloadTestPlayer(t, context, player)
+			player.MatchCount += test.matches
+			player.WinCount += test.wins
+			if err := player.UpdateQuests(context, data.QuestTypeBattle, data.QuestTypeSinglePlayerBattle); err != nil {
+				t.Fatalf("Failed to update quests: %v", err)
+			}
+
+			player = reloadTestPlayer(t, context, player)
+			quest := &player.Quests[index]
+			if quest.QuestID != questID {
+				t.Fatalf("Quest = %s, want %s", data.ToDataName(quest.QuestID), test.questID)
+			}
+			if progress := quest.Properties["progress"]; progress != test.progress {
+				t.Errorf("Progress = %v, want %d", progress, test.progress)
+			}
+			if quest.IsCollectable() != test.collectable {
+				t.Fatalf("Collectable = %v, want %v", quest.IsCollectable(), test.collectable)
+			}
+
+			standardCurrency, premiumCurrency := player.StandardCurrency, player.PremiumCurrency
+			_, collected, err := player.CollectQuest(index, context)
+			if err != nil {
+				t.Fatalf("Failed to collect quest: %v", err)
+			}
+			if collected != test.collectable {
+				t.Errorf("Collected = %v, want %v", collected, test.collectable)
+			}
+
+			player = reloadTestPlayer(t, context, player)
+			if player.Quests[index].Active != test.active {
+				t.Errorf("Active after collecting = %v, want %v", player.Quests[index].Active, test.active)
+			}
+			if player.StandardCurrency - standardCurrency != test.standard || player.PremiumCurrency - premiumCurrency != test.premium {
+				t.Errorf("Collected currency = %d/%d, want %d/%d", player.StandardCurrency - standardCurrency, player.PremiumCurrency - premiumCurrency, test.standard, test.premium)
+			}
+		})
+	}
+}
@@ -1,11 +1,17 @@
 package models
 
 import (
+	"fmt"
 	"time"
+	"bytes"
+	"io/ioutil"
+	"compress/gzip"
 
 	"gopkg.in/mgo.v2"
 	"gopkg.in/mgo.v2/bson"
 
+	"bloodtales/config"
+	"bloodtales/data"
 	"bloodtales/util"
 )
 
@@ -17,16 +23,77 @@ type ReplayInfo struct {
 	CreatedAt  time.Time     `bson:"t0" json:"created"`
 	Rank       int           `bson:"rk" json:"rank"`
 	Info       string        `bson:"in" json:"info"`
+	Size       int           `bson:"sz" json:"size"` // stored (compressed) bytes
+
+	// recorded match (when linked)
+	MatchID    bson.ObjectId  `bson:"mid,omitempty" json:"matchId,omitempty"`
+	Players    []ReplayPlayer `bson:"pl,omitempty" json:"players,omitempty"` // host, then guest
+	Arena      string         `bson:"ar,omitempty" json:"arena,omitempty"`
+	Outcome    MatchOutcome   `bson:"oc" json:"outcome"`                     // for the host
+	League     data.League    `bson:"lg" json:"league"`                      // highest of the players
+	CardIDs    []data.DataId  `bson:"cds,omitempty" json:"-"`                // cards in either deck, for search
+}
+
+// match player, as of the replay upload
+type ReplayPlayer struct {
+	PlayerID   bson.ObjectId `bson:"pid" json:"playerId"`
+	Name       string        `bson:"nm" json:"name"`
+	RankPoints int           `bson:"rk" json:"rankPoints"`
+	League     data.League   `bson:"lg" json:"league"`
+	Deck       Deck          `bson:"dk" json:"deck"`
 }
 
+// replay search (empty fields match everything)
+type ReplayFilter struct {
+	UserID     bson.ObjectId // uploaded by
+	PlayerID   bson.ObjectId // either match player
+	Leagues    []data.League
+	CardID     data.DataId
+	Arena      string
+}
+
+const ReplayShareCollectionName = "replayShares"
+
+// replay shared with a guild
+type ReplayShare struct {
+	ID         bson.ObjectId `bson:"_id,omitempty" json:"id"`
+	GuildID    bson.ObjectId `bson:"gd" json:"-"`
+	InfoID     bson.ObjectId `bson:"iid" json:"-"`
+	PlayerID   bson.ObjectId `bson:"pid" json:"playerId"`
+	Name       string        `bson:"nm" json:"name"`
+	Message    string        `bson:"ms" json:"message"`
+	CreatedAt  time.Time     `bson:"t0" json:"created"`
+
+	// client
+	ReplayInfo *ReplayInfo   `bson:"-" json:"replay"`
+}
+
+// most replays returned per page
+const ReplayPageLimit = 50
+
 const ReplayDataCollectionName = "replayDatas"
 
+// GridFS prefix for replays too large to store inline
+const ReplayFilePrefix = "replays"
+
 type ReplayData struct {
 	ID         bson.ObjectId `bson:"_id,omitempty" json:"-"`
 	InfoID     bson.ObjectId `bson:"iid" json:"-"`
-	Data       string        `bson:"dt" json:"data"`
+	Data       string        `bson:"dt,omitempty" json:"data"`         // uncompressed data (only stored by legacy replays)
+	Compressed []byte        `bson:"cd,omitempty" json:"-"`            // format header and compressed data
+	FileID     bson.ObjectId `bson:"fid,omitempty" json:"-"`           // GridFS file holding the compressed data instead
 }
 
+// stored data formats, in the header following the magic bytes
+const (
+	ReplayFormatLegacy = 0 // uncompressed string, no header
+	ReplayFormatGzip   = 1
+)
+
+const replayBatchSize = 100
+
+var replayMagic []byte = []byte("BTR")
+
 func ensureIndexReplay(database *mgo.Database) {
 	c := database.C(ReplayInfoCollectionName)
 
@@ -42,6 +109,32 @@ func ensureIndexReplay(database *mgo.Database) {
 		Background: true,
 	}))
 
+	// retention index
+	util.Must(c.EnsureIndex(mgo.Index{
+		Key:        []string { "t0" },
+		Background: true,
+	}))
+
+	// top replays index
+	util.Must(c.EnsureIndex(mgo.Index{
+		Key:        []string { "-rk", "-_id" },
+		Background: true,
+	}))
+
+	// match index
+	util.Must(c.EnsureIndex(mgo.Index{
+		Key:        []string { "mid" },
+		Background: true,
+	}))
+
+	// search indexes
+	for _, field := range []string { "lg", "cds", "ar", "pl.pid", "us" } {
+		util.Must(c.EnsureIndex(mgo.Index{
+			Key:        []string { field, "-rk", "-_id" },
+			Background: true,
+		}))
+	}
+
 	c = database.C(ReplayDataCollectionName)
 
 	// user index
@@ -51,14 +144,97 @@ func ensureIndexReplay(database *mgo.Database) {
 		DropDups:   true,
 		Background: true,
 	}))
+
+	// guild feed index
+	c = database.C(ReplayShareCollectionName)
+	util.Must(c.EnsureIndex(mgo.Index{
+		Key:        []string { "gd", "-_id" },
+		Background: true,
+	}))
+
+	// replay index
+	util.Must(c.EnsureIndex(mgo.Index{
+		Key:        []string { "iid" },
+		Background: true,
+	}))
+
+	// GridFS chunks index (not created by mgo)
+	c = database.C(ReplayFilePrefix + ".chunks")
+	util.Must(c.EnsureIndex(mgo.Index{
+		Key:        []string { "files_id", "n" },
+		Unique:     true,
+		Background: true,
+	}))
+}
+
+// compress replay data behind a format header
+func encodeReplayData(data string) (encoded []byte, err error) {
+	var buffer bytes.Buffer
+	buffer.Write(replayMagic)
+	buffer.WriteByte(ReplayFormatGzip)
+
+	writer := gzip.NewWriter(&buffer)
+	if _, err = writer.Write([]byte(data)); err != nil {
+		return
+	}
+	if err = writer.Close(); err != nil {
+		return
+	}
+
+	encoded = buffer.Bytes()
+	return
 }
 
-func CreateReplay(context *util.Context, info string, data string, rank int) (err error) {
+func decodeReplayData(encoded []byte) (data string, err error) {
+	if len(encoded) <= len(replayMagic) || !bytes.HasPrefix(encoded, replayMagic) {
+		err = util.NewError("Invalid replay data header")
+		return
+	}
+
+	format := encoded[len(replayMagic)]
+	switch format {
+	case ReplayFormatGzip:
+		var reader *gzip.Reader
+		if reader, err = gzip.NewReader(bytes.NewReader(encoded[len(replayMagic) + 1:])); err != nil {
+			return
+		}
+		defer reader.Close()
+
+		var raw []byte
+		if raw, err = ioutil.ReadAll(reader); err == nil {
+			data = string(raw)
+		}
+	default:
+		err = util.NewError(fmt.Sprintf("Unsupported replay data format: %d", format))
+	}
+	return
+}
+
+// create a replay, linked to the match in the room when given
+func CreateReplay(context *util.Context, info string, data string, rank int, roomID string) (err error) {
+	replayConfig := config.Config.Replays
+	if replayConfig.MaxSize > 0 && len(data) > replayConfig.MaxSize {
+		return util.NewError(fmt.Sprintf("Replay data is too large: %d bytes (limit %d)", len(data), replayConfig.MaxSize))
+	}
+
+	compressed, err := encodeReplayData(data)
+	if err != nil {
+		return
+	}
+
 	// init replay info
 	replayInfo := &ReplayInfo {
 		UserID: context.UserID,
 		Info:   info,
 		Rank:   rank,
+		Size:   len(compressed),
+	}
+
+	// link match
+	if roomID != "" {
+		if err = replayInfo.setMatch(context, roomID); err != nil {
+			return
+		}
 	}
 
 	// save replay info
@@ -70,48 +246,334 @@ func CreateReplay(context *util.Context, info string, data string, rank int) (er
 	// init replay data
 	replayData := &ReplayData {
 		InfoID: replayInfo.ID,
-		Data:   data,
+	}
+	if err = replayData.setCompressed(context, compressed); err != nil {
+		return
 	}
 
 	// save replay data
 	err = replayData.Save(context)
+	if err != nil {
+		return
+	}
+
+	// drop the user's oldest replays over quota
+	err = enforceReplayQuota(context, context.UserID)
+	return
+}
+
+// record the match players (with their current decks), arena, outcome and league, ranking the replay by the uploader
+func (replayInfo *ReplayInfo) setMatch(context *util.Context, roomID string) (err error) {
+	match, err := Matches.GetByRoom(context, roomID)
+	if err != nil {
+		return
+	}
+
+	host, err := match.GetHost(context)
+	if err != nil {
+		return
+	}
+	guest, err := match.GetGuest(context)
+	if err != nil {
+		return
+	}
+
+	if host.UserID != replayInfo.UserID && guest.UserID != replayInfo.UserID {
+		return util.NewError("Player attempting to link a replay to a match which they don't belong to")
+	}
+
+	replayInfo.MatchID = match.ID
+	replayInfo.Arena = match.Arena
+	replayInfo.Outcome = match.Outcome
+	replayInfo.Players = nil
+	replayInfo.CardIDs = nil
+
+	cards := map[data.DataId]bool {}
+	for _, player := range []*Player { host, guest } {
+		replayPlayer := ReplayPlayer {
+			PlayerID: player.ID,
+			Name: GetUserName(context, player.UserID),
+			RankPoints: player.RankPoints,
+			League: player.GetLeague(),
+		}
+
+		if player.CurrentDeck >= 0 && player.CurrentDeck < len(player.Decks) {
+			replayPlayer.Deck = player.Decks[player.CurrentDeck]
+
+			for _, cardId := range append([]data.DataId { replayPlayer.Deck.LeaderCardID }, replayPlayer.Deck.CardIDs...) {
+				if !cards[cardId] {
+					cards[cardId] = true
+					replayInfo.CardIDs = append(replayInfo.CardIDs, cardId)
+				}
+			}
+		}
+
+		if replayPlayer.League > replayInfo.League {
+			replayInfo.League = replayPlayer.League
+		}
+		if player.UserID == replayInfo.UserID {
+			replayInfo.Rank = player.RankPoints
+		}
+
+		replayInfo.Players = append(replayInfo.Players, replayPlayer)
+	}
+	return
+}
+
+// search replays, highest rank first, returning the cursor of the next page (nil on the last page)
+func SearchReplays(context *util.Context, filter *ReplayFilter, cursor *util.Cursor, limit int) (replayInfos []*ReplayInfo, next *util.Cursor, err error) {
+	if limit <= 0 || limit > ReplayPageLimit {
+		limit = ReplayPageLimit
+	}
+
+	replayInfos, err = Replays.Search(context, filter, cursor, limit)
+	if err == nil && len(replayInfos) == limit {
+		last := replayInfos[len(replayInfos) - 1]
+		next = &util.Cursor { Value: int64(last.Rank), ID: last.ID }
+	}
+	return
+}
+
+// share a replay with the player's guild
+func ShareReplay(context *util.Context, player *Player, replayInfo *ReplayInfo, message string) (replayShare *ReplayShare, err error) {
+	if !player.GuildID.Valid() {
+		err = util.NewError("Player is not in a guild")
+		return
+	}
+
+	replayShare = &ReplayShare {
+		ID: bson.NewObjectId(),
+		GuildID: player.GuildID,
+		InfoID: replayInfo.ID,
+		PlayerID: player.ID,
+		Name: GetUserName(context, player.UserID),
+		Message: message,
+		CreatedAt: time.Now(),
+		ReplayInfo: replayInfo,
+	}
+	err = Replays.InsertShare(context, replayShare)
+	return
+}
+
+// replays shared with a guild, newest first, returning the cursor of the next page (nil on the last page)
+func GetGuildReplayFeed(context *util.Context, guildId bson.ObjectId, cursor *util.Cursor, limit int) (replayShares []*ReplayShare, next *util.Cursor, err error) {
+	if limit <= 0 || limit > ReplayPageLimit {
+		limit = ReplayPageLimit
+	}
+
+	shares, err := Replays.GetSharesByGuild(context, guildId, cursor, limit)
+	if err != nil {
+		return
+	}
+	if len(shares) == limit {
+		next = &util.Cursor { ID: shares[len(shares) - 1].ID }
+	}
+
+	// skip shares of deleted replays
+	for _, replayShare := range shares {
+		replayShare.ReplayInfo, err = Replays.GetInfoById(context, replayShare.InfoID)
+		if err == mgo.ErrNotFound {
+			continue
+		}
+		if err != nil {
+			return
+		}
+		replayShares = append(replayShares, replayShare)
+	}
+	err = nil
+	return
+}
+
+// keep the newest replays within the user's count and size quotas (always keeping the newest)
+func enforceReplayQuota(context *util.Context, userId bson.ObjectId) (err error) {
+	replayConfig := config.Config.Replays
+	if replayConfig.UserLimit <= 0 && replayConfig.UserQuota <= 0 {
+		return
+	}
+
+	replayInfos, err := Replays.GetInfosByUser(context, userId, 0)
+	if err != nil {
+		return
+	}
+
+	size := 0
+	for index, replayInfo := range replayInfos {
+		size += replayInfo.Size
+		if index == 0 {
+			continue
+		}
+
+		if (replayConfig.UserLimit > 0 && index >= replayConfig.UserLimit) || (replayConfig.UserQuota > 0 && size > replayConfig.UserQuota) {
+			if err = replayInfo.Delete(context); err != nil {
+				return
+			}
+		}
+	}
+	return
+}
+
+// delete replays past retention, except the top ranked ones, returning how many were deleted
+func ExpireReplays(context *util.Context) (count int, err error) {
+	replayConfig := config.Config.Replays
+	if replayConfig.Retention.Duration <= 0 {
+		return
+	}
+
+	// top ranked replays are kept
+	var keepIds []bson.ObjectId
+	if replayConfig.KeepTop > 0 {
+		var topInfos []*ReplayInfo
+		if topInfos, err = Replays.GetTopInfos(context, replayConfig.KeepTop); err != nil {
+			return
+		}
+		for _, replayInfo := range topInfos {
+			keepIds = append(keepIds, replayInfo.ID)
+		}
+	}
+
+	before := time.Now().Add(-replayConfig.Retention.Duration)
+	for {
+		var replayInfos []*ReplayInfo
+		if replayInfos, err = Replays.GetExpiredInfos(context, before, keepIds, replayBatchSize); err != nil {
+			return
+		}
+
+		for _, replayInfo := range replayInfos {
+			if err = replayInfo.Delete(context); err != nil {
+				return
+			}
+			count++
+		}
+
+		if len(replayInfos) < replayBatchSize {
+			return
+		}
+	}
+}
+
+// compress legacy (uncompressed) replays, returning how many were migrated
+func MigrateReplays(context *util.Context) (count int, err error) {
+	for {
+		var replayDatas []*ReplayData
+		if replayDatas, err = Replays.GetLegacyDatas(context, replayBatchSize); err != nil {
+			return
+		}
+
+		for _, replayData := range replayDatas {
+			if err = replayData.migrate(context); err != nil {
+				return
+			}
+			count++
+		}
+
+		if len(replayDatas) < replayBatchSize {
+			return
+		}
+	}
+}
+
+func (replayData *ReplayData) migrate(context *util.Context) (err error) {
+	compressed, err := encodeReplayData(replayData.Data)
+	if err != nil {
+		return
+	}
+
+	replayData.Data = ""
+	if err = replayData.setCompressed(context, compressed); err != nil {
+		return
+	}
+	if err = Replays.UpdateData(context, replayData); err != nil {
+		return
+	}
+
+	// count stored size against the user's quota
+	replayInfo, err := Replays.GetInfoById(context, replayData.InfoID)
+	if err == mgo.ErrNotFound {
+		return nil
+	}
+	if err != nil {
+		return
+	}
+
+	replayInfo.Size = len(compressed)
+	err = Replays.UpdateInfo(context, replayInfo)
+	return
+}
+
+// store compressed data inline, or in GridFS when over the inline limit
+func (replayData *ReplayData) setCompressed(context *util.Context, compressed []byte) (err error) {
+	inlineLimit := config.Config.Replays.InlineLimit
+	if inlineLimit > 0 && len(compressed) > inlineLimit {
+		replayData.FileID = bson.NewObjectId()
+		replayData.Compressed = nil
+		err = Replays.InsertFile(context, replayData.FileID, compressed)
+	} else {
+		replayData.Compressed = compressed
+	}
+	return
+}
+
+// decompress stored data into Data
+func (replayData *ReplayData) load(context *util.Context) (err error) {
+	compressed := replayData.Compressed
+	if replayData.FileID.Valid() {
+		if compressed, err = Replays.GetFile(context, replayData.FileID); err != nil {
+			return
+		}
+	}
+
+	// legacy replays are stored uncompressed
+	if len(compressed) == 0 {
+		return
+	}
+
+	replayData.Data, err = decodeReplayData(compressed)
 	return
 }
 
 func GetTopReplays(context *util.Context, userId bson.ObjectId) (replayInfos []*ReplayInfo, err error) {
-	// find replay infos by user ID
-	err = context.DB.C(ReplayInfoCollectionName).Find(nil).Sort("-rk").Limit(5).All(&replayInfos)
+	// find highest ranked replay infos by user ID
+	replayInfos, _, err = SearchReplays(context, &ReplayFilter { UserID: userId }, nil, 5)
 	return
 }
 
 func GetReplayInfosByUser(context *util.Context, userId bson.ObjectId) (replayInfos []*ReplayInfo, err error) {
 	// find replay infos by user ID
-	//err = context.DB.C(ReplayInfoCollectionName).Find(bson.M { "us": userId }).All(&replayInfos)
-	err = context.DB.C(ReplayInfoCollectionName).Find(bson.M { "us": userId }).Sort("-t0").Limit(10).All(&replayInfos)
-	return
+	return Replays.GetInfosByUser(context, userId, 10)
 }
 
 func GetAllReplayInfosByUser(context *util.Context, userId bson.ObjectId) (replayInfos []*ReplayInfo, err error) {
 	// find replay infos by user ID
-	//err = context.DB.C(ReplayInfoCollectionName).Find(bson.M { "us": userId }).All(&replayInfos)
-	err = context.DB.C(ReplayInfoCollectionName).Find(bson.M { "us": userId }).Sort("-t0").All(&replayInfos)
-	return
+	return Replays.GetInfosByUser(context, userId, 0)
 }
 
 func GetLastReplayInfoByUser(context *util.Context, userId bson.ObjectId) (replayInfo *ReplayInfo, err error) {
 	// find last replay info by user ID
-	err = context.DB.C(ReplayInfoCollectionName).Find(bson.M { "us": userId }).Limit(1).Sort("-t0").One(&replayInfo)
+	var replayInfos []*ReplayInfo
+	if replayInfos, err = Replays.GetInfosByUser(context, userId, 1); err == nil {
+		if len(replayInfos) > 0 {
+			replayInfo = replayInfos[0]
+		} else {
+			err = mgo.ErrNotFound
+		}
+	}
 	return
 }
 
+func GetReplayInfosByMatch(context *util.Context, matchId bson.ObjectId) (replayInfos []*ReplayInfo, err error) {
+	return Replays.GetInfosByMatches(context, []bson.ObjectId { matchId })
+}
+
 func GetReplayInfoById(context *util.Context, infoId bson.ObjectId) (replayInfo *ReplayInfo, err error) {
-	err = context.DB.C(ReplayInfoCollectionName).Find(bson.M { "_id": infoId }).One(&replayInfo)
-	return
+	return Replays.GetInfoById(context, infoId)
 }
 
 func GetReplayDataByInfo(context *util.Context, infoId bson.ObjectId) (replayData *ReplayData, err error) {
 	// find replay data by info ID
-	err = context.DB.C(ReplayDataCollectionName).Find(bson.M { "iid": infoId }).One(&replayData)
+	replayData, err = Replays.GetDataByInfo(context, infoId)
+	if err == nil {
+		err = replayData.load(context)
+	}
 	return
 }
 
@@ -119,27 +581,18 @@ func (replayInfo *ReplayInfo) Save(context *util.Context) (err error) {
 	replayInfo.ID = bson.NewObjectId()
 	replayInfo.CreatedAt = time.Now()
 
-	err = context.DB.C(ReplayInfoCollectionName).Insert(replayInfo)
+	err = Replays.InsertInfo(context, replayInfo)
 	return
 }
 
 func (replayData *ReplayData) Save(context *util.Context) (err error) {
 	replayData.ID = bson.NewObjectId()
 
-	err = context.DB.C(ReplayDataCollectionName).Insert(replayData)
+	err = Replays.InsertData(context, replayData)
 	return
 }
 
 func (replayInfo *ReplayInfo) Delete(context *util.Context) (err error) {
-	// delete replay data from database
-	err = context.DB.C(ReplayDataCollectionName).Remove(bson.M { "iid": replayInfo.ID })
-	if err == mgo.ErrNotFound {
-		err = nil
-	}
-	if err != nil {
-		return
-	}
-
-	// delete replay info from database
-	return context.DB.C(ReplayInfoCollectionName).Remove(bson.M{"_id": replayInfo.ID})
+	// delete replay data and info from database
+	return Replays.Delete(context, replayInfo.ID)
 }
@@ -0,0 +1,310 @@
+package models
+
+import (
+	"time"
+
+	"gopkg.in/mgo.v2/bson"
+
+	"bloodtales/data"
+	"bloodtales/util"
+)
+
+// storage for each model (MongoDB, or in memory with memory storage), returning mgo.ErrNotFound for missing documents
+type UserRepository interface {
+	Insert(context *util.Context, user *User) error
+	Save(context *util.Context, user *User) error
+	Delete(context *util.Context, id bson.ObjectId) error
+	GetById(context *util.Context, id bson.ObjectId) (*User, error)
+	GetByDevice(context *util.Context, uuid string) (*User, error)
+	GetByCredentials(context *util.Context, credentials []Credential) (*User, error)
+	GetByTag(context *util.Context, tag string) (*User, error)
+	GetByUsername(context *util.Context, username string) (*User, error)
+	GetByIds(context *util.Context, ids []bson.ObjectId) ([]*User, error)
+	GetAdmins(context *util.Context) ([]*User, error)
+}
+
+type PlayerRepository interface {
+	Save(context *util.Context, player *Player) error
+	Update(context *util.Context, id bson.ObjectId, updates bson.M) error
+	Delete(context *util.Context, id bson.ObjectId) error
+	GetById(context *util.Context, id bson.ObjectId) (*Player, error)
+	GetByUser(context *util.Context, userId bson.ObjectId) (*Player, error)
+	GetByIds(context *util.Context, ids []bson.ObjectId) ([]*Player, error)
+	GetByGuild(context *util.Context, guildId bson.ObjectId) ([]*Player, error)
+	GetAll(context *util.Context) ([]*Player, error)
+
+	// ID order, after the ID (when valid)
+	GetAfter(context *util.Context, afterId bson.ObjectId, limit int) ([]*Player, error)
+
+	// add copies of an owned card (negative to remove, failing when fewer are owned) with other field increments, in one update
+	UpdateCardCount(context *util.Context, id bson.ObjectId, cardId data.DataId, count int, increments bson.M) error
+
+	// remove a donation's copies from the donor like UpdateCardCount, recording the donation in the same update
+	DebitDonation(context *util.Context, donation *CardDonation, increments bson.M) error
+
+	// visit all players in batches from one cursor, loading only the given fields (nil for all)
+	Stream(context *util.Context, fields []string, batchSize int, visit func(players []*Player) error) error
+
+	Count(context *util.Context) (int, error)
+}
+
+type MatchRepository interface {
+	Save(context *util.Context, match *Match) error
+	Delete(context *util.Context, id bson.ObjectId) error
+	GetById(context *util.Context, id bson.ObjectId) (*Match, error)
+	GetByRoom(context *util.Context, roomID string) (*Match, error)
+	GetByPlayer(context *util.Context, playerID bson.ObjectId, states ...MatchState) ([]*Match, error)
+	RemoveByPlayers(context *util.Context, playerIDs []bson.ObjectId, states ...MatchState) error
+
+	// completed matches, newest first, after the cursor ID (when given)
+	GetHistory(context *util.Context, playerID bson.ObjectId, cursor *util.Cursor, limit int) ([]*Match, error)
+}
+
+type GuildRepository interface {
+	Save(context *util.Context, guild *Guild) error
+	Delete(context *util.Context, id bson.ObjectId) error
+	GetById(context *util.Context, id bson.ObjectId) (*Guild, error)
+	GetByTag(context *util.Context, tag string) (*Guild, error)
+	GetByOwner(context *util.Context, ownerId bson.ObjectId) (*Guild, error)
+	GetByIds(context *util.Context, ids []bson.ObjectId) ([]*Guild, error)
+	GetAll(context *util.Context) ([]*Guild, error)
+
+	// case insensitive regular expression
+	FindByName(context *util.Context, pattern string) ([]*Guild, error)
+
+	// atomically add to the guild's progress counters (rating stays at 0 or above), returning the updated guild
+	AddProgress(context *util.Context, id bson.ObjectId, progress GuildProgress) (*Guild, error)
+}
+
+type NotificationRepository interface {
+	Save(context *util.Context, notification *Notification) error
+	Delete(context *util.Context, id bson.ObjectId) error
+	GetById(context *util.Context, id bson.ObjectId) (*Notification, error)
+	GetBySender(context *util.Context, senderId bson.ObjectId) ([]*Notification, error)
+
+	// sent to the player, to everyone or to the guild (when valid), and of the given types (when any)
+	GetByReceiver(context *util.Context, playerId bson.ObjectId, guildId bson.ObjectId, types []string) ([]*Notification, error)
+
+	// remove notifications without actions
+	RemoveViewed(context *util.Context, ids []bson.ObjectId) error
+
+	// set a data value only while it still holds the expected value (mgo.ErrNotFound otherwise)
+	UpdateData(context *util.Context, id bson.ObjectId, key string, expected interface{}, value interface{}) error
+}
+
+type ReplayRepository interface {
+	InsertInfo(context *util.Context, replayInfo *ReplayInfo) error
+	InsertData(context *util.Context, replayData *ReplayData) error
+	UpdateInfo(context *util.Context, replayInfo *ReplayInfo) error
+	UpdateData(context *util.Context, replayData *ReplayData) error
+
+	// chunked storage for large replay data (GridFS)
+	InsertFile(context *util.Context, id bson.ObjectId, data []byte) error
+	GetFile(context *util.Context, id bson.ObjectId) ([]byte, error)
+
+	// delete info, data, file and shares
+	Delete(context *util.Context, infoId bson.ObjectId) error
+	GetInfoById(context *util.Context, infoId bson.ObjectId) (*ReplayInfo, error)
+	GetDataByInfo(context *util.Context, infoId bson.ObjectId) (*ReplayData, error)
+
+	// newest first (limit 0 for all)
+	GetInfosByUser(context *util.Context, userId bson.ObjectId, limit int) ([]*ReplayInfo, error)
+
+	GetInfosByMatches(context *util.Context, matchIds []bson.ObjectId) ([]*ReplayInfo, error)
+
+	// highest rank first
+	GetTopInfos(context *util.Context, limit int) ([]*ReplayInfo, error)
+
+	// created before the time, excluding kept IDs
+	GetExpiredInfos(context *util.Context, before time.Time, keepIds []bson.ObjectId, limit int) ([]*ReplayInfo, error)
+
+	// data stored uncompressed
+	GetLegacyDatas(context *util.Context, limit int) ([]*ReplayData, error)
+
+	// highest rank first, after the cursor (when given)
+	Search(context *util.Context, filter *ReplayFilter, cursor *util.Cursor, limit int) ([]*ReplayInfo, error)
+
+	// guild shares, newest first, after the cursor ID (when given)
+	InsertShare(context *util.Context, replayShare *ReplayShare) error
+	GetSharesByGuild(context *util.Context, guildId bson.ObjectId, cursor *util.Cursor, limit int) ([]*ReplayShare, error)
+}
+
+type SeasonRepository interface {
+	Save(context *util.Context, season *Season) error
+	GetById(context *util.Context, id bson.ObjectId) (*Season, error)
+
+	// newest first
+	GetAll(context *util.Context) ([]*Season, error)
+
+	InsertResult(context *util.Context, result *SeasonResult) error
+	SaveResult(context *util.Context, result *SeasonResult) error
+	GetResult(context *util.Context, seasonId bson.ObjectId, playerId bson.ObjectId) (*SeasonResult, error)
+
+	// newest first
+	GetResultsByPlayer(context *util.Context, playerId bson.ObjectId) ([]*SeasonResult, error)
+
+	// mark claimed, failing when already claimed
+	ClaimResult(context *util.Context, id bson.ObjectId) error
+
+	// undo a claim whose reward could not be granted
+	UnclaimResult(context *util.Context, id bson.ObjectId) error
+}
+
+type DonationRepository interface {
+	// failing with a duplicate key error when another request of the player is marked open
+	InsertRequest(context *util.Context, request *CardRequest) error
+	GetRequestById(context *util.Context, id bson.ObjectId) (*CardRequest, error)
+
+	// clear the open marker of a player's filled or expired requests
+	CloseRequests(context *util.Context, playerId bson.ObjectId, now time.Time) error
+
+	// open at the given time, newest first
+	GetOpenRequestsByGuild(context *util.Context, guildId bson.ObjectId, now time.Time) ([]*CardRequest, error)
+
+	// newest request of a rarity
+	GetLatestRequest(context *util.Context, playerId bson.ObjectId, rarity string) (*CardRequest, error)
+
+	// take a donation's copies from an open request's remaining count, failing when fewer remain
+	// or the donor's copies on the request would exceed the limit
+	ReserveCopies(context *util.Context, donation *CardDonation, limit int, now time.Time) error
+
+	// return a donation's reserved copies, failing when the donation holds no reservation
+	ReleaseCopies(context *util.Context, donation *CardDonation) error
+
+	InsertDonation(context *util.Context, donation *CardDonation) error
+
+	// move a donation between states, failing when not in the expected state
+	SetDonationState(context *util.Context, id bson.ObjectId, from CardDonationState, to CardDonationState) error
+
+	// oldest first
+	GetDonationsByRecipient(context *util.Context, recipientId bson.ObjectId, state CardDonationState) ([]*CardDonation, error)
+
+	// pending donations last updated before the given time
+	GetStalePendingDonations(context *util.Context, before time.Time) ([]*CardDonation, error)
+}
+
+type WarRepository interface {
+	Insert(context *util.Context, war *GuildWar) error
+	GetById(context *util.Context, id bson.ObjectId) (*GuildWar, error)
+
+	// not yet completed, newest first
+	GetOpen(context *util.Context) ([]*GuildWar, error)
+
+	// completed, newest first (limit 0 for all)
+	GetCompleted(context *util.Context, limit int) ([]*GuildWar, error)
+
+	// newest war of a guild
+	GetLatestByGuild(context *util.Context, guildId bson.ObjectId) (*GuildWar, error)
+
+	// add a player's battle against an opponent to the guild's side, adding the player to its participants,
+	// failing when the player reached either battle limit (0 for no limit)
+	AddBattle(context *util.Context, id bson.ObjectId, guildId bson.ObjectId, score int, wins int, playerId bson.ObjectId, opponentId bson.ObjectId, maxBattles int, maxOpponentBattles int) error
+
+	// mark completed with the winning side, failing when already completed
+	Complete(context *util.Context, id bson.ObjectId, winner int, now time.Time) error
+
+	// mark a participant's reward claimed, failing when already claimed
+	ClaimReward(context *util.Context, id bson.ObjectId, playerId bson.ObjectId) error
+
+	// undo a claim whose reward could not be granted
+	UnclaimReward(context *util.Context, id bson.ObjectId, playerId bson.ObjectId) error
+}
+
+type SanctionRepository interface {
+	Insert(context *util.Context, sanction *Sanction) error
+	Save(context *util.Context, sanction *Sanction) error
+	GetById(context *util.Context, id bson.ObjectId) (*Sanction, error)
+
+	// newest first
+	GetByUser(context *util.Context, userId bson.ObjectId) ([]*Sanction, error)
+
+	// not revoked and not expired at the given time
+	GetActive(context *util.Context, userId bson.ObjectId, sanctionType SanctionType, now time.Time) ([]*Sanction, error)
+}
+
+type AuditRepository interface {
+	Insert(context *util.Context, audit *Audit) error
+	GetById(context *util.Context, id bson.ObjectId) (*Audit, error)
+}
+
+type FriendsRepository interface {
+	Save(context *util.Context, friends *Friends) error
+	GetByPlayer(context *util.Context, playerId bson.ObjectId) (*Friends, error)
+}
+
+type TrackingRepository interface {
+	Insert(context *util.Context, tracking *Tracking) error
+	Delete(context *util.Context, id bson.ObjectId) error
+	GetById(context *util.Context, id bson.ObjectId) (*Tracking, error)
+
+	// oldest first
+	GetByUser(context *util.Context, userId bson.ObjectId) ([]Tracking, error)
+}
+
+type SocketRepository interface {
+	Insert(context *util.Context, socketModel *SocketModel) error
+
+	// sent to the user or to everyone after the time, oldest first
+	GetSince(context *util.Context, userId bson.ObjectId, since time.Time) ([]*SocketModel, error)
+}
+
+var (
+	Users          UserRepository
+	Players        PlayerRepository
+	Matches        MatchRepository
+	Guilds         GuildRepository
+	Notifications  NotificationRepository
+	Replays        ReplayRepository
+	Seasons        SeasonRepository
+	Donations      DonationRepository
+	Wars           WarRepository
+	Sanctions      SanctionRepository
+	Audits         AuditRepository
+	FriendLists    FriendsRepository
+	Trackings      TrackingRepository
+	Sockets        SocketRepository
+)
+
+func init() {
+	switch util.Storage {
+	case util.MemoryStorage:
+		ResetMemoryStorage()
+
+	default:
+		Users = mongoUserRepository {}
+		Players = mongoPlayerRepository {}
+		Matches = mongoMatchRepository {}
+		Guilds = mongoGuildRepository {}
+		Notifications = mongoNotificationRepository {}
+		Replays = mongoReplayRepository {}
+		Seasons = mongoSeasonRepository {}
+		Donations = mongoDonationRepository {}
+		Wars = mongoWarRepository {}
+		Sanctions = mongoSanctionRepository {}
+		Audits = mongoAuditRepository {}
+		FriendLists = mongoFriendsRepository {}
+		Trackings = mongoTrackingRepository {}
+		Sockets = mongoSocketRepository {}
+	}
+}
+
+// use empty in-memory repositories and cache (e.g. between tests)
+func ResetMemoryStorage() {
+	Users = &memoryUserRepository { documents: newMemoryCollection() }
+	Players = &memoryPlayerRepository { documents: newMemoryCollection() }
+	Matches = &memoryMatchRepository { documents: newMemoryCollection() }
+	Guilds = &memoryGuildRepository { documents: newMemoryCollection() }
+	Notifications = &memoryNotificationRepository { documents: newMemoryCollection() }
+	Replays = &memoryReplayRepository { infos: newMemoryCollection(), datas: newMemoryCollection(), files: newMemoryCollection(), shares: newMemoryCollection() }
+	Seasons = &memorySeasonRepository { seasons: newMemoryCollection(), results: newMemoryCollection() }
+	Donations = &memoryDonationRepository { requests: newMemoryCollection(), donations: newMemoryCollection() }
+	Wars = &memoryWarRepository { documents: newMemoryCollection() }
+	Sanctions = &memorySanctionRepository { documents: newMemoryCollection() }
+	Audits = &memoryAuditRepository { documents: newMemoryCollection() }
+	FriendLists = &memoryFriendsRepository { documents: newMemoryCollection() }
+	Trackings = &memoryTrackingRepository { documents: newMemoryCollection() }
+	Sockets = &memorySocketRepository { documents: newMemoryCollection() }
+
+	util.ResetMemoryCache()
+	util.ResetMemoryFaults()
+}
@@ -0,0 +1,152 @@
+package models
+
+// admin role
+type AdminRole string
+const (
+	RoleNone       AdminRole = ""
+	RoleViewer     AdminRole = "viewer"
+	RoleSupport    AdminRole = "support"
+	RoleLiveOps    AdminRole = "live-ops"
+	RoleSuperAdmin AdminRole = "superadmin"
+)
+
+// admin action permission
+type AdminPermission string
+const (
+	PermissionNone               AdminPermission = ""
+	PermissionViewDashboard      AdminPermission = "dashboard.view"
+	PermissionViewUsers          AdminPermission = "users.view"
+	PermissionEditUsers          AdminPermission = "users.edit"
+	PermissionResetUsers         AdminPermission = "users.reset"
+	PermissionDeleteUsers        AdminPermission = "users.delete"
+	PermissionViewGuilds         AdminPermission = "guilds.view"
+	PermissionEditGuilds         AdminPermission = "guilds.edit"
+	PermissionDeleteGuilds       AdminPermission = "guilds.delete"
+	PermissionViewMatches        AdminPermission = "matches.view"
+	PermissionEditMatches        AdminPermission = "matches.edit"
+	PermissionDeleteMatches      AdminPermission = "matches.delete"
+	PermissionEditCards          AdminPermission = "cards.edit"
+	PermissionDeleteCards        AdminPermission = "cards.delete"
+	PermissionRefreshLeaderboard AdminPermission = "leaderboard.refresh"
+	PermissionMaintainReplays    AdminPermission = "replays.maintain"
+	PermissionManageSeasons      AdminPermission = "seasons.manage"
+	PermissionManageWars         AdminPermission = "wars.manage"
+	PermissionViewTrackings      AdminPermission = "trackings.view"
+	PermissionDeleteTrackings    AdminPermission = "trackings.delete"
+	PermissionViewFaults         AdminPermission = "faults.view"
+	PermissionDeleteFaults       AdminPermission = "faults.delete"
+	PermissionManageRoles        AdminPermission = "roles.manage"
+	PermissionViewAudits         AdminPermission = "audits.view"
+	PermissionExportAudits       AdminPermission = "audits.export"
+	PermissionEditSanctions      AdminPermission = "sanctions.edit"
+	PermissionDebug              AdminPermission = "debug.use"
+	PermissionProfile            AdminPermission = "debug.profile"
+)
+
+// all roles, ordered from least to most privileged
+var AdminRoles []AdminRole = []AdminRole {
+	RoleViewer,
+	RoleSupport,
+	RoleLiveOps,
+	RoleSuperAdmin,
+}
+
+// all permissions, in display order
+var AdminPermissions []AdminPermission = []AdminPermission {
+	PermissionViewDashboard,
+	PermissionViewUsers,
+	PermissionEditUsers,
+	PermissionResetUsers,
+	PermissionDeleteUsers,
+	PermissionViewGuilds,
+	PermissionEditGuilds,
+	PermissionDeleteGuilds,
+	PermissionViewMatches,
+	PermissionEditMatches,
+	PermissionDeleteMatches,
+	PermissionEditCards,
+	PermissionDeleteCards,
+	PermissionRefreshLeaderboard,
+	PermissionMaintainReplays,
+	PermissionManageSeasons,
+	PermissionManageWars,
+	PermissionViewTrackings,
+	PermissionDeleteTrackings,
+	PermissionViewFaults,
+	PermissionDeleteFaults,
+	PermissionManageRoles,
+	PermissionViewAudits,
+	PermissionExportAudits,
+	PermissionEditSanctions,
+	PermissionDebug,
+	PermissionProfile,
+}
+
+var (
+	// internal
+	rolePermissions map[AdminRole][]AdminPermission
+)
+
+func init() {
+	viewer := []AdminPermission {
+		PermissionViewDashboard,
+		PermissionViewUsers,
+		PermissionViewGuilds,
+		PermissionViewMatches,
+		PermissionViewTrackings,
+		PermissionViewFaults,
+	}
+
+	// support can fix up individual players, guilds and matches
+	support := append(append([]AdminPermission {}, viewer...),
+		PermissionEditUsers,
+		PermissionEditGuilds,
+		PermissionEditMatches,
+		PermissionEditSanctions,
+	)
+
+	// live-ops can change content and run bulk operations
+	liveOps := append(append([]AdminPermission {}, support...),
+		PermissionResetUsers,
+		PermissionDeleteMatches,
+		PermissionEditCards,
+		PermissionDeleteCards,
+		PermissionRefreshLeaderboard,
+		PermissionMaintainReplays,
+		PermissionManageSeasons,
+		PermissionManageWars,
+		PermissionDeleteTrackings,
+		PermissionDeleteFaults,
+		PermissionViewAudits,
+		PermissionDebug,
+	)
+
+	rolePermissions = map[AdminRole][]AdminPermission {
+		RoleViewer: viewer,
+		RoleSupport: support,
+		RoleLiveOps: liveOps,
+		RoleSuperAdmin: AdminPermissions,
+	}
+}
+
+func IsValidAdminRole(role AdminRole) bool {
+	_, ok := rolePermissions[role]
+	return ok
+}
+
+func (role AdminRole) HasPermission(permission AdminPermission) bool {
+	if permission == PermissionNone {
+		return true
+	}
+
+	for _, rolePermission := range rolePermissions[role] {
+		if rolePermission == permission {
+			return true
+		}
+	}
+	return false
+}
+
+func (role AdminRole) GetPermissions() []AdminPermission {
+	return rolePermissions[role]
+}
@@ -0,0 +1,172 @@
+package models
+
+import (
+	"fmt"
+	"time"
+
+	"gopkg.in/mgo.v2"
+	"gopkg.in/mgo.v2/bson"
+
+	"bloodtales/util"
+)
+
+const SanctionCollectionName = "sanctions"
+
+// sanction type
+type SanctionType int
+const (
+	SanctionBan SanctionType = iota
+	SanctionMatchmakingBan
+	SanctionChatMute
+)
+
+// all sanction types, in display order
+var SanctionTypes []SanctionType = []SanctionType {
+	SanctionBan,
+	SanctionMatchmakingBan,
+	SanctionChatMute,
+}
+
+// server model
+type Sanction struct {
+	ID              bson.ObjectId `bson:"_id,omitempty" json:"-"`
+	UserID          bson.ObjectId `bson:"us" json:"-"`
+	Type            SanctionType  `bson:"tp" json:"-"`
+	Reason          string        `bson:"rs" json:"-"`
+	IssuerID        bson.ObjectId `bson:"is,omitempty" json:"-"`
+	IssuerName      string        `bson:"in,omitempty" json:"-"`
+	CreatedTime     time.Time     `bson:"t0" json:"-"`
+	ExpireTime      time.Time     `bson:"exp,omitempty" json:"-"` // zero time is permanent
+	RevokedTime     time.Time     `bson:"rv,omitempty" json:"-"`
+	RevokerID       bson.ObjectId `bson:"rvi,omitempty" json:"-"`
+}
+
+// client model
+type SanctionClient struct {
+	Type            string        `json:"type"`
+	Reason          string        `json:"reason"`
+	Permanent       bool          `json:"permanent"`
+	ExpireTime      int64         `json:"expires,omitempty"` // unix time
+}
+
+func ensureIndexSanction(database *mgo.Database) {
+	c := database.C(SanctionCollectionName)
+
+	// user and type index
+	util.Must(c.EnsureIndex(mgo.Index {
+		Key:          []string { "us", "tp" },
+		Background:   true,
+	}))
+}
+
+func GetSanctionType(name string) (SanctionType, error) {
+	switch name {
+	case "Ban":
+		return SanctionBan, nil
+	case "MatchmakingBan":
+		return SanctionMatchmakingBan, nil
+	case "ChatMute":
+		return SanctionChatMute, nil
+	default:
+		return SanctionBan, util.NewError(fmt.Sprintf("Invalid sanction type: %s", name))
+	}
+}
+
+func GetSanctionTypeName(sanctionType SanctionType) string {
+	switch sanctionType {
+	default:
+		return "Invalid"
+	case SanctionBan:
+		return "Ban"
+	case SanctionMatchmakingBan:
+		return "MatchmakingBan"
+	case SanctionChatMute:
+		return "ChatMute"
+	}
+}
+
+func InsertSanction(context *util.Context, userID bson.ObjectId, sanctionType SanctionType, reason string, duration time.Duration, issuer *User) (sanction *Sanction, err error) {
+	sanction = &Sanction {
+		ID: bson.NewObjectId(),
+		UserID: userID,
+		Type: sanctionType,
+		Reason: reason,
+		CreatedTime: time.Now(),
+	}
+
+	// non-positive duration is permanent
+	if duration > 0 {
+		sanction.ExpireTime = sanction.CreatedTime.Add(duration)
+	}
+
+	if issuer != nil {
+		sanction.IssuerID = issuer.ID
+		sanction.IssuerName = issuer.Username
+	}
+
+	err = Sanctions.Insert(context, sanction)
+	return
+}
+
+func GetSanctionById(context *util.Context, id bson.ObjectId) (sanction *Sanction, err error) {
+	return Sanctions.GetById(context, id)
+}
+
+// get all sanctions ever issued to a user, newest first
+func GetSanctionsByUser(context *util.Context, userID bson.ObjectId) (sanctions []*Sanction, err error) {
+	return Sanctions.GetByUser(context, userID)
+}
+
+// get the longest lasting active sanction of a type for a user (nil if none)
+func GetActiveSanction(context *util.Context, userID bson.ObjectId, sanctionType SanctionType) (sanction *Sanction, err error) {
+	sanctions, err := Sanctions.GetActive(context, userID, sanctionType, time.Now())
+	if err != nil {
+		return
+	}
+
+	for _, active := range sanctions {
+		if sanction == nil || active.IsPermanent() || (!sanction.IsPermanent() && active.ExpireTime.After(sanction.ExpireTime)) {
+			sanction = active
+		}
+	}
+	return
+}
+
+func (sanction *Sanction) IsPermanent() bool {
+	return sanction.ExpireTime.IsZero()
+}
+
+func (sanction *Sanction) IsActive() bool {
+	return sanction.IsActiveAt(time.Now())
+}
+
+func (sanction *Sanction) IsActiveAt(now time.Time) bool {
+	return sanction.RevokedTime.IsZero() && (sanction.IsPermanent() || now.Before(sanction.ExpireTime))
+}
+
+func (sanction *Sanction) GetTypeName() string {
+	return GetSanctionTypeName(sanction.Type)
+}
+
+func (sanction *Sanction) Revoke(context *util.Context, revoker *User) (err error) {
+	sanction.RevokedTime = time.Now()
+	if revoker != nil {
+		sanction.RevokerID = revoker.ID
+	}
+
+	err = Sanctions.Save(context, sanction)
+	return
+}
+
+func (sanction *Sanction) GetSanctionClient() *SanctionClient {
+	client := &SanctionClient {
+		Type: sanction.GetTypeName(),
+		Reason: sanction.Reason,
+		Permanent: sanction.IsPermanent(),
+	}
+
+	if !sanction.IsPermanent() {
+		client.ExpireTime = sanction.ExpireTime.Unix()
+	}
+	return client
+}
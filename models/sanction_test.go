@@ -0,0 +1,32 @@
+package models
+
+import (
+	"testing"
+)
+
+func TestGetSanctionType(t *testing.T) {
+	tests := []struct {
+		name          string
+		sanctionType  SanctionType
+		valid         bool
+	}{
+		{"Ban", SanctionBan, true},
+		{"MatchmakingBan", SanctionMatchmakingBan, true},
+		{"ChatMute", SanctionChatMute, true},
+		{"", 0, false},
+		{"Mute", 0, false},
+	}
+
+	for _, test := range tests {
+		sanctionType, err := GetSanctionType(test.name)
+		if !test.valid {
+			if err == nil {
+				t.Errorf("GetSanctionType(%q) = %v, want an error", test.name, sanctionType)
+			}
+			continue
+		}
+		if err != nil || sanctionType != test.sanctionType {
+			t.Errorf("GetSanctionType(%q) = %v (%v), want %v", test.name, sanctionType, err, test.sanctionType)
+		}
+	}
+}
@@ -0,0 +1,308 @@
+package models
+
+import (
+	"fmt"
+	"time"
+
+	"gopkg.in/mgo.v2"
+	"gopkg.in/mgo.v2/bson"
+
+	"bloodtales/config"
+	"bloodtales/data"
+	"bloodtales/util"
+)
+
+const SeasonCollectionName = "seasons"
+const SeasonResultCollectionName = "seasonResults"
+
+// players processed per rollover batch (progress is saved after each)
+const seasonRolloverBatchSize = 100
+
+// competitive season
+type Season struct {
+	ID              bson.ObjectId  `bson:"_id,omitempty" json:"id"`
+	Number          int            `bson:"n" json:"number"`
+	Name            string         `bson:"nm" json:"name"`
+	StartTime       time.Time      `bson:"t0" json:"start"`
+	EndTime         time.Time      `bson:"t1" json:"end"`
+
+	// rollover progress, players are processed in ID order
+	RolloverStart   time.Time      `bson:"rs,omitempty" json:"-"`
+	RolloverEnd     time.Time      `bson:"re,omitempty" json:"-"`
+	RolloverPlayer  bson.ObjectId  `bson:"rp,omitempty" json:"-"` // last processed player
+	RolloverCount   int            `bson:"rc" json:"-"`
+}
+
+// player's final standing in a season, archived at rollover
+type SeasonResult struct {
+	ID              bson.ObjectId  `bson:"_id,omitempty" json:"-"`
+	SeasonID        bson.ObjectId  `bson:"sn" json:"seasonId"`
+	SeasonNumber    int            `bson:"n" json:"season"`
+	PlayerID        bson.ObjectId  `bson:"pl" json:"-"`
+	League          data.League    `bson:"lg" json:"league"`
+	RankPoints      int            `bson:"rk" json:"rankPoints"`
+	Rating          int            `bson:"rt" json:"rating"`
+	Place           int            `bson:"pc" json:"place"`
+	WinCount        int            `bson:"wc" json:"winCount"`
+	LossCount       int            `bson:"lc" json:"lossCount"`
+	MatchCount      int            `bson:"mc" json:"matchCount"`
+	CreatedAt       time.Time      `bson:"t0" json:"-"`
+	Applied         bool           `bson:"ap" json:"-"` // soft reset applied to the player
+	Claimed         bool           `bson:"cl" json:"claimed"`
+}
+
+func ensureIndexSeason(database *mgo.Database) {
+	c := database.C(SeasonCollectionName)
+
+	// number index
+	util.Must(c.EnsureIndex(mgo.Index {
+		Key:        []string { "n" },
+		Unique:     true,
+		Background: true,
+	}))
+
+	c = database.C(SeasonResultCollectionName)
+
+	// season/player index
+	util.Must(c.EnsureIndex(mgo.Index {
+		Key:        []string { "sn", "pl" },
+		Unique:     true,
+		Background: true,
+	}))
+
+	// player index
+	util.Must(c.EnsureIndex(mgo.Index {
+		Key:        []string { "pl", "-n" },
+		Background: true,
+	}))
+}
+
+func GetSeasons(context *util.Context) (seasons []*Season, err error) {
+	return Seasons.GetAll(context)
+}
+
+func GetSeasonById(context *util.Context, id bson.ObjectId) (season *Season, err error) {
+	return Seasons.GetById(context, id)
+}
+
+// season running now (nil between seasons)
+func GetCurrentSeason(context *util.Context) (current *Season, err error) {
+	seasons, err := Seasons.GetAll(context)
+	if err != nil {
+		return
+	}
+
+	now := time.Now()
+	for _, season := range seasons {
+		if season.IsActive(now) {
+			current = season
+			return
+		}
+	}
+	return
+}
+
+// schedule a season after the existing ones
+func CreateSeason(context *util.Context, name string, start time.Time, end time.Time) (season *Season, err error) {
+	if !end.After(start) {
+		err = util.NewError("Season must end after it starts")
+		return
+	}
+
+	seasons, err := Seasons.GetAll(context)
+	if err != nil {
+		return
+	}
+
+	number := 1
+	if len(seasons) > 0 {
+		last := seasons[0]
+		if start.Before(last.EndTime) {
+			err = util.NewError(fmt.Sprintf("Season must start after season %d ends (%v)", last.Number, last.EndTime))
+			return
+		}
+		number = last.Number + 1
+	}
+
+	season = &Season {
+		ID: bson.NewObjectId(),
+		Number: number,
+		Name: name,
+		StartTime: start,
+		EndTime: end,
+	}
+	err = season.Save(context)
+	return
+}
+
+func (season *Season) Save(context *util.Context) error {
+	return Seasons.Save(context, season)
+}
+
+func (season *Season) IsActive(now time.Time) bool {
+	return !now.Before(season.StartTime) && now.Before(season.EndTime)
+}
+
+func (season *Season) IsRolledOver() bool {
+	return !season.RolloverEnd.IsZero()
+}
+
+// archive every player's standing, soft reset their rank points and rating and reset the leaderboard.
+// Progress is saved per batch and players already archived are skipped, so an interrupted rollover
+// continues where it stopped when run again. Returns the number of players processed by this run.
+func (season *Season) Rollover(context *util.Context) (count int, err error) {
+	if season.IsRolledOver() {
+		return
+	}
+	if time.Now().Before(season.EndTime) {
+		err = util.NewError(fmt.Sprintf("Season %d has not ended yet", season.Number))
+		return
+	}
+
+	if season.RolloverStart.IsZero() {
+		season.RolloverStart = time.Now()
+		if err = season.Save(context); err != nil {
+			return
+		}
+	}
+
+	for {
+		var players []*Player
+		if players, err = Players.GetAfter(context, season.RolloverPlayer, seasonRolloverBatchSize); err != nil {
+			return
+		}
+
+		for _, player := range players {
+			if err = season.rolloverPlayer(context, player); err != nil {
+				return
+			}
+		}
+
+		if len(players) > 0 {
+			count += len(players)
+			season.RolloverPlayer = players[len(players) - 1].ID
+			season.RolloverCount += len(players)
+			if err = season.Save(context); err != nil {
+				return
+			}
+		}
+
+		if len(players) < seasonRolloverBatchSize {
+			break
+		}
+	}
+
+	// places are by season results, so start the leaderboards over
+	ResetLeaderboards(context)
+
+	season.RolloverEnd = time.Now()
+	err = season.Save(context)
+	return
+}
+
+func (season *Season) rolloverPlayer(context *util.Context, player *Player) (err error) {
+	// archive final standing (once, the soft reset is applied from the archived values)
+	result, err := Seasons.GetResult(context, season.ID, player.ID)
+	if err == mgo.ErrNotFound {
+		result = &SeasonResult {
+			ID: bson.NewObjectId(),
+			SeasonID: season.ID,
+			SeasonNumber: season.Number,
+			PlayerID: player.ID,
+			League: player.GetLeague(),
+			RankPoints: player.RankPoints,
+			Rating: player.Rating,
+			Place: player.GetLeaderboardPlace(context),
+			WinCount: player.SeasonWinCount,
+			LossCount: player.SeasonLossCount,
+			MatchCount: player.SeasonMatchCount,
+			CreatedAt: time.Now(),
+		}
+		err = Seasons.InsertResult(context, result)
+	}
+	if err != nil || result.Applied {
+		return
+	}
+
+	// soft reset by final league
+	rules := config.Config.Seasons.GetLeague(int(result.League))
+	err = Players.Update(context, player.ID, bson.M {
+		"rk": softReset(result.RankPoints, rules.RankPoints, rules.RankPointsKeep),
+		"rt": softReset(result.Rating, rules.Rating, rules.RatingKeep),
+		"sw": 0,
+		"sl": 0,
+		"sm": 0,
+	})
+	if err != nil {
+		return
+	}
+
+	result.Applied = true
+	err = Seasons.SaveResult(context, result)
+	return
+}
+
+// move values above the target towards it, keeping a fraction of the difference
+func softReset(value int, target int, keep float64) int {
+	if value <= target {
+		return value
+	}
+	return target + int(float64(value - target) * keep)
+}
+
+// season results of a player, newest first
+func GetSeasonResults(context *util.Context, playerId bson.ObjectId) (results []*SeasonResult, err error) {
+	return Seasons.GetResultsByPlayer(context, playerId)
+}
+
+// grant the league reward of an archived season result, once
+func (player *Player) ClaimSeasonReward(context *util.Context, seasonId bson.ObjectId) (rewards []*Reward, err error) {
+	result, err := Seasons.GetResult(context, seasonId, player.ID)
+	if err != nil {
+		return
+	}
+	if result.Claimed {
+		err = util.NewError(fmt.Sprintf("Season %d reward already claimed", result.SeasonNumber))
+		return
+	}
+
+	// mark claimed first, so concurrent claims cannot both grant
+	if err = Seasons.ClaimResult(context, result.ID); err != nil {
+		return
+	}
+
+	// release the claim when the reward is not granted, so it can be claimed again
+	defer func() {
+		if err != nil {
+			if unclaimErr := Seasons.UnclaimResult(context, result.ID); unclaimErr != nil {
+				context.Log().Errorf("Failed to release season %d claim for player %s: %v", result.SeasonNumber, player.ID.Hex(), unclaimErr)
+			}
+		}
+	}()
+
+	rules := config.Config.Seasons.GetLeague(int(result.League))
+	if rules.Reward != "" {
+		tier := 1
+		if rankData := data.GetRank(result.RankPoints); rankData != nil {
+			tier = rankData.GetTier()
+		}
+		rewards = append(rewards, player.GetReward(data.ToDataId(rules.Reward), result.League, tier))
+	}
+	if rules.StandardCurrency > 0 || rules.PremiumCurrency > 0 {
+		rewards = append(rewards, &Reward {
+			Type: data.RewardType_StandardCurrency,
+			StandardCurrency: rules.StandardCurrency,
+			PremiumCurrency: rules.PremiumCurrency,
+		})
+	}
+
+	for _, reward := range rewards {
+		if err = player.AddRewards(reward, nil); err != nil {
+			return
+		}
+	}
+	player.SetDirty(PlayerDataMask_Currency, PlayerDataMask_Cards)
+
+	err = player.Save(context)
+	return
+}
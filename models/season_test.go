@@ -0,0 +1,155 @@
+package models
+
+import (
+	"time"
+	"testing"
+
+	"bloodtales/config"
+	"bloodtales/util"
+)
+
+// one set of season rules for every league, restored when the test ends
+func useTestSeasonRules(t *testing.T) {
+	rules := config.Config.Seasons
+	t.Cleanup(func() {
+		config.Config.Seasons = rules
+	})
+
+	config.Config.Seasons.Leagues = []config.SeasonLeagueConfiguration {
+		config.SeasonLeagueConfiguration { RankPoints: 10, RankPointsKeep: 0.5, Rating: 1200, RatingKeep: 0.5, StandardCurrency: 100 },
+	}
+}
+
+// saved player with the given standing and season counters
+func newTestSeasonPlayer(t *testing.T, context *util.Context, rankPoints int, rating int, wins int) *Player {
+	player := newTestPlayer(t, context)
+	player.RankPoints = rankPoints
+	player.Rating = rating
+	player.SeasonWinCount = wins
+	player.SeasonMatchCount = wins
+	player.StandardCurrency = 50
+	if err := player.Save(context); err != nil {
+		t.Fatalf("Failed to save player: %v", err)
+	}
+	return player
+}
+
+func TestSeasonRollover(t *testing.T) {
+	useTestSeasonRules(t)
+	context := newTestContext()
+
+	now := time.Now()
+	season, err := CreateSeason(context, "Test Season", now.Add(-2 * time.Hour), now.Add(time.Hour))
+	if err != nil {
+		t.Fatalf("Failed to create season: %v", err)
+	}
+	if _, err = season.Rollover(context); err == nil {
+		t.Errorf("Rolled over a season that has not ended")
+	}
+	season.EndTime = now.Add(-time.Hour)
+
+	tests := []struct {
+		name        string
+		rankPoints  int
+		rating      int
+		wins        int
+		resetRank   int
+		resetRating int
+	}{
+		{"above the targets", 30, 1600, 4, 20, 1400},
+		{"below the targets", 5, 1000, 1, 5, 1000},
+		{"interrupted", 50, 2000, 2, 30, 1600},
+	}
+	players := make([]*Player, len(tests))
+	for i, test := range tests {
+		players[i] = newTestSeasonPlayer(t, context, test.rankPoints, test.rating, test.wins)
+	}
+
+	// a rollover stopping after resetting a player before saving progress must not reset it again
+	if err = season.rolloverPlayer(context, players[2]); err != nil {
+		t.Fatalf("Failed to roll over player: %v", err)
+	}
+
+	count, err := season.Rollover(context)
+	if err != nil || count != len(players) {
+		t.Fatalf("Rollover = %d (%v), want %d", count, err, len(players))
+	}
+	if !season.IsRolledOver() || season.RolloverCount != len(players) {
+		t.Errorf("Season rollover ended %v with %d players", season.RolloverEnd, season.RolloverCount)
+	}
+	if count, err = season.Rollover(context); err != nil || count != 0 {
+		t.Errorf("Second rollover = %d (%v), want nothing", count, err)
+	}
+
+	for i, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			player := reloadTestPlayer(t, context, players[i])
+			if player.RankPoints != test.resetRank || player.Rating != test.resetRating {
+				t.Errorf("Reset to %d rank points and %d rating, want %d and %d", player.RankPoints, player.Rating, test.resetRank, test.resetRating)
+			}
+			if player.SeasonWinCount != 0 || player.SeasonMatchCount != 0 {
+				t.Errorf("Season counters = %d/%d, want them cleared", player.SeasonWinCount, player.SeasonMatchCount)
+			}
+			if player.StandardCurrency != 50 || len(player.Cards) != len(players[i].Cards) {
+				t.Errorf("Rollover changed more than the standing")
+			}
+
+			results, err := GetSeasonResults(context, player.ID)
+			if err != nil || len(results) != 1 {
+				t.Fatalf("Season results = %v (%v), want one", results, err)
+			}
+			result := results[0]
+			if result.SeasonNumber != season.Number || result.RankPoints != test.rankPoints || result.Rating != test.rating || result.WinCount != test.wins || !result.Applied {
+				t.Errorf("Archived %+v, want %d rank points, %d rating and %d wins", result, test.rankPoints, test.rating, test.wins)
+			}
+
+			// the reward is granted once
+			if _, err = player.ClaimSeasonReward(context, season.ID); err != nil {
+				t.Fatalf("Failed to claim season reward: %v", err)
+			}
+			if _, err = reloadTestPlayer(t, context, player).ClaimSeasonReward(context, season.ID); err == nil {
+				t.Errorf("Claimed a season reward twice")
+			}
+			if currency := reloadTestPlayer(t, context, player).StandardCurrency; currency != 150 {
+				t.Errorf("Standard currency = %d, want 150", currency)
+			}
+		})
+	}
+}
+
+func TestClaimSeasonRewardReleasedOnFailure(t *testing.T) {
+	useTestSeasonRules(t)
+	context := newTestContext()
+
+	now := time.Now()
+	season, err := CreateSeason(context, "Test Season", now.Add(-2 * time.Hour), now.Add(-time.Hour))
+	if err != nil {
+		t.Fatalf("Failed to create season: %v", err)
+	}
+	player := newTestSeasonPlayer(t, context, 30, 1600, 1)
+	if _, err = season.Rollover(context); err != nil {
+		t.Fatalf("Failed to roll over season: %v", err)
+	}
+
+	// the player save fails, so the claim is released
+	Players = failingPlayerRepository { Players }
+	_, err = reloadTestPlayer(t, context, player).ClaimSeasonReward(context, season.ID)
+	Players = Players.(failingPlayerRepository).PlayerRepository
+	if err == nil {
+		t.Fatalf("Claimed a season reward without saving the player")
+	}
+	result, err := Seasons.GetResult(context, season.ID, player.ID)
+	if err != nil {
+		t.Fatalf("Failed to get season result: %v", err)
+	}
+	if result.Claimed {
+		t.Fatalf("Season result still claimed after a failed claim")
+	}
+
+	if _, err = reloadTestPlayer(t, context, player).ClaimSeasonReward(context, season.ID); err != nil {
+		t.Fatalf("Failed to claim season reward after a failed claim: %v", err)
+	}
+	if currency := reloadTestPlayer(t, context, player).StandardCurrency; currency != 150 {
+		t.Errorf("Standard currency = %d, want 150", currency)
+	}
+}
@@ -0,0 +1,55 @@
+package models
+
+import (
+	"time"
+
+	"gopkg.in/mgo.v2"
+	"gopkg.in/mgo.v2/bson"
+
+	"bloodtales/util"
+)
+
+const SocketCollectionName = "sockets"
+
+// socket message kept for polling clients
+type SocketModel struct {
+	ID              bson.ObjectId			`bson:"_id,omitempty" json:"-"`
+	CreatedAt       time.Time				`bson:"t0" json:"-"`
+	ExpiresAt       time.Time				`bson:"exp" json:"-"`
+	UserID          bson.ObjectId			`bson:"us,omitempty" json:"-"`
+	Message         string					`bson:"ms" json:"message"`
+	Data            map[string]interface{}  `bson:"-" json:"data"`
+	JsonData        string					`bson:"dt" json:"-"`
+}
+
+func ensureIndexSocket(database *mgo.Database) {
+	c := database.C(SocketCollectionName)
+
+	// user index
+	util.Must(c.EnsureIndex(mgo.Index {
+		Key:        []string { "us", "t0" },
+		Background: true,
+		Sparse:     true,
+	}))
+
+	// expiration
+	util.Must(c.EnsureIndex(mgo.Index{
+		Key:         []string { "exp" },
+		Background:  true,
+		ExpireAfter: time.Second,
+	}))
+}
+
+func (socketModel *SocketModel) Insert(context *util.Context) (err error) {
+	socketModel.ID = bson.NewObjectId()
+	socketModel.CreatedAt = time.Now()
+	socketModel.ExpiresAt = time.Now().Add(time.Hour * time.Duration(24))
+
+	err = Sockets.Insert(context, socketModel)
+	return
+}
+
+// messages sent to the user or to everyone after the time, oldest first
+func GetSocketModelsSince(context *util.Context, userId bson.ObjectId, since time.Time) (socketModels []*SocketModel, err error) {
+	return Sockets.GetSince(context, userId, since)
+}
@@ -204,6 +204,8 @@ func (player *Player) OpenTome(tome *Tome) (reward *Reward) {
 
 	reward = player.GetReward(tomeData.RewardID, tome.League, player.GetLevel())
 
+	MetricTomesOpened.Inc(tomeData.Name)
+
 	tome.Clear()
 
 	return
@@ -297,7 +299,13 @@ func (player *Player) ClaimGuildTome(context *util.Context) (tomeReward *Reward,
 
 	var guild *Guild
 	guild, err = GetGuildById(context, player.GuildID)
+	if err != nil {
+		return
+	}
+
+	// bigger guilds and higher guild levels give more
 	multiplier := 1 + (float64(guild.MemberCount) / float64(data.GameplayConfig.GuildMemberLimit))
+	multiplier *= guild.GetLevelData().TomeMultiplier
 
 	tomeReward = player.GetReward(data.ToDataId("TOME_GUILD_REWARD"), player.GetLeague(), player.GetLevel())
 
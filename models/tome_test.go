@@ -0,0 +1,85 @@
+package models
+
+import (
+	"time"
+	"testing"
+
+	"bloodtales/data"
+	"bloodtales/util"
+)
+
+func TestOpenTome(t *testing.T) {
+	tests := []struct {
+		name        string
+		tomeID      string
+		league      data.League
+		cards       int
+		minStandard int
+		maxStandard int
+		minPremium  int
+		maxPremium  int
+	}{
+		{"common", "TOME_COMMON", data.LeagueOne, 10, 20, 30, 0, 0},
+		{"rare", "TOME_RARE", data.LeagueOne, 20, 60, 80, 0, 0},
+		{"epic", "TOME_EPIC", data.LeagueOne, 40, 150, 200, 2, 4},
+		{"common in a higher league", "TOME_COMMON", data.LeagueTwo, 15, 30, 45, 0, 0},
+		{"epic in a higher league", "TOME_EPIC", data.LeagueTwo, 60, 225, 300, 2, 4},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			context := newTestContext()
+			player := newTestPlayer(t, context)
+			standardCurrency, premiumCurrency := player.StandardCurrency, player.PremiumCurrency
+
+			player.Tomes[0] = Tome {
+				DataID: data.ToDataId(test.tomeID),
+				State: TomeLocked,
+				League: test.league,
+			}
+
+			// unlock, then let the unlock time pass
+			player.StartUnlocking(0)
+			if player.ActiveTome.State != TomeUnlocking || player.Tomes[0].State != TomeEmpty {
+				t.Fatalf("Tome did not start unlocking: %v %v", player.ActiveTome, player.Tomes[0])
+			}
+			player.ActiveTome.UnlockTime = util.TimeToTicks(time.Now().Add(-time.Second))
+			player.ActiveTome.UpdateTome()
+			if player.ActiveTome.State != TomeUnlocked {
+				t.Fatalf("Tome state = %s, want unlocked", player.ActiveTome.GetStateName())
+			}
+
+			reward, err := player.AddTomeRewards(context, &player.ActiveTome)
+			if err != nil {
+				t.Fatalf("Failed to open tome: %v", err)
+			}
+
+			if count := countRewardCards(reward); count != test.cards {
+				t.Errorf("Rewarded %d cards, want %d", count, test.cards)
+			}
+			if reward.StandardCurrency < test.minStandard || reward.StandardCurrency > test.maxStandard {
+				t.Errorf("Rewarded %d standard currency, want %d-%d", reward.StandardCurrency, test.minStandard, test.maxStandard)
+			}
+			if reward.PremiumCurrency < test.minPremium || reward.PremiumCurrency > test.maxPremium {
+				t.Errorf("Rewarded %d premium currency, want %d-%d", reward.PremiumCurrency, test.minPremium, test.maxPremium)
+			}
+
+			stored := reloadTestPlayer(t, context, player)
+			if stored.ActiveTome.State != TomeEmpty {
+				t.Errorf("Opened tome state = %s, want empty", stored.ActiveTome.GetStateName())
+			}
+			if stored.StandardCurrency != standardCurrency + reward.StandardCurrency + reward.OverflowCurrency {
+				t.Errorf("Standard currency = %d, want %d", stored.StandardCurrency, standardCurrency + reward.StandardCurrency + reward.OverflowCurrency)
+			}
+			if stored.PremiumCurrency != premiumCurrency + reward.PremiumCurrency {
+				t.Errorf("Premium currency = %d, want %d", stored.PremiumCurrency, premiumCurrency + reward.PremiumCurrency)
+			}
+			for i, id := range reward.Cards {
+				card := stored.GetCard(id)
+				if card == nil || card.CardCount < reward.NumRewarded[i] - reward.OverflowAmounts[i] {
+					t.Errorf("Card %s was not added (%d rewarded)", data.ToDataName(id), reward.NumRewarded[i])
+				}
+			}
+		})
+	}
+}
@@ -46,22 +46,24 @@ func ensureIndexTracking(database *mgo.Database) {
 }
 
 func GetTrackingById(context *util.Context, id bson.ObjectId) (tracking *Tracking, err error) {
-	err = context.DB.C(TrackingCollectionName).Find(bson.M { "_id": id } ).One(&tracking)
-	return
+	return Trackings.GetById(context, id)
 }
 
 func (tracking *Tracking) Insert(context *util.Context) (err error) {
 	tracking.ID = bson.NewObjectId()
 	tracking.CreatedTime = time.Now()
-	err = context.DB.C(TrackingCollectionName).Insert(tracking)
+	err = Trackings.Insert(context, tracking)
 	return
 }
 
 func (tracking *Tracking) Delete(context *util.Context) (err error) {
-	return context.DB.C(TrackingCollectionName).Remove(bson.M { "_id": tracking.ID })
+	return Trackings.Delete(context, tracking.ID)
 }
 
 func GetTrackings(context *util.Context, userId bson.ObjectId) (trackings *[]Tracking, err error) {
-	err = context.DB.C(TrackingCollectionName).Find(bson.M { "us": userId } ).Sort("t0").All(&trackings)
+	list, err := Trackings.GetByUser(context, userId)
+	if err == nil {
+		trackings = &list
+	}
 	return
 }
@@ -30,14 +30,15 @@ type Device struct {
 type User struct {
 	ID              bson.ObjectId `bson:"_id,omitempty" json:"-"`
 	Admin           bool          `bson:"ad" json:"-"`
+	Role            AdminRole     `bson:"rl,omitempty" json:"-"`
 	Username        string        `bson:"un,omitempty" json:"-"`
-	Password        []byte        `bson:"ps,omitempty" json:"-"`
+	Password        []byte        `bson:"ps,omitempty" audit:"redact" json:"-"`
 	Email           string        `bson:"em,omitempty" json:"-"`
 	CreatedTime     time.Time     `bson:"t0" json:"created"`
 	TimeZone 		string 		  `bson:"tz" json:"timeZone"` 	
 
-	Credentials     []Credential  `bson:"cds,omitempty" json:"-"`
-	Devices         []Device      `bson:"dvs" json"-"`
+	Credentials     []Credential  `bson:"cds,omitempty" audit:"redact" json:"-"`
+	Devices         []Device      `bson:"dvs" audit:"redact" json"-"`
 
 	Tag             string        `bson:"tag" json:"tag"`
 	Name            string        `bson:"nm" json"name"`
@@ -113,17 +114,26 @@ func InsertUserWithDevice(context *util.Context, uuid string, credentials []Cred
 		TimeZone: context.Params.GetString("timeZone", "UTC"),
 	}
 
-	err = context.DB.C(UserCollectionName).Insert(user)
+	err = Users.Insert(context, user)
 	return
 }
 
 func InsertUserWithUsername(context *util.Context, username string, password string) (user *User, err error) {
 	// TODO check for existing user?  - prevented by database
 
-	return InsertUserWithUsernameAndDatabase(context.DB, username, password, context.Params.GetString("timeZone", "UTC"), false)
+	user = newUserWithUsername(username, password, context.Params.GetString("timeZone", "UTC"), false)
+	err = Users.Insert(context, user)
+	return
 }
 
+// insert without a request context (e.g. at startup), only with mongo storage
 func InsertUserWithUsernameAndDatabase(database *mgo.Database, username string, password string, timeZone string, admin bool) (user *User, err error) {
+	user = newUserWithUsername(username, password, timeZone, admin)
+	err = database.C(UserCollectionName).Insert(user)
+	return
+}
+
+func newUserWithUsername(username string, password string, timeZone string, admin bool) (user *User) {
 	// create user
 	user = &User {
 		ID: bson.NewObjectId(),
@@ -134,59 +144,74 @@ func InsertUserWithUsernameAndDatabase(database *mgo.Database, username string,
 		TimeZone: timeZone,
 	}
 	user.HashPassword(password)
-
-	err = database.C(UserCollectionName).Insert(user)
 	return
 }
 
 func GetUserById(context *util.Context, id bson.ObjectId) (user *User, err error) {
-	err = context.DB.C(UserCollectionName).Find(bson.M { "_id": id } ).One(&user)
+	defer util.ObserveDatabase(UserCollectionName, "getById", time.Now(), &err)
+
+	user, err = Users.GetById(context, id)
 	return
 }
 
 func GetUserByDevice(context *util.Context, uuid string) (user *User, err error) {
-	err = context.DB.C(UserCollectionName).Find(bson.M { "dvs.id": uuid } ).One(&user)
-	return
+	return Users.GetByDevice(context, uuid)
 }
 
 func GetUserByCredentials(context *util.Context, credentials []Credential) (user *User, err error) {
-	// convert credentials into bson.M
-	var query []bson.M = make([]bson.M, len(credentials), len(credentials))
-	for i, credential := range credentials {
-		query[i] = bson.M {
-			"cds.pv": credential.Provider,
-			"cds.id": credential.ID,
-		}
-	}
-
 	// get user by credentials (TODO - prioritize social over device?)
-	err = context.DB.C(UserCollectionName).Find(bson.M { "$or": query }).One(&user)
-	return
+	return Users.GetByCredentials(context, credentials)
 }
 
 func GetUserByTag(context *util.Context, tag string) (user *User, err error) {
-	err = context.DB.C(UserCollectionName).Find(bson.M { "tag": tag } ).One(&user)
-	return
+	return Users.GetByTag(context, tag)
 }
 
 func GetUserByUsername(context *util.Context, username string) (user *User, err error) {
-	return GetUserByUsernameAndDatabase(context.DB, username)
+	return Users.GetByUsername(context, username)
 }
 
+// find without a request context (e.g. at startup), only with mongo storage
 func GetUserByUsernameAndDatabase(database *mgo.Database, username string) (user *User, err error) {
 	err = database.C(UserCollectionName).Find(bson.M { "un": username } ).One(&user)
 	return
 }
 
+// get admin role (legacy admins without a role are superadmins)
+func (user *User) GetAdminRole() AdminRole {
+	if user.Role != RoleNone {
+		return user.Role
+	}
+	if user.Admin {
+		return RoleSuperAdmin
+	}
+	return RoleNone
+}
+
+func (user *User) IsAdmin() bool {
+	return user.GetAdminRole() != RoleNone
+}
+
+func (user *User) HasPermission(permission AdminPermission) bool {
+	role := user.GetAdminRole()
+	return role != RoleNone && role.HasPermission(permission)
+}
+
+func GetAdminUsers(context *util.Context) (users []*User, err error) {
+	return Users.GetAdmins(context)
+}
+
 func (user *User) Save(context *util.Context) (err error) {
+	defer util.ObserveDatabase(UserCollectionName, "save", time.Now(), &err)
+
 	// update user in database
-	_, err = context.DB.C(UserCollectionName).Upsert(bson.M { "_id": user.ID }, user)
+	err = Users.Save(context, user)
 	return
 }
 
 func (user *User) Delete(context *util.Context) (err error) {
 	// delete user from database
-	return context.DB.C(UserCollectionName).Remove(bson.M { "_id": user.ID })
+	return Users.Delete(context, user.ID)
 }
 
 func LoginUser(context *util.Context, username string, password string) (user *User, err error) {
@@ -204,6 +229,7 @@ func LoginUser(context *util.Context, username string, password string) (user *U
 	return
 }
 
+// credentials must be verified before being appended
 func (user *User) AppendCredentials(context *util.Context, credentials []Credential) error {
 	appended := false
 
@@ -219,6 +245,7 @@ func (user *User) AppendCredentials(context *util.Context, credentials []Credent
 
 		if !found {
 			user.Credentials = append(user.Credentials, credential)
+			appended = true
 		}
 	}
 
@@ -0,0 +1,438 @@
+package models
+
+import (
+	"fmt"
+	"sort"
+	"time"
+
+	"gopkg.in/mgo.v2"
+	"gopkg.in/mgo.v2/bson"
+
+	"bloodtales/config"
+	"bloodtales/data"
+	"bloodtales/util"
+)
+
+const GuildWarCollectionName = "guildWars"
+
+// winner of a drawn war
+const GuildWarDraw = -1
+
+// one of the two guilds in a war
+type GuildWarSide struct {
+	GuildID         bson.ObjectId    `bson:"gd" json:"-"`
+	Name            string           `bson:"nm" json:"name"`
+	Tag             string           `bson:"tg" json:"tag"`
+	Rating          int              `bson:"rt" json:"rating"` // guild rating when paired
+	Score           int              `bson:"sc" json:"score"`
+	WinCount        int              `bson:"wc" json:"winCount"`
+	BattleCount     int              `bson:"bc" json:"battleCount"`
+	Participants    []bson.ObjectId  `bson:"pa" json:"-"` // members who completed a war battle
+	Claimed         []bson.ObjectId  `bson:"cl" json:"-"` // participants who claimed their reward
+	Battles         map[string]int   `bson:"bt,omitempty" json:"-"` // scored battles by participant (ID hex)
+	OpponentBattles map[string]int   `bson:"ob,omitempty" json:"-"` // scored battles by participant and opponent (warOpponentKey)
+}
+
+// two guilds paired by rating, scoring war battles between their members during the war window
+type GuildWar struct {
+	ID              bson.ObjectId    `bson:"_id,omitempty" json:"id"`
+	StartTime       time.Time        `bson:"t0" json:"start"`
+	EndTime         time.Time        `bson:"t1" json:"end"`
+	Sides           []GuildWarSide   `bson:"sd" json:"sides"`
+	Completed       bool             `bson:"cp" json:"completed"`
+	CompleteTime    time.Time        `bson:"tc,omitempty" json:"-"`
+	Winner          int              `bson:"wn" json:"winner"` // winning side index or GuildWarDraw (when completed)
+}
+
+// client model
+type GuildWarClientAlias GuildWar
+type GuildWarClient struct {
+	Side            int              `json:"side"` // side index of the player's guild (-1 when not in the war)
+	Participant     bool             `json:"participant"`
+	Claimable       bool             `json:"claimable"`
+
+	*GuildWarClientAlias
+}
+
+func ensureIndexWar(database *mgo.Database) {
+	c := database.C(GuildWarCollectionName)
+
+	// guild index
+	util.Must(c.EnsureIndex(mgo.Index {
+		Key:        []string { "sd.gd", "-t0" },
+		Background: true,
+	}))
+
+	// open wars index
+	util.Must(c.EnsureIndex(mgo.Index {
+		Key:        []string { "cp", "-t0" },
+		Background: true,
+	}))
+}
+
+func GetGuildWarById(context *util.Context, id bson.ObjectId) (war *GuildWar, err error) {
+	return Wars.GetById(context, id)
+}
+
+// wars not yet completed, newest first
+func GetOpenGuildWars(context *util.Context) (wars []*GuildWar, err error) {
+	return Wars.GetOpen(context)
+}
+
+// completed wars, newest first
+func GetCompletedGuildWars(context *util.Context, limit int) (wars []*GuildWar, err error) {
+	return Wars.GetCompleted(context, limit)
+}
+
+// newest war of a guild (nil when the guild has never been paired)
+func GetGuildWar(context *util.Context, guildId bson.ObjectId) (war *GuildWar, err error) {
+	war, err = Wars.GetLatestByGuild(context, guildId)
+	if err == mgo.ErrNotFound {
+		war, err = nil, nil
+	}
+	return
+}
+
+// pair guilds not already at war by rating for a war window, neighbours on the rating ladder fight each other
+func ScheduleGuildWars(context *util.Context, start time.Time, end time.Time) (wars []*GuildWar, err error) {
+	if !end.After(start) {
+		err = util.NewError("War must end after it starts")
+		return
+	}
+
+	open, err := Wars.GetOpen(context)
+	if err != nil {
+		return
+	}
+	busy := map[bson.ObjectId]bool {}
+	for _, war := range open {
+		for _, side := range war.Sides {
+			busy[side.GuildID] = true
+		}
+	}
+
+	guilds, err := Guilds.GetAll(context)
+	if err != nil {
+		return
+	}
+
+	rules := config.Config.Wars
+	var eligible []*Guild
+	for _, guild := range guilds {
+		if !busy[guild.ID] && guild.MemberCount >= rules.MinMembers {
+			eligible = append(eligible, guild)
+		}
+	}
+	sort.SliceStable(eligible, func(i, j int) bool {
+		return eligible[i].Rating > eligible[j].Rating
+	})
+
+	for i := 0; i + 1 < len(eligible); {
+		first, second := eligible[i], eligible[i + 1]
+
+		// too far apart, the higher guild sits this war out
+		if rules.MaxRatingGap > 0 && first.Rating - second.Rating > rules.MaxRatingGap {
+			i += 1
+			continue
+		}
+
+		war := &GuildWar {
+			ID: bson.NewObjectId(),
+			StartTime: start,
+			EndTime: end,
+			Sides: []GuildWarSide { newGuildWarSide(first), newGuildWarSide(second) },
+			Winner: GuildWarDraw,
+		}
+		if err = Wars.Insert(context, war); err != nil {
+			return
+		}
+		wars = append(wars, war)
+		i += 2
+	}
+	return
+}
+
+func newGuildWarSide(guild *Guild) GuildWarSide {
+	return GuildWarSide {
+		GuildID: guild.ID,
+		Name: guild.Name,
+		Tag: guild.Tag,
+		Rating: guild.Rating,
+		Participants: []bson.ObjectId {},
+		Claimed: []bson.ObjectId {},
+	}
+}
+
+func (war *GuildWar) GetName() string {
+	return fmt.Sprintf("%s vs %s", war.Sides[0].Name, war.Sides[1].Name)
+}
+
+func (war *GuildWar) IsActive(now time.Time) bool {
+	return !war.Completed && !now.Before(war.StartTime) && now.Before(war.EndTime)
+}
+
+func (war *GuildWar) GetStateName(now time.Time) string {
+	switch {
+	case war.Completed:
+		return "Completed"
+	case now.Before(war.StartTime):
+		return "Scheduled"
+	case now.Before(war.EndTime):
+		return "Active"
+	default:
+		return "Ended"
+	}
+}
+
+// side index of a guild (-1 when the guild is not in the war)
+func (war *GuildWar) GetSide(guildId bson.ObjectId) int {
+	for i, side := range war.Sides {
+		if side.GuildID == guildId {
+			return i
+		}
+	}
+	return -1
+}
+
+// side index a player battled for (-1 when the player did not participate)
+func (war *GuildWar) GetParticipantSide(playerId bson.ObjectId) int {
+	for i, side := range war.Sides {
+		for _, participantId := range side.Participants {
+			if participantId == playerId {
+				return i
+			}
+		}
+	}
+	return -1
+}
+
+// scored battles of a participant on a side
+func (war *GuildWar) GetBattleCount(side int, playerId bson.ObjectId) int {
+	return war.Sides[side].Battles[playerId.Hex()]
+}
+
+// participant has battled enough to claim a reward
+func (war *GuildWar) CanClaim(side int, playerId bson.ObjectId) bool {
+	return war.GetBattleCount(side, playerId) >= config.Config.Wars.MinClaimBattles
+}
+
+// key of a player's battles against one opponent
+func warOpponentKey(playerId bson.ObjectId, opponentId bson.ObjectId) string {
+	return playerId.Hex() + "-" + opponentId.Hex()
+}
+
+func (war *GuildWar) IsClaimed(side int, playerId bson.ObjectId) bool {
+	for _, claimedId := range war.Sides[side].Claimed {
+		if claimedId == playerId {
+			return true
+		}
+	}
+	return false
+}
+
+// war as seen by a player
+func (war *GuildWar) GetClient(player *Player) *GuildWarClient {
+	client := &GuildWarClient {
+		Side: -1,
+		GuildWarClientAlias: (*GuildWarClientAlias)(war),
+	}
+	if player.IsInGuild() {
+		client.Side = war.GetSide(player.GuildID)
+	}
+	if side := war.GetParticipantSide(player.ID); side >= 0 {
+		client.Participant = true
+		client.Claimable = war.Completed && war.CanClaim(side, player.ID) && !war.IsClaimed(side, player.ID)
+	}
+	return client
+}
+
+// open a war battle between members of the two sides, tagging the match with the war
+func StartWarMatch(context *util.Context, war *GuildWar, hostID bson.ObjectId, guestID bson.ObjectId, roomID string, arenaName string) (match *Match, err error) {
+	if !war.IsActive(time.Now()) {
+		err = util.NewError("Guild war is not active")
+		return
+	}
+
+	match, err = StartPrivateMatch(context, hostID, guestID, MatchUnranked, roomID, arenaName)
+	if err != nil {
+		return
+	}
+
+	match.WarID = war.ID
+	err = match.Save(context)
+	return
+}
+
+// score a completed war battle for the guilds of both players, until the war is completed
+func (match *Match) addWarResult(context *util.Context) {
+	war, err := Wars.GetById(context, match.WarID)
+	if err != nil {
+		context.Log().Errorf("Failed to get guild war %s for match %s: %v", match.WarID.Hex(), match.ID.Hex(), err)
+		return
+	}
+	if war.Completed {
+		return
+	}
+
+	if host, err := match.GetHost(context); err == nil {
+		war.addBattle(context, host, match.GuestID, match.Outcome)
+	}
+	if guest, err := match.GetGuest(context); err == nil {
+		war.addBattle(context, guest, match.HostID, invertOutcome(match.Outcome))
+	}
+}
+
+// score a player's battle for their guild's side, up to the per player and per opponent battle limits
+// (so members cannot farm score by replaying one another)
+func (war *GuildWar) addBattle(context *util.Context, player *Player, opponentId bson.ObjectId, outcome MatchOutcome) {
+	if !player.IsInGuild() || war.GetSide(player.GuildID) < 0 {
+		return
+	}
+
+	rules := config.Config.Wars
+	score, wins := 0, 0
+	switch outcome {
+	case MatchWin:
+		score, wins = rules.WinScore, 1
+	case MatchDraw:
+		score = rules.DrawScore
+	}
+
+	err := Wars.AddBattle(context, war.ID, player.GuildID, score, wins, player.ID, opponentId, rules.MaxPlayerBattles, rules.MaxOpponentBattles)
+	if err == mgo.ErrNotFound {
+		context.Log().Printf("Guild war %s battle not scored for player %s: battle limit reached or war completed", war.ID.Hex(), player.ID.Hex())
+	} else if err != nil {
+		context.Log().Errorf("Failed to score guild war %s for player %s: %v", war.ID.Hex(), player.ID.Hex(), err)
+	}
+}
+
+// decide an ended war and reward the winning guild, once
+func (war *GuildWar) Complete(context *util.Context) (err error) {
+	now := time.Now()
+	if war.Completed {
+		err = util.NewError("Guild war is already completed")
+		return
+	}
+	if now.Before(war.EndTime) {
+		err = util.NewError("Guild war has not ended")
+		return
+	}
+
+	// most score wins, then most battles won
+	winner := GuildWarDraw
+	first, second := war.Sides[0], war.Sides[1]
+	switch {
+	case first.Score > second.Score, first.Score == second.Score && first.WinCount > second.WinCount:
+		winner = 0
+	case second.Score > first.Score, first.Score == second.Score && second.WinCount > first.WinCount:
+		winner = 1
+	}
+
+	if err = Wars.Complete(context, war.ID, winner, now); err != nil {
+		if err == mgo.ErrNotFound {
+			err = util.NewError("Guild war is already completed")
+		}
+		return
+	}
+	war.Completed = true
+	war.CompleteTime = now
+	war.Winner = winner
+
+	if winner != GuildWarDraw {
+		rules := config.Config.Wars
+		_, _, err = AddGuildProgress(context, war.Sides[winner].GuildID, GuildProgress {
+			XP: rules.WinXP,
+			Rating: rules.WinRating,
+		})
+	}
+	return
+}
+
+// complete all ended wars, returning how many were completed
+func CompleteGuildWars(context *util.Context) (count int, err error) {
+	wars, err := Wars.GetOpen(context)
+	if err != nil {
+		return
+	}
+
+	now := time.Now()
+	for _, war := range wars {
+		if now.Before(war.EndTime) {
+			continue
+		}
+		if err = war.Complete(context); err != nil {
+			return
+		}
+		count += 1
+	}
+	return
+}
+
+// grant a participant the reward for their side's war outcome, once
+func (player *Player) ClaimGuildWarReward(context *util.Context, warId bson.ObjectId) (rewards []*Reward, err error) {
+	war, err := Wars.GetById(context, warId)
+	if err != nil {
+		return
+	}
+
+	side := war.GetParticipantSide(player.ID)
+	switch {
+	case side < 0:
+		err = util.NewError("Player did not battle in the guild war")
+	case !war.Completed:
+		err = util.NewError("Guild war is not completed")
+	case !war.CanClaim(side, player.ID):
+		err = util.NewError(fmt.Sprintf("Guild war rewards need at least %d battles", config.Config.Wars.MinClaimBattles))
+	case war.IsClaimed(side, player.ID):
+		err = util.NewError("Guild war reward already claimed")
+	}
+	if err != nil {
+		return
+	}
+
+	// mark claimed first, so concurrent claims cannot both grant
+	if err = Wars.ClaimReward(context, war.ID, player.ID); err != nil {
+		if err == mgo.ErrNotFound {
+			err = util.NewError("Guild war reward already claimed")
+		}
+		return
+	}
+
+	rules := config.Config.Wars.Loss
+	switch war.Winner {
+	case side:
+		rules = config.Config.Wars.Win
+	case GuildWarDraw:
+		rules = config.Config.Wars.Draw
+	}
+
+	if rules.Reward != "" {
+		rewards = append(rewards, player.GetReward(data.ToDataId(rules.Reward), player.GetLeague(), player.GetRankTier()))
+	}
+	if rules.StandardCurrency > 0 || rules.PremiumCurrency > 0 {
+		rewards = append(rewards, &Reward {
+			Type: data.RewardType_StandardCurrency,
+			StandardCurrency: rules.StandardCurrency,
+			PremiumCurrency: rules.PremiumCurrency,
+		})
+	}
+
+	// release the claim when the reward is not granted, so it can be claimed again
+	defer func() {
+		if err != nil {
+			if unclaimErr := Wars.UnclaimReward(context, war.ID, player.ID); unclaimErr != nil {
+				context.Log().Errorf("Failed to release guild war %s claim for player %s: %v", war.ID.Hex(), player.ID.Hex(), unclaimErr)
+			}
+		}
+	}()
+
+	for _, reward := range rewards {
+		if err = player.AddRewards(reward, nil); err != nil {
+			return
+		}
+	}
+	player.SetDirty(PlayerDataMask_Currency, PlayerDataMask_Cards)
+
+	err = player.Save(context)
+	return
+}
@@ -0,0 +1,167 @@
+package models
+
+import (
+	"time"
+	"errors"
+	"testing"
+
+	"gopkg.in/mgo.v2/bson"
+
+	"bloodtales/config"
+	"bloodtales/util"
+)
+
+// player repository failing every save
+type failingPlayerRepository struct {
+	PlayerRepository
+}
+
+func (repository failingPlayerRepository) Save(context *util.Context, player *Player) error {
+	return errors.New("save failed")
+}
+
+// war rules for a test, restored when the test ends
+func useTestWarRules(t *testing.T, maxBattles int, maxOpponentBattles int, minClaimBattles int) {
+	rules := config.Config.Wars
+	t.Cleanup(func() {
+		config.Config.Wars = rules
+	})
+
+	config.Config.Wars.WinScore = 3
+	config.Config.Wars.DrawScore = 1
+	config.Config.Wars.MaxPlayerBattles = maxBattles
+	config.Config.Wars.MaxOpponentBattles = maxOpponentBattles
+	config.Config.Wars.MinClaimBattles = minClaimBattles
+	config.Config.Wars.Win = config.GuildWarRewardConfiguration { StandardCurrency: 500 }
+	config.Config.Wars.Draw = config.GuildWarRewardConfiguration { StandardCurrency: 250 }
+	config.Config.Wars.Loss = config.GuildWarRewardConfiguration { StandardCurrency: 100 }
+}
+
+// active war between two new guilds of one player each, returning the war and both players
+func newTestWar(t *testing.T, context *util.Context) (*GuildWar, *Player, *Player) {
+	first, second := newTestPlayer(t, context), newTestPlayer(t, context)
+	firstGuild, secondGuild := newTestGuild(t, context, first), newTestGuild(t, context, second)
+
+	now := time.Now()
+	war := &GuildWar {
+		ID: bson.NewObjectId(),
+		StartTime: now.Add(-time.Hour),
+		EndTime: now.Add(time.Hour),
+		Sides: []GuildWarSide { newGuildWarSide(firstGuild), newGuildWarSide(secondGuild) },
+		Winner: GuildWarDraw,
+	}
+	if err := Wars.Insert(context, war); err != nil {
+		t.Fatalf("Failed to insert war: %v", err)
+	}
+	return war, reloadTestPlayer(t, context, first), reloadTestPlayer(t, context, second)
+}
+
+func getTestWar(t *testing.T, context *util.Context, war *GuildWar) *GuildWar {
+	stored, err := Wars.GetById(context, war.ID)
+	if err != nil {
+		t.Fatalf("Failed to get war: %v", err)
+	}
+	return stored
+}
+
+func TestGuildWarBattleLimits(t *testing.T) {
+	tests := []struct {
+		name                string
+		maxBattles          int
+		maxOpponentBattles  int
+		opponents           int // distinct opponents, battled in turn
+		battles             int // won by the first side's player
+		scored              int
+	}{
+		{"no limits", 0, 0, 1, 6, 6},
+		{"repeat opponent", 0, 2, 1, 6, 2},
+		{"repeat opponents", 0, 2, 3, 6, 6},
+		{"player limit", 4, 0, 3, 6, 4},
+		{"both limits", 5, 1, 3, 6, 3},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			useTestWarRules(t, test.maxBattles, test.maxOpponentBattles, 0)
+			context := newTestContext()
+			war, player, _ := newTestWar(t, context)
+
+			opponents := make([]bson.ObjectId, test.opponents)
+			for i := range opponents {
+				opponents[i] = bson.NewObjectId()
+			}
+			for i := 0; i < test.battles; i++ {
+				war.addBattle(context, player, opponents[i % len(opponents)], MatchWin)
+			}
+
+			side := getTestWar(t, context, war).Sides[0]
+			if side.BattleCount != test.scored || side.WinCount != test.scored || side.Score != test.scored * 3 {
+				t.Errorf("Scored %d battles (%d wins, score %d), want %d", side.BattleCount, side.WinCount, side.Score, test.scored)
+			}
+			if count := getTestWar(t, context, war).GetBattleCount(0, player.ID); count != test.scored {
+				t.Errorf("Player battles = %d, want %d", count, test.scored)
+			}
+		})
+	}
+}
+
+func TestClaimGuildWarReward(t *testing.T) {
+	tests := []struct {
+		name        string
+		battles     int  // won by the first side's player
+		claims      int
+		failSaves   int  // leading claims whose player save fails
+		success     bool // of the last claim
+		claimed     bool
+		standard    int  // currency granted
+	}{
+		{"winner", 3, 1, 0, true, true, 500},
+		{"too few battles", 2, 1, 0, false, false, 0},
+		{"claimed twice", 3, 2, 0, false, true, 500},
+		{"failed save releases the claim", 3, 1, 1, false, false, 0},
+		{"claim after a failed save", 3, 2, 1, true, true, 500},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			useTestWarRules(t, 0, 0, 3)
+			context := newTestContext()
+			war, player, opponent := newTestWar(t, context)
+
+			for i := 0; i < test.battles; i++ {
+				war.addBattle(context, player, opponent.ID, MatchWin)
+				war.addBattle(context, opponent, player.ID, MatchLoss)
+			}
+			ended := getTestWar(t, context, war)
+			ended.EndTime = time.Now()
+			if err := ended.Complete(context); err != nil {
+				t.Fatalf("Failed to complete war: %v", err)
+			}
+
+			standardCurrency := player.StandardCurrency
+			var err error
+			for i := 0; i < test.claims; i++ {
+				failSave := i < test.failSaves
+				if failSave {
+					Players = failingPlayerRepository { Players }
+				}
+
+				_, err = reloadTestPlayer(t, context, player).ClaimGuildWarReward(context, war.ID)
+
+				if failSave {
+					Players = Players.(failingPlayerRepository).PlayerRepository
+				}
+			}
+			if (err == nil) != test.success {
+				t.Fatalf("Claim error = %v, want success %v", err, test.success)
+			}
+
+			if claimed := getTestWar(t, context, war).IsClaimed(0, player.ID); claimed != test.claimed {
+				t.Errorf("Claimed = %v, want %v", claimed, test.claimed)
+			}
+			if granted := reloadTestPlayer(t, context, player).StandardCurrency - standardCurrency; granted != test.standard {
+				t.Errorf("Granted currency = %d, want %d", granted, test.standard)
+			}
+		})
+	}
+}
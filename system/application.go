@@ -1,19 +1,33 @@
 package system
 
 import (
+	"os"
 	"time"
 	"fmt"
+	"syscall"
 	"net/http"
+	"os/signal"
+	"sync/atomic"
+	gocontext "context"
 
+	"bloodtales/config"
 	"bloodtales/log"
 	"bloodtales/util"
 )
 
 type Application struct {
+	*Router
+
+	// internal
+	server            *http.Server
+	shuttingDown      int32
+	shutdownHandlers  []func()
 }
 
 var (
-	App *Application = &Application {}
+	App *Application = &Application {
+		Router: NewRouter(),
+	}
 )
 
 func handleErrors() {
@@ -39,6 +53,11 @@ func (application *Application) Close() {
 	// handle any remaining application errors
 	defer handleErrors()
 
+	// flush any pending work (analytics, etc.) before connections close
+	for _, handler := range application.shutdownHandlers {
+		application.runShutdownHandler(handler)
+	}
+
 	// cleanup database connection
 	util.CloseDatabase()
 
@@ -46,37 +65,18 @@ func (application *Application) Close() {
 	util.CloseCache()
 }
 
-func (application *Application) HandleAPI(pattern string, authType AuthenticationType, handler func(*util.Context)) {
-	application.handle(pattern, authType, handler, "")
+func (application *Application) runShutdownHandler(handler func()) {
+	defer handleErrors()
+	handler()
 }
 
-func (application *Application) HandleTemplate(pattern string, authType AuthenticationType, handler func(*util.Context), template string) {
-	application.handle(pattern, authType, handler, template)
+// register a handler to run during shutdown, after in-flight requests have drained
+func (application *Application) OnShutdown(handler func()) {
+	application.shutdownHandlers = append(application.shutdownHandlers, handler)
 }
 
-func (application *Application) handle(pattern string, authType AuthenticationType, handler func(*util.Context), template string) {
-	// all template requests start here
-	http.HandleFunc(pattern, func(w http.ResponseWriter, r *http.Request) {
-		// create context
-		context := util.CreateContext(w, r)
-
-		// prepare request response
-		defer context.EndRequest(time.Now())
-
-		// init context handling
-		context.BeginRequest(template)
-
-		// authentication
-		err := authenticate(context, authType)
-		if err != nil {
-			context.Fail(fmt.Sprintf("Failed to authenticate user: %v", err))
-		}
-
-		// handle request if authenticated
-		if context.Success {
-			handler(context)
-		}
-	})
+func (application *Application) IsShuttingDown() bool {
+	return atomic.LoadInt32(&application.shuttingDown) != 0
 }
 
 func (application *Application) Static(pattern string, path string) {
@@ -89,19 +89,19 @@ func (application *Application) Static(pattern string, path string) {
 	}
 
 	// server static files from directory
-	http.Handle(pattern, http.StripPrefix(pattern, fs))
+	application.HandleFunc(pattern, http.StripPrefix(pattern, fs).ServeHTTP).Methods("GET")
 }
 
 func (application *Application) Redirect(pattern string, url string, responseCode int) {
 	// redirect these requests
-	http.HandleFunc(pattern, func(w http.ResponseWriter, r *http.Request) {
+	application.HandleFunc(pattern, func(w http.ResponseWriter, r *http.Request) {
 		http.Redirect(w, r, url, responseCode)
 	})
 }
 
 func (application *Application) Ignore(pattern string) {
 	// ignore these requests
-	http.HandleFunc(pattern, func(w http.ResponseWriter, r *http.Request) {
+	application.HandleFunc(pattern, func(w http.ResponseWriter, r *http.Request) {
 		log.Printf("[red!]Invalid request URL: %s[-]", r.URL.RequestURI())
 
 		http.NotFound(w, r)
@@ -115,7 +115,50 @@ func (application *Application) Serve() {
 	// start serving on port
 	port := util.Env.GetRequiredString("PORT")
 
+	application.server = &http.Server {
+		Addr: ":" + port,
+		Handler: application.Router,
+	}
+
+	// listen for shutdown signals
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+
+	errors := make(chan error, 1)
+	go func() {
+		errors <- application.server.ListenAndServe()
+	}()
+
 	log.Printf("[cyan]Server application ready for incoming requests on port: %s[-]", port)
 
-	util.Must(http.ListenAndServe(":" + port, nil))
+	select {
+	case err := <-errors:
+		util.Must(err)
+	case sig := <-signals:
+		log.Printf("[cyan]Received signal (%v), shutting down...[-]", sig)
+		application.shutdown()
+	}
+}
+
+func (application *Application) shutdown() {
+	// fail readiness checks while draining, and keep serving long enough for load balancers to notice
+	atomic.StoreInt32(&application.shuttingDown, 1)
+	if delay := config.Config.Server.ShutdownDelay.Duration; delay > 0 {
+		log.Printf("[cyan]Waiting %v for load balancers to stop routing requests[-]", delay)
+		time.Sleep(delay)
+	}
+
+	timeout := config.Config.Server.ShutdownTimeout.Duration
+	deadline, cancel := gocontext.WithTimeout(gocontext.Background(), timeout)
+	defer cancel()
+
+	// stop accepting requests and drain in-flight handlers
+	if err := application.server.Shutdown(deadline); err != nil {
+		log.Errorf("Server failed to drain requests within %v: %v", timeout, err)
+	}
+
+	// hijacked socket connections are not tracked by the server
+	CloseSockets(deadline)
+
+	log.Println("[cyan]Server application stopped[-]")
 }
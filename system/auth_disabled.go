@@ -13,6 +13,12 @@ var (
 )
 
 func init() {
+	// debug user can only be found in mongo storage
+	if util.Storage != util.MongoStorage {
+		log.Warning("DEBUG - Build has disabled authentication, no debug user with memory storage")
+		return
+	}
+
 	// get database connection
 	db := util.GetDatabaseConnection()
 	defer db.Session.Close()
@@ -9,6 +9,11 @@ import (
 )
 
 func init() {
+	// admin user is only created in mongo storage
+	if util.Storage != util.MongoStorage {
+		return
+	}
+
 	// get database connection
 	db := util.GetDatabaseConnection()
 	defer db.Session.Close()
@@ -44,5 +49,13 @@ func authenticate(context *util.Context, authType AuthenticationType) (err error
 			}
 		}
 	}
+
+	// banned users are refused any authenticated access
+	if err == nil {
+		if err = CheckSanction(context, models.SanctionBan); err != nil {
+			context.Token = ""
+			ClearAuthToken(context)
+		}
+	}
 	return
 }
@@ -2,7 +2,7 @@ package system
 
 import (
 	"errors"
-	"strings"
+	"crypto/subtle"
 
 	"bloodtales/config"
 	"bloodtales/util"
@@ -17,8 +17,8 @@ func authenticateCredentials(context *util.Context, required bool) (err error) {
 	var user *models.User = nil
 
 	if tag != "" {
-		// login using player tag
-		if token == config.Config.Authentication.DebugToken {
+		// login using player tag (development only, with the debug token)
+		if isDebugToken(token) {
 			user, err = models.GetUserByTag(context, tag)
 			util.MustIgnoreNotFound(err)
 
@@ -27,24 +27,20 @@ func authenticateCredentials(context *util.Context, required bool) (err error) {
 			}
 		}
 	} else {
-		// parse credentials parameters
-		credentialsParameter := context.Params.GetString("credentials", "")
+		// parse credential claims parameter (JSON array of CredentialClaim)
+		var claims []CredentialClaim
 		var credentials []models.Credential = nil
 
-		// login using credentials
-		if credentialsParameter != "" {
-			// parse credentials
-			credentialsPairs := strings.Split(credentialsParameter, ",")
-
-			// build credentials
-			credentials := make([]models.Credential, len(credentialsPairs))
-			for i, credentialsPair := range credentialsPairs {
-				credentialsParts := strings.Split(credentialsPair, ":")
-				credentials[i] = models.Credential { Provider: credentialsParts[0], ID: credentialsParts[1] }
+		// login using verified credentials only
+		if context.Params.GetJSON("credentials", &claims) && len(claims) > 0 {
+			credentials, err = VerifyCredentials(claims)
+			if err != nil {
+				return
 			}
 
 			// find user with credentials
 			user, err = models.GetUserByCredentials(context, credentials)
+			util.MustIgnoreNotFound(err)
 		}
 
 		// check if no user was found with credentials
@@ -82,3 +78,9 @@ func authenticateCredentials(context *util.Context, required bool) (err error) {
 	}
 	return
 }
+
+// tag login is refused outside development and when no debug token is configured
+func isDebugToken(token string) bool {
+	debugToken := config.Config.Authentication.DebugToken
+	return config.Env.Development && debugToken != "" && subtle.ConstantTimeCompare([]byte(token), []byte(debugToken)) == 1
+}
@@ -0,0 +1,37 @@
+package system
+
+import (
+	"testing"
+
+	"bloodtales/config"
+)
+
+func TestTagLoginDebugToken(t *testing.T) {
+	tests := []struct {
+		name        string
+		development bool
+		debugToken  string
+		token       string
+		valid       bool
+	}{
+		{"matching token", true, "dev-only-debug-token", "dev-only-debug-token", true},
+		{"wrong token", true, "dev-only-debug-token", "guess", false},
+		{"unset token", true, "", "", false},
+		{"production", false, "debug-token", "debug-token", false},
+	}
+
+	development, debugToken := config.Env.Development, config.Config.Authentication.DebugToken
+	defer func() {
+		config.Env.Development, config.Config.Authentication.DebugToken = development, debugToken
+	}()
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			config.Env.Development = test.development
+			config.Config.Authentication.DebugToken = test.debugToken
+			if valid := isDebugToken(test.token); valid != test.valid {
+				t.Errorf("Tag login allowed = %v, want %v", valid, test.valid)
+			}
+		})
+	}
+}
@@ -0,0 +1,83 @@
+package system
+
+import (
+	"fmt"
+	"errors"
+	"net/http"
+	"encoding/json"
+
+	"bloodtales/data"
+	"bloodtales/util"
+)
+
+// health check result
+type HealthCheck struct {
+	Healthy         bool                    `json:"healthy"`
+	Checks          map[string]string       `json:"checks,omitempty"`
+}
+
+func init() {
+	// health checks skip context creation so they never depend on a database connection
+	App.HandleFunc("/healthz", healthHandler).Methods("GET")
+	App.HandleFunc("/readyz", readyHandler).Methods("GET")
+}
+
+// liveness: the process is up and serving
+func healthHandler(w http.ResponseWriter, r *http.Request) {
+	writeHealthCheck(w, &HealthCheck {
+		Healthy: true,
+	})
+}
+
+// readiness: all dependencies are reachable and game data is loaded
+func readyHandler(w http.ResponseWriter, r *http.Request) {
+	check := &HealthCheck {
+		Healthy: true,
+		Checks: map[string]string {},
+	}
+
+	check.run("shutdown", func() error {
+		if App.IsShuttingDown() {
+			return errors.New("Server is shutting down")
+		}
+		return nil
+	})
+	check.run("mongo", util.PingDatabase)
+	check.run("redis", util.PingCache)
+	check.run("postgres", util.PingSQL)
+	check.run("data", data.CheckLoaded)
+
+	writeHealthCheck(w, check)
+}
+
+func (check *HealthCheck) run(name string, checker func() error) {
+	// treat panics as failures
+	defer func() {
+		if err := recover(); err != nil {
+			check.fail(name, err)
+		}
+	}()
+
+	if err := checker(); err != nil {
+		check.fail(name, err)
+	} else {
+		check.Checks[name] = "ok"
+	}
+}
+
+func (check *HealthCheck) fail(name string, err interface{}) {
+	check.Healthy = false
+	check.Checks[name] = fmt.Sprintf("%v", err)
+}
+
+func writeHealthCheck(w http.ResponseWriter, check *HealthCheck) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-cache")
+
+	if check.Healthy {
+		w.WriteHeader(http.StatusOK)
+	} else {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}
+	json.NewEncoder(w).Encode(check)
+}
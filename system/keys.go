@@ -0,0 +1,246 @@
+package system
+
+import (
+	"fmt"
+	"sync"
+	"time"
+	"errors"
+	"strings"
+	"math/big"
+	"net/http"
+	"io/ioutil"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"encoding/json"
+	"encoding/base64"
+
+	"bloodtales/config"
+)
+
+// JSON web key (RSA only)
+type jsonWebKey struct {
+	KeyType         string                  `json:"kty"`
+	KeyID           string                  `json:"kid"`
+	Algorithm       string                  `json:"alg"`
+	Modulus         string                  `json:"n"`
+	Exponent        string                  `json:"e"`
+}
+
+// JSON web key set
+type jsonWebKeySet struct {
+	Keys            []jsonWebKey            `json:"keys"`
+}
+
+// cached public keys for a single key URL
+type publicKeyCache struct {
+	keys            map[string]*rsa.PublicKey
+	expires         time.Time
+	fetched         time.Time               // last fetch attempt, unknown keys are refetched once per Credentials.KeysRefetchInterval
+	err             error                   // error of the last fetch attempt
+	fetching        chan struct{}           // closed when the fetch in progress finishes
+}
+
+// fetch all keys from a key URL
+type publicKeyFetcher func(url string) (keys map[string]*rsa.PublicKey, err error)
+
+// most key URLs cached, Game Center key URLs come from clients (under a trusted prefix)
+const maxKeyCaches = 64
+
+var (
+	// internal
+	keyCaches       map[string]*publicKeyCache = map[string]*publicKeyCache {}
+	keyMutex        sync.Mutex
+)
+
+// read key resource from URL (supports "file://" for local fixtures)
+func readKeyResource(url string) (body []byte, err error) {
+	if strings.HasPrefix(url, "file://") {
+		// read file from local
+		return ioutil.ReadFile(strings.TrimPrefix(url, "file://"))
+	}
+
+	// read file from URL
+	var response *http.Response
+	response, err = http.Get(url)
+	if err != nil {
+		return
+	}
+	defer response.Body.Close()
+
+	if response.StatusCode != http.StatusOK {
+		err = errors.New(fmt.Sprintf("Failed to fetch keys from: %s (%s)", url, response.Status))
+		return
+	}
+
+	return ioutil.ReadAll(response.Body)
+}
+
+func parseJSONWebKey(key *jsonWebKey) (publicKey *rsa.PublicKey, err error) {
+	if key.KeyType != "RSA" {
+		err = errors.New(fmt.Sprintf("Unsupported key type: %s", key.KeyType))
+		return
+	}
+
+	// decode modulus and exponent
+	var n, e []byte
+	if n, err = base64.RawURLEncoding.DecodeString(key.Modulus); err != nil {
+		return
+	}
+	if e, err = base64.RawURLEncoding.DecodeString(key.Exponent); err != nil {
+		return
+	}
+
+	publicKey = &rsa.PublicKey {
+		N: new(big.Int).SetBytes(n),
+		E: int(new(big.Int).SetBytes(e).Int64()),
+	}
+	return
+}
+
+func fetchJSONWebKeys(url string) (keys map[string]*rsa.PublicKey, err error) {
+	var body []byte
+	if body, err = readKeyResource(url); err != nil {
+		return
+	}
+
+	// parse key set
+	var keySet jsonWebKeySet
+	if err = json.Unmarshal(body, &keySet); err != nil {
+		return
+	}
+
+	keys = map[string]*rsa.PublicKey {}
+	for i, key := range keySet.Keys {
+		var publicKey *rsa.PublicKey
+		if publicKey, err = parseJSONWebKey(&keySet.Keys[i]); err != nil {
+			return
+		}
+		keys[key.KeyID] = publicKey
+	}
+	return
+}
+
+// get a key by ID from a JSON web key set, refreshing the set if expired or if the key is unknown
+func getJSONWebKey(url string, keyID string) (publicKey *rsa.PublicKey, err error) {
+	return getPublicKey(url, keyID, fetchJSONWebKeys)
+}
+
+// get the public key from a DER (or PEM) encoded certificate
+func getCertificateKey(url string) (publicKey *rsa.PublicKey, err error) {
+	return getPublicKey(url, "", fetchCertificateKey)
+}
+
+func fetchCertificateKey(url string) (keys map[string]*rsa.PublicKey, err error) {
+	var body []byte
+	if body, err = readKeyResource(url); err != nil {
+		return
+	}
+
+	// parse certificate
+	var certificate *x509.Certificate
+	if certificate, err = x509.ParseCertificate(decodePEM(body)); err != nil {
+		return
+	}
+
+	publicKey, ok := certificate.PublicKey.(*rsa.PublicKey)
+	if !ok {
+		err = errors.New(fmt.Sprintf("Unsupported certificate key from: %s", url))
+		return
+	}
+
+	keys = map[string]*rsa.PublicKey { "": publicKey }
+	return
+}
+
+// get a cached key, fetching the keys (outside the lock, once at a time per URL) when expired or when the key is unknown
+func getPublicKey(url string, keyID string, fetch publicKeyFetcher) (publicKey *rsa.PublicKey, err error) {
+	for {
+		keyMutex.Lock()
+		cache, ok := keyCaches[url]
+		if !ok {
+			evictKeyCache()
+			cache = &publicKeyCache {}
+			keyCaches[url] = cache
+		}
+
+		// wait for a fetch in progress, then look again
+		if fetching := cache.fetching; fetching != nil {
+			keyMutex.Unlock()
+			<-fetching
+			continue
+		}
+
+		now := time.Now()
+		publicKey, ok = cache.keys[keyID]
+		recent := now.Sub(cache.fetched) < config.Config.Credentials.KeysRefetchInterval.Duration
+		if ok && (now.Before(cache.expires) || recent) {
+			keyMutex.Unlock()
+			return
+		}
+
+		// limit refetches for unknown keys (and retries of failed fetches)
+		if recent {
+			err = cache.err
+			keyMutex.Unlock()
+
+			if err == nil {
+				err = errors.New(fmt.Sprintf("Unknown key ID: %s", keyID))
+			}
+			return
+		}
+
+		fetching := make(chan struct{})
+		cache.fetching = fetching
+		cache.fetched = now
+		keyMutex.Unlock()
+
+		keys, fetchErr := fetch(url)
+
+		keyMutex.Lock()
+		if fetchErr == nil {
+			cache.keys = keys
+			cache.expires = time.Now().Add(config.Config.Credentials.KeysExpiration.Duration)
+		}
+		cache.err = fetchErr
+		cache.fetching = nil
+		close(fetching)
+		publicKey, ok = cache.keys[keyID]
+		keyMutex.Unlock()
+
+		// keys of a failed refresh stay usable until the next refetch
+		if !ok {
+			err = fetchErr
+			if err == nil {
+				err = errors.New(fmt.Sprintf("Unknown key ID: %s", keyID))
+			}
+		}
+		return
+	}
+}
+
+// make room for another key URL by dropping the least recently fetched one (not being fetched), keyMutex must be held
+func evictKeyCache() {
+	if len(keyCaches) < maxKeyCaches {
+		return
+	}
+
+	oldestURL := ""
+	var oldest time.Time
+	for url, cache := range keyCaches {
+		if cache.fetching == nil && (oldestURL == "" || cache.fetched.Before(oldest)) {
+			oldestURL, oldest = url, cache.fetched
+		}
+	}
+	if oldestURL != "" {
+		delete(keyCaches, oldestURL)
+	}
+}
+
+// unwrap PEM encoded data, otherwise assume raw DER
+func decodePEM(body []byte) []byte {
+	if block, _ := pem.Decode(body); block != nil {
+		return block.Bytes
+	}
+	return body
+}
@@ -0,0 +1,162 @@
+package system
+
+import (
+	"fmt"
+	"sync"
+	"time"
+	"testing"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+
+	"bloodtales/config"
+)
+
+// key set server counting fetches, each fetch waits for release (when set)
+func newTestKeyServer(t *testing.T, release chan struct{}) (server *httptest.Server, fetches *int32) {
+	body, err := ioutil.ReadFile("resources/auth/jwks.json")
+	if err != nil {
+		t.Fatalf("Failed to read key set: %v", err)
+	}
+
+	fetches = new(int32)
+	server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(fetches, 1)
+		if release != nil {
+			<-release
+		}
+		w.Write(body)
+	}))
+	t.Cleanup(server.Close)
+	return
+}
+
+func TestJSONWebKeyRefetchInterval(t *testing.T) {
+	useTestCredentials(t)
+	config.Config.Credentials.KeysRefetchInterval.Duration = time.Minute
+	server, fetches := newTestKeyServer(t, nil)
+
+	if _, err := getJSONWebKey(server.URL, "test"); err != nil {
+		t.Fatalf("Failed to get key: %v", err)
+	}
+
+	// unknown keys do not refetch until the interval has passed
+	for i := 0; i < 10; i++ {
+		if _, err := getJSONWebKey(server.URL, "rotated"); err == nil {
+			t.Fatalf("Got unknown key")
+		}
+	}
+	if count := atomic.LoadInt32(fetches); count != 1 {
+		t.Errorf("Fetched %d times within the interval, want 1", count)
+	}
+
+	keyMutex.Lock()
+	keyCaches[server.URL].fetched = time.Now().Add(-2 * time.Minute)
+	keyMutex.Unlock()
+
+	if _, err := getJSONWebKey(server.URL, "rotated"); err == nil {
+		t.Fatalf("Got unknown key")
+	}
+	if count := atomic.LoadInt32(fetches); count != 2 {
+		t.Errorf("Fetched %d times after the interval, want 2", count)
+	}
+
+	// known keys still come from the cache
+	if _, err := getJSONWebKey(server.URL, "test"); err != nil {
+		t.Errorf("Failed to get cached key: %v", err)
+	}
+	if count := atomic.LoadInt32(fetches); count != 2 {
+		t.Errorf("Fetched %d times for a cached key, want 2", count)
+	}
+}
+
+func TestJSONWebKeyConcurrentFetch(t *testing.T) {
+	useTestCredentials(t)
+	release := make(chan struct{})
+	server, fetches := newTestKeyServer(t, release)
+
+	// lookups during a fetch wait for it instead of fetching again
+	var group sync.WaitGroup
+	errs := make(chan error, 20)
+	for i := 0; i < cap(errs); i++ {
+		group.Add(1)
+		go func() {
+			defer group.Done()
+			_, err := getJSONWebKey(server.URL, "test")
+			errs <- err
+		}()
+	}
+
+	time.Sleep(50 * time.Millisecond)
+	close(release)
+	group.Wait()
+	close(errs)
+
+	for err := range errs {
+		if err != nil {
+			t.Errorf("Failed to get key: %v", err)
+		}
+	}
+	if count := atomic.LoadInt32(fetches); count != 1 {
+		t.Errorf("Fetched %d times, want 1", count)
+	}
+}
+
+func TestJSONWebKeyFetchOutsideLock(t *testing.T) {
+	useTestCredentials(t)
+	cached, _ := newTestKeyServer(t, nil)
+	release := make(chan struct{})
+	slow, _ := newTestKeyServer(t, release)
+
+	if _, err := getJSONWebKey(cached.URL, "test"); err != nil {
+		t.Fatalf("Failed to get key: %v", err)
+	}
+
+	// a slow key server does not hold up lookups of other key sets
+	slowDone := make(chan error, 1)
+	go func() {
+		_, err := getJSONWebKey(slow.URL, "test")
+		slowDone <- err
+	}()
+	time.Sleep(50 * time.Millisecond)
+
+	done := make(chan error)
+	go func() {
+		_, err := getJSONWebKey(cached.URL, "test")
+		done <- err
+	}()
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Errorf("Failed to get cached key: %v", err)
+		}
+	case <-time.After(time.Second):
+		t.Errorf("Cached key lookup blocked by another fetch")
+	}
+	// the slow fetch finishes before the test resets the key caches
+	close(release)
+	if err := <-slowDone; err != nil {
+		t.Errorf("Failed to get key from the slow server: %v", err)
+	}
+}
+
+func TestKeyCachesBounded(t *testing.T) {
+	useTestCredentials(t)
+	config.Config.Credentials.KeysRefetchInterval.Duration = time.Minute
+	server, _ := newTestKeyServer(t, nil)
+
+	// distinct URLs (e.g. client supplied) do not grow the caches without limit
+	for i := 0; i < maxKeyCaches * 2; i++ {
+		if _, err := getJSONWebKey(fmt.Sprintf("%s/keys/%d", server.URL, i), "test"); err != nil {
+			t.Fatalf("Failed to get key: %v", err)
+		}
+	}
+
+	keyMutex.Lock()
+	count := len(keyCaches)
+	keyMutex.Unlock()
+	if count > maxKeyCaches {
+		t.Errorf("Cached %d key URLs, want at most %d", count, maxKeyCaches)
+	}
+}
@@ -0,0 +1,87 @@
+package system
+
+import (
+	"bufio"
+	"errors"
+	"net"
+	"time"
+	"strconv"
+	"net/http"
+	"crypto/subtle"
+
+	"bloodtales/config"
+	"bloodtales/log"
+	"bloodtales/util"
+)
+
+// response writer remembering status code (sockets still need to hijack)
+type statusRecorder struct {
+	http.ResponseWriter
+
+	status          int
+}
+
+var (
+	// metrics
+	requestCount    *util.Metric = util.NewCounter("http_requests_total", "HTTP requests by route and status.", "method", "route", "status")
+	requestDuration *util.Metric = util.NewHistogram("http_request_duration_seconds", "HTTP request latency by route.", nil, "method", "route")
+)
+
+func init() {
+	App.HandleFunc("/metrics", metricsHandler).Methods("GET")
+}
+
+// prometheus scrape endpoint (bearer token required if configured)
+func metricsHandler(w http.ResponseWriter, r *http.Request) {
+	token := config.Config.Server.MetricsToken
+	if token != "" && subtle.ConstantTimeCompare([]byte(r.Header.Get("Authorization")), []byte("Bearer " + token)) != 1 {
+		http.Error(w, http.StatusText(http.StatusUnauthorized), http.StatusUnauthorized)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+	if err := util.WriteMetrics(w); err != nil {
+		log.Errorf("Failed to write metrics: %v", err)
+	}
+}
+
+func observeRequest(recorder *statusRecorder, r *http.Request, pattern *string, start time.Time) {
+	status := recorder.status
+	if status == 0 {
+		status = http.StatusOK
+	}
+
+	requestCount.Inc(r.Method, *pattern, strconv.Itoa(status))
+	requestDuration.ObserveSince(start, r.Method, *pattern)
+}
+
+func (recorder *statusRecorder) WriteHeader(status int) {
+	if recorder.status == 0 {
+		recorder.status = status
+	}
+	recorder.ResponseWriter.WriteHeader(status)
+}
+
+func (recorder *statusRecorder) Write(p []byte) (int, error) {
+	if recorder.status == 0 {
+		recorder.status = http.StatusOK
+	}
+	return recorder.ResponseWriter.Write(p)
+}
+
+func (recorder *statusRecorder) Flush() {
+	if flusher, ok := recorder.ResponseWriter.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
+
+func (recorder *statusRecorder) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	hijacker, ok := recorder.ResponseWriter.(http.Hijacker)
+	if !ok {
+		return nil, nil, errors.New("Response writer does not support hijacking")
+	}
+
+	// upgraded connections are reported as switching protocols
+	recorder.status = http.StatusSwitchingProtocols
+	return hijacker.Hijack()
+}
@@ -64,8 +64,8 @@ func handleAuthCallback(context *util.Context) {
 	// 	panic(err)
 	// }
 	// session.Values["heroku-oauth-token"] = token
-	context.Session.Set("oauth-token", token)
-	util.Must(context.Session.Save())
+	context.Session().Set("oauth-token", token)
+	util.Must(context.Session().Save())
 
 	context.Redirect("/user", http.StatusFound) // TODO - where should it redirect for mobile?
 }
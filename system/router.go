@@ -0,0 +1,275 @@
+package system
+
+import (
+	"fmt"
+	"time"
+	"strings"
+	"net/http"
+
+	"bloodtales/log"
+	"bloodtales/util"
+)
+
+// request middleware, calls next to continue the chain (or fails the context to stop it)
+type Middleware func(context *util.Context, next func(*util.Context))
+
+// raw route handler, with any matched path parameters
+type routeHandler func(w http.ResponseWriter, r *http.Request, params map[string]string)
+
+// single route (patterns may contain :name parameters, and match a subtree when ending with /)
+type Route struct {
+	Pattern         string
+
+	// internal
+	methods         []string
+	segments        []string
+	subtree         bool
+	group           *RouteGroup
+	middleware      []Middleware
+	handler         routeHandler
+	spec            *routeSpec
+}
+
+// set of routes sharing a path prefix and middleware chain
+type RouteGroup struct {
+	// internal
+	prefix          string
+	parent          *RouteGroup
+	middleware      []Middleware
+	router          *Router
+}
+
+// method and path router
+type Router struct {
+	RouteGroup
+
+	// internal
+	routes          []*Route
+}
+
+// default methods for routes without explicit constraints
+var DefaultMethods []string = []string { "GET", "POST" }
+
+func NewRouter() *Router {
+	router := &Router {}
+	router.RouteGroup.router = router
+	return router
+}
+
+// create a nested route group
+func (group *RouteGroup) Group(prefix string, middleware ...Middleware) *RouteGroup {
+	return &RouteGroup {
+		prefix: group.prefix + prefix,
+		parent: group,
+		middleware: middleware,
+		router: group.router,
+	}
+}
+
+// add middleware to all routes in group (including routes already added)
+func (group *RouteGroup) Use(middleware ...Middleware) *RouteGroup {
+	group.middleware = append(group.middleware, middleware...)
+	return group
+}
+
+// get full middleware chain, outermost group first
+func (group *RouteGroup) getMiddleware() []Middleware {
+	if group.parent == nil {
+		return group.middleware
+	}
+	return append(append([]Middleware {}, group.parent.getMiddleware()...), group.middleware...)
+}
+
+func (group *RouteGroup) add(pattern string, handler routeHandler) *Route {
+	pattern = group.prefix + pattern
+	trimmed := strings.Trim(pattern, "/")
+
+	route := &Route {
+		Pattern: pattern,
+		methods: DefaultMethods,
+		subtree: strings.HasSuffix(pattern, "/"),
+		group: group,
+		handler: handler,
+	}
+	if trimmed != "" {
+		route.segments = strings.Split(trimmed, "/")
+	}
+	route.spec = newRouteSpec(route)
+
+	group.router.routes = append(group.router.routes, route)
+	return route
+}
+
+// handle raw HTTP requests (no context, authentication or middleware)
+func (group *RouteGroup) HandleFunc(pattern string, handler http.HandlerFunc) *Route {
+	return group.add(pattern, func(w http.ResponseWriter, r *http.Request, params map[string]string) {
+		handler(w, r)
+	})
+}
+
+func (group *RouteGroup) HandleAPI(pattern string, authType AuthenticationType, handler func(*util.Context)) *Route {
+	return group.handle(pattern, authType, handler, "")
+}
+
+func (group *RouteGroup) HandleTemplate(pattern string, authType AuthenticationType, handler func(*util.Context), template string) *Route {
+	return group.handle(pattern, authType, handler, template)
+}
+
+func (group *RouteGroup) handle(pattern string, authType AuthenticationType, handler func(*util.Context), template string) (route *Route) {
+	route = group.add(pattern, func(w http.ResponseWriter, r *http.Request, params map[string]string) {
+		// create context
+		context := util.CreateContext(w, r)
+		context.Route = route.Pattern
+
+		// prepare request response
+		defer context.EndRequest(time.Now())
+
+		// init context handling
+		context.BeginRequest(template)
+
+		// path parameters
+		for name, value := range params {
+			context.Params.Set(name, value)
+		}
+
+		// run group and route middleware, then validate declared parameters before handler
+		chain := append(append([]Middleware {}, route.group.getMiddleware()...), route.middleware...)
+		runMiddleware(context, append(chain, route.validateParams), handler)
+	})
+
+	// authentication precedes any route specific middleware
+	route.middleware = []Middleware { Authenticate(authType) }
+	route.spec.authType, route.spec.template, route.spec.context = authType, template, true
+	return
+}
+
+// restrict route to HTTP methods (HEAD is implied by GET)
+func (route *Route) Methods(methods ...string) *Route {
+	route.methods = methods
+	return route
+}
+
+// add middleware to route, run after group middleware and authentication
+func (route *Route) Use(middleware ...Middleware) *Route {
+	route.middleware = append(route.middleware, middleware...)
+	return route
+}
+
+func (route *Route) allows(method string) bool {
+	for _, allowed := range route.methods {
+		if allowed == method || (allowed == "GET" && method == "HEAD") {
+			return true
+		}
+	}
+	return false
+}
+
+// match path against route, returning parameters and specificity (static segments matched)
+func (route *Route) match(path string) (params map[string]string, score int, ok bool) {
+	trimmed := strings.Trim(path, "/")
+	segments := []string {}
+	if trimmed != "" {
+		segments = strings.Split(trimmed, "/")
+	}
+
+	// subtrees match any deeper path, otherwise segment counts must agree
+	if len(segments) < len(route.segments) || (!route.subtree && len(segments) != len(route.segments)) {
+		return nil, 0, false
+	}
+	if !route.subtree && strings.HasSuffix(path, "/") && path != "/" {
+		return nil, 0, false
+	}
+
+	for i, segment := range route.segments {
+		if strings.HasPrefix(segment, ":") {
+			if params == nil {
+				params = map[string]string {}
+			}
+			params[segment[1:]] = segments[i]
+		} else if segment == segments[i] {
+			score += 2
+		} else {
+			return nil, 0, false
+		}
+	}
+
+	// exact routes beat subtrees with equal segments
+	if !route.subtree {
+		score++
+	}
+	return params, score, true
+}
+
+// run middleware chain, each middleware decides whether to continue
+func runMiddleware(context *util.Context, middleware []Middleware, handler func(*util.Context)) {
+	if len(middleware) == 0 {
+		handler(context)
+		return
+	}
+
+	middleware[0](context, func(context *util.Context) {
+		runMiddleware(context, middleware[1:], handler)
+	})
+}
+
+// authentication middleware
+func Authenticate(authType AuthenticationType) Middleware {
+	return func(context *util.Context, next func(*util.Context)) {
+		err := authenticate(context, authType)
+		if err != nil {
+			context.Fail(fmt.Sprintf("Failed to authenticate user: %v", err))
+		}
+
+		// handle request if authenticated
+		if context.Success {
+			next(context)
+		}
+	}
+}
+
+func (router *Router) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	// record request metrics by route pattern
+	recorder := &statusRecorder { ResponseWriter: w }
+	pattern := "unmatched"
+	defer observeRequest(recorder, r, &pattern, time.Now())
+	w = recorder
+
+	// find most specific matching routes (one per method set)
+	var candidates []*Route
+	var candidateParams []map[string]string
+	bestScore := -1
+
+	for _, route := range router.routes {
+		params, score, ok := route.match(r.URL.Path)
+		if !ok || score < bestScore {
+			continue
+		}
+
+		if score > bestScore {
+			candidates, candidateParams, bestScore = nil, nil, score
+		}
+		candidates = append(candidates, route)
+		candidateParams = append(candidateParams, params)
+	}
+
+	if len(candidates) == 0 {
+		http.NotFound(w, r)
+		return
+	}
+
+	// handle with first route allowing method
+	allowed := []string {}
+	for i, route := range candidates {
+		if route.allows(r.Method) {
+			pattern = route.Pattern
+			route.handler(w, r, candidateParams[i])
+			return
+		}
+		allowed = append(allowed, route.methods...)
+	}
+
+	log.Printf("[red!]Invalid request method: %s %s[-]", r.Method, r.URL.RequestURI())
+
+	w.Header().Set("Allow", strings.Join(allowed, ", "))
+	http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+}
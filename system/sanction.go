@@ -0,0 +1,41 @@
+package system
+
+import (
+	"fmt"
+	"errors"
+
+	"bloodtales/util"
+	"bloodtales/models"
+)
+
+// check current user has no active sanction of a type, setting a structured error in the response if they do
+func CheckSanction(context *util.Context, sanctionType models.SanctionType) (err error) {
+	user := GetUser(context)
+	if user == nil {
+		return
+	}
+
+	sanction, err := models.GetActiveSanction(context, user.ID, sanctionType)
+	if err != nil || sanction == nil {
+		return
+	}
+
+	// inform client of reason and expiry
+	context.SetData("sanction", sanction.GetSanctionClient())
+
+	if sanction.IsPermanent() {
+		err = errors.New(fmt.Sprintf("%s: %s", sanction.GetTypeName(), sanction.Reason))
+	} else {
+		err = errors.New(fmt.Sprintf("%s until %v: %s", sanction.GetTypeName(), sanction.ExpireTime.UTC(), sanction.Reason))
+	}
+	return
+}
+
+// fail the request if current user has an active sanction of a type
+func RequireNoSanction(context *util.Context, sanctionType models.SanctionType) bool {
+	if err := CheckSanction(context, sanctionType); err != nil {
+		context.Fail(err.Error())
+		return false
+	}
+	return true
+}
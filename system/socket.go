@@ -2,13 +2,14 @@ package system
 
 import (
 	"time"
+	gocontext "context"
 	"encoding/json"
 
-	"gopkg.in/mgo.v2"
 	"gopkg.in/mgo.v2/bson"
 	"github.com/gorilla/websocket"
 
 	"bloodtales/util"
+	"bloodtales/models"
 	"bloodtales/log"
 )
 
@@ -33,8 +34,6 @@ const (
 	bufferSize = 512
 )
 
-const SocketCollectionName = "sockets"
-
 // socket message
 type SocketMessage struct {
 	Message         string                  `json:"m"`
@@ -48,18 +47,15 @@ type SocketClient struct {
 	registered      bool
 	connection      *websocket.Conn
 	send            chan SocketMessage
+	closeCode       int
+	done            chan bool
 }
 
-// socket model
-type SocketModel struct {
-	ID              bson.ObjectId			`bson:"_id,omitempty" json:"-"`
-	CreatedAt       time.Time				`bson:"t0" json:"-"`
-	ExpiresAt       time.Time				`bson:"exp" json:"-"`
-	UserID          bson.ObjectId			`bson:"us,omitempty" json:"-"`
-	Message         string					`bson:"ms" json:"message"`
-	Data            map[string]interface{}  `bson:"-" json:"data"`
-	JsonData        string					`bson:"dt" json:"-"`
-}
+// metrics
+var (
+	socketConnections *util.Metric = util.NewGauge("socket_connections", "Registered socket connections.")
+	socketDrops       *util.Metric = util.NewCounter("socket_send_drops_total", "Socket messages dropped because the client send queue was full.")
+)
 
 // internal globals
 var (
@@ -67,6 +63,7 @@ var (
 	broadcast       chan SocketMessage = make(chan SocketMessage)
 	register        chan *SocketClient = make(chan *SocketClient)
 	unregister      chan *SocketClient = make(chan *SocketClient)
+	closeAll        chan chan []*SocketClient = make(chan chan []*SocketClient)
 	upgrader        websocket.Upgrader = websocket.Upgrader {
 		ReadBufferSize:  bufferSize,
 		WriteBufferSize: bufferSize,
@@ -96,22 +93,20 @@ func SocketSend(context *util.Context, userID bson.ObjectId, message string, dat
 
 	// put message into DB
 	rawJsonData, _ := json.Marshal(data)
-	socketModel := &SocketModel {
+	socketModel := &models.SocketModel {
 		UserID: userID,
 		Message: message,
 		JsonData: string(rawJsonData),
 	}
-	socketModel.save(context)
+	socketModel.Insert(context)
 }
 
 // socket broadcast handler
 func init() {
 	// handle route
-	App.HandleAPI("/socket/connect", TokenAuthentication, socketConnectHandler)
-	App.HandleAPI("/socket/poll", TokenAuthentication, socketPollHandler)
-
-	// indexes
-	ensureIndexSocket()
+	socketRoutes := App.Group("/socket")
+	socketRoutes.HandleAPI("/connect", TokenAuthentication, socketConnectHandler).Methods("GET").Describe("Open a websocket for notifications")
+	socketRoutes.HandleAPI("/poll", TokenAuthentication, socketPollHandler).Describe("Poll socket messages (long polling fallback)")
 
 	// start main listening routine
 	go func() {
@@ -122,6 +117,7 @@ func init() {
 			case client := <-register:
 				// add new client
 				clients[client.userID] = client
+				socketConnections.Set(float64(len(clients)))
 
 				logSocket("Registered socket for User ID: %v (%v total connections)", client.userID.Hex(), len(clients))
 
@@ -129,10 +125,22 @@ func init() {
 				// unregister client
 				if _, ok := clients[client.userID]; ok {
 					client.unregisterClient()
+					socketConnections.Set(float64(len(clients)))
 
 					logSocket("Unregistered socket for User ID: %v", client.userID.Hex())
 				}
 
+			case closed := <-closeAll:
+				// unregister all clients, sending close frames
+				closing := []*SocketClient {}
+				for _, client := range clients {
+					client.closeCode = websocket.CloseGoingAway
+					client.unregisterClient()
+					closing = append(closing, client)
+				}
+				socketConnections.Set(0)
+				closed <- closing
+
 			case message := <-broadcast:
 				// broadcast message to all clients
 				for userID := range clients {
@@ -149,9 +157,11 @@ func init() {
 
 					default:
 						log.Errorf("Socket broadcast error for User ID: %v", client.userID)
+						socketDrops.Inc()
 
 						// unregister client
 						client.unregisterClient()
+						socketConnections.Set(float64(len(clients)))
 
 					}
 				}
@@ -161,34 +171,6 @@ func init() {
 	}()
 }
 
-func ensureIndexSocket() {
-	// no-sql database
-	db := util.GetDatabaseConnection()
-	defer db.Session.Close()
-	defer func() {
-		// handle any panic errors
-		if err := recover(); err != nil {
-			util.LogError("Occurred during database initialization", err)
-		}
-	}()
-
-	c := db.C(SocketCollectionName)
-
-	// user index
-	util.Must(c.EnsureIndex(mgo.Index {
-		Key:        []string { "us", "t0" },
-		Background: true,
-		Sparse:     true,
-	}))
-
-	// expiration
-	util.Must(c.EnsureIndex(mgo.Index{
-		Key:         []string { "exp" },
-		Background:  true,
-		ExpireAfter: time.Second,
-	}))
-}
-
 // socket route handlers
 func socketConnectHandler(context *util.Context) {
 	// upgrade to web socket connection
@@ -205,6 +187,8 @@ func socketConnectHandler(context *util.Context) {
 		registered: false,
 		connection: connection,
 		send:       make(chan SocketMessage),
+		closeCode:  websocket.CloseNormalClosure,
+		done:       make(chan bool),
 	}
 
 	// handle connection close
@@ -228,22 +212,8 @@ func socketConnectHandler(context *util.Context) {
 func socketPollHandler(context *util.Context) {
 	user := GetUser(context)
 
-	// query conditions
-	query := bson.M { "$and": 
-		[]bson.M {
-			bson.M {
-				"$or": []bson.M {
-					bson.M { "us": context.UserID },
-					bson.M { "us": bson.M { "$exists": false} },
-				},
-			},
-			bson.M { "t0": bson.M { "$gt": user.LastSocketTime } },
-		},
-	}
-
 	// get all recently received socket messages
-	var socketModels []*SocketModel
-	err := context.DB.C(SocketCollectionName).Find(query).Sort("t0").All(&socketModels)
+	socketModels, err := models.GetSocketModelsSince(context, context.UserID, user.LastSocketTime)
 	util.Must(err)
 
 	// check if any messages were found
@@ -265,14 +235,22 @@ func socketPollHandler(context *util.Context) {
 	context.SetData("messages", socketModels)
 }
 
-func (socketModel *SocketModel) save(context *util.Context) (err error) {
-	socketModel.ID = bson.NewObjectId()
-	socketModel.CreatedAt = time.Now()
-	socketModel.ExpiresAt = time.Now().Add(time.Hour * time.Duration(24))
+// close all socket clients (used during shutdown), waiting for close frames until the deadline
+func CloseSockets(deadline gocontext.Context) {
+	closed := make(chan []*SocketClient)
+	closeAll <- closed
+	closing := <-closed
+
+	logSocket("Closing %v socket connections", len(closing))
 
-	// insert socket model in database
-	err = context.DB.C(SocketCollectionName).Insert(socketModel)
-	return
+	for _, client := range closing {
+		select {
+		case <-client.done:
+		case <-deadline.Done():
+			log.Errorf("Socket close timed out with %v connections", len(closing))
+			return
+		}
+	}
 }
 
 // socket client write
@@ -284,6 +262,7 @@ func (client *SocketClient) write() {
 	defer func() {
 		ticker.Stop()
 		client.close()
+		close(client.done)
 	}()
 
 	for {
@@ -297,7 +276,7 @@ func (client *SocketClient) write() {
 			if !ok {
 				if client.open {
 					// client send channel has been closed
-					err := client.connection.WriteMessage(websocket.CloseMessage, []byte {})
+					err := client.connection.WriteMessage(websocket.CloseMessage, websocket.FormatCloseMessage(client.closeCode, ""))
 					if err != nil {
 						log.Errorf("Socket failed to write close message: %v", err)
 					}
@@ -375,7 +354,7 @@ func (client *SocketClient) unregisterClient() {
 
 // socket logging
 func logSocket(message string, args ...interface{}) {
-	if debugSockets {
-		log.Printf("[magenta!]" + message + "[-]", args...)
+	if debugSockets && log.Sampled("socket") {
+		log.Debugf("[magenta!]" + message + "[-]", args...)
 	}
 }
\ No newline at end of file
@@ -0,0 +1,433 @@
+package system
+
+import (
+	"fmt"
+	"sync"
+	"strings"
+	"net/http"
+	"encoding/json"
+
+	"bloodtales/config"
+	"bloodtales/util"
+)
+
+// route parameter descriptor (documented in the API spec and validated before the handler)
+type Param struct {
+	Name            string
+	Type            util.ParamType
+	Required        bool
+	Default         interface{}
+	Values          []string
+	Description     string
+
+	// internal
+	path            bool
+}
+
+// route response data descriptor (JSON schema type: object, array, string, integer, number or boolean)
+type ResponseData struct {
+	Name            string
+	Type            string
+	Description     string
+}
+
+type routeSpec struct {
+	summary         string
+	params          []Param
+	data            []ResponseData
+	authType        AuthenticationType
+	template        string
+	context         bool
+	internal        bool
+}
+
+var (
+	// internal
+	specOnce        sync.Once
+	specRaw         []byte
+)
+
+func init() {
+	App.HandleFunc("/api/spec", specHandler).Methods("GET").Describe("OpenAPI document for public routes")
+}
+
+func Required(name string, paramType util.ParamType, description string) Param {
+	return Param {
+		Name: name,
+		Type: paramType,
+		Required: true,
+		Description: description,
+	}
+}
+
+func Optional(name string, paramType util.ParamType, defaultValue interface{}, description string) Param {
+	return Param {
+		Name: name,
+		Type: paramType,
+		Default: defaultValue,
+		Description: description,
+	}
+}
+
+// restrict parameter to a set of values
+func (param Param) OneOf(values ...string) Param {
+	param.Values = values
+	return param
+}
+
+func Data(name string, dataType string, description string) ResponseData {
+	return ResponseData {
+		Name: name,
+		Type: dataType,
+		Description: description,
+	}
+}
+
+// create spec with path parameters from the route pattern
+func newRouteSpec(route *Route) *routeSpec {
+	spec := &routeSpec {}
+	for _, segment := range route.segments {
+		if strings.HasPrefix(segment, ":") {
+			spec.params = append(spec.params, Param {
+				Name: segment[1:],
+				Type: util.StringParam,
+				Required: true,
+				path: true,
+			})
+		}
+	}
+	return spec
+}
+
+// set route summary
+func (route *Route) Describe(summary string) *Route {
+	route.spec.summary = summary
+	return route
+}
+
+// declare route parameters (path parameters keep their location)
+func (route *Route) Params(params ...Param) *Route {
+	for _, param := range params {
+		found := false
+		for i, existing := range route.spec.params {
+			if existing.Name == param.Name {
+				param.path = existing.path
+				route.spec.params[i] = param
+				found = true
+				break
+			}
+		}
+		if !found {
+			route.spec.params = append(route.spec.params, param)
+		}
+	}
+	return route
+}
+
+// leave route out of the public API spec (admin and debug routes)
+func (route *Route) Internal() *Route {
+	route.spec.internal = true
+	return route
+}
+
+// declare response data
+func (route *Route) Returns(data ...ResponseData) *Route {
+	route.spec.data = append(route.spec.data, data...)
+	return route
+}
+
+// validation middleware, failing requests with missing or invalid declared parameters
+// and setting declared defaults for missing ones (so handlers read them without a fallback)
+func (route *Route) validateParams(context *util.Context, next func(*util.Context)) {
+	for _, param := range route.spec.params {
+		if err := context.Params.Validate(param.Name, param.Type, param.Required); err != nil {
+			context.Fail(err.Error())
+			return
+		}
+
+		if param.Default != nil {
+			if value, ok := context.Params.Get(param.Name).(string); ok && value == "" {
+				context.Params.Set(param.Name, param.Default)
+			}
+		}
+
+		if len(param.Values) > 0 {
+			if value := context.Params.GetString(param.Name, ""); value != "" && !param.allows(value) {
+				context.Fail(fmt.Sprintf("Invalid value: \"%s\" = \"%s\" (expected one of: %s)", param.Name, value, strings.Join(param.Values, ", ")))
+				return
+			}
+		}
+	}
+
+	next(context)
+}
+
+func specHandler(w http.ResponseWriter, r *http.Request) {
+	// routes are all registered before serving
+	specOnce.Do(func() {
+		var err error
+		if specRaw, err = json.Marshal(App.Spec()); err != nil {
+			panic(err)
+		}
+	})
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(specRaw)
+}
+
+// generate OpenAPI 3 document from registered public routes (raw routes only when described)
+func (router *Router) Spec() map[string]interface{} {
+	paths := map[string]interface{} {}
+	for _, route := range router.routes {
+		if route.spec.internal || (!route.spec.context && route.spec.summary == "") {
+			continue
+		}
+
+		path := route.openAPIPath()
+		operations, ok := paths[path].(map[string]interface{})
+		if !ok {
+			operations = map[string]interface{} {}
+			paths[path] = operations
+		}
+
+		for _, method := range route.methods {
+			operations[strings.ToLower(method)] = route.operation(method)
+		}
+	}
+
+	return map[string]interface{} {
+		"openapi": "3.0.3",
+		"info": map[string]interface{} {
+			"title": "Bloodtales API",
+			"version": config.Config.Platform.Version,
+		},
+		"paths": paths,
+		"components": map[string]interface{} {
+			"schemas": map[string]interface{} {
+				"Response": map[string]interface{} {
+					"type": "object",
+					"properties": map[string]interface{} {
+						"requestId": map[string]interface{} { "type": "string" },
+						"token": map[string]interface{} { "type": "string" },
+						"success": map[string]interface{} { "type": "boolean" },
+						"messages": map[string]interface{} { "type": "array", "items": map[string]interface{} { "type": "string" } },
+						"data": map[string]interface{} { "type": "object" },
+					},
+				},
+			},
+		},
+	}
+}
+
+// pattern with OpenAPI path parameters
+func (route *Route) openAPIPath() string {
+	segments := make([]string, len(route.segments))
+	for i, segment := range route.segments {
+		if strings.HasPrefix(segment, ":") {
+			segment = "{" + segment[1:] + "}"
+		}
+		segments[i] = segment
+	}
+	return "/" + strings.Join(segments, "/")
+}
+
+func (route *Route) operation(method string) map[string]interface{} {
+	spec := route.spec
+	operation := map[string]interface{} {}
+	if spec.summary != "" {
+		operation["summary"] = spec.summary
+	}
+	if len(route.segments) > 0 {
+		operation["tags"] = []string { strings.TrimPrefix(route.segments[0], ":") }
+	}
+
+	// path parameters, then query or body parameters (including authentication)
+	parameters := []interface{} {}
+	properties := map[string]interface{} {}
+	required := []string {}
+	for _, param := range append(append([]Param {}, spec.params...), authenticationParams(spec.authType)...) {
+		if param.path || method != "POST" {
+			location := "query"
+			if param.path {
+				location = "path"
+			}
+
+			parameter := map[string]interface{} {
+				"name": param.Name,
+				"in": location,
+				"required": param.Required,
+				"schema": param.schema(),
+			}
+			if param.Description != "" {
+				parameter["description"] = param.Description
+			}
+			if isListParam(param.Type) {
+				parameter["style"] = "form"
+				parameter["explode"] = false
+			}
+			parameters = append(parameters, parameter)
+		} else {
+			schema := param.schema()
+			if param.Description != "" {
+				schema["description"] = param.Description
+			}
+			properties[param.Name] = schema
+			if param.Required {
+				required = append(required, param.Name)
+			}
+		}
+	}
+	if len(parameters) > 0 {
+		operation["parameters"] = parameters
+	}
+
+	// body parameters as form values or an equivalent binary map
+	if len(properties) > 0 {
+		schema := map[string]interface{} {
+			"type": "object",
+			"properties": properties,
+		}
+		if len(required) > 0 {
+			schema["required"] = required
+		}
+
+		content := map[string]interface{} {
+			"application/x-www-form-urlencoded": map[string]interface{} { "schema": schema },
+		}
+		if spec.context && spec.template == "" {
+			content[string(util.WireMsgPack)] = map[string]interface{} { "schema": schema }
+			content[string(util.WireCBOR)] = map[string]interface{} { "schema": schema }
+		}
+		operation["requestBody"] = map[string]interface{} {
+			"required": len(required) > 0,
+			"content": content,
+		}
+	}
+
+	// responses
+	response := map[string]interface{} {
+		"description": "Success",
+	}
+	switch {
+	case spec.context && spec.template != "":
+		response["description"] = "HTML page"
+		response["content"] = map[string]interface{} {
+			"text/html": map[string]interface{} {},
+		}
+
+	case spec.context:
+		data := map[string]interface{} {}
+		for _, item := range spec.data {
+			schema := map[string]interface{} { "type": item.Type }
+			if item.Description != "" {
+				schema["description"] = item.Description
+			}
+			data[item.Name] = schema
+		}
+
+		schema := map[string]interface{} {
+			"allOf": []interface{} {
+				map[string]interface{} { "$ref": "#/components/schemas/Response" },
+				map[string]interface{} {
+					"properties": map[string]interface{} {
+						"data": map[string]interface{} {
+							"type": "object",
+							"properties": data,
+						},
+					},
+				},
+			},
+		}
+
+		response["description"] = "Response envelope"
+		response["content"] = map[string]interface{} {
+			string(util.WireJSON): map[string]interface{} { "schema": schema },
+			string(util.WireMsgPack): map[string]interface{} { "schema": schema },
+			string(util.WireCBOR): map[string]interface{} { "schema": schema },
+		}
+	}
+	operation["responses"] = map[string]interface{} {
+		"200": response,
+	}
+	return operation
+}
+
+// JSON schema for parameter values
+func (param Param) schema() map[string]interface{} {
+	var schema map[string]interface{}
+	switch param.Type {
+	case util.IntParam:
+		schema = map[string]interface{} { "type": "integer", "format": "int32" }
+	case util.Int64Param:
+		schema = map[string]interface{} { "type": "integer", "format": "int64" }
+	case util.FloatParam:
+		schema = map[string]interface{} { "type": "number" }
+	case util.BoolParam:
+		schema = map[string]interface{} { "type": "boolean" }
+	case util.IdParam:
+		schema = map[string]interface{} { "type": "string", "pattern": "^[0-9a-fA-F]{24}$" }
+	case util.JSONParam:
+		schema = map[string]interface{} { "type": "string", "format": "json" }
+	case util.StringsParam:
+		schema = map[string]interface{} { "type": "array", "items": map[string]interface{} { "type": "string" } }
+	case util.IntsParam:
+		schema = map[string]interface{} { "type": "array", "items": map[string]interface{} { "type": "integer" } }
+	case util.IdsParam:
+		schema = map[string]interface{} { "type": "array", "items": map[string]interface{} { "type": "string", "pattern": "^[0-9a-fA-F]{24}$" } }
+	default:
+		schema = map[string]interface{} { "type": "string" }
+	}
+
+	if param.Default != nil {
+		schema["default"] = param.Default
+	}
+	if len(param.Values) > 0 {
+		if items, ok := schema["items"].(map[string]interface{}); ok {
+			items["enum"] = param.Values
+		} else {
+			schema["enum"] = param.Values
+		}
+	}
+	return schema
+}
+
+func (param Param) allows(value string) bool {
+	for _, allowed := range param.Values {
+		if allowed == value {
+			return true
+		}
+	}
+	return false
+}
+
+func isListParam(paramType util.ParamType) bool {
+	return paramType == util.StringsParam || paramType == util.IntsParam || paramType == util.IdsParam
+}
+
+// parameters read by authentication (validated by authentication itself)
+func authenticationParams(authType AuthenticationType) []Param {
+	token := Optional("token", util.StringParam, nil, "Authentication token (otherwise taken from the session)")
+	device := []Param {
+		Optional("uuid", util.StringParam, nil, "Device UUID"),
+		Optional("credentials", util.JSONParam, nil, "Credential claims (JSON array)"),
+		Optional("tag", util.StringParam, nil, "Player tag (debug login)"),
+		Optional("debug", util.StringParam, nil, "Debug token (debug login)"),
+	}
+	password := []Param {
+		Optional("username", util.StringParam, nil, "Username"),
+		Optional("password", util.StringParam, nil, "Password"),
+	}
+
+	switch authType {
+	case TokenAuthentication:
+		return []Param { token }
+	case DeviceAuthentication:
+		return device
+	case PasswordAuthentication:
+		password[0].Required, password[1].Required = true, true
+		return password
+	case AnyAuthentication:
+		return append(append([]Param { token }, password...), device...)
+	}
+	return nil
+}
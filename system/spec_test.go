@@ -0,0 +1,62 @@
+package system
+
+import (
+	"testing"
+	"net/http/httptest"
+
+	"bloodtales/util"
+)
+
+func TestSpecLeavesOutInternalRoutes(t *testing.T) {
+	router := NewRouter()
+	handler := func(context *util.Context) {}
+	router.HandleAPI("/player/get", NoAuthentication, handler).Describe("Get player")
+	router.HandleTemplate("/admin/users", TokenAuthentication, handler, "").Describe("List users").Internal()
+	router.HandleAPI("/debug/addCards", TokenAuthentication, handler).Describe("Debug: add cards").Internal()
+
+	paths := router.Spec()["paths"].(map[string]interface{})
+	if _, ok := paths["/player/get"]; !ok {
+		t.Errorf("Public route missing from spec")
+	}
+	for _, path := range []string { "/admin/users", "/debug/addCards" } {
+		if _, ok := paths[path]; ok {
+			t.Errorf("Internal route %s listed in spec", path)
+		}
+	}
+}
+
+func TestValidateParamsDefaults(t *testing.T) {
+	router := NewRouter()
+	route := router.HandleAPI("/replay/search", NoAuthentication, func(context *util.Context) {}).Params(
+		Optional("limit", util.IntParam, 20, "Page size"),
+		Optional("league", util.IntParam, nil, "League"),
+	)
+
+	tests := []struct {
+		name        string
+		query       string
+		limit       int
+	}{
+		{"declared default", "", 20},
+		{"given value", "?limit=5", 5},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			context := util.CreateContext(httptest.NewRecorder(), httptest.NewRequest("GET", "/replay/search" + test.query, nil))
+			called := false
+			route.validateParams(context, func(context *util.Context) {
+				called = true
+				if limit := context.Params.GetRequiredInt("limit"); limit != test.limit {
+					t.Errorf("Limit = %d, want %d", limit, test.limit)
+				}
+				if context.Params.Has("league") {
+					t.Errorf("Set a league without a declared default")
+				}
+			})
+			if !called {
+				t.Fatalf("Validation failed: %v", context.Messages)
+			}
+		})
+	}
+}
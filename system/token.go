@@ -27,7 +27,7 @@ func authenticateToken(context *util.Context, required bool) (err error) {
 	unparsedToken := context.Params.GetString("token", "")
 	if unparsedToken == "" {
 		// if not found, then check session
-		unparsedToken = context.Session.GetString("token", "")
+		unparsedToken = context.Session().GetString("token", "")
 	}
 
 	if unparsedToken != "" {
@@ -89,7 +89,7 @@ func ValidateTokenWithoutClaims(context *util.Context) (valid bool, err error) {
 	unparsedToken := context.Params.GetString("token", "")
 	if unparsedToken == "" {
 		// if not found, then check session
-		unparsedToken = context.Session.GetString("token", "")
+		unparsedToken = context.Session().GetString("token", "")
 	}
 
 	if unparsedToken != "" {
@@ -141,7 +141,7 @@ func IssueAuthToken(context *util.Context) (err error) {
 	// create auth token
 	token := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims {
 		"id": user.ID.Hex(),
-		"exp": time.Now().Add(time.Second * config.Config.Authentication.TokenExpiration).Unix(),
+		"exp": time.Now().Add(config.Config.Authentication.TokenExpiration.Duration).Unix(),
 	})
 
 	// sign and get the complete encoded token as string
@@ -149,14 +149,14 @@ func IssueAuthToken(context *util.Context) (err error) {
 
 	// store auth token in session
 	if err == nil {
-		context.Session.Set("token", context.Token)
-		context.Session.Save()
+		context.Session().Set("token", context.Token)
+		context.Session().Save()
 	}
 	return
 }
 
 func ClearAuthToken(context *util.Context) {
 	// clear auth token from session
-	context.Session.Set("token", "")
-	context.Session.Save()
+	context.Session().Set("token", "")
+	context.Session().Save()
 }
\ No newline at end of file
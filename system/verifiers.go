@@ -0,0 +1,219 @@
+package system
+
+import (
+	"fmt"
+	"time"
+	"errors"
+	"strings"
+	"crypto"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/base64"
+
+	"github.com/dgrijalva/jwt-go"
+
+	"bloodtales/config"
+	"bloodtales/models"
+)
+
+// credential providers
+const (
+	GoogleProvider      = "google"
+	AppleProvider       = "apple"
+	GameCenterProvider  = "gamecenter"
+)
+
+// unverified credential submitted by client
+type CredentialClaim struct {
+	Provider        string        `json:"provider"`
+
+	// Google and Apple identity token
+	Token           string        `json:"token"`
+
+	// Game Center identity signature
+	PlayerID        string        `json:"playerId"`
+	BundleID        string        `json:"bundleId"`
+	PublicKeyURL    string        `json:"publicKeyUrl"`
+	Signature       string        `json:"signature"`
+	Salt            string        `json:"salt"`
+	Timestamp       uint64        `json:"timestamp"`
+}
+
+// verifier for a single credential provider, returns the verified provider ID
+type CredentialVerifier func(claim *CredentialClaim) (id string, err error)
+
+var (
+	// internal
+	credentialVerifiers map[string]CredentialVerifier = map[string]CredentialVerifier {
+		GoogleProvider: verifyGoogleCredential,
+		AppleProvider: verifyAppleCredential,
+		GameCenterProvider: verifyGameCenterCredential,
+	}
+)
+
+// register or replace a credential verifier
+func HandleCredentialVerifier(provider string, verifier CredentialVerifier) {
+	credentialVerifiers[provider] = verifier
+}
+
+// verify claims and convert to credentials
+func VerifyCredentials(claims []CredentialClaim) (credentials []models.Credential, err error) {
+	credentials = make([]models.Credential, len(claims))
+	for i, _ := range claims {
+		claim := &claims[i]
+
+		verifier, ok := credentialVerifiers[claim.Provider]
+		if !ok {
+			return nil, errors.New(fmt.Sprintf("Unsupported credential provider: %s", claim.Provider))
+		}
+
+		id, err := verifier(claim)
+		if err != nil {
+			return nil, errors.New(fmt.Sprintf("Failed to verify %s credential: %v", claim.Provider, err))
+		}
+
+		credentials[i] = models.Credential { Provider: claim.Provider, ID: id }
+	}
+	return
+}
+
+// verify RS256 identity token signed by a key from the given JSON web key set
+func verifyIdentityToken(unparsedToken string, keysURL string, issuers []string, audiences []string) (subject string, err error) {
+	var token *jwt.Token
+	token, err = jwt.Parse(unparsedToken, func(token *jwt.Token) (interface{}, error) {
+		// validate the alg is what you expect
+		if _, ok := token.Method.(*jwt.SigningMethodRSA); !ok {
+			return nil, errors.New(fmt.Sprintf("Unexpected identity signing method: %v", token.Header["alg"]))
+		}
+
+		keyID, _ := token.Header["kid"].(string)
+		return getJSONWebKey(keysURL, keyID)
+	})
+	if err != nil {
+		return
+	}
+
+	claims, ok := token.Claims.(jwt.MapClaims)
+	if !ok || !token.Valid {
+		err = errors.New("Invalid identity token")
+		return
+	}
+
+	// check issuer
+	issuerValid := false
+	for _, issuer := range issuers {
+		if claims.VerifyIssuer(issuer, true) {
+			issuerValid = true
+			break
+		}
+	}
+	if !issuerValid {
+		err = errors.New(fmt.Sprintf("Invalid identity token issuer: %v", claims["iss"]))
+		return
+	}
+
+	// check audience
+	audienceValid := false
+	for _, audience := range audiences {
+		if claims.VerifyAudience(audience, true) {
+			audienceValid = true
+			break
+		}
+	}
+	if !audienceValid {
+		err = errors.New(fmt.Sprintf("Invalid identity token audience: %v", claims["aud"]))
+		return
+	}
+
+	// get subject
+	if subject, ok = claims["sub"].(string); !ok || subject == "" {
+		err = errors.New("Missing identity token subject")
+	}
+	return
+}
+
+func verifyGoogleCredential(claim *CredentialClaim) (id string, err error) {
+	settings := &config.Config.Credentials
+	return verifyIdentityToken(claim.Token, settings.GoogleKeysURL, settings.GoogleIssuers, settings.GoogleClientIDs)
+}
+
+func verifyAppleCredential(claim *CredentialClaim) (id string, err error) {
+	settings := &config.Config.Credentials
+	return verifyIdentityToken(claim.Token, settings.AppleKeysURL, []string { settings.AppleIssuer }, settings.AppleClientIDs)
+}
+
+func verifyGameCenterCredential(claim *CredentialClaim) (id string, err error) {
+	settings := &config.Config.Credentials
+
+	if claim.PlayerID == "" {
+		err = errors.New("Missing player ID")
+		return
+	}
+
+	// check public key URL is trusted
+	trusted := false
+	for _, prefix := range settings.GameCenterKeyURLs {
+		if strings.HasPrefix(claim.PublicKeyURL, prefix) {
+			trusted = true
+			break
+		}
+	}
+	if !trusted {
+		err = errors.New(fmt.Sprintf("Untrusted public key URL: %s", claim.PublicKeyURL))
+		return
+	}
+
+	// check bundle ID
+	bundleValid := false
+	for _, bundleID := range settings.GameCenterBundleIDs {
+		if claim.BundleID == bundleID {
+			bundleValid = true
+			break
+		}
+	}
+	if !bundleValid {
+		err = errors.New(fmt.Sprintf("Invalid bundle ID: %s", claim.BundleID))
+		return
+	}
+
+	// check timestamp (milliseconds) is recent
+	signedTime := time.Unix(0, int64(claim.Timestamp) * int64(time.Millisecond))
+	if age := time.Since(signedTime); age > settings.GameCenterMaxAge.Duration || age < -settings.GameCenterMaxAge.Duration {
+		err = errors.New(fmt.Sprintf("Expired identity signature: %v", signedTime))
+		return
+	}
+
+	// decode signature and salt
+	var signature, salt []byte
+	if signature, err = base64.StdEncoding.DecodeString(claim.Signature); err != nil {
+		return
+	}
+	if salt, err = base64.StdEncoding.DecodeString(claim.Salt); err != nil {
+		return
+	}
+
+	// get public key
+	var publicKey *rsa.PublicKey
+	if publicKey, err = getCertificateKey(claim.PublicKeyURL); err != nil {
+		return
+	}
+
+	// build signed payload: player ID + bundle ID + timestamp (big-endian) + salt
+	timestamp := make([]byte, 8)
+	binary.BigEndian.PutUint64(timestamp, claim.Timestamp)
+
+	hash := sha256.New()
+	hash.Write([]byte(claim.PlayerID))
+	hash.Write([]byte(claim.BundleID))
+	hash.Write(timestamp)
+	hash.Write(salt)
+
+	// verify signature
+	if err = rsa.VerifyPKCS1v15(publicKey, crypto.SHA256, hash.Sum(nil), signature); err != nil {
+		return
+	}
+
+	id = claim.PlayerID
+	return
+}
@@ -0,0 +1,171 @@
+package system
+
+import (
+	"time"
+	"testing"
+	"io/ioutil"
+	"crypto"
+	"crypto/rsa"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/base64"
+
+	"github.com/dgrijalva/jwt-go"
+
+	"bloodtales/config"
+)
+
+// test keys: jwks.json holds the public key of identity-key.pem, gamecenter.cer the certificate of gamecenter-key.pem
+const (
+	testKeysURL              = "file://resources/auth/jwks.json"
+	testIdentityKeyPath      = "resources/auth/identity-key.pem"
+	testGameCenterKeyPath    = "resources/auth/gamecenter-key.pem"
+	testGameCenterKeyURL     = "file://resources/auth/gamecenter.cer"
+	testIssuer               = "https://accounts.example.com"
+	testClientID             = "bloodtales-test"
+	testBundleID             = "com.bloodtales.test"
+)
+
+func readTestKey(t *testing.T, path string) *rsa.PrivateKey {
+	raw, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatalf("Failed to read key %s: %v", path, err)
+	}
+	key, err := jwt.ParseRSAPrivateKeyFromPEM(raw)
+	if err != nil {
+		t.Fatalf("Failed to parse key %s: %v", path, err)
+	}
+	return key
+}
+
+// use the test keys and settings, restored when the test ends
+func useTestCredentials(t *testing.T) {
+	settings := config.Config.Credentials
+	t.Cleanup(func() {
+		config.Config.Credentials = settings
+		resetKeyCaches()
+	})
+
+	config.Config.Credentials.GoogleKeysURL = testKeysURL
+	config.Config.Credentials.GoogleIssuers = []string { testIssuer }
+	config.Config.Credentials.GoogleClientIDs = []string { testClientID }
+	config.Config.Credentials.GameCenterKeyURLs = []string { "file://resources/auth/" }
+	config.Config.Credentials.GameCenterBundleIDs = []string { testBundleID }
+	resetKeyCaches()
+}
+
+func resetKeyCaches() {
+	keyMutex.Lock()
+	defer keyMutex.Unlock()
+	keyCaches = map[string]*publicKeyCache {}
+}
+
+func TestVerifyIdentityToken(t *testing.T) {
+	useTestCredentials(t)
+	identityKey := readTestKey(t, testIdentityKeyPath)
+	otherKey := readTestKey(t, testGameCenterKeyPath)
+
+	tests := []struct {
+		name      string
+		key       *rsa.PrivateKey
+		keyID     string
+		issuer    string
+		audience  string
+		expires   time.Duration
+		valid     bool
+	}{
+		{"valid", identityKey, "test", testIssuer, testClientID, time.Hour, true},
+		{"expired", identityKey, "test", testIssuer, testClientID, -time.Minute, false},
+		{"other issuer", identityKey, "test", "https://evil.example.com", testClientID, time.Hour, false},
+		{"other audience", identityKey, "test", testIssuer, "other-client", time.Hour, false},
+		{"unknown key ID", identityKey, "rotated", testIssuer, testClientID, time.Hour, false},
+		{"signed by another key", otherKey, "test", testIssuer, testClientID, time.Hour, false},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			token := jwt.NewWithClaims(jwt.SigningMethodRS256, jwt.MapClaims {
+				"iss": test.issuer,
+				"aud": test.audience,
+				"sub": "player-subject",
+				"exp": time.Now().Add(test.expires).Unix(),
+			})
+			token.Header["kid"] = test.keyID
+			signed, err := token.SignedString(test.key)
+			if err != nil {
+				t.Fatalf("Failed to sign token: %v", err)
+			}
+
+			id, err := verifyGoogleCredential(&CredentialClaim { Provider: GoogleProvider, Token: signed })
+			if test.valid {
+				if err != nil || id != "player-subject" {
+					t.Errorf("Verified %q (%v), want player-subject", id, err)
+				}
+			} else if err == nil {
+				t.Errorf("Verified %q, want an error", id)
+			}
+		})
+	}
+}
+
+func TestVerifyGameCenterCredential(t *testing.T) {
+	useTestCredentials(t)
+	gameCenterKey := readTestKey(t, testGameCenterKeyPath)
+	otherKey := readTestKey(t, testIdentityKeyPath)
+
+	tests := []struct {
+		name          string
+		key           *rsa.PrivateKey
+		keyURL        string
+		bundleID      string
+		age           time.Duration
+		signedPlayer  string // player ID in the signed payload
+		valid         bool
+	}{
+		{"valid", gameCenterKey, testGameCenterKeyURL, testBundleID, time.Minute, "G:1234", true},
+		{"untrusted key URL", gameCenterKey, "https://keys.example.com/gamecenter.cer", testBundleID, time.Minute, "G:1234", false},
+		{"other bundle", gameCenterKey, testGameCenterKeyURL, "com.example.other", time.Minute, "G:1234", false},
+		{"stale signature", gameCenterKey, testGameCenterKeyURL, testBundleID, time.Hour, "G:1234", false},
+		{"other player", gameCenterKey, testGameCenterKeyURL, testBundleID, time.Minute, "G:5678", false},
+		{"signed by another key", otherKey, testGameCenterKeyURL, testBundleID, time.Minute, "G:1234", false},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			salt := []byte("salt1234")
+			timestamp := uint64(time.Now().Add(-test.age).UnixNano() / int64(time.Millisecond))
+
+			// player ID + bundle ID + timestamp (big-endian) + salt
+			payload := make([]byte, 8)
+			binary.BigEndian.PutUint64(payload, timestamp)
+			hash := sha256.New()
+			hash.Write([]byte(test.signedPlayer))
+			hash.Write([]byte(test.bundleID))
+			hash.Write(payload)
+			hash.Write(salt)
+
+			signature, err := rsa.SignPKCS1v15(rand.Reader, test.key, crypto.SHA256, hash.Sum(nil))
+			if err != nil {
+				t.Fatalf("Failed to sign payload: %v", err)
+			}
+
+			id, err := verifyGameCenterCredential(&CredentialClaim {
+				Provider: GameCenterProvider,
+				PlayerID: "G:1234",
+				BundleID: test.bundleID,
+				PublicKeyURL: test.keyURL,
+				Signature: base64.StdEncoding.EncodeToString(signature),
+				Salt: base64.StdEncoding.EncodeToString(salt),
+				Timestamp: timestamp,
+			})
+			if test.valid {
+				if err != nil || id != "G:1234" {
+					t.Errorf("Verified %q (%v), want G:1234", id, err)
+				}
+			} else if err == nil {
+				t.Errorf("Verified %q, want an error", id)
+			}
+		})
+	}
+}
@@ -1,6 +1,8 @@
 package util
 
 import (
+	"time"
+	"strconv"
 	"net/url"
 
 	"github.com/garyburd/redigo/redis"
@@ -8,7 +10,37 @@ import (
 	"bloodtales/log"
 )
 
-type Cache struct {
+// cache connection (redis, or in memory with memory storage)
+type Cache interface {
+	Has(name string) bool
+	Set(name string, value interface{}) string
+	Get(name string) interface{}
+	GetString(name string, defaultValue string) string
+	GetInt(name string, defaultValue int) int
+	GetJSON(name string, result interface{}) bool
+	Expire(name string, ttl int)
+	SetIfAbsent(name string, value interface{}, ttl int) bool
+	SetScore(group string, name string, score int)
+	SetScores(group string, scores map[string]int)
+	GetScore(group string, name string) int
+	RemoveScore(group string, name string)
+	ClearScores(group string)
+	RenameScores(group string, name string)
+	GetScoreCount(group string) int
+	GetRank(group string, name string) int
+	GetRevRank(group string, name string) int
+	GetRankRange(group string, start int, stop int) []string
+	GetRankRangeWithScores(group string, start int, stop int) []ScoreEntry
+	Close()
+}
+
+// sorted set member with its score
+type ScoreEntry struct {
+	Name     string
+	Score    int
+}
+
+type RedisCache struct {
 	Stream
 
 	// internal
@@ -20,7 +52,16 @@ type CacheStreamSource struct {
 	redis    redis.Conn
 }
 
+// redis connection recording command latency and errors
+type instrumentedConn struct {
+	redis.Conn
+}
+
 var (
+	// metrics
+	cacheDuration  *Metric = NewHistogram("redis_command_duration_seconds", "Redis command latency.", nil, "command")
+	cacheErrors    *Metric = NewCounter("redis_command_errors_total", "Redis command errors (nil replies excluded).", "command")
+
 	// internal
 	redisPool      *redis.Pool
 	redisURL       url.URL
@@ -57,7 +98,23 @@ func (source CacheStreamSource) Get(name string) interface{} {
 	return value
 }
 
+func (conn instrumentedConn) Do(command string, args ...interface{}) (reply interface{}, err error) {
+	start := time.Now()
+	reply, err = conn.Conn.Do(command, args...)
+
+	cacheDuration.ObserveSince(start, command)
+	if err != nil && err != redis.ErrNil {
+		cacheErrors.Inc(command)
+	}
+	return
+}
+
 func init() {
+	// no redis with memory storage
+	if Storage != MongoStorage {
+		return
+	}
+
 	// get redis URL
 	rawRedisURL := Env.GetRequiredString("REDIS_URL")
 	redisURL, err := url.Parse(rawRedisURL)
@@ -120,9 +177,26 @@ func CloseCache() {
 	}
 }
 
-func GetCacheConnection() (cache *Cache) {
-	// get redis connection from pool
+// check redis connectivity
+func PingCache() (err error) {
+	if redisPool == nil {
+		return nil
+	}
+
 	redis := redisPool.Get()
+	defer redis.Close()
+
+	_, err = redis.Do("PING")
+	return
+}
+
+func GetCacheConnection() (cache Cache) {
+	if Storage == MemoryStorage {
+		return GetMemoryCacheConnection()
+	}
+
+	// get redis connection from pool
+	redis := instrumentedConn { redisPool.Get() }
 
 	// stream source
 	source := CacheStreamSource {
@@ -130,7 +204,7 @@ func GetCacheConnection() (cache *Cache) {
 	}
 
 	// create abstracted cache
-	cache = &Cache {
+	cache = &RedisCache {
 		Stream: Stream {
 			source: source,
 		},
@@ -139,12 +213,12 @@ func GetCacheConnection() (cache *Cache) {
 	return
 }
 
-func (cache *Cache) Close() {
+func (cache *RedisCache) Close() {
 	// close redis connection
 	cache.redis.Close()
 }
 
-func (cache *Cache) Expire(name string, ttl int) {
+func (cache *RedisCache) Expire(name string, ttl int) {
 	var err error
 	_, err = cache.redis.Do("EXPIRE", name, ttl)
 	if err != nil {
@@ -153,7 +227,21 @@ func (cache *Cache) Expire(name string, ttl int) {
 	}
 }
 
-func (cache *Cache) SetScore(group string, name string, score int) {
+// set a value expiring after ttl seconds only if the name does not exist (false when it does)
+func (cache *RedisCache) SetIfAbsent(name string, value interface{}, ttl int) bool {
+	_, err := redis.String(cache.redis.Do("SET", name, value, "NX", "EX", ttl))
+	if err == redis.ErrNil {
+		return false
+	}
+	if err != nil {
+		log.Errorf("Redis error: %v", err)
+		PrintStack()
+		return false
+	}
+	return true
+}
+
+func (cache *RedisCache) SetScore(group string, name string, score int) {
 	_, err := cache.redis.Do("ZADD", group, score, name)
 	if err != nil {
 		log.Errorf("Redis error: %v", err)
@@ -161,7 +249,26 @@ func (cache *Cache) SetScore(group string, name string, score int) {
 	}
 }
 
-func (cache *Cache) GetScore(group string, name string) int {
+// set many scores in one command
+func (cache *RedisCache) SetScores(group string, scores map[string]int) {
+	if len(scores) == 0 {
+		return
+	}
+
+	args := make([]interface{}, 0, 1 + len(scores) * 2)
+	args = append(args, group)
+	for name, score := range scores {
+		args = append(args, score, name)
+	}
+
+	_, err := cache.redis.Do("ZADD", args...)
+	if err != nil {
+		log.Errorf("Redis error: %v", err)
+		PrintStack()
+	}
+}
+
+func (cache *RedisCache) GetScore(group string, name string) int {
 	result, err := redis.Int(cache.redis.Do("ZSCORE", group, name))
 	if err != nil {
 		log.Errorf("Redis error: %v", err)
@@ -170,7 +277,7 @@ func (cache *Cache) GetScore(group string, name string) int {
 	return result
 }
 
-func (cache *Cache) RemoveScore(group string, name string) {
+func (cache *RedisCache) RemoveScore(group string, name string) {
 	_, err := cache.redis.Do("ZREM", group, name)
 	if err != nil {
 		log.Errorf("Redis error: %v", err)
@@ -178,7 +285,7 @@ func (cache *Cache) RemoveScore(group string, name string) {
 	}
 }
 
-func (cache *Cache) ClearScores(group string) {
+func (cache *RedisCache) ClearScores(group string) {
 	_, err := cache.redis.Do("DEL", group)
 	if err != nil {
 		log.Errorf("Redis error: %v", err)
@@ -186,7 +293,30 @@ func (cache *Cache) ClearScores(group string) {
 	}
 }
 
-func (cache *Cache) GetRank(group string, name string) int {
+// atomically replace the named scores with the group (deleting the name when the group is empty)
+func (cache *RedisCache) RenameScores(group string, name string) {
+	var err error
+	if exists, _ := redis.Bool(cache.redis.Do("EXISTS", group)); exists {
+		_, err = cache.redis.Do("RENAME", group, name)
+	} else {
+		_, err = cache.redis.Do("DEL", name)
+	}
+	if err != nil {
+		log.Errorf("Redis error: %v", err)
+		PrintStack()
+	}
+}
+
+func (cache *RedisCache) GetScoreCount(group string) int {
+	result, err := redis.Int(cache.redis.Do("ZCARD", group))
+	if err != nil {
+		log.Errorf("Redis error: %v", err)
+		PrintStack()
+	}
+	return result
+}
+
+func (cache *RedisCache) GetRank(group string, name string) int {
 	result, err := redis.Int(cache.redis.Do("ZRANK", group, name))
 	if err != nil {
 		log.Errorf("Redis error: %v", err)
@@ -195,7 +325,20 @@ func (cache *Cache) GetRank(group string, name string) int {
 	return result
 }
 
-func (cache *Cache) GetRankRange(group string, start int, stop int) []string {
+// descending rank (-1 when missing)
+func (cache *RedisCache) GetRevRank(group string, name string) int {
+	result, err := redis.Int(cache.redis.Do("ZREVRANK", group, name))
+	if err == redis.ErrNil {
+		return -1
+	}
+	if err != nil {
+		log.Errorf("Redis error: %v", err)
+		PrintStack()
+	}
+	return result
+}
+
+func (cache *RedisCache) GetRankRange(group string, start int, stop int) []string {
 	result, err := redis.Strings(cache.redis.Do("ZREVRANGE", group, start, stop))
 	if err != nil {
 		log.Errorf("Redis error: %v", err)
@@ -203,3 +346,23 @@ func (cache *Cache) GetRankRange(group string, start int, stop int) []string {
 	}
 	return result
 }
+
+// members by descending score with their scores, in one command
+func (cache *RedisCache) GetRankRangeWithScores(group string, start int, stop int) []ScoreEntry {
+	result, err := redis.Strings(cache.redis.Do("ZREVRANGE", group, start, stop, "WITHSCORES"))
+	if err != nil {
+		log.Errorf("Redis error: %v", err)
+		PrintStack()
+	}
+
+	entries := make([]ScoreEntry, 0, len(result) / 2)
+	for i := 0; i + 1 < len(result); i += 2 {
+		score, err := strconv.ParseFloat(result[i + 1], 64)
+		if err != nil {
+			log.Errorf("Redis error: %v", err)
+			PrintStack()
+		}
+		entries = append(entries, ScoreEntry { Name: result[i], Score: int(score) })
+	}
+	return entries
+}
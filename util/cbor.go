@@ -0,0 +1,346 @@
+package util
+
+import (
+	"io"
+	"fmt"
+	"math"
+	"sort"
+	"bytes"
+	"errors"
+	"encoding/binary"
+	"encoding/json"
+)
+
+// CBOR major types
+const (
+	cborUnsigned byte = iota << 5
+	cborNegative
+	cborBytes
+	cborText
+	cborArray
+	cborMap
+	cborTag
+	cborSimple
+)
+
+// CBOR encoding of generic values (as produced by decoding JSON with UseNumber)
+func EncodeCBOR(value interface{}) (raw []byte, err error) {
+	var buffer bytes.Buffer
+	err = encodeCBOR(&buffer, value)
+	raw = buffer.Bytes()
+	return
+}
+
+func encodeCBOR(buffer *bytes.Buffer, value interface{}) (err error) {
+	switch value := value.(type) {
+	case nil:
+		buffer.WriteByte(cborSimple | 22)
+
+	case bool:
+		if value {
+			buffer.WriteByte(cborSimple | 21)
+		} else {
+			buffer.WriteByte(cborSimple | 20)
+		}
+
+	case json.Number:
+		if integer, err := value.Int64(); err == nil {
+			encodeCBORInt(buffer, integer)
+		} else {
+			float, err := value.Float64()
+			if err != nil {
+				return err
+			}
+			encodeCBORFloat(buffer, float)
+		}
+
+	case float64:
+		encodeCBORFloat(buffer, value)
+
+	case int:
+		encodeCBORInt(buffer, int64(value))
+
+	case int64:
+		encodeCBORInt(buffer, value)
+
+	case string:
+		encodeCBORHead(buffer, cborText, uint64(len(value)))
+		buffer.WriteString(value)
+
+	case []interface{}:
+		encodeCBORHead(buffer, cborArray, uint64(len(value)))
+		for _, item := range value {
+			if err = encodeCBOR(buffer, item); err != nil {
+				return
+			}
+		}
+
+	case map[string]interface{}:
+		encodeCBORHead(buffer, cborMap, uint64(len(value)))
+
+		// sorted keys for stable output
+		keys := make([]string, 0, len(value))
+		for key, _ := range value {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+
+		for _, key := range keys {
+			encodeCBORHead(buffer, cborText, uint64(len(key)))
+			buffer.WriteString(key)
+			if err = encodeCBOR(buffer, value[key]); err != nil {
+				return
+			}
+		}
+
+	default:
+		err = errors.New(fmt.Sprintf("CBOR cannot encode type: %T", value))
+	}
+	return
+}
+
+func encodeCBORInt(buffer *bytes.Buffer, value int64) {
+	if value >= 0 {
+		encodeCBORHead(buffer, cborUnsigned, uint64(value))
+	} else {
+		encodeCBORHead(buffer, cborNegative, uint64(-(value + 1)))
+	}
+}
+
+func encodeCBORFloat(buffer *bytes.Buffer, value float64) {
+	buffer.WriteByte(cborSimple | 27)
+	binary.Write(buffer, binary.BigEndian, math.Float64bits(value))
+}
+
+// write major type with argument in the shortest form
+func encodeCBORHead(buffer *bytes.Buffer, major byte, argument uint64) {
+	switch {
+	case argument < 24:
+		buffer.WriteByte(major | byte(argument))
+	case argument <= math.MaxUint8:
+		buffer.WriteByte(major | 24)
+		buffer.WriteByte(byte(argument))
+	case argument <= math.MaxUint16:
+		buffer.WriteByte(major | 25)
+		binary.Write(buffer, binary.BigEndian, uint16(argument))
+	case argument <= math.MaxUint32:
+		buffer.WriteByte(major | 26)
+		binary.Write(buffer, binary.BigEndian, uint32(argument))
+	default:
+		buffer.WriteByte(major | 27)
+		binary.Write(buffer, binary.BigEndian, argument)
+	}
+}
+
+// decode CBOR into generic values (maps, slices, strings, numbers, bools and nil)
+func DecodeCBOR(raw []byte) (value interface{}, err error) {
+	reader := bytes.NewReader(raw)
+	if value, err = decodeCBOR(reader, 0); err != nil {
+		return
+	}
+	if reader.Len() > 0 {
+		err = errors.New("CBOR has trailing data")
+	}
+	return
+}
+
+// indefinite length terminator
+var errCBORBreak = errors.New("CBOR unexpected break")
+
+func decodeCBOR(reader *bytes.Reader, depth int) (value interface{}, err error) {
+	if depth > maxWireDepth {
+		return nil, errors.New(fmt.Sprintf("CBOR nested deeper than %d levels", maxWireDepth))
+	}
+
+	initial, err := reader.ReadByte()
+	if err != nil {
+		return
+	}
+	major := initial & 0xe0
+	info := initial & 0x1f
+
+	// simple values and floats
+	if major == cborSimple {
+		switch info {
+		case 20:
+			return false, nil
+		case 21:
+			return true, nil
+		case 22, 23:
+			return nil, nil
+		case 25:
+			var half uint16
+			err = binary.Read(reader, binary.BigEndian, &half)
+			return decodeCBORHalf(half), err
+		case 26:
+			var float float32
+			err = binary.Read(reader, binary.BigEndian, &float)
+			return float64(float), err
+		case 27:
+			var float float64
+			err = binary.Read(reader, binary.BigEndian, &float)
+			return float, err
+		case 31:
+			return nil, errCBORBreak
+		}
+		return nil, errors.New(fmt.Sprintf("CBOR unsupported simple value: %d", info))
+	}
+
+	// indefinite length strings, arrays and maps
+	if info == 31 {
+		switch major {
+		case cborBytes, cborText:
+			var builder bytes.Buffer
+			for {
+				var chunk interface{}
+				if chunk, err = decodeCBOR(reader, depth + 1); err == errCBORBreak {
+					return builder.String(), nil
+				} else if err != nil {
+					return
+				}
+				text, ok := chunk.(string)
+				if !ok {
+					return nil, errors.New("CBOR invalid string chunk")
+				}
+				builder.WriteString(text)
+			}
+		case cborArray:
+			items := []interface{} {}
+			for {
+				var item interface{}
+				if item, err = decodeCBOR(reader, depth + 1); err == errCBORBreak {
+					return items, nil
+				} else if err != nil {
+					return
+				}
+				items = append(items, item)
+			}
+		case cborMap:
+			items := map[string]interface{} {}
+			for {
+				var key, item interface{}
+				if key, err = decodeCBOR(reader, depth + 1); err == errCBORBreak {
+					return items, nil
+				} else if err != nil {
+					return
+				}
+				if item, err = decodeCBOR(reader, depth + 1); err != nil {
+					return
+				}
+				items[fmt.Sprintf("%v", key)] = item
+			}
+		}
+		return nil, errors.New("CBOR invalid indefinite length")
+	}
+
+	argument, err := readCBORArgument(reader, info)
+	if err != nil {
+		return
+	}
+
+	switch major {
+	case cborUnsigned:
+		if argument > math.MaxInt64 {
+			return float64(argument), nil
+		}
+		return int64(argument), nil
+
+	case cborNegative:
+		if argument > math.MaxInt64 {
+			return -float64(argument) - 1, nil
+		}
+		return -int64(argument) - 1, nil
+
+	case cborBytes, cborText:
+		if err = checkCBORLength(reader, argument, 1); err != nil {
+			return
+		}
+		raw := make([]byte, argument)
+		_, err = io.ReadFull(reader, raw)
+		return string(raw), err
+
+	case cborArray:
+		if err = checkCBORLength(reader, argument, 1); err != nil {
+			return
+		}
+		items := make([]interface{}, argument)
+		for i := range items {
+			if items[i], err = decodeCBOR(reader, depth + 1); err != nil {
+				return
+			}
+		}
+		return items, nil
+
+	case cborMap:
+		if err = checkCBORLength(reader, argument, 2); err != nil {
+			return
+		}
+		items := make(map[string]interface{}, argument)
+		for i := uint64(0); i < argument; i++ {
+			var key, item interface{}
+			if key, err = decodeCBOR(reader, depth + 1); err != nil {
+				return
+			}
+			if item, err = decodeCBOR(reader, depth + 1); err != nil {
+				return
+			}
+			items[fmt.Sprintf("%v", key)] = item
+		}
+		return items, nil
+
+	default:
+		// tags are ignored, using the tagged value
+		return decodeCBOR(reader, depth + 1)
+	}
+}
+
+// check a declared length against the remaining input, each element taking at least size bytes
+func checkCBORLength(reader *bytes.Reader, length uint64, size uint64) error {
+	if length > uint64(reader.Len()) / size {
+		return errors.New(fmt.Sprintf("CBOR length %d exceeds remaining input (%d bytes)", length, reader.Len()))
+	}
+	return nil
+}
+
+func readCBORArgument(reader *bytes.Reader, info byte) (argument uint64, err error) {
+	if info < 24 {
+		return uint64(info), nil
+	}
+	if info > 27 {
+		return 0, errors.New(fmt.Sprintf("CBOR invalid additional info: %d", info))
+	}
+
+	raw := make([]byte, 1 << (info - 24))
+	if _, err = io.ReadFull(reader, raw); err != nil {
+		return
+	}
+	for _, b := range raw {
+		argument = argument << 8 | uint64(b)
+	}
+	return
+}
+
+// convert IEEE 754 half precision float
+func decodeCBORHalf(half uint16) float64 {
+	exponent := int(half >> 10) & 0x1f
+	mantissa := float64(half & 0x3ff)
+
+	var value float64
+	switch exponent {
+	case 0:
+		value = math.Ldexp(mantissa, -24)
+	case 31:
+		if mantissa == 0 {
+			value = math.Inf(1)
+		} else {
+			value = math.NaN()
+		}
+	default:
+		value = math.Ldexp(mantissa + 1024, exponent - 25)
+	}
+
+	if half & 0x8000 != 0 {
+		return -value
+	}
+	return value
+}
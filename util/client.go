@@ -6,6 +6,7 @@ import (
 
 type Client struct {
 	Version       string      `json:"v"`
+	Platform      string      `json:"p"`
 
 	// internal
 	session       *Session
@@ -0,0 +1,207 @@
+package util
+
+import (
+	"io"
+	"fmt"
+	"bytes"
+	"errors"
+	"strings"
+	"strconv"
+	"io/ioutil"
+	"net/http"
+	"compress/gzip"
+	"encoding/json"
+
+	"bloodtales/config"
+)
+
+// wire format for API requests and responses
+type WireFormat string
+const (
+	WireJSON WireFormat = "application/json"
+	WireMsgPack = "application/msgpack"
+	WireCBOR = "application/cbor"
+)
+
+// maximum binary request body size
+const maxWireBodySize = 1 << 20
+
+// maximum nesting of arrays, maps (and CBOR tags) in binary request bodies
+const maxWireDepth = 64
+
+// get wire format from a content type or accept header (empty if unsupported)
+func ParseWireFormat(header string) WireFormat {
+	for _, part := range strings.Split(header, ",") {
+		mediaType := strings.ToLower(strings.TrimSpace(strings.Split(part, ";")[0]))
+
+		switch mediaType {
+		case "application/msgpack", "application/x-msgpack":
+			return WireMsgPack
+		case "application/cbor":
+			return WireCBOR
+		case "application/json":
+			return WireJSON
+		}
+	}
+	return ""
+}
+
+// get negotiated response format (JSON by default)
+func (context *Context) GetWireFormat() WireFormat {
+	if format := ParseWireFormat(context.Request.Header.Get("Accept")); format != "" {
+		return format
+	}
+	return WireJSON
+}
+
+// encode JSON response in wire format, converting through generic values so custom JSON marshalling is kept
+func EncodeWire(format WireFormat, raw []byte) ([]byte, error) {
+	if format == WireJSON {
+		return raw, nil
+	}
+
+	decoder := json.NewDecoder(bytes.NewReader(raw))
+	decoder.UseNumber()
+
+	var value interface{}
+	if err := decoder.Decode(&value); err != nil {
+		return nil, err
+	}
+
+	switch format {
+	case WireMsgPack:
+		return EncodeMsgPack(value)
+	case WireCBOR:
+		return EncodeCBOR(value)
+	}
+	return nil, errors.New(fmt.Sprintf("Unsupported wire format: %s", format))
+}
+
+// write an API response in the negotiated format, compressing large responses
+func (context *Context) writeWireResponse(raw []byte) (err error) {
+	format := context.GetWireFormat()
+	encoded, encodeErr := EncodeWire(format, raw)
+	if encodeErr != nil {
+		// fall back to JSON
+		context.Log().Errorf("Encoding %s response: %v", format, encodeErr)
+		format, encoded = WireJSON, raw
+	}
+	raw = encoded
+
+	header := context.ResponseWriter.Header()
+	header.Set("Content-Type", string(format))
+	header.Add("Vary", "Accept")
+	header.Add("Vary", "Accept-Encoding")
+
+	threshold := config.Config.Server.GzipThreshold
+	if threshold > 0 && len(raw) >= threshold && acceptsGzip(context.Request) {
+		header.Set("Content-Encoding", "gzip")
+
+		writer := gzip.NewWriter(context.ResponseWriter)
+		if _, err = writer.Write(raw); err != nil {
+			return
+		}
+		return writer.Close()
+	}
+
+	header.Set("Content-Length", strconv.Itoa(len(raw)))
+	_, err = context.ResponseWriter.Write(raw)
+	return
+}
+
+func acceptsGzip(request *http.Request) bool {
+	for _, part := range strings.Split(request.Header.Get("Accept-Encoding"), ",") {
+		fields := strings.Split(part, ";")
+		if strings.TrimSpace(fields[0]) != "gzip" {
+			continue
+		}
+
+		// explicitly refused with zero quality
+		for _, field := range fields[1:] {
+			field = strings.TrimSpace(field)
+			if strings.HasPrefix(field, "q=") {
+				if quality, err := strconv.ParseFloat(field[2:], 64); err == nil && quality == 0 {
+					return false
+				}
+			}
+		}
+		return true
+	}
+	return false
+}
+
+// bind a MessagePack or CBOR request body into params, values are converted to strings like form values
+func (context *Context) decodeWireBody() {
+	format := ParseWireFormat(context.Request.Header.Get("Content-Type"))
+	if format != WireMsgPack && format != WireCBOR {
+		return
+	}
+
+	raw, err := ioutil.ReadAll(http.MaxBytesReader(context.ResponseWriter, context.Request.Body, maxWireBodySize))
+	if err != nil {
+		panic(fmt.Sprintf("Failed to read request body: %v", err))
+	}
+	if len(raw) == 0 {
+		return
+	}
+
+	// optionally compressed
+	if strings.EqualFold(context.Request.Header.Get("Content-Encoding"), "gzip") {
+		reader, err := gzip.NewReader(bytes.NewReader(raw))
+		if err == nil {
+			raw, err = ioutil.ReadAll(io.LimitReader(reader, maxWireBodySize))
+		}
+		if err != nil {
+			panic(fmt.Sprintf("Failed to decompress request body: %v", err))
+		}
+	}
+
+	var value interface{}
+	if format == WireMsgPack {
+		value, err = DecodeMsgPack(raw)
+	} else {
+		value, err = DecodeCBOR(raw)
+	}
+	if err != nil {
+		panic(fmt.Sprintf("Invalid %s request body: %v", format, err))
+	}
+
+	params, ok := value.(map[string]interface{})
+	if !ok {
+		panic(fmt.Sprintf("Invalid %s request body: expected a map", format))
+	}
+
+	for name, param := range params {
+		context.Params.Set(name, wireParamString(param))
+	}
+}
+
+// convert a decoded value to its form parameter equivalent (scalar lists are comma separated, documents are JSON)
+func wireParamString(value interface{}) string {
+	switch value := value.(type) {
+	case nil:
+		return ""
+	case string:
+		return value
+	case bool:
+		return strconv.FormatBool(value)
+	case int64:
+		return strconv.FormatInt(value, 10)
+	case float64:
+		return strconv.FormatFloat(value, 'g', -1, 64)
+	case []interface{}:
+		values := make([]string, len(value))
+		for i, item := range value {
+			switch item.(type) {
+			case []interface{}, map[string]interface{}:
+				raw, _ := json.Marshal(value)
+				return string(raw)
+			}
+			values[i] = wireParamString(item)
+		}
+		return strings.Join(values, ",")
+	}
+
+	raw, _ := json.Marshal(value)
+	return string(raw)
+}
@@ -0,0 +1,77 @@
+package util
+
+import (
+	"bytes"
+	"testing"
+	"reflect"
+)
+
+// nested single element arrays (MessagePack fixarray 0x91, CBOR array 0x81) around an integer
+func nestedArrays(prefix byte, depth int) []byte {
+	return append(bytes.Repeat([]byte { prefix }, depth), 0x01)
+}
+
+func TestDecodeWire(t *testing.T) {
+	decoders := map[string]func([]byte) (interface{}, error) {
+		"msgpack": DecodeMsgPack,
+		"cbor": DecodeCBOR,
+	}
+
+	tests := []struct {
+		name     string
+		format   string
+		raw      []byte
+		valid    bool
+	}{
+		{"nested at the limit", "msgpack", nestedArrays(0x91, maxWireDepth), true},
+		{"nested too deep", "msgpack", nestedArrays(0x91, maxWireDepth + 1), false},
+		{"huge array", "msgpack", []byte { 0xdd, 0xff, 0xff, 0xff, 0xff, 0x01 }, false},
+		{"map longer than input", "msgpack", []byte { 0xde, 0x00, 0x02, 0x01, 0x01 }, false},
+		{"string longer than input", "msgpack", []byte { 0xdb, 0x00, 0x00, 0x01, 0x00, 0x61 }, false},
+		{"truncated array", "msgpack", []byte { 0x92, 0x01 }, false},
+		{"nested at the limit", "cbor", nestedArrays(0x81, maxWireDepth), true},
+		{"nested too deep", "cbor", nestedArrays(0x81, maxWireDepth + 1), false},
+		{"nested tags", "cbor", append(bytes.Repeat([]byte { 0xc6 }, maxWireDepth + 1), 0x01), false},
+		{"indefinite arrays too deep", "cbor", append(bytes.Repeat([]byte { 0x9f }, maxWireDepth + 1), 0x01), false},
+		{"huge array", "cbor", []byte { 0x9b, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0x01 }, false},
+		{"map longer than input", "cbor", []byte { 0xa2, 0x01, 0x01 }, false},
+		{"text longer than input", "cbor", []byte { 0x7a, 0x00, 0x00, 0x01, 0x00, 0x61 }, false},
+	}
+
+	for _, test := range tests {
+		t.Run(test.format + " " + test.name, func(t *testing.T) {
+			value, err := decoders[test.format](test.raw)
+			if test.valid && err != nil {
+				t.Errorf("Failed to decode: %v", err)
+			} else if !test.valid && err == nil {
+				t.Errorf("Decoded %v, want an error", value)
+			}
+		})
+	}
+}
+
+func TestEncodeDecodeWire(t *testing.T) {
+	value := map[string]interface{} {
+		"name": "player",
+		"level": int64(12),
+		"ratio": 0.5,
+		"active": true,
+		"cards": []interface{} { int64(1), "two", nil, map[string]interface{} { "count": int64(-3) } },
+	}
+
+	raw, err := EncodeMsgPack(value)
+	if err != nil {
+		t.Fatalf("Failed to encode MessagePack: %v", err)
+	}
+	if decoded, err := DecodeMsgPack(raw); err != nil || !reflect.DeepEqual(decoded, value) {
+		t.Errorf("MessagePack decoded %v (%v), want %v", decoded, err, value)
+	}
+
+	raw, err = EncodeCBOR(value)
+	if err != nil {
+		t.Fatalf("Failed to encode CBOR: %v", err)
+	}
+	if decoded, err := DecodeCBOR(raw); err != nil || !reflect.DeepEqual(decoded, value) {
+		t.Errorf("CBOR decoded %v (%v), want %v", decoded, err, value)
+	}
+}
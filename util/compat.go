@@ -0,0 +1,138 @@
+package util
+
+import (
+	"bytes"
+	"sort"
+	"sync"
+	"encoding/json"
+)
+
+// payload shape in API responses, recognised by its keys, which can be adapted for older clients
+type PayloadType struct {
+	Name            string
+	Keys            []string
+
+	// internal
+	adapters        []payloadAdapter
+}
+
+type payloadAdapter struct {
+	version         string
+	adapt           func(payload map[string]interface{})
+}
+
+var (
+	// internal
+	payloadTypes    []*PayloadType
+	payloadMutex    sync.RWMutex
+)
+
+// register a payload shape (a response document containing all keys)
+func NewPayloadType(name string, keys ...string) *PayloadType {
+	payloadType := &PayloadType {
+		Name: name,
+		Keys: keys,
+	}
+
+	payloadMutex.Lock()
+	defer payloadMutex.Unlock()
+
+	payloadTypes = append(payloadTypes, payloadType)
+	return payloadType
+}
+
+// register a transform from the shape of the next version down to the shape expected by clients at version (major and minor),
+// adapters are chained so clients receive every transform down to their own version
+func (payloadType *PayloadType) Adapt(version string, adapt func(payload map[string]interface{})) {
+	payloadMutex.Lock()
+	defer payloadMutex.Unlock()
+
+	payloadType.adapters = append(payloadType.adapters, payloadAdapter {
+		version: version,
+		adapt: adapt,
+	})
+
+	// newest versions first
+	sort.SliceStable(payloadType.adapters, func(i, j int) bool {
+		return CompareVersion(payloadType.adapters[i].version, payloadType.adapters[j].version, 2) < 0
+	})
+}
+
+func (payloadType *PayloadType) matches(payload map[string]interface{}) bool {
+	for _, key := range payloadType.Keys {
+		if _, ok := payload[key]; !ok {
+			return false
+		}
+	}
+	return true
+}
+
+// check if an adapter applies to a client version (at or below the adapter version)
+func (adapter *payloadAdapter) appliesTo(version string) bool {
+	return CompareVersion(adapter.version, version, 2) <= 0
+}
+
+// check if responses for a client version need adapting
+func NeedsAdapting(version string) bool {
+	if version == "" {
+		return false
+	}
+
+	payloadMutex.RLock()
+	defer payloadMutex.RUnlock()
+
+	for _, payloadType := range payloadTypes {
+		for _, adapter := range payloadType.adapters {
+			if adapter.appliesTo(version) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// adapt a JSON response for a client version (unchanged for current clients)
+func AdaptResponse(version string, raw []byte) ([]byte, error) {
+	if !NeedsAdapting(version) {
+		return raw, nil
+	}
+
+	decoder := json.NewDecoder(bytes.NewReader(raw))
+	decoder.UseNumber()
+
+	var value interface{}
+	if err := decoder.Decode(&value); err != nil {
+		return nil, err
+	}
+
+	payloadMutex.RLock()
+	adaptPayloads(value, version)
+	payloadMutex.RUnlock()
+
+	return json.Marshal(value)
+}
+
+// walk generic values, adapting recognised payloads before their children
+func adaptPayloads(value interface{}, version string) {
+	switch value := value.(type) {
+	case map[string]interface{}:
+		for _, payloadType := range payloadTypes {
+			if !payloadType.matches(value) {
+				continue
+			}
+			for _, adapter := range payloadType.adapters {
+				if adapter.appliesTo(version) {
+					adapter.adapt(value)
+				}
+			}
+		}
+		for _, child := range value {
+			adaptPayloads(child, version)
+		}
+
+	case []interface{}:
+		for _, child := range value {
+			adaptPayloads(child, version)
+		}
+	}
+}
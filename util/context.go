@@ -20,56 +20,155 @@ import (
 	"bloodtales/log"
 )
 
+const RequestIDHeader = "X-Request-ID"
+
+// request resources acquired on first use (mongo sessions, redis connections and cookie sessions)
+var ContextResources *Metric = NewCounter("context_resources_acquired_total", "Per-request resources acquired by contexts.", "resource")
+
 type Context struct {
 	UserID          bson.ObjectId          `json:"-"`
-	DB              *mgo.Database          `json:"-"`
 	SQL             *sql.DB                `json:"-"`
-	Session         *Session               `json:"-"`
-	Cache           *Cache                 `json:"-"`
-	Client          *Client                `json:"-"`
 	Request         *http.Request          `json:"-"`
 	ResponseWriter  http.ResponseWriter    `json:"-"`
 	Params          *Stream                `json:"-"`
 	Template        string                 `json:"-"`
+	Route           string                 `json:"-"`
+	RequestID       string                 `json:"requestId"`
 
 	Token           string                 `json:"token"`
 	Success         bool                   `json:"success"`
 	Messages        []string               `json:"messages"`
 	Data            map[string]interface{} `json:"data"`
 
-	// internal
+	// internal, acquired on first use and released when the request ends
+	db              *mgo.Database
+	cache           Cache
+	session         *Session
+	client          *Client
 	responseWritten bool
 }
 
 func CreateContext(w http.ResponseWriter, r *http.Request) *Context {
-	// cookies session
-	session := GetSession(w, r)
-
-	// create context
+	// create context (connections and session are acquired lazily)
 	context := &Context {
-		DB: GetDatabaseConnection(),
 		SQL: GetSQLDatabaseConnection(),
-		Session: session,
-		Cache: GetCacheConnection(),
-		Client: LoadClient(session),
 		Request: r,
 		ResponseWriter: w,
 		Params: NewParamsStream(r),
 
+		RequestID: getRequestID(r),
+
 		Token: "",
 		Success: true,
 		Data: map[string]interface{} {},
 	}
 
+	// echo request ID for correlation
+	w.Header().Set(RequestIDHeader, context.RequestID)
+
 	return context
 }
 
+// context for work outside of requests (e.g. background jobs), released with Close
+func CreateBackgroundContext() *Context {
+	return &Context {
+		SQL: GetSQLDatabaseConnection(),
+		RequestID: GenerateUUID(),
+		Success: true,
+		Data: map[string]interface{} {},
+	}
+}
+
+// use a sane incoming request ID (e.g. from the router), otherwise generate one
+func getRequestID(r *http.Request) string {
+	requestID := r.Header.Get(RequestIDHeader)
+	if requestID != "" && len(requestID) <= 64 && IsAlphaNumeric(strings.Replace(requestID, "-", "", -1), false) {
+		return requestID
+	}
+	return GenerateUUID()
+}
+
+// logger with request fields
+func (context *Context) Log() *log.Entry {
+	fields := log.Fields {
+		"requestId": context.RequestID,
+		"route": context.Route,
+	}
+	if context.UserID.Valid() {
+		fields["userId"] = context.UserID.Hex()
+	}
+	if context.client != nil && context.client.Version != "" {
+		fields["clientVersion"] = context.client.Version
+	}
+	return log.WithFields(fields)
+}
+
+// mongo database, with a session copied on first use
+func (context *Context) DB() *mgo.Database {
+	if context.db == nil {
+		context.db = GetDatabaseConnection()
+		ContextResources.Inc("mongo")
+	}
+	return context.db
+}
+
+// cache, with a redis connection checked out of the pool on first use
+func (context *Context) Cache() Cache {
+	if context.cache == nil {
+		context.cache = GetCacheConnection()
+		ContextResources.Inc("redis")
+	}
+	return context.cache
+}
+
+// cookie session, decoded on first use
+func (context *Context) Session() *Session {
+	if context.session == nil {
+		context.session = GetSession(context.ResponseWriter, context.Request)
+		ContextResources.Inc("session")
+	}
+	return context.session
+}
+
+// client info, loaded from session on first use
+func (context *Context) Client() *Client {
+	if context.client == nil {
+		context.client = LoadClient(context.Session())
+	}
+	return context.client
+}
+
+// client version for adapting responses, without decoding a missing session or failing on an invalid one
+func (context *Context) getResponseVersion() (version string) {
+	if _, err := context.Request.Cookie(SessionCookieName); context.session == nil && err != nil {
+		return ""
+	}
+
+	defer func() {
+		if err := recover(); err != nil {
+			version = ""
+		}
+	}()
+	return context.Client().Version
+}
+
+// release connections of a background context
+func (context *Context) Close() {
+	context.close()
+}
+
 func (context *Context) close() {
 	// close database connection
-	context.DB.Session.Close()
+	if context.db != nil {
+		context.db.Session.Close()
+		context.db = nil
+	}
 
 	// close redis connection
-	context.Cache.Close()
+	if context.cache != nil {
+		context.cache.Close()
+		context.cache = nil
+	}
 }
 
 func (context *Context) Write(p []byte) (n int, err error) {
@@ -112,6 +211,11 @@ func (context *Context) BeginRequest(template string) {
 	// remember defined template
 	context.Template = template
 
+	// binary request bodies (API only)
+	if template == "" {
+		context.decodeWireBody()
+	}
+
 	// initial request logging
 	switch config.Config.GetLogging().Requests {
 
@@ -122,18 +226,18 @@ func (context *Context) BeginRequest(template string) {
 			query, _ = url.QueryUnescape(context.Request.URL.RawQuery)
 			query = "?" + strings.Replace(query, "\r\n", "", -1)
 		}
-		message := log.Sprintf("[cyan]Request received: %v%v%v[-]", context.Request.Host, context.Request.URL.Path, query)
+		message := fmt.Sprintf("Request received: %v%v%v", context.Request.Host, context.Request.URL.Path, query)
 		if len(message) > 472 {
 			message = message[:472] + "..."
 		}
 
-		log.Println(message)
+		context.Log().Printf("[cyan]%s[-]", message)
 
 	case config.FullLogging:
 		// get formatted request dump to log
 		dump, _ := httputil.DumpRequest(context.Request, true)
 
-		log.Printf("[cyan]Request received: %q[-]", dump)
+		context.Log().Printf("[cyan]Request received: %q[-]", dump)
 
 	}
 }
@@ -155,7 +259,7 @@ func (context *Context) EndRequest(startTime time.Time) {
 	// catch any panics occurring in this function
 	defer func() {
 		if templateErr := recover(); templateErr != nil {
-			LogError("Occurred during last request", templateErr)
+			context.LogError("Occurred during last request", templateErr)
 
 			if context.Template != "" {
 				context.Redirect(fmt.Sprintf("/error?message=%v", templateErr), 302) // TODO - can remove parameter once session flashes are working
@@ -187,23 +291,34 @@ func (context *Context) EndRequest(startTime time.Time) {
 			// respond with error
 			responseString = fmt.Sprintf("Processing template (%v): %v", context.Template, err)
 
-			log.Error(responseString)
+			context.Log().Errorf("%s", responseString)
 			context.Redirect(fmt.Sprintf("/error?message=%s", responseString), 302) // TODO - can remove parameter once session flashes are working
 		}
 	} else {
 		// serialize API response to json
 		var responseString string
 		raw, err := json.Marshal(context)
+		if err == nil {
+			// older clients receive payloads in the shape they expect
+			version := context.getResponseVersion()
+			if adapted, adaptErr := AdaptResponse(version, raw); adaptErr == nil {
+				raw = adapted
+			} else {
+				context.Log().Errorf("Adapting response for version %s: %v", version, adaptErr)
+			}
+		}
 		if err == nil {
 			responseString = string(raw)
 		} else {
 			responseString = fmt.Sprintf("Marshalling response: %v", err)
 
-			log.Error(responseString)
+			context.Log().Errorf("%s", responseString)
 		}
 
-		// write API response to stream
-		fmt.Fprint(context.ResponseWriter, responseString)
+		// write API response to stream in negotiated format
+		if err = context.writeWireResponse([]byte(responseString)); err != nil {
+			context.Log().Errorf("Writing response: %v", err)
+		}
 	}
 
 	// show response profiling info
@@ -226,10 +341,14 @@ func (context *Context) EndRequest(startTime time.Time) {
 			userColor = "yellow!"
 		}
 
-		Profile(log.Sprintf("[cyan]Request handled: %v%v ([" + successColor + "]%s[-][cyan], User: [" + userColor + "]%s[-])[-]", context.Request.Host, context.Request.URL.Path, successMessage, userID), startTime)
+		elapsedTime := time.Since(startTime)
+		context.Log().WithFields(log.Fields {
+			"latency": elapsedTime.Seconds() * 1000,
+			"success": context.Success,
+		}).Printf("[cyan]Request handled: %v%v ([" + successColor + "]%s[-][cyan], User: [" + userColor + "]%s[-])[-] [%v]", context.Request.Host, context.Request.URL.Path, successMessage, userID, elapsedTime)
 
 		if caughtErr == nil && context.Success == false {
-			log.Errorf("Request failed with: %s", context.Messages[0])
+			context.Log().Errorf("Request failed with: %s", context.Messages[0])
 		}
 		
 	}
@@ -238,6 +357,6 @@ func (context *Context) EndRequest(startTime time.Time) {
 	if caughtErr != nil {
 		InsertErrorFault(context, caughtErr)
 
-		LogError("Occurred during last request", caughtErr)
+		context.LogError("Occurred during last request", caughtErr)
 	}
 }
\ No newline at end of file
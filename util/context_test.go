@@ -0,0 +1,61 @@
+package util
+
+import (
+	"time"
+	"testing"
+	"net/http/httptest"
+
+	"bloodtales/log"
+)
+
+// resources counted by ContextResources (mongo is unavailable on memory storage)
+var contextBenchResources []string = []string { "redis", "session" }
+
+// request which never uses the cache or session (loader.io token)
+func BenchmarkCreateContext(b *testing.B) {
+	benchmarkCreateContext(b, false)
+}
+
+// same request acquiring every resource, as contexts did before resources were acquired lazily
+func BenchmarkCreateContextEager(b *testing.B) {
+	benchmarkCreateContext(b, true)
+}
+
+func benchmarkCreateContext(b *testing.B, eager bool) {
+	// request logging would dominate timings
+	log.Configure(log.Options { Format: log.ConsoleFormat, Level: log.LevelError })
+	ResetMemoryCache()
+
+	before := make([]float64, len(contextBenchResources))
+	for i, resource := range contextBenchResources {
+		before[i] = ContextResources.Value(resource)
+	}
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		benchmarkContextRequest(eager)
+	}
+	b.StopTimer()
+
+	for i, resource := range contextBenchResources {
+		b.ReportMetric((ContextResources.Value(resource) - before[i]) / float64(b.N), resource + "/op")
+	}
+}
+
+// handle a request which writes its own response
+func benchmarkContextRequest(eager bool) {
+	w := httptest.NewRecorder()
+	r := httptest.NewRequest("GET", "/loaderio-token/", nil)
+
+	context := CreateContext(w, r)
+	defer context.EndRequest(time.Now())
+	context.BeginRequest("")
+
+	if eager {
+		context.Cache()
+		context.Client()
+	}
+
+	context.Write([]byte("loaderio-token"))
+}
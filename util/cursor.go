@@ -0,0 +1,63 @@
+package util
+
+import (
+	"fmt"
+	"errors"
+	"strconv"
+	"strings"
+	"encoding/base64"
+
+	"gopkg.in/mgo.v2/bson"
+)
+
+// opaque position after the last result of a page, for results sorted by a value (descending) then ID (descending)
+type Cursor struct {
+	Value       int64
+	ID          bson.ObjectId
+}
+
+func (cursor *Cursor) String() string {
+	return base64.RawURLEncoding.EncodeToString([]byte(fmt.Sprintf("%d:%s", cursor.Value, cursor.ID.Hex())))
+}
+
+func ParseCursor(raw string) (cursor *Cursor, err error) {
+	decoded, err := base64.RawURLEncoding.DecodeString(raw)
+	if err == nil {
+		parts := strings.SplitN(string(decoded), ":", 2)
+		if len(parts) == 2 && bson.IsObjectIdHex(parts[1]) {
+			var value int64
+			if value, err = strconv.ParseInt(parts[0], 10, 64); err == nil {
+				return &Cursor { Value: value, ID: bson.ObjectIdHex(parts[1]) }, nil
+			}
+		}
+	}
+
+	return nil, errors.New(fmt.Sprintf("Invalid cursor: %s", raw))
+}
+
+// mongo query for results after the cursor, sorted by -field then -_id
+func (cursor *Cursor) Query(field string) bson.M {
+	return bson.M { "$or": []bson.M {
+		bson.M { field: bson.M { "$lt": cursor.Value } },
+		bson.M { field: cursor.Value, "_id": bson.M { "$lt": cursor.ID } },
+	}}
+}
+
+// whether a result sorted by value then ID comes after the cursor
+func (cursor *Cursor) After(value int64, id bson.ObjectId) bool {
+	return value < cursor.Value || (value == cursor.Value && id < cursor.ID)
+}
+
+// cursor parameter (nil when missing)
+func (stream *Stream) GetCursor(name string) *Cursor {
+	value := stream.GetString(name, "")
+	if value == "" {
+		return nil
+	}
+
+	cursor, err := ParseCursor(value)
+	if err != nil {
+		panic(err)
+	}
+	return cursor
+}
@@ -1,6 +1,7 @@
 package util
 
 import (
+	"fmt"
 	"time"
 	"strings"
 	"io/ioutil"
@@ -11,6 +12,12 @@ import (
 )
 
 var (
+	// metrics
+	databaseDuration *Metric = NewHistogram("mongo_operation_duration_seconds", "MongoDB operation latency.", nil, "collection", "operation")
+	databaseErrors   *Metric = NewCounter("mongo_operation_errors_total", "MongoDB operation errors (not found excluded).", "collection", "operation")
+	databaseOps      *Metric = NewCounter("mongo_driver_ops_total", "MongoDB wire operations sent and received.", "direction")
+	databaseSockets  *Metric = NewGauge("mongo_driver_sockets", "MongoDB driver sockets.", "state")
+
 	// internal
 	mgoDBSession	*mgo.Session
 	mgoDB			*mgo.Database
@@ -19,8 +26,14 @@ var (
 )
 
 func init() {
-	initDatabase();
+	if Storage == MongoStorage {
+		initDatabase();
+	}
 	initSQL();
+
+	// driver stats
+	mgo.SetStats(true)
+	AddMetricCollector(collectDatabaseMetrics)
 }
 
 func initDatabase() {
@@ -57,6 +70,10 @@ func initSQL() {
 }
 
 func GetDatabaseConnection() (*mgo.Database) {
+	if mgoDBSession == nil {
+		panic(fmt.Sprintf("MongoDB is not available with %s storage", Storage))
+	}
+
 	session := mgoDBSession.Copy()
 	return mgoDB.With(session)
 }
@@ -82,6 +99,42 @@ func GetSQLDatabaseConnection() (*sql.DB) {
 	return pqDB
 }
 
+// record a MongoDB operation, used as: defer util.ObserveDatabase("players", "save", time.Now(), &err)
+func ObserveDatabase(collection string, operation string, start time.Time, err *error) {
+	databaseDuration.ObserveSince(start, collection, operation)
+	if err != nil && *err != nil && *err != mgo.ErrNotFound {
+		databaseErrors.Inc(collection, operation)
+	}
+}
+
+func collectDatabaseMetrics() {
+	stats := mgo.GetStats()
+	databaseOps.Set(float64(stats.SentOps), "sent")
+	databaseOps.Set(float64(stats.ReceivedOps), "received")
+	databaseSockets.Set(float64(stats.SocketsAlive), "alive")
+	databaseSockets.Set(float64(stats.SocketsInUse), "in_use")
+}
+
+// check MongoDB connectivity
+func PingDatabase() error {
+	if mgoDBSession == nil {
+		return nil
+	}
+
+	session := mgoDBSession.Copy()
+	defer session.Close()
+
+	return session.Ping()
+}
+
+// check SQL connectivity (if configured)
+func PingSQL() error {
+	if pqDB == nil {
+		return nil
+	}
+	return pqDB.Ping()
+}
+
 func CloseDatabase() {
 	// close MongoDB
 	if mgoDBSession != nil {
@@ -34,7 +34,16 @@ func (e *errorStack) Error() string {
 }
 
 func LogError(message string, err interface{}) {
-	log.Errorf("%s: %v", message, err)
+	logError(log.WithFields(nil), message, err)
+}
+
+// log error with request fields
+func (context *Context) LogError(message string, err interface{}) {
+	logError(context.Log(), message, err)
+}
+
+func logError(entry *log.Entry, message string, err interface{}) {
+	entry.Errorf("%s: %v", message, err)
 
 	// get stack
 	var stack string = ""
@@ -2,6 +2,8 @@ package util
 
 import (
 	"fmt"
+	"sort"
+	"sync"
 	"time"
 	"runtime/debug"
 	
@@ -11,9 +13,30 @@ import (
 
 const FaultCollectionName = "faults"
 
+// fault storage (MongoDB, or in memory with memory storage), returning mgo.ErrNotFound for missing faults
+type FaultRepository interface {
+	Insert(context *Context, fault *Fault) error
+	Delete(context *Context, id bson.ObjectId) error
+	GetById(context *Context, id bson.ObjectId) (*Fault, error)
+
+	// oldest first
+	GetByUser(context *Context, userId bson.ObjectId) ([]Fault, error)
+}
+
+var Faults FaultRepository = newFaultRepository()
+
+type mongoFaultRepository struct {}
+
+// faults kept until they expire, like the mongo expiry index
+type memoryFaultRepository struct {
+	mutex           sync.Mutex
+	faults          []Fault
+}
+
 type Fault struct {
 	ID             bson.ObjectId `bson:"_id,omitempty" json:"-"`
 	UserID         bson.ObjectId `bson:"us,omitempty" json:"-"`
+	RequestID      string        `bson:"rid,omitempty" json:"requestId"`
 	CreatedTime    time.Time     `bson:"t0" json:"created"`
 	ExpireTime     time.Time     `bson:"exp,omitempty" json:"expires"`
 	Error          string        `bson:"err" json:"error"`
@@ -39,9 +62,20 @@ func EnsureIndexFault(database *mgo.Database) {
 	}))
 }
 
+func newFaultRepository() FaultRepository {
+	if Storage == MemoryStorage {
+		return &memoryFaultRepository {}
+	}
+	return mongoFaultRepository {}
+}
+
+// use an empty in-memory fault repository (e.g. between tests)
+func ResetMemoryFaults() {
+	Faults = &memoryFaultRepository {}
+}
+
 func GetFaultById(context *Context, id bson.ObjectId) (fault *Fault, err error) {
-	err = context.DB.C(FaultCollectionName).Find(bson.M { "_id": id } ).One(&fault)
-	return
+	return Faults.GetById(context, id)
 }
 
 func InsertErrorFault(context *Context, err interface{}) error {
@@ -55,6 +89,7 @@ func InsertErrorFault(context *Context, err interface{}) error {
 
 	fault := &Fault {
 		UserID: context.UserID,
+		RequestID: context.RequestID,
 		ExpireTime: time.Now().Add(time.Hour * time.Duration(168)), // 1 week
 		Error: fmt.Sprintf("%v", err),
 		Stack: stack,
@@ -66,15 +101,97 @@ func InsertErrorFault(context *Context, err interface{}) error {
 func (fault *Fault) Insert(context *Context) (err error) {
 	fault.ID = bson.NewObjectId()
 	fault.CreatedTime = time.Now()
-	err = context.DB.C(FaultCollectionName).Insert(fault)
+	err = Faults.Insert(context, fault)
 	return
 }
 
 func (fault *Fault) Delete(context *Context) (err error) {
-	return context.DB.C(FaultCollectionName).Remove(bson.M { "_id": fault.ID })
+	return Faults.Delete(context, fault.ID)
 }
 
 func GetFaults(context *Context, userId bson.ObjectId) (faults *[]Fault, err error) {
-	err = context.DB.C(FaultCollectionName).Find(bson.M { "us": userId } ).Sort("t0").All(&faults)
+	list, err := Faults.GetByUser(context, userId)
+	if err == nil {
+		faults = &list
+	}
+	return
+}
+
+// mongo
+
+func (repository mongoFaultRepository) Insert(context *Context, fault *Fault) error {
+	return context.DB().C(FaultCollectionName).Insert(fault)
+}
+
+func (repository mongoFaultRepository) Delete(context *Context, id bson.ObjectId) error {
+	return context.DB().C(FaultCollectionName).Remove(bson.M { "_id": id })
+}
+
+func (repository mongoFaultRepository) GetById(context *Context, id bson.ObjectId) (fault *Fault, err error) {
+	err = context.DB().C(FaultCollectionName).Find(bson.M { "_id": id } ).One(&fault)
+	return
+}
+
+func (repository mongoFaultRepository) GetByUser(context *Context, userId bson.ObjectId) (faults []Fault, err error) {
+	err = context.DB().C(FaultCollectionName).Find(bson.M { "us": userId } ).Sort("t0").All(&faults)
+	return
+}
+
+// memory
+
+func (repository *memoryFaultRepository) Insert(context *Context, fault *Fault) error {
+	repository.mutex.Lock()
+	defer repository.mutex.Unlock()
+
+	// drop expired faults
+	now := time.Now()
+	kept := repository.faults[:0]
+	for _, existing := range repository.faults {
+		if existing.ExpireTime.IsZero() || now.Before(existing.ExpireTime) {
+			kept = append(kept, existing)
+		}
+	}
+	repository.faults = append(kept, *fault)
+	return nil
+}
+
+func (repository *memoryFaultRepository) Delete(context *Context, id bson.ObjectId) error {
+	repository.mutex.Lock()
+	defer repository.mutex.Unlock()
+
+	for i, existing := range repository.faults {
+		if existing.ID == id {
+			repository.faults = append(repository.faults[:i], repository.faults[i + 1:]...)
+			return nil
+		}
+	}
+	return mgo.ErrNotFound
+}
+
+func (repository *memoryFaultRepository) GetById(context *Context, id bson.ObjectId) (*Fault, error) {
+	repository.mutex.Lock()
+	defer repository.mutex.Unlock()
+
+	for _, existing := range repository.faults {
+		if existing.ID == id {
+			fault := existing
+			return &fault, nil
+		}
+	}
+	return nil, mgo.ErrNotFound
+}
+
+func (repository *memoryFaultRepository) GetByUser(context *Context, userId bson.ObjectId) (faults []Fault, err error) {
+	repository.mutex.Lock()
+	defer repository.mutex.Unlock()
+
+	for _, existing := range repository.faults {
+		if existing.UserID == userId {
+			faults = append(faults, existing)
+		}
+	}
+	sort.SliceStable(faults, func(i, j int) bool {
+		return faults[i].CreatedTime.Before(faults[j].CreatedTime)
+	})
 	return
 }
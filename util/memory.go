@@ -0,0 +1,323 @@
+package util
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+	"strconv"
+)
+
+// in-process cache with the semantics of the redis commands used (values are stored as strings)
+type MemoryCache struct {
+	Stream
+
+	// internal
+	store    *memoryCacheStore
+}
+
+type MemoryCacheStreamSource struct {
+	// internal
+	store    *memoryCacheStore
+}
+
+// shared by all connections, like a redis server
+type memoryCacheStore struct {
+	mutex    sync.Mutex
+	values   map[string]string
+	scores   map[string]map[string]int
+	expiry   map[string]time.Time
+}
+
+var (
+	// internal
+	memoryCache    *memoryCacheStore = newMemoryCacheStore()
+)
+
+func newMemoryCacheStore() *memoryCacheStore {
+	return &memoryCacheStore {
+		values: map[string]string {},
+		scores: map[string]map[string]int {},
+		expiry: map[string]time.Time {},
+	}
+}
+
+// clear the shared memory cache (e.g. between tests)
+func ResetMemoryCache() {
+	memoryCache.mutex.Lock()
+	defer memoryCache.mutex.Unlock()
+
+	memoryCache.values = map[string]string {}
+	memoryCache.scores = map[string]map[string]int {}
+	memoryCache.expiry = map[string]time.Time {}
+}
+
+func GetMemoryCacheConnection() (cache *MemoryCache) {
+	return &MemoryCache {
+		Stream: Stream {
+			source: MemoryCacheStreamSource {
+				store: memoryCache,
+			},
+		},
+		store: memoryCache,
+	}
+}
+
+// remove key if expired (requires lock)
+func (store *memoryCacheStore) expire(name string) {
+	if expiry, ok := store.expiry[name]; ok && !time.Now().Before(expiry) {
+		store.delete(name)
+	}
+}
+
+func (store *memoryCacheStore) delete(name string) {
+	delete(store.values, name)
+	delete(store.scores, name)
+	delete(store.expiry, name)
+}
+
+// sorted set members by score then name (requires lock)
+func (store *memoryCacheStore) sortedMembers(group string) []string {
+	store.expire(group)
+	scores := store.scores[group]
+
+	members := make([]string, 0, len(scores))
+	for member, _ := range scores {
+		members = append(members, member)
+	}
+	sort.Slice(members, func(i, j int) bool {
+		if scores[members[i]] != scores[members[j]] {
+			return scores[members[i]] < scores[members[j]]
+		}
+		return members[i] < members[j]
+	})
+	return members
+}
+
+// members by descending score within the index range (requires lock)
+func (store *memoryCacheStore) revRange(group string, start int, stop int) []string {
+	members := store.sortedMembers(group)
+	count := len(members)
+	if start < 0 {
+		start += count
+	}
+	if stop < 0 {
+		stop += count
+	}
+	if start < 0 {
+		start = 0
+	}
+	if stop >= count {
+		stop = count - 1
+	}
+
+	result := []string {}
+	for i := start; i <= stop; i++ {
+		result = append(result, members[count - 1 - i])
+	}
+	return result
+}
+
+// format values as the redis client sends them
+func memoryCacheValue(value interface{}) string {
+	switch value := value.(type) {
+	case string:
+		return value
+	case []byte:
+		return string(value)
+	case bool:
+		if value {
+			return "1"
+		}
+		return "0"
+	case float64:
+		return strconv.FormatFloat(value, 'g', -1, 64)
+	}
+	return fmt.Sprint(value)
+}
+
+func (source MemoryCacheStreamSource) Has(name string) bool {
+	source.store.mutex.Lock()
+	defer source.store.mutex.Unlock()
+
+	source.store.expire(name)
+	_, isValue := source.store.values[name]
+	_, isGroup := source.store.scores[name]
+	return isValue || isGroup
+}
+
+func (source MemoryCacheStreamSource) Set(name string, value interface{}) {
+	source.store.mutex.Lock()
+	defer source.store.mutex.Unlock()
+
+	// setting a value clears any expiry, like SET
+	source.store.delete(name)
+	if !IsNil(value) {
+		source.store.values[name] = memoryCacheValue(value)
+	}
+}
+
+func (source MemoryCacheStreamSource) Get(name string) interface{} {
+	source.store.mutex.Lock()
+	defer source.store.mutex.Unlock()
+
+	source.store.expire(name)
+	return source.store.values[name]
+}
+
+func (cache *MemoryCache) Close() {
+}
+
+func (cache *MemoryCache) Expire(name string, ttl int) {
+	cache.store.mutex.Lock()
+	defer cache.store.mutex.Unlock()
+
+	cache.store.expire(name)
+	_, isValue := cache.store.values[name]
+	_, isGroup := cache.store.scores[name]
+	if isValue || isGroup {
+		cache.store.expiry[name] = time.Now().Add(time.Duration(ttl) * time.Second)
+	}
+}
+
+func (cache *MemoryCache) SetIfAbsent(name string, value interface{}, ttl int) bool {
+	cache.store.mutex.Lock()
+	defer cache.store.mutex.Unlock()
+
+	cache.store.expire(name)
+	_, isValue := cache.store.values[name]
+	_, isGroup := cache.store.scores[name]
+	if isValue || isGroup {
+		return false
+	}
+	cache.store.values[name] = memoryCacheValue(value)
+	cache.store.expiry[name] = time.Now().Add(time.Duration(ttl) * time.Second)
+	return true
+}
+
+func (cache *MemoryCache) SetScore(group string, name string, score int) {
+	cache.store.mutex.Lock()
+	defer cache.store.mutex.Unlock()
+
+	cache.store.expire(group)
+	scores, ok := cache.store.scores[group]
+	if !ok {
+		scores = map[string]int {}
+		cache.store.scores[group] = scores
+	}
+	scores[name] = score
+}
+
+func (cache *MemoryCache) SetScores(group string, scores map[string]int) {
+	cache.store.mutex.Lock()
+	defer cache.store.mutex.Unlock()
+
+	if len(scores) == 0 {
+		return
+	}
+
+	cache.store.expire(group)
+	existing, ok := cache.store.scores[group]
+	if !ok {
+		existing = map[string]int {}
+		cache.store.scores[group] = existing
+	}
+	for name, score := range scores {
+		existing[name] = score
+	}
+}
+
+func (cache *MemoryCache) GetScore(group string, name string) int {
+	cache.store.mutex.Lock()
+	defer cache.store.mutex.Unlock()
+
+	cache.store.expire(group)
+	return cache.store.scores[group][name]
+}
+
+func (cache *MemoryCache) RemoveScore(group string, name string) {
+	cache.store.mutex.Lock()
+	defer cache.store.mutex.Unlock()
+
+	cache.store.expire(group)
+	if scores, ok := cache.store.scores[group]; ok {
+		delete(scores, name)
+		if len(scores) == 0 {
+			cache.store.delete(group)
+		}
+	}
+}
+
+func (cache *MemoryCache) ClearScores(group string) {
+	cache.store.mutex.Lock()
+	defer cache.store.mutex.Unlock()
+
+	cache.store.delete(group)
+}
+
+func (cache *MemoryCache) RenameScores(group string, name string) {
+	cache.store.mutex.Lock()
+	defer cache.store.mutex.Unlock()
+
+	cache.store.expire(group)
+	scores, ok := cache.store.scores[group]
+	cache.store.delete(name)
+	if ok {
+		cache.store.delete(group)
+		cache.store.scores[name] = scores
+	}
+}
+
+func (cache *MemoryCache) GetScoreCount(group string) int {
+	cache.store.mutex.Lock()
+	defer cache.store.mutex.Unlock()
+
+	cache.store.expire(group)
+	return len(cache.store.scores[group])
+}
+
+// ascending rank (0 when missing, as the redis implementation returns)
+func (cache *MemoryCache) GetRank(group string, name string) int {
+	cache.store.mutex.Lock()
+	defer cache.store.mutex.Unlock()
+
+	for rank, member := range cache.store.sortedMembers(group) {
+		if member == name {
+			return rank
+		}
+	}
+	return 0
+}
+
+// descending rank (-1 when missing)
+func (cache *MemoryCache) GetRevRank(group string, name string) int {
+	cache.store.mutex.Lock()
+	defer cache.store.mutex.Unlock()
+
+	members := cache.store.sortedMembers(group)
+	for rank, member := range members {
+		if member == name {
+			return len(members) - 1 - rank
+		}
+	}
+	return -1
+}
+
+// members by descending score, with redis index semantics (negative indices count from the end)
+func (cache *MemoryCache) GetRankRange(group string, start int, stop int) []string {
+	cache.store.mutex.Lock()
+	defer cache.store.mutex.Unlock()
+
+	return cache.store.revRange(group, start, stop)
+}
+
+func (cache *MemoryCache) GetRankRangeWithScores(group string, start int, stop int) []ScoreEntry {
+	cache.store.mutex.Lock()
+	defer cache.store.mutex.Unlock()
+
+	entries := []ScoreEntry {}
+	for _, member := range cache.store.revRange(group, start, stop) {
+		entries = append(entries, ScoreEntry { Name: member, Score: cache.store.scores[group][member] })
+	}
+	return entries
+}
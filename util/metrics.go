@@ -0,0 +1,258 @@
+package util
+
+import (
+	"io"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+	"math"
+	"strings"
+	"strconv"
+)
+
+// metric type (prometheus text exposition format)
+type MetricType string
+const (
+	MetricCounter MetricType = "counter"
+	MetricGauge = "gauge"
+	MetricHistogram = "histogram"
+)
+
+// default histogram buckets (seconds)
+var DefaultMetricBuckets []float64 = []float64 { 0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10 }
+
+// labelled metric family
+type Metric struct {
+	Name            string
+	Help            string
+	Type            MetricType
+	Labels          []string
+	Buckets         []float64
+
+	// internal
+	mutex           sync.Mutex
+	values          map[string]*metricValue
+}
+
+type metricValue struct {
+	labels          []string
+	value           float64
+	counts          []uint64
+	count           uint64
+}
+
+var (
+	// internal
+	metricLabelEscaper *strings.Replacer = strings.NewReplacer("\\", "\\\\", "\"", "\\\"", "\n", "\\n")
+	metricsMutex    sync.Mutex
+	metrics         []*Metric
+	metricCollectors []func()
+)
+
+func newMetric(name string, help string, metricType MetricType, buckets []float64, labels []string) *Metric {
+	metric := &Metric {
+		Name: name,
+		Help: help,
+		Type: metricType,
+		Labels: labels,
+		Buckets: buckets,
+		values: map[string]*metricValue {},
+	}
+
+	metricsMutex.Lock()
+	defer metricsMutex.Unlock()
+
+	for _, existing := range metrics {
+		if existing.Name == name {
+			panic(fmt.Sprintf("Metric already registered: %s", name))
+		}
+	}
+	metrics = append(metrics, metric)
+	return metric
+}
+
+func NewCounter(name string, help string, labels ...string) *Metric {
+	return newMetric(name, help, MetricCounter, nil, labels)
+}
+
+func NewGauge(name string, help string, labels ...string) *Metric {
+	return newMetric(name, help, MetricGauge, nil, labels)
+}
+
+func NewHistogram(name string, help string, buckets []float64, labels ...string) *Metric {
+	if buckets == nil {
+		buckets = DefaultMetricBuckets
+	}
+	return newMetric(name, help, MetricHistogram, buckets, labels)
+}
+
+// register a function called before metrics are written (to update gauges)
+func AddMetricCollector(collector func()) {
+	metricsMutex.Lock()
+	defer metricsMutex.Unlock()
+
+	metricCollectors = append(metricCollectors, collector)
+}
+
+func (metric *Metric) get(labels []string) *metricValue {
+	if len(labels) != len(metric.Labels) {
+		panic(fmt.Sprintf("Metric %s expects %d labels, got %d", metric.Name, len(metric.Labels), len(labels)))
+	}
+
+	key := strings.Join(labels, "\xff")
+	value, ok := metric.values[key]
+	if !ok {
+		value = &metricValue {
+			labels: append([]string {}, labels...),
+		}
+		if metric.Type == MetricHistogram {
+			value.counts = make([]uint64, len(metric.Buckets))
+		}
+		metric.values[key] = value
+	}
+	return value
+}
+
+func (metric *Metric) Inc(labels ...string) {
+	metric.Add(1, labels...)
+}
+
+func (metric *Metric) Add(delta float64, labels ...string) {
+	metric.mutex.Lock()
+	defer metric.mutex.Unlock()
+
+	metric.get(labels).value += delta
+}
+
+func (metric *Metric) Set(value float64, labels ...string) {
+	metric.mutex.Lock()
+	defer metric.mutex.Unlock()
+
+	metric.get(labels).value = value
+}
+
+func (metric *Metric) Observe(observed float64, labels ...string) {
+	metric.mutex.Lock()
+	defer metric.mutex.Unlock()
+
+	value := metric.get(labels)
+	value.value += observed
+	value.count++
+	for i, bound := range metric.Buckets {
+		if observed <= bound {
+			value.counts[i]++
+		}
+	}
+}
+
+// get current value (sum for histograms)
+func (metric *Metric) Value(labels ...string) float64 {
+	metric.mutex.Lock()
+	defer metric.mutex.Unlock()
+
+	return metric.get(labels).value
+}
+
+// observe seconds elapsed since start
+func (metric *Metric) ObserveSince(start time.Time, labels ...string) {
+	metric.Observe(time.Since(start).Seconds(), labels...)
+}
+
+// clear all label values (for gauges rebuilt by collectors)
+func (metric *Metric) Reset() {
+	metric.mutex.Lock()
+	defer metric.mutex.Unlock()
+
+	metric.values = map[string]*metricValue {}
+}
+
+// write all metrics in prometheus text format
+func WriteMetrics(writer io.Writer) (err error) {
+	metricsMutex.Lock()
+	collectors := append([]func() {}, metricCollectors...)
+	families := append([]*Metric {}, metrics...)
+	metricsMutex.Unlock()
+
+	for _, collector := range collectors {
+		runMetricCollector(collector)
+	}
+
+	sort.Slice(families, func(i, j int) bool { return families[i].Name < families[j].Name })
+
+	for _, metric := range families {
+		if _, err = io.WriteString(writer, metric.format()); err != nil {
+			return
+		}
+	}
+	return
+}
+
+func runMetricCollector(collector func()) {
+	defer func() {
+		if err := recover(); err != nil {
+			LogError("Occurred during metrics collection", err)
+		}
+	}()
+	collector()
+}
+
+func (metric *Metric) format() string {
+	metric.mutex.Lock()
+	defer metric.mutex.Unlock()
+
+	var builder strings.Builder
+	fmt.Fprintf(&builder, "# HELP %s %s\n", metric.Name, strings.Replace(metric.Help, "\n", " ", -1))
+	fmt.Fprintf(&builder, "# TYPE %s %s\n", metric.Name, metric.Type)
+
+	// stable order by label values
+	keys := make([]string, 0, len(metric.values))
+	for key, _ := range metric.values {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	for _, key := range keys {
+		value := metric.values[key]
+
+		switch metric.Type {
+		case MetricHistogram:
+			for i, bound := range metric.Buckets {
+				fmt.Fprintf(&builder, "%s_bucket%s %d\n", metric.Name, metric.formatLabels(value.labels, "le", formatMetricValue(bound)), value.counts[i])
+			}
+			fmt.Fprintf(&builder, "%s_bucket%s %d\n", metric.Name, metric.formatLabels(value.labels, "le", "+Inf"), value.count)
+			fmt.Fprintf(&builder, "%s_sum%s %s\n", metric.Name, metric.formatLabels(value.labels), formatMetricValue(value.value))
+			fmt.Fprintf(&builder, "%s_count%s %d\n", metric.Name, metric.formatLabels(value.labels), value.count)
+
+		default:
+			fmt.Fprintf(&builder, "%s%s %s\n", metric.Name, metric.formatLabels(value.labels), formatMetricValue(value.value))
+		}
+	}
+	return builder.String()
+}
+
+// format label set, with optional extra name/value pair
+func (metric *Metric) formatLabels(values []string, extra ...string) string {
+	pairs := []string {}
+	for i, name := range metric.Labels {
+		pairs = append(pairs, fmt.Sprintf("%s=\"%s\"", name, metricLabelEscaper.Replace(values[i])))
+	}
+	if len(extra) == 2 {
+		pairs = append(pairs, fmt.Sprintf("%s=\"%s\"", extra[0], metricLabelEscaper.Replace(extra[1])))
+	}
+
+	if len(pairs) == 0 {
+		return ""
+	}
+	return "{" + strings.Join(pairs, ",") + "}"
+}
+
+func formatMetricValue(value float64) string {
+	switch {
+	case math.IsInf(value, 1):
+		return "+Inf"
+	case math.IsInf(value, -1):
+		return "-Inf"
+	}
+	return strconv.FormatFloat(value, 'g', -1, 64)
+}
@@ -0,0 +1,325 @@
+package util
+
+import (
+	"io"
+	"fmt"
+	"math"
+	"sort"
+	"bytes"
+	"errors"
+	"encoding/binary"
+	"encoding/json"
+)
+
+// MessagePack encoding of generic values (as produced by decoding JSON with UseNumber)
+func EncodeMsgPack(value interface{}) (raw []byte, err error) {
+	var buffer bytes.Buffer
+	err = encodeMsgPack(&buffer, value)
+	raw = buffer.Bytes()
+	return
+}
+
+func encodeMsgPack(buffer *bytes.Buffer, value interface{}) (err error) {
+	switch value := value.(type) {
+	case nil:
+		buffer.WriteByte(0xc0)
+
+	case bool:
+		if value {
+			buffer.WriteByte(0xc3)
+		} else {
+			buffer.WriteByte(0xc2)
+		}
+
+	case json.Number:
+		if integer, err := value.Int64(); err == nil {
+			encodeMsgPackInt(buffer, integer)
+		} else {
+			float, err := value.Float64()
+			if err != nil {
+				return err
+			}
+			buffer.WriteByte(0xcb)
+			binary.Write(buffer, binary.BigEndian, math.Float64bits(float))
+		}
+
+	case float64:
+		buffer.WriteByte(0xcb)
+		binary.Write(buffer, binary.BigEndian, math.Float64bits(value))
+
+	case int:
+		encodeMsgPackInt(buffer, int64(value))
+
+	case int64:
+		encodeMsgPackInt(buffer, value)
+
+	case string:
+		length := len(value)
+		switch {
+		case length < 32:
+			buffer.WriteByte(0xa0 | byte(length))
+		case length <= math.MaxUint8:
+			buffer.WriteByte(0xd9)
+			buffer.WriteByte(byte(length))
+		case length <= math.MaxUint16:
+			buffer.WriteByte(0xda)
+			binary.Write(buffer, binary.BigEndian, uint16(length))
+		default:
+			buffer.WriteByte(0xdb)
+			binary.Write(buffer, binary.BigEndian, uint32(length))
+		}
+		buffer.WriteString(value)
+
+	case []interface{}:
+		length := len(value)
+		switch {
+		case length < 16:
+			buffer.WriteByte(0x90 | byte(length))
+		case length <= math.MaxUint16:
+			buffer.WriteByte(0xdc)
+			binary.Write(buffer, binary.BigEndian, uint16(length))
+		default:
+			buffer.WriteByte(0xdd)
+			binary.Write(buffer, binary.BigEndian, uint32(length))
+		}
+		for _, item := range value {
+			if err = encodeMsgPack(buffer, item); err != nil {
+				return
+			}
+		}
+
+	case map[string]interface{}:
+		length := len(value)
+		switch {
+		case length < 16:
+			buffer.WriteByte(0x80 | byte(length))
+		case length <= math.MaxUint16:
+			buffer.WriteByte(0xde)
+			binary.Write(buffer, binary.BigEndian, uint16(length))
+		default:
+			buffer.WriteByte(0xdf)
+			binary.Write(buffer, binary.BigEndian, uint32(length))
+		}
+
+		// sorted keys for stable output
+		keys := make([]string, 0, length)
+		for key, _ := range value {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+
+		for _, key := range keys {
+			if err = encodeMsgPack(buffer, key); err != nil {
+				return
+			}
+			if err = encodeMsgPack(buffer, value[key]); err != nil {
+				return
+			}
+		}
+
+	default:
+		err = errors.New(fmt.Sprintf("MessagePack cannot encode type: %T", value))
+	}
+	return
+}
+
+func encodeMsgPackInt(buffer *bytes.Buffer, value int64) {
+	switch {
+	case value >= 0 && value <= 0x7f:
+		buffer.WriteByte(byte(value))
+	case value < 0 && value >= -32:
+		buffer.WriteByte(byte(value))
+	case value >= 0 && value <= math.MaxUint8:
+		buffer.WriteByte(0xcc)
+		buffer.WriteByte(byte(value))
+	case value >= 0 && value <= math.MaxUint16:
+		buffer.WriteByte(0xcd)
+		binary.Write(buffer, binary.BigEndian, uint16(value))
+	case value >= 0 && value <= math.MaxUint32:
+		buffer.WriteByte(0xce)
+		binary.Write(buffer, binary.BigEndian, uint32(value))
+	case value >= 0:
+		buffer.WriteByte(0xcf)
+		binary.Write(buffer, binary.BigEndian, uint64(value))
+	case value >= math.MinInt8:
+		buffer.WriteByte(0xd0)
+		binary.Write(buffer, binary.BigEndian, int8(value))
+	case value >= math.MinInt16:
+		buffer.WriteByte(0xd1)
+		binary.Write(buffer, binary.BigEndian, int16(value))
+	case value >= math.MinInt32:
+		buffer.WriteByte(0xd2)
+		binary.Write(buffer, binary.BigEndian, int32(value))
+	default:
+		buffer.WriteByte(0xd3)
+		binary.Write(buffer, binary.BigEndian, value)
+	}
+}
+
+// decode MessagePack into generic values (maps, slices, strings, numbers, bools and nil)
+func DecodeMsgPack(raw []byte) (value interface{}, err error) {
+	reader := bytes.NewReader(raw)
+	if value, err = decodeMsgPack(reader, 0); err != nil {
+		return
+	}
+	if reader.Len() > 0 {
+		err = errors.New("MessagePack has trailing data")
+	}
+	return
+}
+
+func decodeMsgPack(reader *bytes.Reader, depth int) (value interface{}, err error) {
+	if depth > maxWireDepth {
+		return nil, errors.New(fmt.Sprintf("MessagePack nested deeper than %d levels", maxWireDepth))
+	}
+
+	code, err := reader.ReadByte()
+	if err != nil {
+		return
+	}
+
+	switch {
+	case code <= 0x7f:
+		return int64(code), nil
+	case code >= 0xe0:
+		return int64(int8(code)), nil
+	case code & 0xe0 == 0xa0:
+		return readMsgPackString(reader, uint64(code & 0x1f))
+	case code & 0xf0 == 0x90:
+		return readMsgPackArray(reader, uint64(code & 0x0f), depth)
+	case code & 0xf0 == 0x80:
+		return readMsgPackMap(reader, uint64(code & 0x0f), depth)
+	}
+
+	switch code {
+	case 0xc0:
+		return nil, nil
+	case 0xc2:
+		return false, nil
+	case 0xc3:
+		return true, nil
+
+	case 0xcc, 0xcd, 0xce, 0xcf:
+		var unsigned uint64
+		if unsigned, err = readMsgPackUint(reader, 1 << (code - 0xcc)); err != nil {
+			return
+		}
+		if unsigned > math.MaxInt64 {
+			return float64(unsigned), nil
+		}
+		return int64(unsigned), nil
+
+	case 0xd0:
+		var integer int8
+		err = binary.Read(reader, binary.BigEndian, &integer)
+		return int64(integer), err
+	case 0xd1:
+		var integer int16
+		err = binary.Read(reader, binary.BigEndian, &integer)
+		return int64(integer), err
+	case 0xd2:
+		var integer int32
+		err = binary.Read(reader, binary.BigEndian, &integer)
+		return int64(integer), err
+	case 0xd3:
+		var integer int64
+		err = binary.Read(reader, binary.BigEndian, &integer)
+		return integer, err
+
+	case 0xca:
+		var float float32
+		err = binary.Read(reader, binary.BigEndian, &float)
+		return float64(float), err
+	case 0xcb:
+		var float float64
+		err = binary.Read(reader, binary.BigEndian, &float)
+		return float, err
+
+	case 0xd9, 0xda, 0xdb, 0xc4, 0xc5, 0xc6:
+		// strings and binary (read as strings)
+		size := 1 << (code - 0xd9)
+		if code <= 0xc6 {
+			size = 1 << (code - 0xc4)
+		}
+		var length uint64
+		if length, err = readMsgPackUint(reader, size); err != nil {
+			return
+		}
+		return readMsgPackString(reader, length)
+
+	case 0xdc, 0xdd:
+		var length uint64
+		if length, err = readMsgPackUint(reader, 2 << (code - 0xdc)); err != nil {
+			return
+		}
+		return readMsgPackArray(reader, length, depth)
+
+	case 0xde, 0xdf:
+		var length uint64
+		if length, err = readMsgPackUint(reader, 2 << (code - 0xde)); err != nil {
+			return
+		}
+		return readMsgPackMap(reader, length, depth)
+	}
+
+	return nil, errors.New(fmt.Sprintf("MessagePack unsupported type: 0x%02x", code))
+}
+
+func readMsgPackUint(reader *bytes.Reader, size int) (value uint64, err error) {
+	raw := make([]byte, size)
+	if _, err = io.ReadFull(reader, raw); err != nil {
+		return
+	}
+	for _, b := range raw {
+		value = value << 8 | uint64(b)
+	}
+	return
+}
+
+// check a declared length against the remaining input, each element taking at least size bytes
+func checkMsgPackLength(reader *bytes.Reader, length uint64, size uint64) error {
+	if length > uint64(reader.Len()) / size {
+		return errors.New(fmt.Sprintf("MessagePack length %d exceeds remaining input (%d bytes)", length, reader.Len()))
+	}
+	return nil
+}
+
+func readMsgPackString(reader *bytes.Reader, length uint64) (value interface{}, err error) {
+	if err = checkMsgPackLength(reader, length, 1); err != nil {
+		return
+	}
+	raw := make([]byte, length)
+	_, err = io.ReadFull(reader, raw)
+	return string(raw), err
+}
+
+func readMsgPackArray(reader *bytes.Reader, length uint64, depth int) (value interface{}, err error) {
+	if err = checkMsgPackLength(reader, length, 1); err != nil {
+		return
+	}
+	items := make([]interface{}, length)
+	for i := range items {
+		if items[i], err = decodeMsgPack(reader, depth + 1); err != nil {
+			return
+		}
+	}
+	return items, nil
+}
+
+func readMsgPackMap(reader *bytes.Reader, length uint64, depth int) (value interface{}, err error) {
+	if err = checkMsgPackLength(reader, length, 2); err != nil {
+		return
+	}
+	items := make(map[string]interface{}, length)
+	for i := uint64(0); i < length; i++ {
+		var key, item interface{}
+		if key, err = decodeMsgPack(reader, depth + 1); err != nil {
+			return
+		}
+		if item, err = decodeMsgPack(reader, depth + 1); err != nil {
+			return
+		}
+		items[fmt.Sprintf("%v", key)] = item
+	}
+	return items, nil
+}
@@ -4,6 +4,7 @@ import (
 	"bytes"
 	"fmt"
 	"math"
+	"strings"
 	"html/template"
 
 	"gopkg.in/mgo.v2"
@@ -53,6 +54,16 @@ func Paginate(query *mgo.Query, limit int, page int) (pagination *Pagination, er
 	return pagination, err
 }
 
+// pagination of a known total, for results not from a query
+func PaginateCount(total int, limit int, page int) *Pagination {
+	return &Pagination {
+		total: total,
+		limit: limit,
+		page: page,
+		pageTotal: int(math.Ceil(float64(total) / float64(limit))),
+	}
+}
+
 func (pagination *Pagination) GetTotal() int {
 	return pagination.total
 }
@@ -168,7 +179,15 @@ func (context *Context) RenderPagination() template.HTML {
 	if context.Params.Has("pagination") {
 		pagination := context.Params.Get("pagination").(*Pagination)
 		url := context.Request.URL
-		urlPattern := fmt.Sprintf("%s?page=%%d", url.Path)
+
+		// keep other query parameters (e.g. filters)
+		values := url.Query()
+		values.Del("page")
+		query := ""
+		if len(values) > 0 {
+			query = strings.Replace(values.Encode(), "%", "%%", -1) + "&"
+		}
+		urlPattern := fmt.Sprintf("%s?%spage=%%d", url.Path, query)
 		return pagination.Links(10, urlPattern)
 	}
 	return template.HTML("")
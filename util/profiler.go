@@ -4,9 +4,15 @@ import (
 	"time"
 	"log"
 	"os"
+	"fmt"
+	"sync"
+	"sort"
+	"errors"
+	"strings"
+	"io/ioutil"
+	"path/filepath"
 	"runtime"
 	"runtime/pprof"
-	_ "net/http/pprof"
 )
 
 type Profiler struct {
@@ -15,6 +21,12 @@ type Profiler struct {
 
 var profiler *Profiler = nil
 
+var (
+	// internal
+	cpuProfileFile *os.File = nil
+	profileMutex sync.Mutex
+)
+
 func HandleProfiling(handler func(string, time.Duration)) {
 	if profiler == nil {
 		// create singleton
@@ -34,28 +46,108 @@ func Profile(name string, startTime time.Time) {
 	}
 }
 
-func StartCPUProfile() {
-	path := Env.GetString("PROFILE_CPU_PATH", "cpu.prf")
+// get directory for profile captures
+func GetProfilePath() string {
+	return Env.GetString("PROFILE_PATH", "profiles")
+}
 
-	f, err := os.Create(path)
-	Must(err)
+func IsCPUProfiling() bool {
+	profileMutex.Lock()
+	defer profileMutex.Unlock()
 
-	err = pprof.StartCPUProfile(f)
-	Must(err)
+	return cpuProfileFile != nil
 }
 
-func StopCPUProfile() {
-	pprof.StopCPUProfile()
+// start capturing a CPU profile, returns the capture file name
+func StartCPUProfile() (name string, err error) {
+	profileMutex.Lock()
+	defer profileMutex.Unlock()
+
+	if cpuProfileFile != nil {
+		err = errors.New("CPU profile capture already in progress")
+		return
+	}
+
+	var f *os.File
+	if name, f, err = createProfileFile("cpu", "prof"); err != nil {
+		return
+	}
+
+	if err = pprof.StartCPUProfile(f); err != nil {
+		f.Close()
+		return
+	}
+
+	cpuProfileFile = f
+	return
 }
 
-func WriteHeapProfile() {
-	path := Env.GetString("PROFILE_MEM_PATH", "heap.gz")
+// stop current CPU profile capture, returns the capture file name
+func StopCPUProfile() (name string) {
+	profileMutex.Lock()
+	defer profileMutex.Unlock()
+
+	if cpuProfileFile == nil {
+		return
+	}
+
+	pprof.StopCPUProfile()
+	name = filepath.Base(cpuProfileFile.Name())
+	cpuProfileFile.Close()
+	cpuProfileFile = nil
+	return
+}
 
-	f, err := os.Create(path)
-	Must(err)
+// capture a heap profile, returns the capture file name
+func WriteHeapProfile() (name string, err error) {
+	var f *os.File
+	if name, f, err = createProfileFile("heap", "prof"); err != nil {
+		return
+	}
 	defer f.Close()
 
 	runtime.GC()
 	err = pprof.WriteHeapProfile(f)
-	Must(err)
-}
\ No newline at end of file
+	return
+}
+
+// list captured profile file names, newest first
+func GetProfiles() (names []string, err error) {
+	var files []os.FileInfo
+	if files, err = ioutil.ReadDir(GetProfilePath()); err != nil {
+		if os.IsNotExist(err) {
+			err = nil
+		}
+		return
+	}
+
+	sort.Slice(files, func(i, j int) bool { return files[i].ModTime().After(files[j].ModTime()) })
+	for _, file := range files {
+		if !file.IsDir() {
+			names = append(names, file.Name())
+		}
+	}
+	return
+}
+
+// get path to a captured profile (name must not escape the profile directory)
+func GetProfileFile(name string) (path string, err error) {
+	if name == "" || name != filepath.Base(name) || strings.HasPrefix(name, ".") {
+		err = errors.New(fmt.Sprintf("Invalid profile name: %s", name))
+		return
+	}
+
+	path = filepath.Join(GetProfilePath(), name)
+	_, err = os.Stat(path)
+	return
+}
+
+func createProfileFile(kind string, extension string) (name string, f *os.File, err error) {
+	if err = os.MkdirAll(GetProfilePath(), 0755); err != nil {
+		return
+	}
+
+	name = fmt.Sprintf("%s-%s.%s", kind, time.Now().UTC().Format("20060102-150405"), extension)
+	f, err = os.Create(filepath.Join(GetProfilePath(), name))
+	return
+}
@@ -22,6 +22,8 @@ type SessionStreamSource struct {
 	session          *sessions.Session
 }
 
+const SessionCookieName = "session"
+
 var (
 	// internal
 	cookieStore		 *sessions.CookieStore
@@ -55,7 +57,7 @@ func init() {
 
 func GetSession(w http.ResponseWriter, r *http.Request) (session *Session) {
 	// get cookis session from store
-	cookieSession, err := cookieStore.Get(r, "session")
+	cookieSession, err := cookieStore.Get(r, SessionCookieName)
 	Must(err)
 	
 	// stream source
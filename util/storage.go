@@ -0,0 +1,34 @@
+package util
+
+import (
+	"fmt"
+
+	"bloodtales/config"
+)
+
+// storage backend for models and the cache
+type StorageType string
+const (
+	// MongoDB and Redis (requires MONGODB_URI and REDIS_URL)
+	MongoStorage StorageType = "mongo"
+
+	// in-process fakes for tests and offline runs (nothing is persisted)
+	MemoryStorage StorageType = "memory"
+)
+
+var Storage StorageType = getStorageType()
+
+// storage from STORAGE (test binaries default to memory)
+func getStorageType() StorageType {
+	defaultStorage := MongoStorage
+	if config.Env.Test {
+		defaultStorage = MemoryStorage
+	}
+
+	storage := StorageType(Env.GetString("STORAGE", string(defaultStorage)))
+	switch storage {
+	case MongoStorage, MemoryStorage:
+		return storage
+	}
+	panic(fmt.Sprintf("Unknown storage: %s (expected %s or %s)", storage, MongoStorage, MemoryStorage))
+}
@@ -20,6 +20,21 @@ type Stream struct {
 	source  StreamSource
 }
 
+// declared parameter value types (lists are comma separated)
+type ParamType string
+const (
+	StringParam ParamType = "string"
+	StringsParam = "strings"
+	IntParam = "int"
+	IntsParam = "ints"
+	Int64Param = "int64"
+	FloatParam = "float"
+	BoolParam = "bool"
+	IdParam = "id"
+	IdsParam = "ids"
+	JSONParam = "json"
+)
+
 func (stream *Stream) SetSource(newSource StreamSource) bool {
 	if stream.source != nil {
 		return false
@@ -403,4 +418,65 @@ func (stream *Stream) GetRequiredIds(name string) []bson.ObjectId {
 	}
 
 	return results
-}
\ No newline at end of file
+}
+
+// check a value can be read as a parameter type, using the same parsing as the getters
+func (stream *Stream) Validate(name string, paramType ParamType, required bool) error {
+	value := stream.source.Get(name)
+
+	// missing values
+	if stringValue, ok := value.(string); value == nil || (ok && stringValue == "") {
+		if required {
+			return errors.New(missingStreamValue(name))
+		}
+		return nil
+	}
+
+	// lists are validated per item
+	var itemType ParamType
+	switch paramType {
+	case StringsParam:
+		itemType = StringParam
+	case IntsParam:
+		itemType = IntParam
+	case IdsParam:
+		itemType = IdParam
+	}
+	if itemType != "" {
+		stringValue, ok := value.(string)
+		if !ok {
+			return errors.New(invalidStreamValue(name, value, errors.New("expected a list")))
+		}
+		for i, item := range strings.Split(stringValue, ",") {
+			if err := validateStreamValue(fmt.Sprintf("%s[%d]", name, i), item, itemType); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	return validateStreamValue(name, value, paramType)
+}
+
+func validateStreamValue(name string, value interface{}, paramType ParamType) (err error) {
+	switch paramType {
+	case IntParam:
+		_, err = parseInt(name, value)
+	case Int64Param:
+		_, err = parseInt64(name, value)
+	case FloatParam:
+		_, err = parseFloat(name, value)
+	case BoolParam:
+		_, err = parseBool(name, value)
+	case IdParam:
+		if _, err = parseId(name, value); err != nil {
+			err = errors.New(invalidStreamValue(name, value, errors.New("expected an ID")))
+		}
+	case JSONParam:
+		stringValue, ok := value.(string)
+		if !ok || !json.Valid([]byte(stringValue)) {
+			err = errors.New(invalidStreamValue(name, value, errors.New("expected JSON")))
+		}
+	}
+	return
+}